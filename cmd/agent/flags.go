@@ -7,8 +7,13 @@ import (
 	"strconv"
 	"time"
 
+	"google.golang.org/grpc/encoding/gzip"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/compress"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/compressor/zstd"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
 )
 
@@ -22,6 +27,10 @@ var (
 	cryptoKey      string
 	flagConfigFile string
 	flagProtocol   string // HTTP or GRPC
+
+	flagCompressCodec string // алгоритм сжатия отправляемых данных: gzip или zstd
+	flagCompressLevel int    // уровень сжатия, 0 - уровень по умолчанию для выбранного алгоритма
+	flagAgentID       string // идентификатор агента для сервера
 )
 
 func parseFlags() {
@@ -35,6 +44,9 @@ func parseFlags() {
 	flag.StringVar(&cryptoKey, "crypto-key", "", "public key for asymmetric encryption")
 	flag.StringVar(&flagConfigFile, "c", "", "name of configuration file")
 	flag.StringVar(&flagProtocol, "protocol", "http", "name of using protocol, http or grpc")
+	flag.StringVar(&flagCompressCodec, "compress", "gzip", "compression codec for pushing metrics, gzip or zstd")
+	flag.IntVar(&flagCompressLevel, "compress-level", 0, "compression level, 0 means default level of codec")
+	flag.StringVar(&flagAgentID, "id", defaultAgentID(), "agent identifier for server quotas, host name by default")
 
 	flag.Parse()
 
@@ -51,6 +63,40 @@ func parseFlags() {
 	config.SetPollInterval(time.Duration(*pollInterval))
 	hasher.SetKey(flagKey)
 	config.SetCryptoGrapher(encryption.Initialize(cryptoKey, ""))
+	setCompression()
+	config.SetAgentID(flagAgentID)
+}
+
+// defaultAgentID - возвращает идентификатор агента по умолчанию, равный имени хоста.
+func defaultAgentID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// setCompression - устанавливает алгоритм и уровень сжатия для HTTP и gRPC клиентов агента.
+func setCompression() {
+	if err := compress.SetCodec(flagCompressCodec); err != nil {
+		log.Fatalf("set compress codec error: %v\n", err)
+	}
+	compress.SetLevel(flagCompressLevel)
+
+	// уровень сжатия gRPC компрессоров устанавливается глобально, до создания клиентов
+	if flagCompressLevel == 0 {
+		return
+	}
+	var err error
+	switch flagCompressCodec {
+	case repositories.EncodingZstd:
+		err = zstd.SetLevel(flagCompressLevel)
+	case repositories.EncodingGzip:
+		err = gzip.SetLevel(flagCompressLevel)
+	}
+	if err != nil {
+		log.Fatalf("set compress level error: %v\n", err)
+	}
 }
 
 // parseEnvironment - функция для переопределения параметров конфигурации из глобальных переменных.
@@ -95,6 +141,19 @@ func parseEnvironment() {
 	if envProtocol := os.Getenv("PROTOCOL"); envProtocol != "" {
 		flagProtocol = envProtocol
 	}
+	if envAgentID := os.Getenv("AGENT_ID"); envAgentID != "" {
+		flagAgentID = envAgentID
+	}
+	if envCompressCodec := os.Getenv("COMPRESS_CODEC"); envCompressCodec != "" {
+		flagCompressCodec = envCompressCodec
+	}
+	if envCompressLevel := os.Getenv("COMPRESS_LEVEL"); envCompressLevel != "" {
+		val, err := strconv.Atoi(envCompressLevel)
+		if err != nil {
+			log.Fatalln("Environment variable \"COMPRESS_LEVEL\" must be int")
+		}
+		flagCompressLevel = val
+	}
 }
 
 // parseConfigFile - функция для переопределения параметров конфигурации из файла конфигурации.
@@ -114,4 +173,14 @@ func parseConfigFile() {
 	*pollInterval = int(configs.PollInterval.Duration.Seconds())
 	cryptoKey = configs.CryptoKey
 	flagProtocol = configs.Protocol
+	if configs.AgentID != "" {
+		flagAgentID = configs.AgentID
+	}
+	// параметры сжатия необязательны в файле конфигурации
+	if configs.CompressCodec != "" {
+		flagCompressCodec = configs.CompressCodec
+	}
+	if configs.CompressLevel != 0 {
+		flagCompressLevel = configs.CompressLevel
+	}
 }
@@ -8,13 +8,16 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/compress"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
 )
 
 func TestParseFlagsWithFlags(t *testing.T) {
 	// Сохраняем оригинальные значения флагов
 	originalArgs := os.Args
 	os.Args = []string{"cmd", "-a", ":9000", "-r", "120", "-p", "240", "-log=info", "-l", "3", "-k", "secret",
-		"-crypto-key", "/crypto/key/path", "-protocol", "grpc"}
+		"-crypto-key", "/crypto/key/path", "-protocol", "grpc", "-compress", "zstd", "-compress-level", "3", "-id", "agent-1"}
 	defer func() { os.Args = originalArgs }()
 
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
@@ -28,6 +31,12 @@ func TestParseFlagsWithFlags(t *testing.T) {
 	assert.Equal(t, "secret", flagKey)
 	assert.Equal(t, "/crypto/key/path", cryptoKey)
 	assert.Equal(t, "grpc", flagProtocol)
+	assert.Equal(t, "zstd", flagCompressCodec)
+	assert.Equal(t, 3, flagCompressLevel)
+	assert.Equal(t, "zstd", compress.GetCodec())
+	assert.Equal(t, 3, compress.GetLevel())
+	assert.Equal(t, "agent-1", flagAgentID)
+	assert.Equal(t, "agent-1", config.GetAgentID())
 }
 
 func TestParseFlagsPriority(t *testing.T) {
@@ -92,6 +101,9 @@ func TestParseEnvironment(t *testing.T) {
 	os.Setenv("KEY", "secret")
 	os.Setenv("CRYPTO_KEY", "/secret/crypto/key")
 	os.Setenv("PROTOCOL", "grpc")
+	os.Setenv("COMPRESS_CODEC", "zstd")
+	os.Setenv("COMPRESS_LEVEL", "7")
+	os.Setenv("AGENT_ID", "env-agent")
 
 	defer func() {
 		os.Unsetenv("ADDRESS")
@@ -102,6 +114,9 @@ func TestParseEnvironment(t *testing.T) {
 		os.Unsetenv("KEY")
 		os.Unsetenv("CRYPTO_KEY")
 		os.Unsetenv("PROTOCOL")
+		os.Unsetenv("COMPRESS_CODEC")
+		os.Unsetenv("COMPRESS_LEVEL")
+		os.Unsetenv("AGENT_ID")
 	}()
 
 	parseEnvironment()
@@ -114,6 +129,9 @@ func TestParseEnvironment(t *testing.T) {
 	assert.Equal(t, "secret", flagKey)
 	assert.Equal(t, "/secret/crypto/key", cryptoKey)
 	assert.Equal(t, "grpc", flagProtocol)
+	assert.Equal(t, "zstd", flagCompressCodec)
+	assert.Equal(t, 7, flagCompressLevel)
+	assert.Equal(t, "env-agent", flagAgentID)
 }
 
 func TestParseConfigFile(t *testing.T) {
@@ -125,10 +143,13 @@ func TestParseConfigFile(t *testing.T) {
 	testPollInterval := 3
 	testFlagCryptoKey := "test crypto key"
 	testFlagProtocol := "grpc"
+	testFlagCompressCodec := "zstd"
+	testFlagCompressLevel := 5
+	testFlagAgentID := "config-agent"
 
 	createFile := func(name string) {
-		data := fmt.Sprintf("{\"address\": \"%s\",\"report_interval\": \"%ds\",\"poll_interval\": \"%ds\",\"crypto_key\": \"%s\",\"protocol\": \"%s\"}",
-			testFlagNetAddr, testReportInterval, testPollInterval, testFlagCryptoKey, testFlagProtocol)
+		data := fmt.Sprintf("{\"address\": \"%s\",\"report_interval\": \"%ds\",\"poll_interval\": \"%ds\",\"crypto_key\": \"%s\",\"protocol\": \"%s\",\"compress_codec\": \"%s\",\"compress_level\": %d,\"agent_id\": \"%s\"}",
+			testFlagNetAddr, testReportInterval, testPollInterval, testFlagCryptoKey, testFlagProtocol, testFlagCompressCodec, testFlagCompressLevel, testFlagAgentID)
 		f, err := os.Create(name)
 		require.NoError(t, err)
 		_, err = f.Write([]byte(data))
@@ -145,6 +166,9 @@ func TestParseConfigFile(t *testing.T) {
 	assert.Equal(t, testPollInterval, *pollInterval)
 	assert.Equal(t, testFlagCryptoKey, cryptoKey)
 	assert.Equal(t, testFlagProtocol, flagProtocol)
+	assert.Equal(t, testFlagCompressCodec, flagCompressCodec)
+	assert.Equal(t, testFlagCompressLevel, flagCompressLevel)
+	assert.Equal(t, testFlagAgentID, flagAgentID)
 
 	err := os.Remove(nameFile)
 	require.NoError(t, err)
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/migrate"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/bolt"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/saver"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/sqlite"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// Схемы адресов хранилищ, отличных от PostgreSQL. Адрес без схемы считается адресом подключения к PostgreSQL.
+const (
+	schemeFile = "file://" // файл с метриками, сохраняемый сервером в режиме -f
+	schemeKV   = "kv://"   // файл встроенной базы данных, используемый сервером в режиме -kv-path
+)
+
+// backend - открытое хранилище метрик.
+type backend struct {
+	migrate.Target
+	// save - сохраняет записанные метрики, если хранилище не сохраняет их при записи
+	save func() error
+	// close - закрывает хранилище
+	close func() error
+}
+
+// openBackend - открывает хранилище метрик по адресу. Если target равно true, хранилище открывается
+// для записи: отсутствующий файл создается, а таблицы базы данных создаются при необходимости.
+func openBackend(ctx context.Context, address string, target bool) (*backend, error) {
+	switch {
+	case address == "":
+		return nil, errors.New("storage address is empty")
+	case strings.HasPrefix(address, schemeFile):
+		return openFile(ctx, strings.TrimPrefix(address, schemeFile), target)
+	case strings.HasPrefix(address, schemeKV):
+		path := strings.TrimPrefix(address, schemeKV)
+		if err := checkExists(path, target); err != nil {
+			return nil, err
+		}
+		store, err := bolt.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Bootstrap(ctx); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return &backend{Target: store, close: store.Close}, nil
+	case sqlite.IsDSN(address):
+		if err := checkExists(strings.TrimPrefix(address, sqlite.Scheme), target); err != nil {
+			return nil, err
+		}
+		store, err := sqlite.Open(address)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Bootstrap(ctx); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return &backend{Target: store, close: store.Close}, nil
+	default:
+		conn, err := sql.Open("pgx", address)
+		if err != nil {
+			return nil, err
+		}
+		store := pg.NewStore(conn)
+		if err := store.Bootstrap(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &backend{Target: store, close: conn.Close}, nil
+	}
+}
+
+// openFile - загружает метрики из файла в хранилище в памяти. Метрики целевого хранилища сохраняются
+// в файл методом save.
+func openFile(ctx context.Context, path string, target bool) (*backend, error) {
+	if err := checkExists(path, target); err != nil {
+		return nil, err
+	}
+	stor := storage.NewDefaultMemStorage()
+	reader, err := saver.NewReader(path)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := reader.ReadTimedMetrics()
+	if err != nil {
+		return nil, fmt.Errorf("read metrics file %s error: %w", path, err)
+	}
+	if err := stor.AddTimedMetrics(ctx, metrics); err != nil {
+		return nil, fmt.Errorf("load metrics file %s error: %w", path, err)
+	}
+
+	b := &backend{Target: stor, close: func() error { return nil }}
+	if target {
+		b.save = func() error {
+			writer, err := saver.NewWriter(path)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteMetrics(stor); err != nil {
+				writer.Close()
+				return err
+			}
+			return writer.Close()
+		}
+	}
+	return b, nil
+}
+
+// checkExists - проверяет, что файл исходного хранилища существует, чтобы опечатка в пути
+// не приводила к переносу пустого хранилища.
+func checkExists(path string, target bool) error {
+	if target {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("source storage file error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/migrate"
+)
+
+var (
+	flagFrom   string
+	flagTo     string
+	flagMode   string
+	flagDryRun bool
+	flagVerify bool
+)
+
+// parseFlags - разбирает параметры переноса метрик из флагов и переменных окружения.
+func parseFlags() migrate.Options {
+	flag.StringVar(&flagFrom, "from", "", "source storage: file://path, kv://path, sqlite://path or database connection address")
+	flag.StringVar(&flagTo, "to", "", "target storage: file://path, kv://path, sqlite://path or database connection address")
+	flag.StringVar(&flagMode, "mode", string(migrate.ModeMerge), "migration mode of counter metrics: merge adds source values, overwrite replaces target values")
+	flag.BoolVar(&flagDryRun, "dry-run", false, "print planned changes without writing metrics")
+	flag.BoolVar(&flagVerify, "verify", true, "compare target metrics with expected values after migration")
+	flag.Parse()
+
+	parseEnvironment()
+
+	mode, err := migrate.ParseMode(flagMode)
+	if err != nil {
+		log.Fatalf("Parse migration mode error: %v\n", err)
+	}
+	return migrate.Options{Mode: mode, DryRun: flagDryRun, Verify: flagVerify}
+}
+
+// parseEnvironment - функция для переопределения параметров из глобальных переменных.
+func parseEnvironment() {
+	if envFrom := os.Getenv("MIGRATE_FROM"); envFrom != "" {
+		flagFrom = envFrom
+	}
+	if envTo := os.Getenv("MIGRATE_TO"); envTo != "" {
+		flagTo = envTo
+	}
+	if envMode := os.Getenv("MIGRATE_MODE"); envMode != "" {
+		flagMode = envMode
+	}
+	if envDryRun := os.Getenv("MIGRATE_DRY_RUN"); envDryRun != "" {
+		dryRun, err := strconv.ParseBool(envDryRun)
+		if err != nil {
+			log.Fatalf("Parse MIGRATE_DRY_RUN global variable error: %v\n", err)
+		}
+		flagDryRun = dryRun
+	}
+	if envVerify := os.Getenv("MIGRATE_VERIFY"); envVerify != "" {
+		verify, err := strconv.ParseBool(envVerify)
+		if err != nil {
+			log.Fatalf("Parse MIGRATE_VERIFY global variable error: %v\n", err)
+		}
+		flagVerify = verify
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/migrate"
+)
+
+func TestParseFlags(t *testing.T) {
+	originalArgs := os.Args
+	os.Args = []string{"cmd", "-from", "file://./metrics.json", "-to", "kv://./metrics.db", "-mode", "overwrite", "-dry-run", "-verify=false"}
+	defer func() { os.Args = originalArgs }()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	opts := parseFlags()
+
+	assert.Equal(t, "file://./metrics.json", flagFrom)
+	assert.Equal(t, "kv://./metrics.db", flagTo)
+	assert.Equal(t, migrate.Options{Mode: migrate.ModeOverwrite, DryRun: true, Verify: false}, opts)
+}
+
+func TestParseEnvironment(t *testing.T) {
+	os.Setenv("MIGRATE_FROM", "sqlite:///var/lib/metrics.sqlite")
+	os.Setenv("MIGRATE_TO", "host=localhost")
+	os.Setenv("MIGRATE_MODE", "merge")
+	os.Setenv("MIGRATE_DRY_RUN", "true")
+	os.Setenv("MIGRATE_VERIFY", "false")
+	defer func() {
+		os.Unsetenv("MIGRATE_FROM")
+		os.Unsetenv("MIGRATE_TO")
+		os.Unsetenv("MIGRATE_MODE")
+		os.Unsetenv("MIGRATE_DRY_RUN")
+		os.Unsetenv("MIGRATE_VERIFY")
+	}()
+
+	parseEnvironment()
+
+	assert.Equal(t, "sqlite:///var/lib/metrics.sqlite", flagFrom)
+	assert.Equal(t, "host=localhost", flagTo)
+	assert.Equal(t, "merge", flagMode)
+	assert.Equal(t, true, flagDryRun)
+	assert.Equal(t, false, flagVerify)
+}
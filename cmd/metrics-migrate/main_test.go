@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/migrate"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/sqlite"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "metrics.json")
+	data := `[{"id":"temp","type":"gauge","value":36.6},{"id":"requests","type":"counter","delta":10,"updated":"2024-01-01T00:00:00Z"}]`
+	require.NoError(t, os.WriteFile(file, []byte(data), 0644))
+	kv := schemeKV + filepath.Join(dir, "metrics.db")
+	sqliteDSN := sqlite.Scheme + filepath.Join(dir, "metrics.sqlite")
+
+	// перенос без записи не изменяет целевое хранилище
+	var output bytes.Buffer
+	require.NoError(t, run(ctx, schemeFile+file, kv, migrate.Options{Mode: migrate.ModeMerge, DryRun: true}, &output))
+	assert.Contains(t, output.String(), "dry run")
+	assert.Contains(t, output.String(), "read: 2, created: 2, updated: 0, conflicts: 0")
+
+	// файл -> встроенная база данных -> SQLite -> файл
+	output.Reset()
+	require.NoError(t, run(ctx, schemeFile+file, kv, migrate.Options{Mode: migrate.ModeMerge, Verify: true}, &output))
+	assert.Contains(t, output.String(), "verification passed")
+	require.NoError(t, run(ctx, kv, sqliteDSN, migrate.Options{Mode: migrate.ModeMerge, Verify: true}, &output))
+	// повторный перенос с заменой значений не удваивает counter
+	require.NoError(t, run(ctx, kv, sqliteDSN, migrate.Options{Mode: migrate.ModeOverwrite, Verify: true}, &output))
+	copied := filepath.Join(dir, "copy.json")
+	require.NoError(t, run(ctx, sqliteDSN, schemeFile+copied, migrate.Options{Mode: migrate.ModeMerge, Verify: true}, &output))
+
+	dst, err := openBackend(ctx, schemeFile+copied, false)
+	require.NoError(t, err)
+	defer dst.close()
+	got, err := dst.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "10", got)
+	got, err = dst.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "36.6", got)
+}
+
+func TestRunErrors(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		from string
+		to   string
+	}{
+		{name: "same storage", from: schemeKV + filepath.Join(dir, "a.db"), to: schemeKV + filepath.Join(dir, "a.db")},
+		{name: "missing source file", from: schemeFile + filepath.Join(dir, "missing.json"), to: schemeKV + filepath.Join(dir, "b.db")},
+		{name: "missing source database", from: sqlite.Scheme + filepath.Join(dir, "missing.sqlite"), to: schemeKV + filepath.Join(dir, "c.db")},
+		{name: "empty source", from: "", to: schemeKV + filepath.Join(dir, "d.db")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			assert.Error(t, run(ctx, tt.from, tt.to, migrate.Options{Mode: migrate.ModeMerge}, &output))
+		})
+	}
+	_, err := os.Stat(filepath.Join(dir, "missing.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -7,11 +7,28 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/config"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/encrypt"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/expiry"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/graphite"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hasher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/influx"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ipfilter"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/notifier"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/otlp"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/readcache"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/recording"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/saver"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/sqlite"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/stream"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/encryption"
 )
 
@@ -27,6 +44,83 @@ var (
 	flagCryptoKey       string
 	flagConfigFile      string
 	flagTrustedSubnet   string
+
+	// параметры ограничения частоты и объема запросов на запись метрик
+	flagRateLimitRPS    float64
+	flagRateLimitBurst  int
+	flagRouteRateLimits map[string]float64
+	flagMaxBatchMetrics int
+	flagMaxBodySize     int64
+
+	// параметры проверки имен метрик и ограничения количества серий
+	flagMaxSeries         int
+	flagMaxSeriesPerAgent int
+	flagCardinalityPolicy string
+	flagMetricNameMaxLen  int
+	flagMetricNamePattern string
+
+	// параметры удаления устаревших метрик
+	flagGaugeTTL       time.Duration
+	flagCounterTTL     time.Duration
+	flagMetricTTL      map[string]time.Duration
+	flagExpireInterval time.Duration
+
+	// параметры пула соединений с базой данных
+	flagDBMaxConns          int
+	flagDBMinConns          int
+	flagDBMaxConnLifetime   time.Duration
+	flagDBMaxConnIdleTime   time.Duration
+	flagDBHealthCheckPeriod time.Duration
+	flagDBStatementCache    int
+	flagDBConnectTimeout    time.Duration
+
+	// параметры буферизации записи метрик в базу данных
+	flagWriteBehindInterval   time.Duration
+	flagWriteBehindFlushSize  int
+	flagWriteBehindMaxPending int
+	flagWriteBehindMaxWait    time.Duration
+
+	// параметры кеша чтения метрик
+	flagReadCacheTTL    time.Duration
+	flagReadCacheNotify bool
+
+	// количество сегментов хранилища метрик в памяти
+	flagMemShards int
+
+	// путь к файлу встроенной базы данных для хранения метрик
+	flagKVStoragePath string
+
+	// параметры потока событий записи метрик
+	flagStreamHeartbeat time.Duration
+	flagStreamBuffer    int
+
+	// параметры проверки правил оповещения
+	flagAlertRules    string
+	flagAlertInterval time.Duration
+
+	// путь к файлу настроек получателей уведомлений
+	flagNotifyConfig string
+
+	// параметры вычисления правил записи
+	flagRecordingRules    string
+	flagRecordingInterval time.Duration
+
+	// параметры истории значений метрик
+	flagHistory                bool
+	flagHistoryTiers           string
+	flagHistoryCompactInterval time.Duration
+
+	// параметры приема метрик в формате InfluxDB line protocol
+	flagInfluxTags     string
+	flagInfluxCounters bool
+
+	// параметры приема метрик по протоколу Graphite
+	flagGraphiteAddress  string
+	flagGraphiteCounters string
+
+	// параметры приема метрик OpenTelemetry
+	flagOTLPResource           string
+	flagOTLPResourceAttributes string
 )
 
 // Определяют способ хранения метрик.
@@ -37,6 +131,10 @@ const (
 	SAVEINFILE
 	// SAVEINRAM устанавливает созранение метрик в базу данных
 	SAVEINDATABASE
+	// SAVEINKV устанавливает сохранение метрик во встроенную базу данных в файле
+	SAVEINKV
+	// SAVEINSQLITE устанавливает сохранение метрик в базу данных SQLite
+	SAVEINSQLITE
 )
 
 func parseFlags() int {
@@ -48,11 +146,54 @@ func parseFlags() int {
 	flag.StringVar(&flagFileStoragePath, "f", "", "path address to saving metrics file") // Путь к файлу по умолчанию: ./metrics.json
 	flagRestoreTemp := flag.Bool("r", true, "for define needed of loading metrics from file while server starting")
 	// настройка флагов для хранения метрик в базе данных
-	flag.StringVar(&flagDatabaseDsn, "d", "", "database connection address") // host=localhost user=metrics password=metrics dbname=metricsdb  sslmode=disable
+	flag.StringVar(&flagDatabaseDsn, "d", "", "database connection address, sqlite:///path/metrics.db selects SQLite") // host=localhost user=metrics password=metrics dbname=metricsdb  sslmode=disable
 	flag.StringVar(&flagKey, "k", "", "key for hashing data")
 	flag.StringVar(&flagCryptoKey, "crypto-key", "", "private key for asymmetric encryption")
 	flag.StringVar(&flagConfigFile, "c", "", "name of configuration file")
 	flag.StringVar(&flagTrustedSubnet, "t", "", "Classless Distributed Ranging (CIDR) string representation")
+	flag.Float64Var(&flagRateLimitRPS, "rate-limit", 0, "allowed requests per second for each client and route, 0 disables limit")
+	flag.IntVar(&flagRateLimitBurst, "rate-burst", 0, "maximum burst of requests for each client and route")
+	flag.IntVar(&flagMaxBatchMetrics, "max-batch", 0, "maximum count of metrics in one batch, 0 disables limit")
+	flag.Int64Var(&flagMaxBodySize, "max-body", 0, "maximum size of request body in bytes, 0 disables limit")
+	flag.IntVar(&flagMaxSeries, "max-series", 0, "maximum count of distinct metric series, 0 disables limit")
+	flag.IntVar(&flagMaxSeriesPerAgent, "max-series-per-agent", 0, "maximum count of distinct metric series created by one agent, 0 disables limit")
+	flag.StringVar(&flagCardinalityPolicy, "cardinality-policy", "reject", "policy for metrics over series limit: reject, drop or log")
+	flag.IntVar(&flagMetricNameMaxLen, "name-max-length", cardinality.DefaultMaxNameLength, "maximum length of metric name")
+	flag.StringVar(&flagMetricNamePattern, "name-pattern", "", "regular expression that metric names must match")
+	flag.DurationVar(&flagGaugeTTL, "gauge-ttl", 0, "time to live of gauge metrics without updates, 0 disables expiry")
+	flag.DurationVar(&flagCounterTTL, "counter-ttl", 0, "time to live of counter metrics without updates, 0 disables expiry")
+	flag.DurationVar(&flagExpireInterval, "expire-interval", expiry.DefaultInterval, "interval of deleting expired metrics")
+	flag.IntVar(&flagDBMaxConns, "db-max-conns", 0, "maximum count of database connections, 0 keeps pool default")
+	flag.IntVar(&flagDBMinConns, "db-min-conns", 0, "minimum count of open database connections")
+	flag.DurationVar(&flagDBMaxConnLifetime, "db-max-conn-lifetime", 0, "lifetime of database connection, 0 keeps pool default")
+	flag.DurationVar(&flagDBMaxConnIdleTime, "db-max-conn-idle-time", 0, "idle time after which database connection is closed, 0 keeps pool default")
+	flag.DurationVar(&flagDBHealthCheckPeriod, "db-health-check-period", 0, "period of checking idle database connections, 0 keeps pool default")
+	flag.IntVar(&flagDBStatementCache, "db-statement-cache", 0, "capacity of prepared statement cache per connection, negative value disables cache")
+	flag.DurationVar(&flagDBConnectTimeout, "db-connect-timeout", pg.DefaultConnectTimeout, "time of waiting for database while server starting")
+	flag.DurationVar(&flagWriteBehindInterval, "write-behind-interval", 0, "interval of flushing buffered metrics to database, 0 disables buffering")
+	flag.IntVar(&flagWriteBehindFlushSize, "write-behind-flush-size", writebehind.DefaultFlushSize, "count of buffered series which triggers flush")
+	flag.IntVar(&flagWriteBehindMaxPending, "write-behind-max-pending", writebehind.DefaultMaxPending, "maximum count of buffered series")
+	flag.DurationVar(&flagWriteBehindMaxWait, "write-behind-max-wait", writebehind.DefaultMaxWait, "time of waiting for free buffer space")
+	flag.DurationVar(&flagReadCacheTTL, "read-cache-ttl", 0, "lifetime of cached metric values, 0 disables read cache")
+	flag.IntVar(&flagMemShards, "mem-shards", storage.DefaultShards, "count of in-memory storage shards, 0 uses single-lock storage")
+	flag.BoolVar(&flagReadCacheNotify, "read-cache-notify", false, "invalidate read cache of other server instances through database notifications")
+	flag.StringVar(&flagKVStoragePath, "kv-path", "", "path to embedded key-value database file for storing metrics")
+	flag.DurationVar(&flagStreamHeartbeat, "stream-heartbeat", stream.DefaultHeartbeat, "interval of heartbeat comments in metrics event stream")
+	flag.StringVar(&flagAlertRules, "alert-rules", "", "path to YAML or JSON file with alerting rules, reloaded on SIGHUP")
+	flag.DurationVar(&flagAlertInterval, "alert-interval", alerting.DefaultInterval, "interval of evaluating alerting rules")
+	flag.StringVar(&flagRecordingRules, "recording-rules", "", "path to YAML or JSON file with recording rules, reloaded on SIGHUP")
+	flag.DurationVar(&flagRecordingInterval, "recording-interval", recording.DefaultInterval, "interval of evaluating recording rules")
+	flag.BoolVar(&flagHistory, "history", false, "store history of metric values with downsampling by retention tiers")
+	flag.StringVar(&flagHistoryTiers, "history-tiers", history.DefaultTiers, "retention tiers of history as resolution:retention list, first tier keeps raw values")
+	flag.DurationVar(&flagHistoryCompactInterval, "history-compact-interval", history.DefaultCompactInterval, "interval of computing history rollups and deleting expired values")
+	flag.StringVar(&flagInfluxTags, "influx-tags", influx.TagsAsLabels, "how tags of InfluxDB line protocol become part of metric name: labels or prefix")
+	flag.BoolVar(&flagInfluxCounters, "influx-counters", false, "store InfluxDB line protocol fields ending with _total or _count as counters")
+	flag.StringVar(&flagGraphiteAddress, "graphite-address", "", "address of TCP and UDP listener for Graphite plaintext protocol, empty disables it")
+	flag.StringVar(&flagGraphiteCounters, "graphite-counters", "", "comma separated Graphite path patterns, e.g. stats.*.requests, whose values are stored as counters")
+	flag.StringVar(&flagOTLPResource, "otlp-resource", otlp.ResourceAsLabels, "how OTLP resource attributes become part of metric name: labels or prefix")
+	flag.StringVar(&flagOTLPResourceAttributes, "otlp-resource-attributes", otlp.DefaultResourceAttributes, "comma separated OTLP resource attributes included in metric name")
+	flag.StringVar(&flagNotifyConfig, "notify-config", "", "path to YAML or JSON file with webhook receivers of notifications, reloaded on SIGHUP")
+	flag.IntVar(&flagStreamBuffer, "stream-buffer", stream.DefaultBufferSize, "count of recent metric events kept for resuming event stream, 0 disables resuming")
 
 	flag.Parse()
 	flagStoreInterval = *flagStoreIntervalTemp
@@ -71,9 +212,103 @@ func parseFlags() int {
 	hasher.SetKey(flagKey)
 	encrypt.SetCryptoGrapher(encryption.Initialize("", flagCryptoKey))
 	ipfilter.SetTrustedSubnet(flagTrustedSubnet)
+	ratelimit.SetLimits(ratelimit.Limits{
+		RPS:             flagRateLimitRPS,
+		Burst:           flagRateLimitBurst,
+		RouteRPS:        flagRouteRateLimits,
+		MaxBatchMetrics: flagMaxBatchMetrics,
+		MaxBodySize:     flagMaxBodySize,
+	})
+	policy, err := cardinality.ParsePolicy(flagCardinalityPolicy)
+	if err != nil {
+		log.Fatalf("Parse cardinality policy error: %v\n", err)
+	}
+	cardinality.SetLimits(cardinality.Limits{
+		MaxSeries:          flagMaxSeries,
+		MaxSeriesPerClient: flagMaxSeriesPerAgent,
+		Policy:             policy,
+	})
+	nameRules, err := cardinality.ParseNameRules(flagMetricNameMaxLen, flagMetricNamePattern)
+	if err != nil {
+		log.Fatalf("Parse metric name rules error: %v\n", err)
+	}
+	cardinality.SetNameRules(nameRules)
+	expiry.SetTTL(repositories.TTL{
+		Gauge:   flagGaugeTTL,
+		Counter: flagCounterTTL,
+		Metrics: flagMetricTTL,
+	})
+	expiry.SetInterval(flagExpireInterval)
+	pg.SetPoolConfig(pg.PoolConfig{
+		MaxConns:               int32(flagDBMaxConns),
+		MinConns:               int32(flagDBMinConns),
+		MaxConnLifetime:        flagDBMaxConnLifetime,
+		MaxConnIdleTime:        flagDBMaxConnIdleTime,
+		HealthCheckPeriod:      flagDBHealthCheckPeriod,
+		StatementCacheCapacity: flagDBStatementCache,
+		ConnectTimeout:         flagDBConnectTimeout,
+	})
+	writebehind.SetConfig(writebehind.Config{
+		FlushInterval: flagWriteBehindInterval,
+		FlushSize:     flagWriteBehindFlushSize,
+		MaxPending:    flagWriteBehindMaxPending,
+		MaxWait:       flagWriteBehindMaxWait,
+	})
+	readcache.SetConfig(readcache.Config{
+		TTL:    flagReadCacheTTL,
+		Notify: flagReadCacheNotify,
+	})
+	alerting.SetRulesPath(flagAlertRules)
+	alerting.SetInterval(flagAlertInterval)
+	notifier.SetConfigPath(flagNotifyConfig)
+	historyTiers, err := history.ParseTiers(flagHistoryTiers)
+	if err != nil {
+		log.Fatalf("Parse history tiers error: %v\n", err)
+	}
+	history.SetConfig(history.Config{
+		Enabled:         flagHistory,
+		Tiers:           historyTiers,
+		CompactInterval: flagHistoryCompactInterval,
+	})
+	recording.SetRulesPath(flagRecordingRules)
+	recording.SetInterval(flagRecordingInterval)
+	if err := influx.ValidateTags(flagInfluxTags); err != nil {
+		log.Fatalf("Parse influx tags error: %v\n", err)
+	}
+	influx.SetConfig(influx.Config{
+		Tags:     flagInfluxTags,
+		Counters: flagInfluxCounters,
+	})
+	graphiteCounters, err := graphite.ParsePatterns(flagGraphiteCounters)
+	if err != nil {
+		log.Fatalf("Parse graphite counters error: %v\n", err)
+	}
+	graphite.SetConfig(graphite.Config{
+		Address:  flagGraphiteAddress,
+		Counters: graphiteCounters,
+	})
+	if err := otlp.ValidateResource(flagOTLPResource); err != nil {
+		log.Fatalf("Parse otlp resource error: %v\n", err)
+	}
+	otlp.SetConfig(otlp.Config{
+		Resource:   flagOTLPResource,
+		Attributes: otlp.ParseAttributes(flagOTLPResourceAttributes),
+	})
+	streamConfig := stream.Config{
+		BufferSize: flagStreamBuffer,
+		Heartbeat:  flagStreamHeartbeat,
+	}
+	if err := streamConfig.Validate(); err != nil {
+		log.Fatalf("Parse stream config error: %v\n", err)
+	}
+	stream.SetConfig(streamConfig)
 
-	if flagDatabaseDsn != "" {
+	if sqlite.IsDSN(flagDatabaseDsn) {
+		return SAVEINSQLITE
+	} else if flagDatabaseDsn != "" {
 		return SAVEINDATABASE
+	} else if flagKVStoragePath != "" {
+		return SAVEINKV
 	} else if flagFileStoragePath != "" {
 		return SAVEINFILE
 	}
@@ -123,6 +358,259 @@ func parseEnvironment() {
 	if envTrustedSubnet := os.Getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
 		flagTrustedSubnet = envTrustedSubnet
 	}
+	if envRateLimitRPS := os.Getenv("RATE_LIMIT_RPS"); envRateLimitRPS != "" {
+		rps, err := strconv.ParseFloat(envRateLimitRPS, 64)
+		if err != nil {
+			log.Fatalf("Parse RATE_LIMIT_RPS global variable error: %v\n", err)
+		}
+		flagRateLimitRPS = rps
+	}
+	if envRateLimitBurst := os.Getenv("RATE_LIMIT_BURST"); envRateLimitBurst != "" {
+		burst, err := strconv.Atoi(envRateLimitBurst)
+		if err != nil {
+			log.Fatalf("Parse RATE_LIMIT_BURST global variable error: %v\n", err)
+		}
+		flagRateLimitBurst = burst
+	}
+	if envMaxBatchMetrics := os.Getenv("MAX_BATCH_METRICS"); envMaxBatchMetrics != "" {
+		maxBatch, err := strconv.Atoi(envMaxBatchMetrics)
+		if err != nil {
+			log.Fatalf("Parse MAX_BATCH_METRICS global variable error: %v\n", err)
+		}
+		flagMaxBatchMetrics = maxBatch
+	}
+	if envMaxBodySize := os.Getenv("MAX_BODY_SIZE"); envMaxBodySize != "" {
+		maxBody, err := strconv.ParseInt(envMaxBodySize, 10, 64)
+		if err != nil {
+			log.Fatalf("Parse MAX_BODY_SIZE global variable error: %v\n", err)
+		}
+		flagMaxBodySize = maxBody
+	}
+	if envMaxSeries := os.Getenv("MAX_SERIES"); envMaxSeries != "" {
+		maxSeries, err := strconv.Atoi(envMaxSeries)
+		if err != nil {
+			log.Fatalf("Parse MAX_SERIES global variable error: %v\n", err)
+		}
+		flagMaxSeries = maxSeries
+	}
+	if envMaxSeriesPerAgent := os.Getenv("MAX_SERIES_PER_AGENT"); envMaxSeriesPerAgent != "" {
+		maxSeries, err := strconv.Atoi(envMaxSeriesPerAgent)
+		if err != nil {
+			log.Fatalf("Parse MAX_SERIES_PER_AGENT global variable error: %v\n", err)
+		}
+		flagMaxSeriesPerAgent = maxSeries
+	}
+	if envCardinalityPolicy := os.Getenv("CARDINALITY_POLICY"); envCardinalityPolicy != "" {
+		flagCardinalityPolicy = envCardinalityPolicy
+	}
+	if envNameMaxLength := os.Getenv("METRIC_NAME_MAX_LENGTH"); envNameMaxLength != "" {
+		maxLength, err := strconv.Atoi(envNameMaxLength)
+		if err != nil {
+			log.Fatalf("Parse METRIC_NAME_MAX_LENGTH global variable error: %v\n", err)
+		}
+		flagMetricNameMaxLen = maxLength
+	}
+	if envNamePattern := os.Getenv("METRIC_NAME_PATTERN"); envNamePattern != "" {
+		flagMetricNamePattern = envNamePattern
+	}
+	if envGaugeTTL := os.Getenv("GAUGE_TTL"); envGaugeTTL != "" {
+		ttl, err := time.ParseDuration(envGaugeTTL)
+		if err != nil {
+			log.Fatalf("Parse GAUGE_TTL global variable error: %v\n", err)
+		}
+		flagGaugeTTL = ttl
+	}
+	if envCounterTTL := os.Getenv("COUNTER_TTL"); envCounterTTL != "" {
+		ttl, err := time.ParseDuration(envCounterTTL)
+		if err != nil {
+			log.Fatalf("Parse COUNTER_TTL global variable error: %v\n", err)
+		}
+		flagCounterTTL = ttl
+	}
+	if envExpireInterval := os.Getenv("EXPIRE_INTERVAL"); envExpireInterval != "" {
+		interval, err := time.ParseDuration(envExpireInterval)
+		if err != nil {
+			log.Fatalf("Parse EXPIRE_INTERVAL global variable error: %v\n", err)
+		}
+		flagExpireInterval = interval
+	}
+	if envDBMaxConns := os.Getenv("DB_MAX_CONNS"); envDBMaxConns != "" {
+		maxConns, err := strconv.Atoi(envDBMaxConns)
+		if err != nil {
+			log.Fatalf("Parse DB_MAX_CONNS global variable error: %v\n", err)
+		}
+		flagDBMaxConns = maxConns
+	}
+	if envDBMinConns := os.Getenv("DB_MIN_CONNS"); envDBMinConns != "" {
+		minConns, err := strconv.Atoi(envDBMinConns)
+		if err != nil {
+			log.Fatalf("Parse DB_MIN_CONNS global variable error: %v\n", err)
+		}
+		flagDBMinConns = minConns
+	}
+	if envDBMaxConnLifetime := os.Getenv("DB_MAX_CONN_LIFETIME"); envDBMaxConnLifetime != "" {
+		lifetime, err := time.ParseDuration(envDBMaxConnLifetime)
+		if err != nil {
+			log.Fatalf("Parse DB_MAX_CONN_LIFETIME global variable error: %v\n", err)
+		}
+		flagDBMaxConnLifetime = lifetime
+	}
+	if envDBMaxConnIdleTime := os.Getenv("DB_MAX_CONN_IDLE_TIME"); envDBMaxConnIdleTime != "" {
+		idleTime, err := time.ParseDuration(envDBMaxConnIdleTime)
+		if err != nil {
+			log.Fatalf("Parse DB_MAX_CONN_IDLE_TIME global variable error: %v\n", err)
+		}
+		flagDBMaxConnIdleTime = idleTime
+	}
+	if envDBHealthCheckPeriod := os.Getenv("DB_HEALTH_CHECK_PERIOD"); envDBHealthCheckPeriod != "" {
+		period, err := time.ParseDuration(envDBHealthCheckPeriod)
+		if err != nil {
+			log.Fatalf("Parse DB_HEALTH_CHECK_PERIOD global variable error: %v\n", err)
+		}
+		flagDBHealthCheckPeriod = period
+	}
+	if envDBStatementCache := os.Getenv("DB_STATEMENT_CACHE"); envDBStatementCache != "" {
+		capacity, err := strconv.Atoi(envDBStatementCache)
+		if err != nil {
+			log.Fatalf("Parse DB_STATEMENT_CACHE global variable error: %v\n", err)
+		}
+		flagDBStatementCache = capacity
+	}
+	if envDBConnectTimeout := os.Getenv("DB_CONNECT_TIMEOUT"); envDBConnectTimeout != "" {
+		timeout, err := time.ParseDuration(envDBConnectTimeout)
+		if err != nil {
+			log.Fatalf("Parse DB_CONNECT_TIMEOUT global variable error: %v\n", err)
+		}
+		flagDBConnectTimeout = timeout
+	}
+	if envWriteBehindInterval := os.Getenv("WRITE_BEHIND_INTERVAL"); envWriteBehindInterval != "" {
+		interval, err := time.ParseDuration(envWriteBehindInterval)
+		if err != nil {
+			log.Fatalf("Parse WRITE_BEHIND_INTERVAL global variable error: %v\n", err)
+		}
+		flagWriteBehindInterval = interval
+	}
+	if envWriteBehindFlushSize := os.Getenv("WRITE_BEHIND_FLUSH_SIZE"); envWriteBehindFlushSize != "" {
+		size, err := strconv.Atoi(envWriteBehindFlushSize)
+		if err != nil {
+			log.Fatalf("Parse WRITE_BEHIND_FLUSH_SIZE global variable error: %v\n", err)
+		}
+		flagWriteBehindFlushSize = size
+	}
+	if envWriteBehindMaxPending := os.Getenv("WRITE_BEHIND_MAX_PENDING"); envWriteBehindMaxPending != "" {
+		maxPending, err := strconv.Atoi(envWriteBehindMaxPending)
+		if err != nil {
+			log.Fatalf("Parse WRITE_BEHIND_MAX_PENDING global variable error: %v\n", err)
+		}
+		flagWriteBehindMaxPending = maxPending
+	}
+	if envWriteBehindMaxWait := os.Getenv("WRITE_BEHIND_MAX_WAIT"); envWriteBehindMaxWait != "" {
+		maxWait, err := time.ParseDuration(envWriteBehindMaxWait)
+		if err != nil {
+			log.Fatalf("Parse WRITE_BEHIND_MAX_WAIT global variable error: %v\n", err)
+		}
+		flagWriteBehindMaxWait = maxWait
+	}
+	if envReadCacheTTL := os.Getenv("READ_CACHE_TTL"); envReadCacheTTL != "" {
+		ttl, err := time.ParseDuration(envReadCacheTTL)
+		if err != nil {
+			log.Fatalf("Parse READ_CACHE_TTL global variable error: %v\n", err)
+		}
+		flagReadCacheTTL = ttl
+	}
+	if envReadCacheNotify := os.Getenv("READ_CACHE_NOTIFY"); envReadCacheNotify != "" {
+		notify, err := strconv.ParseBool(envReadCacheNotify)
+		if err != nil {
+			log.Fatalf("Parse READ_CACHE_NOTIFY global variable error: %v\n", err)
+		}
+		flagReadCacheNotify = notify
+	}
+	if envMemShards := os.Getenv("MEM_SHARDS"); envMemShards != "" {
+		shards, err := strconv.Atoi(envMemShards)
+		if err != nil {
+			log.Fatalf("Parse MEM_SHARDS global variable error: %v\n", err)
+		}
+		flagMemShards = shards
+	}
+	if envKVStoragePath := os.Getenv("KV_STORAGE_PATH"); envKVStoragePath != "" {
+		flagKVStoragePath = envKVStoragePath
+	}
+	if envStreamHeartbeat := os.Getenv("STREAM_HEARTBEAT"); envStreamHeartbeat != "" {
+		heartbeat, err := time.ParseDuration(envStreamHeartbeat)
+		if err != nil {
+			log.Fatalf("Parse STREAM_HEARTBEAT global variable error: %v\n", err)
+		}
+		flagStreamHeartbeat = heartbeat
+	}
+	if envStreamBuffer := os.Getenv("STREAM_BUFFER"); envStreamBuffer != "" {
+		buffer, err := strconv.Atoi(envStreamBuffer)
+		if err != nil {
+			log.Fatalf("Parse STREAM_BUFFER global variable error: %v\n", err)
+		}
+		flagStreamBuffer = buffer
+	}
+	if envAlertRules := os.Getenv("ALERT_RULES"); envAlertRules != "" {
+		flagAlertRules = envAlertRules
+	}
+	if envAlertInterval := os.Getenv("ALERT_INTERVAL"); envAlertInterval != "" {
+		alertInterval, err := time.ParseDuration(envAlertInterval)
+		if err != nil {
+			log.Fatalf("Parse ALERT_INTERVAL global variable error: %v\n", err)
+		}
+		flagAlertInterval = alertInterval
+	}
+	if envNotifyConfig := os.Getenv("NOTIFY_CONFIG"); envNotifyConfig != "" {
+		flagNotifyConfig = envNotifyConfig
+	}
+	if envHistory := os.Getenv("HISTORY"); envHistory != "" {
+		enabled, err := strconv.ParseBool(envHistory)
+		if err != nil {
+			log.Fatalf("Parse HISTORY global variable error: %v\n", err)
+		}
+		flagHistory = enabled
+	}
+	if envHistoryTiers := os.Getenv("HISTORY_TIERS"); envHistoryTiers != "" {
+		flagHistoryTiers = envHistoryTiers
+	}
+	if envHistoryCompactInterval := os.Getenv("HISTORY_COMPACT_INTERVAL"); envHistoryCompactInterval != "" {
+		compactInterval, err := time.ParseDuration(envHistoryCompactInterval)
+		if err != nil {
+			log.Fatalf("Parse HISTORY_COMPACT_INTERVAL global variable error: %v\n", err)
+		}
+		flagHistoryCompactInterval = compactInterval
+	}
+	if envRecordingRules := os.Getenv("RECORDING_RULES"); envRecordingRules != "" {
+		flagRecordingRules = envRecordingRules
+	}
+	if envRecordingInterval := os.Getenv("RECORDING_INTERVAL"); envRecordingInterval != "" {
+		recordingInterval, err := time.ParseDuration(envRecordingInterval)
+		if err != nil {
+			log.Fatalf("Parse RECORDING_INTERVAL global variable error: %v\n", err)
+		}
+		flagRecordingInterval = recordingInterval
+	}
+	if envInfluxTags := os.Getenv("INFLUX_TAGS"); envInfluxTags != "" {
+		flagInfluxTags = envInfluxTags
+	}
+	if envInfluxCounters := os.Getenv("INFLUX_COUNTERS"); envInfluxCounters != "" {
+		influxCounters, err := strconv.ParseBool(envInfluxCounters)
+		if err != nil {
+			log.Fatalf("Parse INFLUX_COUNTERS global variable error: %v\n", err)
+		}
+		flagInfluxCounters = influxCounters
+	}
+	if envGraphiteAddress := os.Getenv("GRAPHITE_ADDRESS"); envGraphiteAddress != "" {
+		flagGraphiteAddress = envGraphiteAddress
+	}
+	if envGraphiteCounters := os.Getenv("GRAPHITE_COUNTERS"); envGraphiteCounters != "" {
+		flagGraphiteCounters = envGraphiteCounters
+	}
+	if envOTLPResource := os.Getenv("OTLP_RESOURCE"); envOTLPResource != "" {
+		flagOTLPResource = envOTLPResource
+	}
+	if envOTLPResourceAttributes := os.Getenv("OTLP_RESOURCE_ATTRIBUTES"); envOTLPResourceAttributes != "" {
+		flagOTLPResourceAttributes = envOTLPResourceAttributes
+	}
 }
 
 // parseConfigFile - функция для переопределения параметров конфигурации из файла конфигурации.
@@ -146,4 +634,146 @@ func parseConfigFile() {
 	flagDatabaseDsn = configs.DatabaseDSN
 	flagCryptoKey = configs.CryptoKey
 	flagTrustedSubnet = configs.TrustedSubnet
+	// параметры ограничения запросов необязательны в файле конфигурации
+	if configs.RateLimitRPS != 0 {
+		flagRateLimitRPS = configs.RateLimitRPS
+	}
+	if configs.RateLimitBurst != 0 {
+		flagRateLimitBurst = configs.RateLimitBurst
+	}
+	if configs.RouteRateLimits != nil {
+		flagRouteRateLimits = configs.RouteRateLimits
+	}
+	if configs.MaxBatchMetrics != 0 {
+		flagMaxBatchMetrics = configs.MaxBatchMetrics
+	}
+	if configs.MaxBodySize != 0 {
+		flagMaxBodySize = configs.MaxBodySize
+	}
+	// параметры проверки имен метрик и ограничения количества серий необязательны в файле конфигурации
+	if configs.MaxSeries != 0 {
+		flagMaxSeries = configs.MaxSeries
+	}
+	if configs.MaxSeriesPerAgent != 0 {
+		flagMaxSeriesPerAgent = configs.MaxSeriesPerAgent
+	}
+	if configs.CardinalityPolicy != "" {
+		flagCardinalityPolicy = configs.CardinalityPolicy
+	}
+	if configs.MetricNameMaxLength != 0 {
+		flagMetricNameMaxLen = configs.MetricNameMaxLength
+	}
+	if configs.MetricNamePattern != "" {
+		flagMetricNamePattern = configs.MetricNamePattern
+	}
+	// параметры удаления устаревших метрик необязательны в файле конфигурации
+	if configs.GaugeTTL.Duration != 0 {
+		flagGaugeTTL = configs.GaugeTTL.Duration
+	}
+	if configs.CounterTTL.Duration != 0 {
+		flagCounterTTL = configs.CounterTTL.Duration
+	}
+	if configs.MetricTTL != nil {
+		flagMetricTTL = make(map[string]time.Duration, len(configs.MetricTTL))
+		for name, ttl := range configs.MetricTTL {
+			flagMetricTTL[name] = ttl.Duration
+		}
+	}
+	if configs.ExpireInterval.Duration != 0 {
+		flagExpireInterval = configs.ExpireInterval.Duration
+	}
+	// параметры пула соединений с базой данных необязательны в файле конфигурации
+	if configs.DBMaxConns != 0 {
+		flagDBMaxConns = configs.DBMaxConns
+	}
+	if configs.DBMinConns != 0 {
+		flagDBMinConns = configs.DBMinConns
+	}
+	if configs.DBMaxConnLifetime.Duration != 0 {
+		flagDBMaxConnLifetime = configs.DBMaxConnLifetime.Duration
+	}
+	if configs.DBMaxConnIdleTime.Duration != 0 {
+		flagDBMaxConnIdleTime = configs.DBMaxConnIdleTime.Duration
+	}
+	if configs.DBHealthCheckPeriod.Duration != 0 {
+		flagDBHealthCheckPeriod = configs.DBHealthCheckPeriod.Duration
+	}
+	if configs.DBStatementCache != 0 {
+		flagDBStatementCache = configs.DBStatementCache
+	}
+	if configs.DBConnectTimeout.Duration != 0 {
+		flagDBConnectTimeout = configs.DBConnectTimeout.Duration
+	}
+	if configs.WriteBehindInterval.Duration != 0 {
+		flagWriteBehindInterval = configs.WriteBehindInterval.Duration
+	}
+	if configs.WriteBehindFlushSize != 0 {
+		flagWriteBehindFlushSize = configs.WriteBehindFlushSize
+	}
+	if configs.WriteBehindMaxPending != 0 {
+		flagWriteBehindMaxPending = configs.WriteBehindMaxPending
+	}
+	if configs.WriteBehindMaxWait.Duration != 0 {
+		flagWriteBehindMaxWait = configs.WriteBehindMaxWait.Duration
+	}
+	if configs.ReadCacheTTL.Duration != 0 {
+		flagReadCacheTTL = configs.ReadCacheTTL.Duration
+	}
+	if configs.ReadCacheNotify {
+		flagReadCacheNotify = configs.ReadCacheNotify
+	}
+	if configs.MemShards != 0 {
+		flagMemShards = configs.MemShards
+	}
+	if configs.KVStoragePath != "" {
+		flagKVStoragePath = configs.KVStoragePath
+	}
+	if configs.StreamHeartbeat.Duration != 0 {
+		flagStreamHeartbeat = configs.StreamHeartbeat.Duration
+	}
+	if configs.StreamBuffer != 0 {
+		flagStreamBuffer = configs.StreamBuffer
+	}
+	if configs.AlertRules != "" {
+		flagAlertRules = configs.AlertRules
+	}
+	if configs.AlertInterval.Duration != 0 {
+		flagAlertInterval = configs.AlertInterval.Duration
+	}
+	if configs.NotifyConfig != "" {
+		flagNotifyConfig = configs.NotifyConfig
+	}
+	if configs.History {
+		flagHistory = configs.History
+	}
+	if configs.HistoryTiers != "" {
+		flagHistoryTiers = configs.HistoryTiers
+	}
+	if configs.HistoryCompactInterval.Duration != 0 {
+		flagHistoryCompactInterval = configs.HistoryCompactInterval.Duration
+	}
+	if configs.RecordingRules != "" {
+		flagRecordingRules = configs.RecordingRules
+	}
+	if configs.RecordingInterval.Duration != 0 {
+		flagRecordingInterval = configs.RecordingInterval.Duration
+	}
+	if configs.InfluxTags != "" {
+		flagInfluxTags = configs.InfluxTags
+	}
+	if configs.InfluxCounters {
+		flagInfluxCounters = configs.InfluxCounters
+	}
+	if configs.GraphiteAddress != "" {
+		flagGraphiteAddress = configs.GraphiteAddress
+	}
+	if configs.GraphiteCounters != "" {
+		flagGraphiteCounters = configs.GraphiteCounters
+	}
+	if configs.OTLPResource != "" {
+		flagOTLPResource = configs.OTLPResource
+	}
+	if configs.OTLPResourceAttributes != "" {
+		flagOTLPResourceAttributes = configs.OTLPResourceAttributes
+	}
 }
@@ -5,17 +5,68 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/expiry"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/graphite"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/influx"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/notifier"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/otlp"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/readcache"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/recording"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/stream"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
 )
 
 func TestParseFlagsWithFlags(t *testing.T) {
 	// Сохраняем оригинальные значения флагов
 	originalArgs := os.Args
 	os.Args = []string{"cmd", "-a", ":9000", "-grpc-address", ":9002", "-l", "debug", "-i", "120", "-f", "./metrics.json", "-r=false", "-d", "db_dsn",
-		"-k", "secret", "-crypto-key", "./path/to/crypto/key", "-t", "192.168.0.2/24"}
+		"-k", "secret", "-crypto-key", "./path/to/crypto/key", "-t", "192.168.0.2/24",
+		"-rate-limit", "2.5", "-rate-burst", "5", "-max-batch", "100", "-max-body", "1024",
+		"-max-series", "1000", "-max-series-per-agent", "50", "-cardinality-policy", "drop", "-name-max-length", "64", "-name-pattern", "^[a-z]+$",
+		"-gauge-ttl", "1h", "-counter-ttl", "24h", "-expire-interval", "30s",
+		"-db-max-conns", "16", "-db-min-conns", "2", "-db-max-conn-lifetime", "30m", "-db-max-conn-idle-time", "5m",
+		"-db-health-check-period", "20s", "-db-statement-cache", "-1", "-db-connect-timeout", "2m",
+		"-write-behind-interval", "200ms", "-write-behind-flush-size", "500", "-write-behind-max-pending", "5000", "-write-behind-max-wait", "3s",
+		"-read-cache-ttl", "2s", "-read-cache-notify", "-mem-shards", "64", "-kv-path", "./metrics.db",
+		"-stream-heartbeat", "5s", "-stream-buffer", "200", "-alert-rules", "./rules.yaml", "-alert-interval", "1m",
+		"-notify-config", "./receivers.yaml", "-recording-rules", "./recording.yaml", "-recording-interval", "2m",
+		"-history", "-history-tiers", "raw:12h,5m:7d", "-history-compact-interval", "30s", "-influx-tags", "prefix", "-influx-counters",
+		"-graphite-address", ":2003", "-graphite-counters", "stats.*.requests, app.errors",
+		"-otlp-resource", "prefix", "-otlp-resource-attributes", "service.namespace, service.name"}
 	defer func() { os.Args = originalArgs }()
+	defer pg.SetPoolConfig(pg.PoolConfig{ConnectTimeout: pg.DefaultConnectTimeout})
+	defer writebehind.SetConfig(writebehind.Config{
+		FlushSize:  writebehind.DefaultFlushSize,
+		MaxPending: writebehind.DefaultMaxPending,
+		MaxWait:    writebehind.DefaultMaxWait,
+	})
+	defer readcache.SetConfig(readcache.Config{})
+	defer alerting.SetRulesPath("")
+	defer notifier.SetConfigPath("")
+	defer recording.SetRulesPath("")
+	defer history.SetConfig(history.Config{CompactInterval: history.DefaultCompactInterval})
+	defer influx.SetConfig(influx.Config{Tags: influx.TagsAsLabels})
+	defer graphite.SetConfig(graphite.Config{})
+	defer otlp.SetConfig(otlp.Config{Resource: otlp.ResourceAsLabels, Attributes: otlp.ParseAttributes(otlp.DefaultResourceAttributes)})
+	defer recording.SetInterval(recording.DefaultInterval)
+	defer alerting.SetInterval(alerting.DefaultInterval)
+	defer stream.SetConfig(stream.Config{BufferSize: stream.DefaultBufferSize, Heartbeat: stream.DefaultHeartbeat})
+	defer ratelimit.SetLimits(ratelimit.Limits{})
+	defer cardinality.SetLimits(cardinality.Limits{})
+	defer cardinality.SetNameRules(cardinality.NameRules{})
+	defer expiry.SetTTL(repositories.TTL{})
+	defer expiry.SetInterval(expiry.DefaultInterval)
 
 	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	result := parseFlags()
@@ -31,6 +82,58 @@ func TestParseFlagsWithFlags(t *testing.T) {
 	assert.Equal(t, "./path/to/crypto/key", flagCryptoKey)
 	assert.Equal(t, SAVEINDATABASE, result)
 	assert.Equal(t, "192.168.0.2/24", flagTrustedSubnet)
+	assert.Equal(t, 2.5, flagRateLimitRPS)
+	assert.Equal(t, 5, flagRateLimitBurst)
+	assert.Equal(t, 100, flagMaxBatchMetrics)
+	assert.Equal(t, int64(1024), flagMaxBodySize)
+
+	limits := ratelimit.GetLimiter().Limits()
+	assert.Equal(t, 2.5, limits.RPS)
+	assert.Equal(t, 5, limits.Burst)
+	assert.Equal(t, 100, limits.MaxBatchMetrics)
+	assert.Equal(t, int64(1024), limits.MaxBodySize)
+
+	assert.Equal(t, cardinality.Limits{MaxSeries: 1000, MaxSeriesPerClient: 50, Policy: cardinality.PolicyDrop},
+		cardinality.GetTracker().Limits())
+	assert.Equal(t, 64, cardinality.GetNameRules().MaxLength)
+	assert.NoError(t, cardinality.ValidateName("heap"))
+	assert.ErrorIs(t, cardinality.ValidateName("Heap"), cardinality.ErrInvalidName)
+
+	assert.Equal(t, repositories.TTL{Gauge: time.Hour, Counter: 24 * time.Hour}, expiry.GetTTL())
+	assert.Equal(t, 30*time.Second, expiry.GetInterval())
+
+	assert.Equal(t, pg.PoolConfig{
+		MaxConns:               16,
+		MinConns:               2,
+		MaxConnLifetime:        30 * time.Minute,
+		MaxConnIdleTime:        5 * time.Minute,
+		HealthCheckPeriod:      20 * time.Second,
+		StatementCacheCapacity: -1,
+		ConnectTimeout:         2 * time.Minute,
+	}, pg.GetPoolConfig())
+	assert.Equal(t, writebehind.Config{
+		FlushInterval: 200 * time.Millisecond,
+		FlushSize:     500,
+		MaxPending:    5000,
+		MaxWait:       3 * time.Second,
+	}, writebehind.GetConfig())
+	assert.Equal(t, readcache.Config{TTL: 2 * time.Second, Notify: true}, readcache.GetConfig())
+	assert.Equal(t, 64, flagMemShards)
+	assert.Equal(t, "./metrics.db", flagKVStoragePath)
+	assert.Equal(t, stream.Config{BufferSize: 200, Heartbeat: 5 * time.Second}, stream.GetConfig())
+	assert.Equal(t, "./rules.yaml", alerting.GetRulesPath())
+	assert.Equal(t, time.Minute, alerting.GetInterval())
+	assert.Equal(t, "./receivers.yaml", notifier.GetConfigPath())
+	assert.Equal(t, "./recording.yaml", recording.GetRulesPath())
+	assert.Equal(t, 2*time.Minute, recording.GetInterval())
+	assert.Equal(t, history.Config{
+		Enabled:         true,
+		Tiers:           []history.Tier{{Retention: 12 * time.Hour}, {Resolution: 5 * time.Minute, Retention: 7 * 24 * time.Hour}},
+		CompactInterval: 30 * time.Second,
+	}, history.GetConfig())
+	assert.Equal(t, influx.Config{Tags: influx.TagsAsPrefix, Counters: true}, influx.GetConfig())
+	assert.Equal(t, graphite.Config{Address: ":2003", Counters: graphite.Patterns{"stats.*.requests", "app.errors"}}, graphite.GetConfig())
+	assert.Equal(t, otlp.Config{Resource: otlp.ResourceAsPrefix, Attributes: []string{"service.namespace", "service.name"}}, otlp.GetConfig())
 }
 
 func TestParseFlagsPriority(t *testing.T) {
@@ -96,6 +199,49 @@ func TestParseEnvironment(t *testing.T) {
 	os.Setenv("CRYPTO_KEY", "env_crypto_key")
 	os.Setenv("CONFIG", "test_name_of_config_file")
 	os.Setenv("TRUSTED_SUBNET", "192.168.0.12/24")
+	os.Setenv("RATE_LIMIT_RPS", "10")
+	os.Setenv("RATE_LIMIT_BURST", "20")
+	os.Setenv("MAX_BATCH_METRICS", "500")
+	os.Setenv("MAX_BODY_SIZE", "2048")
+	os.Setenv("MAX_SERIES", "300")
+	os.Setenv("MAX_SERIES_PER_AGENT", "30")
+	os.Setenv("CARDINALITY_POLICY", "log")
+	os.Setenv("METRIC_NAME_MAX_LENGTH", "100")
+	os.Setenv("METRIC_NAME_PATTERN", "^go_")
+	os.Setenv("GAUGE_TTL", "10m")
+	os.Setenv("COUNTER_TTL", "20m")
+	os.Setenv("EXPIRE_INTERVAL", "15s")
+	os.Setenv("DB_MAX_CONNS", "8")
+	os.Setenv("DB_MIN_CONNS", "1")
+	os.Setenv("DB_MAX_CONN_LIFETIME", "1h")
+	os.Setenv("DB_MAX_CONN_IDLE_TIME", "10m")
+	os.Setenv("DB_HEALTH_CHECK_PERIOD", "30s")
+	os.Setenv("DB_STATEMENT_CACHE", "128")
+	os.Setenv("DB_CONNECT_TIMEOUT", "45s")
+	os.Setenv("WRITE_BEHIND_INTERVAL", "1s")
+	os.Setenv("WRITE_BEHIND_FLUSH_SIZE", "50")
+	os.Setenv("WRITE_BEHIND_MAX_PENDING", "400")
+	os.Setenv("WRITE_BEHIND_MAX_WAIT", "2s")
+	os.Setenv("READ_CACHE_TTL", "500ms")
+	os.Setenv("READ_CACHE_NOTIFY", "true")
+	os.Setenv("MEM_SHARDS", "0")
+	os.Setenv("KV_STORAGE_PATH", "./env/metrics.db")
+	os.Setenv("STREAM_HEARTBEAT", "30s")
+	os.Setenv("STREAM_BUFFER", "50")
+	os.Setenv("ALERT_RULES", "./env/rules.yaml")
+	os.Setenv("ALERT_INTERVAL", "30s")
+	os.Setenv("NOTIFY_CONFIG", "./env/receivers.yaml")
+	os.Setenv("RECORDING_RULES", "./env/recording.yaml")
+	os.Setenv("RECORDING_INTERVAL", "20s")
+	os.Setenv("HISTORY", "true")
+	os.Setenv("HISTORY_TIERS", "raw:1h")
+	os.Setenv("HISTORY_COMPACT_INTERVAL", "10s")
+	os.Setenv("INFLUX_TAGS", "prefix")
+	os.Setenv("INFLUX_COUNTERS", "true")
+	os.Setenv("GRAPHITE_ADDRESS", ":2004")
+	os.Setenv("GRAPHITE_COUNTERS", "env.*")
+	os.Setenv("OTLP_RESOURCE", "prefix")
+	os.Setenv("OTLP_RESOURCE_ATTRIBUTES", "host.name")
 	defer func() {
 		os.Unsetenv("ADDRESS")
 		os.Unsetenv("GRPC_ADDRESS")
@@ -107,6 +253,49 @@ func TestParseEnvironment(t *testing.T) {
 		os.Unsetenv("CRYPTO_KEY")
 		os.Unsetenv("CONFIG")
 		os.Unsetenv("TRUSTED_SUBNET")
+		os.Unsetenv("RATE_LIMIT_RPS")
+		os.Unsetenv("RATE_LIMIT_BURST")
+		os.Unsetenv("MAX_BATCH_METRICS")
+		os.Unsetenv("MAX_BODY_SIZE")
+		os.Unsetenv("MAX_SERIES")
+		os.Unsetenv("MAX_SERIES_PER_AGENT")
+		os.Unsetenv("CARDINALITY_POLICY")
+		os.Unsetenv("METRIC_NAME_MAX_LENGTH")
+		os.Unsetenv("METRIC_NAME_PATTERN")
+		os.Unsetenv("GAUGE_TTL")
+		os.Unsetenv("COUNTER_TTL")
+		os.Unsetenv("EXPIRE_INTERVAL")
+		os.Unsetenv("DB_MAX_CONNS")
+		os.Unsetenv("DB_MIN_CONNS")
+		os.Unsetenv("DB_MAX_CONN_LIFETIME")
+		os.Unsetenv("DB_MAX_CONN_IDLE_TIME")
+		os.Unsetenv("DB_HEALTH_CHECK_PERIOD")
+		os.Unsetenv("DB_STATEMENT_CACHE")
+		os.Unsetenv("DB_CONNECT_TIMEOUT")
+		os.Unsetenv("WRITE_BEHIND_INTERVAL")
+		os.Unsetenv("WRITE_BEHIND_FLUSH_SIZE")
+		os.Unsetenv("WRITE_BEHIND_MAX_PENDING")
+		os.Unsetenv("WRITE_BEHIND_MAX_WAIT")
+		os.Unsetenv("READ_CACHE_TTL")
+		os.Unsetenv("READ_CACHE_NOTIFY")
+		os.Unsetenv("MEM_SHARDS")
+		os.Unsetenv("KV_STORAGE_PATH")
+		os.Unsetenv("STREAM_HEARTBEAT")
+		os.Unsetenv("STREAM_BUFFER")
+		os.Unsetenv("ALERT_RULES")
+		os.Unsetenv("ALERT_INTERVAL")
+		os.Unsetenv("NOTIFY_CONFIG")
+		os.Unsetenv("RECORDING_RULES")
+		os.Unsetenv("RECORDING_INTERVAL")
+		os.Unsetenv("HISTORY")
+		os.Unsetenv("HISTORY_TIERS")
+		os.Unsetenv("HISTORY_COMPACT_INTERVAL")
+		os.Unsetenv("INFLUX_TAGS")
+		os.Unsetenv("INFLUX_COUNTERS")
+		os.Unsetenv("GRAPHITE_ADDRESS")
+		os.Unsetenv("GRAPHITE_COUNTERS")
+		os.Unsetenv("OTLP_RESOURCE")
+		os.Unsetenv("OTLP_RESOURCE_ATTRIBUTES")
 	}()
 
 	parseEnvironment()
@@ -122,6 +311,49 @@ func TestParseEnvironment(t *testing.T) {
 	assert.Equal(t, "env_crypto_key", flagCryptoKey)
 	assert.Equal(t, "test_name_of_config_file", flagConfigFile)
 	assert.Equal(t, "192.168.0.12/24", flagTrustedSubnet)
+	assert.Equal(t, 10.0, flagRateLimitRPS)
+	assert.Equal(t, 20, flagRateLimitBurst)
+	assert.Equal(t, 500, flagMaxBatchMetrics)
+	assert.Equal(t, int64(2048), flagMaxBodySize)
+	assert.Equal(t, 300, flagMaxSeries)
+	assert.Equal(t, 30, flagMaxSeriesPerAgent)
+	assert.Equal(t, "log", flagCardinalityPolicy)
+	assert.Equal(t, 100, flagMetricNameMaxLen)
+	assert.Equal(t, "^go_", flagMetricNamePattern)
+	assert.Equal(t, 10*time.Minute, flagGaugeTTL)
+	assert.Equal(t, 20*time.Minute, flagCounterTTL)
+	assert.Equal(t, 15*time.Second, flagExpireInterval)
+	assert.Equal(t, 8, flagDBMaxConns)
+	assert.Equal(t, 1, flagDBMinConns)
+	assert.Equal(t, time.Hour, flagDBMaxConnLifetime)
+	assert.Equal(t, 10*time.Minute, flagDBMaxConnIdleTime)
+	assert.Equal(t, 30*time.Second, flagDBHealthCheckPeriod)
+	assert.Equal(t, 128, flagDBStatementCache)
+	assert.Equal(t, 45*time.Second, flagDBConnectTimeout)
+	assert.Equal(t, time.Second, flagWriteBehindInterval)
+	assert.Equal(t, 50, flagWriteBehindFlushSize)
+	assert.Equal(t, 400, flagWriteBehindMaxPending)
+	assert.Equal(t, 2*time.Second, flagWriteBehindMaxWait)
+	assert.Equal(t, 500*time.Millisecond, flagReadCacheTTL)
+	assert.Equal(t, true, flagReadCacheNotify)
+	assert.Equal(t, 0, flagMemShards)
+	assert.Equal(t, "./env/metrics.db", flagKVStoragePath)
+	assert.Equal(t, 30*time.Second, flagStreamHeartbeat)
+	assert.Equal(t, 50, flagStreamBuffer)
+	assert.Equal(t, "./env/rules.yaml", flagAlertRules)
+	assert.Equal(t, 30*time.Second, flagAlertInterval)
+	assert.Equal(t, "./env/receivers.yaml", flagNotifyConfig)
+	assert.Equal(t, "./env/recording.yaml", flagRecordingRules)
+	assert.Equal(t, 20*time.Second, flagRecordingInterval)
+	assert.Equal(t, true, flagHistory)
+	assert.Equal(t, "raw:1h", flagHistoryTiers)
+	assert.Equal(t, 10*time.Second, flagHistoryCompactInterval)
+	assert.Equal(t, "prefix", flagInfluxTags)
+	assert.Equal(t, true, flagInfluxCounters)
+	assert.Equal(t, ":2004", flagGraphiteAddress)
+	assert.Equal(t, "env.*", flagGraphiteCounters)
+	assert.Equal(t, "prefix", flagOTLPResource)
+	assert.Equal(t, "host.name", flagOTLPResourceAttributes)
 }
 
 func TestParseConfigFile(t *testing.T) {
@@ -134,11 +366,28 @@ func TestParseConfigFile(t *testing.T) {
 	testFlagCryptoKey := "test crypto key"
 	testFlagTrustedSubnet := "192.169.0.14/24"
 	testFlagGRPCNetAddr := ":9999"
+	testFlagRateLimitRPS := 3.5
+	testFlagRateLimitBurst := 7
+	testFlagUpdatesRateLimit := 1.5
+	testFlagMaxBatchMetrics := 1000
+	testFlagMaxBodySize := int64(1 << 20)
+	testFlagMaxSeries := 10000
+	testFlagMaxSeriesPerAgent := 500
+	testFlagCardinalityPolicy := "drop"
+	testFlagMetricNameMaxLen := 96
+	testFlagMetricNamePattern := "^[A-Za-z]"
+	testFlagGaugeTTL := 2 * time.Hour
+	testFlagCounterTTL := 48 * time.Hour
+	testFlagMetricTTL := 5 * time.Minute
+	testFlagExpireInterval := 10 * time.Second
 
 	createFile := func(name string) {
-		data := fmt.Sprintf("{\"address\": \"%s\",\"log_level\": \"%s\",\"restore\": %t,\"store_interval\": \"%ds\",\"store_file\": \"%s\",\"database_dsn\": \"%s\",\"crypto_key\": \"%s\", \"trusted_subnet\": \"%s\", \"grpc_address\": \"%s\"}",
+		data := fmt.Sprintf("{\"address\": \"%s\",\"log_level\": \"%s\",\"restore\": %t,\"store_interval\": \"%ds\",\"store_file\": \"%s\",\"database_dsn\": \"%s\",\"crypto_key\": \"%s\", \"trusted_subnet\": \"%s\", \"grpc_address\": \"%s\", \"rate_limit_rps\": %g, \"rate_limit_burst\": %d, \"route_rate_limits\": {\"/updates/\": %g}, \"max_batch_metrics\": %d, \"max_body_size\": %d, \"max_series\": %d, \"max_series_per_agent\": %d, \"cardinality_policy\": \"%s\", \"metric_name_max_length\": %d, \"metric_name_pattern\": \"%s\", \"gauge_ttl\": \"%s\", \"counter_ttl\": \"%s\", \"metric_ttl\": {\"host.*\": \"%s\"}, \"expire_interval\": \"%s\"}",
 			testFlagNetAddr, testFlagLogLevel, testFlagRestore, testFlagStoreInterval, testFlagFileStoragePath,
-			testFlagDatabaseDsn, testFlagCryptoKey, testFlagTrustedSubnet, testFlagGRPCNetAddr)
+			testFlagDatabaseDsn, testFlagCryptoKey, testFlagTrustedSubnet, testFlagGRPCNetAddr,
+			testFlagRateLimitRPS, testFlagRateLimitBurst, testFlagUpdatesRateLimit, testFlagMaxBatchMetrics, testFlagMaxBodySize,
+			testFlagMaxSeries, testFlagMaxSeriesPerAgent, testFlagCardinalityPolicy, testFlagMetricNameMaxLen, testFlagMetricNamePattern,
+			testFlagGaugeTTL, testFlagCounterTTL, testFlagMetricTTL, testFlagExpireInterval)
 		f, err := os.Create(name)
 		require.NoError(t, err)
 		_, err = f.Write([]byte(data))
@@ -159,7 +408,149 @@ func TestParseConfigFile(t *testing.T) {
 	assert.Equal(t, testFlagCryptoKey, flagCryptoKey)
 	assert.Equal(t, testFlagTrustedSubnet, flagTrustedSubnet)
 	assert.Equal(t, testFlagGRPCNetAddr, flagGRPCNetAddr)
+	assert.Equal(t, testFlagRateLimitRPS, flagRateLimitRPS)
+	assert.Equal(t, testFlagRateLimitBurst, flagRateLimitBurst)
+	assert.Equal(t, map[string]float64{"/updates/": testFlagUpdatesRateLimit}, flagRouteRateLimits)
+	assert.Equal(t, testFlagMaxBatchMetrics, flagMaxBatchMetrics)
+	assert.Equal(t, testFlagMaxBodySize, flagMaxBodySize)
+	assert.Equal(t, testFlagMaxSeries, flagMaxSeries)
+	assert.Equal(t, testFlagMaxSeriesPerAgent, flagMaxSeriesPerAgent)
+	assert.Equal(t, testFlagCardinalityPolicy, flagCardinalityPolicy)
+	assert.Equal(t, testFlagMetricNameMaxLen, flagMetricNameMaxLen)
+	assert.Equal(t, testFlagMetricNamePattern, flagMetricNamePattern)
+	assert.Equal(t, testFlagGaugeTTL, flagGaugeTTL)
+	assert.Equal(t, testFlagCounterTTL, flagCounterTTL)
+	assert.Equal(t, map[string]time.Duration{"host.*": testFlagMetricTTL}, flagMetricTTL)
+	assert.Equal(t, testFlagExpireInterval, flagExpireInterval)
 
 	err := os.Remove(nameFile)
 	require.NoError(t, err)
 }
+
+func TestParseConfigFileDBPool(t *testing.T) {
+	nameFile := "./test_pool_config.json"
+	data := `{"db_max_conns": 32, "db_min_conns": 4, "db_max_conn_lifetime": "2h", "db_max_conn_idle_time": "15m",
+		"db_health_check_period": "1m", "db_statement_cache": -1, "db_connect_timeout": "90s"}`
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0644))
+	defer os.Remove(nameFile)
+
+	flagConfigFile = nameFile
+	parseConfigFile()
+
+	assert.Equal(t, 32, flagDBMaxConns)
+	assert.Equal(t, 4, flagDBMinConns)
+	assert.Equal(t, 2*time.Hour, flagDBMaxConnLifetime)
+	assert.Equal(t, 15*time.Minute, flagDBMaxConnIdleTime)
+	assert.Equal(t, time.Minute, flagDBHealthCheckPeriod)
+	assert.Equal(t, -1, flagDBStatementCache)
+	assert.Equal(t, 90*time.Second, flagDBConnectTimeout)
+}
+
+func TestParseConfigFileWriteBehind(t *testing.T) {
+	nameFile := "./test_write_behind_config.json"
+	data := `{"write_behind_interval": "250ms", "write_behind_flush_size": 200, "write_behind_max_pending": 2000,
+		"write_behind_max_wait": "10s"}`
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0644))
+	defer os.Remove(nameFile)
+
+	flagConfigFile = nameFile
+	parseConfigFile()
+
+	assert.Equal(t, 250*time.Millisecond, flagWriteBehindInterval)
+	assert.Equal(t, 200, flagWriteBehindFlushSize)
+	assert.Equal(t, 2000, flagWriteBehindMaxPending)
+	assert.Equal(t, 10*time.Second, flagWriteBehindMaxWait)
+}
+
+func TestParseConfigFileReadCache(t *testing.T) {
+	nameFile := "./test_read_cache_config.json"
+	data := `{"read_cache_ttl": "3s", "read_cache_notify": true, "mem_shards": 16}`
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0644))
+	defer os.Remove(nameFile)
+
+	flagConfigFile = nameFile
+	parseConfigFile()
+
+	assert.Equal(t, 3*time.Second, flagReadCacheTTL)
+	assert.Equal(t, true, flagReadCacheNotify)
+	assert.Equal(t, 16, flagMemShards)
+}
+
+func TestParseConfigFileStream(t *testing.T) {
+	nameFile := "./test_stream_config.json"
+	data := `{"stream_heartbeat": "1m", "stream_buffer": 10}`
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0644))
+	defer os.Remove(nameFile)
+
+	flagConfigFile = nameFile
+	parseConfigFile()
+
+	assert.Equal(t, time.Minute, flagStreamHeartbeat)
+	assert.Equal(t, 10, flagStreamBuffer)
+}
+
+func TestParseConfigFileAlerting(t *testing.T) {
+	nameFile := "./test_alerting_config.json"
+	data := `{"alert_rules": "./config/rules.yaml", "alert_interval": "45s", "notify_config": "./config/receivers.yaml",
+		"recording_rules": "./config/recording.yaml", "recording_interval": "90s",
+		"history": true, "history_tiers": "raw:6h,1m:1d", "history_compact_interval": "2m",
+		"influx_tags": "prefix", "influx_counters": true,
+		"graphite_address": ":2005", "graphite_counters": "stats.*",
+		"otlp_resource": "prefix", "otlp_resource_attributes": "service.name,host.name"}`
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0644))
+	defer os.Remove(nameFile)
+
+	flagConfigFile = nameFile
+	parseConfigFile()
+
+	assert.Equal(t, "./config/rules.yaml", flagAlertRules)
+	assert.Equal(t, 45*time.Second, flagAlertInterval)
+	assert.Equal(t, "./config/receivers.yaml", flagNotifyConfig)
+	assert.Equal(t, "./config/recording.yaml", flagRecordingRules)
+	assert.Equal(t, 90*time.Second, flagRecordingInterval)
+	assert.Equal(t, true, flagHistory)
+	assert.Equal(t, "raw:6h,1m:1d", flagHistoryTiers)
+	assert.Equal(t, 2*time.Minute, flagHistoryCompactInterval)
+	assert.Equal(t, "prefix", flagInfluxTags)
+	assert.Equal(t, true, flagInfluxCounters)
+	assert.Equal(t, ":2005", flagGraphiteAddress)
+	assert.Equal(t, "stats.*", flagGraphiteCounters)
+	assert.Equal(t, "prefix", flagOTLPResource)
+	assert.Equal(t, "service.name,host.name", flagOTLPResourceAttributes)
+}
+
+func TestParseConfigFileKVStorage(t *testing.T) {
+	nameFile := "./test_kv_storage_config.json"
+	data := `{"kv_storage_path": "./config/metrics.db"}`
+	require.NoError(t, os.WriteFile(nameFile, []byte(data), 0644))
+	defer os.Remove(nameFile)
+
+	flagConfigFile = nameFile
+	parseConfigFile()
+
+	assert.Equal(t, "./config/metrics.db", flagKVStoragePath)
+}
+
+func TestParseFlagsSaveMode(t *testing.T) {
+	originalArgs := os.Args
+	defer func() { os.Args = originalArgs }()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "memory", args: []string{}, want: SAVEINRAM},
+		{name: "file", args: []string{"-f", "./metrics.json"}, want: SAVEINFILE},
+		{name: "key-value file", args: []string{"-kv-path", "./metrics.db", "-f", "./metrics.json"}, want: SAVEINKV},
+		{name: "postgres", args: []string{"-d", "host=localhost", "-kv-path", "./metrics.db"}, want: SAVEINDATABASE},
+		{name: "sqlite", args: []string{"-d", "sqlite:///var/lib/metrics.db"}, want: SAVEINSQLITE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Args = append([]string{"cmd"}, tt.args...)
+			flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+			assert.Equal(t, tt.want, parseFlags())
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
 	_ "google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/reflection"
@@ -24,21 +25,40 @@ import (
 	rpcHasher "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/api/server/interceptors/hasher"
 	rpcIPfilter "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/api/server/interceptors/ipfilter"
 	rpcLogger "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/api/server/interceptors/logger"
+	rpcRatelimit "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/api/server/interceptors/ratelimit"
+	_ "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/compressor/zstd"
 	pb "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/bolt"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/compress"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/dashboard"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/encrypt"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/expiry"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/fallback"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/graphite"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/handlers"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hasher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/influx"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ipfilter"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/notifier"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/otlp"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/readcache"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/recording"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/saver"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/sqlite"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/stream"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
 )
 
 const shutdownWaitPeriod = 20 * time.Second // для установки в контекст для реализаации graceful shutdown
@@ -49,35 +69,113 @@ func main() {
 
 	saveMode := parseFlags()
 
-	// Подключение к базе данных
-	db, err := sql.Open("pgx", flagDatabaseDsn)
-	if err != nil {
-		log.Fatalf("Error connection to database: %v by address %s", err, flagDatabaseDsn)
-	}
-	defer db.Close()
-
 	// Создаю разные хранилища в зависимости от типа запуска сервера
 	var stor repositories.IStorage
+	var db handlers.DatabasePinger
 	if saveMode == SAVEINDATABASE {
-		// создаём соединение с СУБД PostgreSQL с помощью аргумента командной строки
-		conn, err := sql.Open("pgx", flagDatabaseDsn)
-		if err != nil {
-			log.Fatalf("Error create database connection for saving metrics : %v\n", err)
-		}
-		// Проверка соединения с БД
+		// создаю пул соединений с СУБД PostgreSQL, ожидая доступности базы данных
 		ctx := context.Background()
-		err = db.PingContext(ctx)
+		pool, err := pg.Connect(ctx, flagDatabaseDsn, pg.GetPoolConfig())
 		if err != nil {
-			log.Fatalf("Error checking connection with database: %v\n", err)
+			log.Fatalf("Error connection to database: %v\n", err)
 		}
 		// создаем экземпляр хранилища pg
-		stor = pg.NewStore(conn)
-		err = stor.Bootstrap(ctx)
+		pgStore := pg.NewPoolStore(pool)
+		defer pgStore.Close()
+		err = pgStore.Bootstrap(ctx)
+		if err != nil {
+			log.Fatalf("Error prepare database to work: %v\n", err)
+		}
+		// пока база данных недоступна, запросы чтения обслуживаются последними известными значениями метрик
+		cached := fallback.NewStorage(pgStore, pgStore)
+		if err := cached.Warm(ctx); err != nil {
+			log.Fatalf("Error loading metrics from database: %v\n", err)
+		}
+		stor = cached
+		db = pgStore
+
+		// история значений метрик хранится в таблице базы данных
+		if history.GetConfig().Enabled {
+			if err := pgStore.BootstrapHistory(ctx); err != nil {
+				log.Fatalf("Error prepare history table: %v\n", err)
+			}
+			history.SetStore(pgStore)
+		}
+
+		// запись метрик буферизуется в памяти и сбрасывается в базу данных пакетами
+		var buffered *writebehind.Storage
+		if cfg := writebehind.GetConfig(); cfg.Enabled() {
+			buffered = writebehind.NewStorage(cached, cfg)
+			defer func() {
+				// при штатном завершении работы сервера накопленные метрики сбрасываются в базу данных
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownWaitPeriod)
+				defer cancel()
+				if err := buffered.Close(ctx); err != nil {
+					logger.ServerLog.Error("flushing buffered metrics error", zap.String("error", error.Error(err)))
+				}
+			}()
+			stor = buffered
+		}
+
+		// чтение метрик кешируется, кеш сбрасывается при записи и по уведомлениям других экземпляров сервера
+		if cfg := readcache.GetConfig(); cfg.Enabled() {
+			if cfg.Notify {
+				channel := pg.NewChannel(pool, pg.DefaultNotifyChannel)
+				cache := readcache.NewStorage(stor, cfg.TTL, channel)
+				if buffered != nil {
+					// другие экземпляры сервера уведомляются о записи одним уведомлением на сброс буфера,
+					// когда метрики уже записаны в базу данных
+					cache.SetDeferredNotify(true)
+					buffered.SetOnFlush(cache.NotifyWritten)
+				}
+				listenCtx, stopListen := context.WithCancel(context.Background())
+				defer stopListen()
+				go channel.Listen(listenCtx, cache.HandleNotification)
+				stor = cache
+			} else {
+				stor = readcache.NewStorage(stor, cfg.TTL, nil)
+			}
+		}
+		if buffered != nil {
+			buffered.Start()
+		}
+	} else if saveMode == SAVEINSQLITE {
+		// метрики хранятся в файле SQLite со схемой и поведением записи хранилища PostgreSQL
+		sqliteStore, err := sqlite.Open(flagDatabaseDsn)
 		if err != nil {
+			log.Fatalf("Error connection to database: %v\n", err)
+		}
+		defer sqliteStore.Close()
+		if err := sqliteStore.Bootstrap(context.Background()); err != nil {
 			log.Fatalf("Error prepare database to work: %v\n", err)
 		}
+		stor = sqliteStore
+		db = sqliteStore
 	} else {
-		stor = storage.NewDefaultMemStorage()
+		if saveMode == SAVEINKV {
+			// метрики записываются во встроенную базу данных транзакциями и сохраняются при аварийном завершении сервера
+			kvStore, err := bolt.Open(flagKVStoragePath)
+			if err != nil {
+				log.Fatalf("Error opening storage file: %v\n", err)
+			}
+			defer kvStore.Close()
+			if err := kvStore.Bootstrap(context.Background()); err != nil {
+				log.Fatalf("Error prepare storage file to work: %v\n", err)
+			}
+			stor = kvStore
+		} else if flagMemShards > 0 {
+			// хранилище с несколькими сегментами не блокирует запись всех метрик на время чтения
+			stor = storage.NewShardedStorage(flagMemShards)
+		} else {
+			stor = storage.NewDefaultMemStorage()
+		}
+		// Подключение к базе данных для проверки связи с ней
+		conn, err := sql.Open("pgx", flagDatabaseDsn)
+		if err != nil {
+			log.Fatalf("Error connection to database: %v by address %s", err, flagDatabaseDsn)
+		}
+		defer conn.Close()
+		db = conn
 	}
 
 	// В случае запуска сервера в режиме сохранения метрик в файл
@@ -105,7 +203,7 @@ func main() {
 }
 
 // run полезна при инициализации зависимостей сервера перед запуском.
-func run(stor repositories.IStorage, saverVar saver.FileWriter, db *sql.DB, saveMode int) error {
+func run(stor repositories.IStorage, saverVar saver.FileWriter, db handlers.DatabasePinger, saveMode int) error {
 	if err := logger.Initialize(flagLogLevel); err != nil {
 		return err
 	}
@@ -131,11 +229,87 @@ func run(stor repositories.IStorage, saverVar saver.FileWriter, db *sql.DB, save
 		go FlushMetricsToFile(stor, saverVar)
 	}
 
+	// принятые записи метрик добавляются в историю значений, если она включена
+	recorded := stor
+	if hist := history.Open(); hist != nil {
+		recorded = history.NewStorage(stor, hist)
+		historyCtx, stopHistory := context.WithCancel(context.Background())
+		historyDone := make(chan struct{})
+		go func() {
+			defer close(historyDone)
+			hist.Run(historyCtx, history.DefaultFlushInterval, history.GetConfig().CompactInterval)
+		}()
+		// накопленные значения записываются в хранилище истории до его закрытия
+		defer func() {
+			stopHistory()
+			<-historyDone
+		}()
+	}
+
+	// запись метрик через http и grpc выполняется с проверкой имен метрик и лимитов количества серий,
+	// серии, уже сохраненные в хранилище, учитываются при проверке лимитов. Принятые записи публикуются
+	// в поток событий /api/stream
+	guarded := cardinality.NewStorage(stream.NewStorage(recorded, stream.GetHub()), cardinality.GetTracker())
+	if err := guarded.Seed(context.Background()); err != nil {
+		logger.ServerLog.Error("count stored series error", zap.String("error", error.Error(err)))
+		return err
+	}
+
+	// удаление устаревших метрик выполняется через обертку, чтобы освобождать лимиты количества серий
+	expiryCtx, stopExpiry := context.WithCancel(context.Background())
+	defer stopExpiry()
+	go expiry.Run(expiryCtx, guarded)
+
+	// правила записи вычисляются по метрикам хранилища, результаты записываются через обертку, чтобы на них
+	// действовали лимиты количества серий и о них узнавали подписчики потока событий
+	if err := recording.Reload(); err != nil {
+		logger.ServerLog.Error("load recording rules error", zap.String("error", error.Error(err)))
+		return err
+	}
+	recordingCtx, stopRecording := context.WithCancel(context.Background())
+	defer stopRecording()
+	go recording.Run(recordingCtx, guarded)
+
+	// правила оповещения проверяются по метрикам хранилища, об изменении их состояния и о записях метрик
+	// уведомляются получатели. Правила и получатели перечитываются из файлов по сигналу SIGHUP вместе с правилами записи
+	notify := notifier.New(stream.GetHub(), nil)
+	defer notify.Close()
+	alerting.GetEngine().SetNotifier(notify)
+	if err := alerting.Reload(); err != nil {
+		logger.ServerLog.Error("load alerting rules error", zap.String("error", error.Error(err)))
+		return err
+	}
+	if err := notifier.Reload(notify); err != nil {
+		logger.ServerLog.Error("load notification receivers error", zap.String("error", error.Error(err)))
+		return err
+	}
+	alertingCtx, stopAlerting := context.WithCancel(context.Background())
+	defer stopAlerting()
+	go alerting.Run(alertingCtx, guarded)
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	go func() {
+		for range reload {
+			if err := alerting.Reload(); err != nil {
+				logger.ServerLog.Error("reload alerting rules error", zap.String("error", error.Error(err)))
+			}
+			if err := notifier.Reload(notify); err != nil {
+				logger.ServerLog.Error("reload notification receivers error", zap.String("error", error.Error(err)))
+			}
+			if err := recording.Reload(); err != nil {
+				logger.ServerLog.Error("reload recording rules error", zap.String("error", error.Error(err)))
+			}
+		}
+	}()
+
 	// запускаю сам сервис с проверкой отмены контекста для реализации graceful shutdown--------------
 	srv := &http.Server{
 		Addr:    flagNetAddr,
-		Handler: MetricRouter(stor, db),
+		Handler: MetricRouter(guarded, db),
 	}
+	srv.RegisterOnShutdown(dashboard.CloseStreams)
+	srv.RegisterOnShutdown(stream.GetHub().Close)
 	// Канал для получения сигнала прерывания
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -157,15 +331,23 @@ func run(stor repositories.IStorage, saverVar saver.FileWriter, db *sql.DB, save
 		// Логирование конца вызова
 		logging.WithLogOnEvents(logging.FinishCall),
 	}
-	grpcServer := grpc.NewServer(
+	serverOpts := []grpc.ServerOption{
 		grpc.ChainUnaryInterceptor(
 			logging.UnaryServerInterceptor(rpcLogger.Logger(logger.ServerGRPCLog), opts...),
 			rpcHasher.UnaryServerInterceptor,
 			rpcIPfilter.UnaryServerInterceptor,
+			rpcRatelimit.UnaryServerInterceptor,
 			// Add any other interceptor.
 		),
-	)
-	pb.RegisterServiceServer(grpcServer, server.NewServer(stor))
+	}
+	// квота на размер тела запроса распространяется и на размер gRPC сообщения
+	if maxBodySize := ratelimit.GetLimiter().Limits().MaxBodySize; maxBodySize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(int(maxBodySize)))
+	}
+	grpcServer := grpc.NewServer(serverOpts...)
+	pb.RegisterServiceServer(grpcServer, server.NewServer(guarded))
+	// прием метрик OpenTelemetry по протоколу OTLP/gRPC на том же порту
+	colmetricspb.RegisterMetricsServiceServer(grpcServer, server.NewMetricsService(guarded, otlp.GetConverter()))
 	reflection.Register(grpcServer)
 
 	// Горутина для запуска grpc сервера-----------------------------------------------
@@ -176,6 +358,17 @@ func run(stor repositories.IStorage, saverVar saver.FileWriter, db *sql.DB, save
 		}
 	}()
 
+	// прием метрик по протоколу Graphite через TCP и UDP запускается, только если задан его адрес. Запись
+	// выполняется через ту же обертку хранилища, что и для http и grpc
+	var graphiteServer *graphite.Server
+	if graphiteConfig := graphite.GetConfig(); graphiteConfig.Address != "" {
+		graphiteServer = graphite.NewServer(graphiteConfig, guarded)
+		if err := graphiteServer.Start(); err != nil {
+			return fmt.Errorf("error starting graphite listener: %v", err)
+		}
+		logger.ServerLog.Info("Running graphite listener", zap.String("address", graphiteConfig.Address))
+	}
+
 	// Блокирование до тех пор, пока не поступит сигнал о прерывании
 	<-quit
 	log.Println("Shutting down server...")
@@ -219,37 +412,83 @@ func run(stor repositories.IStorage, saverVar saver.FileWriter, db *sql.DB, save
 		close(done)
 	}(ctx, &wg)
 
+	// останавливаю прием метрик по протоколу Graphite, уже полученные строки записываются в хранилище
+	if graphiteServer != nil {
+		wg.Add(1)
+		go func(ctx context.Context, wg *sync.WaitGroup) {
+			defer wg.Done()
+			if err := graphiteServer.Shutdown(ctx); err != nil {
+				logger.ServerLog.Error("failed to stop graphite listener gracefully", zap.String("error", error.Error(err)))
+			}
+		}(ctx, &wg)
+	}
+
 	// Ожидание завершения работы серверов.
 	wg.Wait()
 	return nil
 }
 
 // MetricRouter - дирежирует обработку http запросов к серверу.
-func MetricRouter(stor repositories.IStorage, db *sql.DB) chi.Router {
+func MetricRouter(stor repositories.IStorage, db handlers.DatabasePinger) chi.Router {
 	r := chi.NewRouter()
 
 	r.Route("/", func(r chi.Router) {
-		r.Get("/", logger.RequestLogger(compress.GzipMiddleware(handlers.GetGlobalHandler(stor))))
-		r.Get("/ping", logger.RequestLogger(compress.GzipMiddleware(handlers.PingDatabaseHandler(db))))
-
-		r.Post("/updates/", logger.RequestLogger(ipfilter.Middleware(encrypt.Middleware(compress.GzipMiddleware(
-			hasher.HashMiddleware(handlers.UpdateMetricsBatchHandler(stor)))))))
+		r.Get("/", logger.RequestLogger(compress.Middleware(dashboard.Handler())))
+		r.Get(dashboard.Prefix+"*", logger.RequestLogger(compress.Middleware(dashboard.Handler())))
+		// поток событий не сжимается, чтобы каждое событие сразу доходило до браузера
+		r.Get(dashboard.Prefix+"events", logger.RequestLogger(dashboard.EventsHandler(stor)))
+		r.Get("/plain", logger.RequestLogger(compress.Middleware(handlers.GetGlobalHandler(stor))))
+		r.Get("/ping", logger.RequestLogger(compress.Middleware(handlers.PingDatabaseHandler(db))))
+
+		r.Post("/updates/", logger.RequestLogger(ipfilter.Middleware(ratelimit.Middleware(encrypt.Middleware(compress.Middleware(
+			hasher.HashMiddleware(handlers.UpdateMetricsBatchHandler(stor))))))))
 		r.Route("/update", func(r chi.Router) {
-			r.Post("/", logger.RequestLogger(ipfilter.Middleware(encrypt.Middleware(compress.GzipMiddleware(
-				hasher.HashMiddleware(handlers.UpdateMetricsJSONHandler(stor)))))))
-			r.Post("/{metricType}/{metricName}/{metricValue}", logger.RequestLogger(
-				ipfilter.Middleware(encrypt.Middleware(compress.GzipMiddleware(hasher.HashMiddleware(handlers.UpdateMetricsHandler(stor)))))))
+			r.Post("/", logger.RequestLogger(ipfilter.Middleware(ratelimit.Middleware(encrypt.Middleware(compress.Middleware(
+				hasher.HashMiddleware(handlers.UpdateMetricsJSONHandler(stor))))))))
+			r.Post("/{metricType}/{metricName}/{metricValue}", logger.RequestLogger(ipfilter.Middleware(ratelimit.Middleware(
+				encrypt.Middleware(compress.Middleware(hasher.HashMiddleware(handlers.UpdateMetricsHandler(stor))))))))
 		})
 
+		// запись метрик OpenTelemetry по протоколу OTLP/HTTP
+		r.Post("/v1/metrics", logger.RequestLogger(ipfilter.Middleware(ratelimit.Middleware(encrypt.Middleware(compress.Middleware(
+			hasher.HashMiddleware(handlers.OTLPMetricsHandler(stor, otlp.GetConverter()))))))))
+		// запись в формате InfluxDB line protocol по адресам API InfluxDB 2.x и 1.x
+		r.Post("/api/v2/write", logger.RequestLogger(ipfilter.Middleware(ratelimit.Middleware(encrypt.Middleware(compress.Middleware(
+			hasher.HashMiddleware(handlers.InfluxWriteHandler(stor, influx.GetConverter()))))))))
+		r.Post("/write", logger.RequestLogger(ipfilter.Middleware(ratelimit.Middleware(encrypt.Middleware(compress.Middleware(
+			hasher.HashMiddleware(handlers.InfluxWriteHandler(stor, influx.GetConverter()))))))))
+
 		r.Route("/value", func(r chi.Router) {
-			r.Post("/", logger.RequestLogger(ipfilter.Middleware(encrypt.Middleware(compress.GzipMiddleware(
+			r.Post("/", logger.RequestLogger(ipfilter.Middleware(encrypt.Middleware(compress.Middleware(
 				hasher.HashMiddleware(handlers.GetMetricJSONHandler(stor)))))))
-			r.Get("/{metricType}/{metricName}", logger.RequestLogger(compress.GzipMiddleware(handlers.GetMetricHandler(stor))))
+			r.Get("/{metricType}/{metricName}", logger.RequestLogger(compress.Middleware(handlers.GetMetricHandler(stor))))
+			r.Delete("/{metricType}/{metricName}", logger.RequestLogger(ipfilter.Middleware(compress.Middleware(
+				hasher.SignedMiddleware(handlers.DeleteMetricHandler(stor))))))
 		})
+
+		r.Get("/api/metrics", logger.RequestLogger(compress.Middleware(handlers.ListMetricsHandler(stor))))
+		r.Delete("/api/metrics", logger.RequestLogger(ipfilter.Middleware(compress.Middleware(
+			hasher.SignedMiddleware(handlers.DeleteMetricsHandler(stor))))))
+
+		// поток событий не сжимается, чтобы события отправлялись клиенту сразу
+		r.Get("/api/stream", logger.RequestLogger(handlers.StreamMetricsHandler(stream.GetHub())))
+
+		r.Get("/api/export", logger.RequestLogger(ipfilter.Middleware(compress.Middleware(
+			handlers.ExportMetricsHandler(stor)))))
+		r.Post("/api/import", logger.RequestLogger(ipfilter.Middleware(encrypt.Middleware(compress.Middleware(
+			hasher.SignedMiddleware(handlers.ImportMetricsHandler(stor)))))))
+
+		r.Get("/api/cardinality", logger.RequestLogger(ipfilter.Middleware(compress.Middleware(
+			handlers.CardinalityReportHandler(cardinality.GetTracker())))))
+		r.Get("/api/history", logger.RequestLogger(compress.Middleware(handlers.HistoryHandler(history.Get()))))
+		r.Get("/api/query", logger.RequestLogger(compress.Middleware(handlers.QueryHandler(stor, history.Get()))))
+		r.Get("/api/alerts", logger.RequestLogger(compress.Middleware(handlers.AlertsHandler(alerting.GetEngine()))))
+		r.Get("/api/cache", logger.RequestLogger(ipfilter.Middleware(compress.Middleware(
+			handlers.CacheStatsHandler()))))
 	})
 
 	// Определяем маршрут по умолчанию для некорректных запросов
-	r.NotFound(logger.RequestLogger(compress.GzipMiddleware(hasher.HashMiddleware(handlers.OtherRequestHandler()))))
+	r.NotFound(logger.RequestLogger(compress.Middleware(hasher.HashMiddleware(handlers.OtherRequestHandler()))))
 
 	return r
 }
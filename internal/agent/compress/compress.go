@@ -2,19 +2,72 @@ package compress
 
 import (
 	"bytes"
-	"compress/gzip"
 	"fmt"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+var (
+	codec = repositories.EncodingGzip // алгоритм сжатия отправляемых на сервер данных
+	level int                         // уровень сжатия, 0 - уровень по умолчанию для выбранного алгоритма
 )
 
-// Compress сжимает слайс байт.
+// SetCodec - устанавливает алгоритм сжатия отправляемых на сервер данных: gzip или zstd.
+func SetCodec(c string) error {
+	switch c {
+	case repositories.EncodingGzip, repositories.EncodingZstd:
+		codec = c
+		return nil
+	default:
+		return fmt.Errorf("unsupported compress codec: %s", c)
+	}
+}
+
+// GetCodec - возвращает алгоритм сжатия отправляемых на сервер данных.
+// Значение совпадает со значением заголовка Content-Encoding.
+func GetCodec() string {
+	return codec
+}
+
+// SetLevel - устанавливает уровень сжатия.
+func SetLevel(l int) {
+	level = l
+}
+
+// GetLevel - возвращает уровень сжатия.
+func GetLevel() int {
+	return level
+}
+
+// AcceptEncoding - возвращает значение заголовка Accept-Encoding для запросов агента.
+// Предпочтение отдается установленному алгоритму, gzip остается запасным вариантом.
+func AcceptEncoding() string {
+	if codec == repositories.EncodingGzip {
+		return repositories.EncodingGzip
+	}
+	return codec + ", " + repositories.EncodingGzip + ";q=0.5"
+}
+
+// Compress сжимает слайс байт установленным алгоритмом сжатия.
 func Compress(data []byte) ([]byte, error) {
+	return CompressWith(data, codec, level)
+}
+
+// CompressWith сжимает слайс байт алгоритмом encoding с уровнем сжатия l.
+func CompressWith(data []byte, encoding string, l int) ([]byte, error) {
 	var b bytes.Buffer
 	// создаём переменную w — в неё будут записываться входящие данные,
 	// которые будут сжиматься и сохраняться в bytes.Buffer
-	w := gzip.NewWriter(&b)
+	w, err := repositories.NewEncoder(&b, encoding, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed create compress writer: %v", err)
+	}
 
 	// запись данных
-	_, err := w.Write(data)
+	_, err = w.Write(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed write data to compress temporary buffer: %v", err)
 	}
@@ -29,10 +82,15 @@ func Compress(data []byte) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// Decompress распаковывает слайс байт.
+// Decompress распаковывает слайс байт, сжатый в формате gzip.
 func Decompress(data []byte) ([]byte, error) {
+	return DecompressWith(data, repositories.EncodingGzip)
+}
+
+// DecompressWith распаковывает слайс байт, сжатый алгоритмом encoding.
+func DecompressWith(data []byte, encoding string) ([]byte, error) {
 	// переменная r будет читать входящие данные и распаковывать их
-	r, err := gzip.NewReader(bytes.NewReader(data))
+	r, err := repositories.NewDecoder(bytes.NewReader(data), encoding)
 	if err != nil {
 		return nil, fmt.Errorf("failed decompress data: %v", err)
 	}
@@ -40,10 +98,28 @@ func Decompress(data []byte) ([]byte, error) {
 
 	var b bytes.Buffer
 	// в переменную b записываются распакованные данные
-	_, er := b.ReadFrom(r)
-	if er != nil {
+	_, err = b.ReadFrom(r)
+	if err != nil {
 		return nil, fmt.Errorf("failed decompress data: %v", err)
 	}
 
 	return b.Bytes(), nil
 }
+
+// DecompressMiddleware - распаковывает тело ответа сервера, сжатое алгоритмами zstd или br.
+// Ответы в формате gzip распаковывает сам resty. Мидлварь должна быть установлена до проверки подписи ответа.
+func DecompressMiddleware(_ *resty.Client, resp *resty.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header().Get("Content-Encoding")))
+	if encoding != repositories.EncodingZstd && encoding != repositories.EncodingBrotli {
+		return nil
+	}
+	if len(resp.Body()) == 0 {
+		return nil
+	}
+	body, err := DecompressWith(resp.Body(), encoding)
+	if err != nil {
+		return err
+	}
+	resp.SetBody(body)
+	return nil
+}
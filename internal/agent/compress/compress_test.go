@@ -1,10 +1,15 @@
 package compress
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
 
 func TestDecompress(t *testing.T) {
@@ -27,3 +32,83 @@ func TestDecompress(t *testing.T) {
 		require.Error(t, err)
 	}
 }
+
+func TestCompressWith(t *testing.T) {
+	initialData := []byte("data for testing data for testing data for testing")
+	for _, encoding := range []string{repositories.EncodingGzip, repositories.EncodingZstd, repositories.EncodingBrotli} {
+		t.Run(encoding, func(t *testing.T) {
+			// сжатие данных с уровнем по умолчанию и с явно заданным уровнем
+			for _, l := range []int{0, 5} {
+				compressData, err := CompressWith(initialData, encoding, l)
+				require.NoError(t, err)
+				decompressData, err := DecompressWith(compressData, encoding)
+				require.NoError(t, err)
+				assert.Equal(t, initialData, decompressData)
+			}
+		})
+	}
+	// неизвестный алгоритм сжатия
+	_, err := CompressWith(initialData, "unknown", 0)
+	require.Error(t, err)
+	_, err = DecompressWith(initialData, "unknown")
+	require.Error(t, err)
+}
+
+func TestSetCodec(t *testing.T) {
+	defer func() {
+		require.NoError(t, SetCodec(repositories.EncodingGzip))
+		SetLevel(0)
+	}()
+
+	assert.Equal(t, repositories.EncodingGzip, GetCodec())
+	assert.Equal(t, repositories.EncodingGzip, AcceptEncoding())
+
+	require.NoError(t, SetCodec(repositories.EncodingZstd))
+	SetLevel(3)
+	assert.Equal(t, repositories.EncodingZstd, GetCodec())
+	assert.Equal(t, 3, GetLevel())
+	assert.Equal(t, "zstd, gzip;q=0.5", AcceptEncoding())
+
+	// данные сжимаются установленным алгоритмом
+	initialData := []byte("data for testing")
+	compressData, err := Compress(initialData)
+	require.NoError(t, err)
+	decompressData, err := DecompressWith(compressData, repositories.EncodingZstd)
+	require.NoError(t, err)
+	assert.Equal(t, initialData, decompressData)
+
+	// агент не сжимает данные алгоритмом brotli
+	require.Error(t, SetCodec(repositories.EncodingBrotli))
+	assert.Equal(t, repositories.EncodingZstd, GetCodec())
+}
+
+func TestDecompressMiddleware(t *testing.T) {
+	body := []byte(`[{"id":"counter","type":"counter","delta":1}]`)
+
+	handler := func(encoding string) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			data := body
+			if encoding != "" {
+				var err error
+				data, err = CompressWith(body, encoding, 0)
+				require.NoError(t, err)
+				w.Header().Set("Content-Encoding", encoding)
+			}
+			_, err := w.Write(data)
+			require.NoError(t, err)
+		}
+	}
+
+	for _, encoding := range []string{"", repositories.EncodingGzip, repositories.EncodingZstd, repositories.EncodingBrotli} {
+		t.Run("encoding "+encoding, func(t *testing.T) {
+			ts := httptest.NewServer(handler(encoding))
+			defer ts.Close()
+
+			client := resty.New()
+			client.OnAfterResponse(DecompressMiddleware)
+			resp, err := client.R().Get(ts.URL)
+			require.NoError(t, err)
+			assert.Equal(t, body, resp.Body())
+		})
+	}
+}
@@ -2,12 +2,17 @@ package checker
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
 )
@@ -68,3 +73,59 @@ func IsFileLockedError(err error) bool {
 	}
 	return res
 }
+
+// RetryAfterError - ошибка, означающая, что сервер ограничил частоту запросов агента
+// и запрос можно повторить не ранее, чем через Delay.
+type RetryAfterError struct {
+	Delay time.Duration
+	Err   error
+}
+
+// NewRetryAfterError - фабричная функция структуры RetryAfterError.
+func NewRetryAfterError(delay time.Duration, err error) *RetryAfterError {
+	return &RetryAfterError{
+		Delay: delay,
+		Err:   err,
+	}
+}
+
+// Error - реализация интерфейса error.
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s: %v", e.Delay, e.Err)
+}
+
+// Unwrap - возвращает исходную ошибку.
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter - проверяет, что ошибка относится к RetryAfterError, и возвращает время до повтора запроса.
+func RetryAfter(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		logger.AgentLog.Debug("error is RetryAfterError", zap.Duration("delay", retryErr.Delay))
+		return retryErr.Delay, true
+	}
+	return 0, false
+}
+
+// ParseRetryAfter - разбирает значение заголовка Retry-After, заданное количеством секунд или датой HTTP.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
@@ -1,11 +1,14 @@
 package checker
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -198,3 +201,40 @@ func TestIsFileLockedError(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryAfter(t *testing.T) {
+	delay, ok := RetryAfter(fmt.Errorf("push failed: %w", NewRetryAfterError(3*time.Second, errors.New("too many requests"))))
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	_, ok = RetryAfter(errors.New("other error"))
+	assert.False(t, ok)
+
+	_, ok = RetryAfter(nil)
+	assert.False(t, ok)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "seconds", value: "5", want: 5 * time.Second, wantOk: true},
+		{name: "zero seconds", value: "0", want: 0, wantOk: true},
+		{name: "http date", value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second, wantOk: true},
+		{name: "date in the past", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOk: true},
+		{name: "negative seconds", value: "-1", wantOk: false},
+		{name: "empty", value: "", wantOk: false},
+		{name: "garbage", value: "soon", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
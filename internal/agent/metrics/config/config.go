@@ -17,6 +17,7 @@ var (
 	reportInterval time.Duration            = 10
 	contextTimeout                          = 500 * time.Millisecond
 	cryptoGrapher  encryption.Cryptographer // переменная, которая хранит структуру шифрования и расшифровки.
+	agentID        string                   // идентификатор агента, по которому сервер ограничивает частоту запросов
 )
 
 // Configs представляет структуру конфигурации
@@ -26,6 +27,9 @@ type Configs struct {
 	PollInterval   repositories.Duration `json:"poll_interval"`   // аналог переменной окружения POLL_INTERVAL или флага -p
 	CryptoKey      string                `json:"crypto_key"`      // аналог переменной окружения CRYPTO_KEY или флага -crypto-key
 	Protocol       string                `json:"protocol"`        // аналог переменной окружения PROTOCOL или флага -protocol
+	CompressCodec  string                `json:"compress_codec"`  // аналог переменной окружения COMPRESS_CODEC или флага -compress
+	CompressLevel  int                   `json:"compress_level"`  // аналог переменной окружения COMPRESS_LEVEL или флага -compress-level
+	AgentID        string                `json:"agent_id"`        // аналог переменной окружения AGENT_ID или флага -id
 }
 
 // SetPollInterval устанавливает интервал между сбором.
@@ -73,6 +77,16 @@ func GetCryptoGrapher() encryption.Cryptographer {
 	return cryptoGrapher
 }
 
+// SetAgentID - устанавливает идентификатор агента.
+func SetAgentID(id string) {
+	agentID = id
+}
+
+// GetAgentID - возвращает идентификатор агента.
+func GetAgentID() string {
+	return agentID
+}
+
 // ParseConfigFile - функция для переопределения параметров конфигурации из файла конфигурации.
 func ParseConfigFile(configFileName string) (Configs, error) {
 	var configs Configs
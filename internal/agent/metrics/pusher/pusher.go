@@ -7,12 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/compress"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/builder"
@@ -75,10 +76,11 @@ func PushJSON(address, action, typeMetric, nameMetric, valueMetric string, clien
 	url := fmt.Sprintf("%s/%s", address, action)
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
-		SetHeader("Content-Encoding", "gzip").
-		SetHeader("Accept-Encoding", "gzip").
+		SetHeader("Content-Encoding", compress.GetCodec()).
+		SetHeader("Accept-Encoding", compress.AcceptEncoding()).
 		SetHeader("HashSHA256", hash).
 		SetHeader("X-Real-IP", hostAddress).
+		SetHeader("X-Agent-ID", config.GetAgentID()).
 		SetBody(compressBody).
 		Post(url)
 
@@ -95,11 +97,11 @@ func PushJSON(address, action, typeMetric, nameMetric, valueMetric string, clien
 
 	if resp.StatusCode() != http.StatusOK {
 		logger.AgentLog.Error("Geting status is not 200 ", zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())))
-		return fmt.Errorf("status code is: %d %w", resp.StatusCode(), errors.New(resp.String()))
+		return statusError(resp)
 	}
 
 	contentEncoding := resp.Header().Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
+	if contentEncoding != "" {
 		logger.AgentLog.Debug("Get compress answer data in PushJSON function", zap.String("Content-Encoding", contentEncoding))
 	} else {
 		logger.AgentLog.Debug("Get uncompress answer data in PushJSON function", zap.String("Content-Encoding", contentEncoding))
@@ -124,6 +126,18 @@ func PushJSON(address, action, typeMetric, nameMetric, valueMetric string, clien
 	return nil
 }
 
+// statusError - формирует ошибку по ответу сервера с неуспешным статусом. Если сервер ограничил частоту
+// запросов агента, возвращается ошибка checker.RetryAfterError с временем до повтора запроса из заголовка Retry-After.
+func statusError(resp *resty.Response) error {
+	err := fmt.Errorf("status code is: %d %w", resp.StatusCode(), errors.New(resp.String()))
+	if resp.StatusCode() == http.StatusTooManyRequests {
+		if delay, ok := checker.ParseRetryAfter(resp.Header().Get("Retry-After"), time.Now()); ok {
+			return checker.NewRetryAfterError(delay, err)
+		}
+	}
+	return err
+}
+
 // Push отправляет метрику на сервер и возвращает ошибку при неудаче.
 func Push(address, action, typemetric, namemetric, valuemetric string, client *resty.Client) error {
 	url := fmt.Sprintf("%s/%s/%s/%s/%s", address, action, typemetric, namemetric, valuemetric)
@@ -138,6 +152,7 @@ func Push(address, action, typemetric, namemetric, valuemetric string, client *r
 	resp, err := client.R().
 		SetHeader("Content-Type", "text/plain").
 		SetHeader("X-Real-IP", hostAddress).
+		SetHeader("X-Agent-ID", config.GetAgentID()).
 		Post(url)
 
 	if err != nil {
@@ -220,10 +235,11 @@ func PushBatch(address, action string, metricsSlice []repositories.Metric, clien
 	url := fmt.Sprintf("%s/%s", address, action)
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
-		SetHeader("Content-Encoding", "gzip").
-		SetHeader("Accept-Encoding", "gzip").
+		SetHeader("Content-Encoding", compress.GetCodec()).
+		SetHeader("Accept-Encoding", compress.AcceptEncoding()).
 		SetHeader("HashSHA256", hash).
 		SetHeader("X-Real-IP", hostAddress).
+		SetHeader("X-Agent-ID", config.GetAgentID()).
 		SetBody(compressBody).
 		SetContext(ctx).
 		Post(url)
@@ -241,10 +257,10 @@ func PushBatch(address, action string, metricsSlice []repositories.Metric, clien
 
 	if resp.StatusCode() != http.StatusOK {
 		logger.AgentLog.Error("Geting status is not 200 ", zap.String("statusCode", fmt.Sprintf("%d", resp.StatusCode())))
-		return fmt.Errorf("status code is: %d %w", resp.StatusCode(), errors.New(resp.String()))
+		return statusError(resp)
 	}
 	contentEncoding := resp.Header().Get("Content-Encoding")
-	if strings.Contains(contentEncoding, "gzip") {
+	if contentEncoding != "" {
 		logger.AgentLog.Debug("Get compress answer data in PushBatch function", zap.String("Content-Encoding", contentEncoding))
 	} else {
 		logger.AgentLog.Debug("Get uncompress answer data in PushBatch function", zap.String("Content-Encoding", contentEncoding))
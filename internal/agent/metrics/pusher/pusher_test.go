@@ -8,6 +8,7 @@ import (
 	"os"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
@@ -18,6 +19,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/mocks"
 	agentStorage "github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
@@ -189,7 +191,7 @@ func TestPushJSON(t *testing.T) {
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				r := chi.NewRouter()
-				r.Post("/update", compress.GzipMiddleware(handlers.UpdateMetricsJSONHandler(stor)))
+				r.Post("/update", compress.Middleware(handlers.UpdateMetricsJSONHandler(stor)))
 
 				// Создаём тестовый сервер
 				ts := httptest.NewServer(r)
@@ -303,7 +305,7 @@ func TestPushJSON(t *testing.T) {
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				r := chi.NewRouter()
-				r.Post("/update", compress.GzipMiddleware(handlers.UpdateMetricsJSONHandler(m)))
+				r.Post("/update", compress.Middleware(handlers.UpdateMetricsJSONHandler(m)))
 
 				// Создаём тестовый сервер
 				ts := httptest.NewServer(r)
@@ -415,7 +417,7 @@ func TestPushBatch(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := chi.NewRouter()
-			r.Post("/updates/", compress.GzipMiddleware(handlers.UpdateMetricsBatchHandler(m)))
+			r.Post("/updates/", compress.Middleware(handlers.UpdateMetricsBatchHandler(m)))
 
 			// Создаём тестовый сервер
 			ts := httptest.NewServer(r)
@@ -431,6 +433,30 @@ func TestPushBatch(t *testing.T) {
 	}
 }
 
+func TestPushBatchRetryAfter(t *testing.T) {
+	config.SetAgentID("test agent")
+	defer config.SetAgentID("")
+
+	// сервер ограничивает частоту запросов агента
+	var agentID string
+	r := chi.NewRouter()
+	r.Post("/updates/", func(w http.ResponseWriter, r *http.Request) {
+		agentID = r.Header.Get("X-Agent-ID")
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	delta := int64(1)
+	err := PushBatch(ts.URL, "updates/", []repositories.Metric{{ID: "counter", MType: "counter", Delta: &delta}}, resty.New())
+	require.Error(t, err)
+	assert.Equal(t, "test agent", agentID)
+	delay, ok := checker.RetryAfter(err)
+	require.True(t, ok)
+	assert.Equal(t, 7*time.Second, delay)
+}
+
 func TestPrepareAndPushBatch(t *testing.T) {
 	// error: storage is nil
 	{
@@ -10,6 +10,7 @@ import (
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/compress"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/hasher"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
@@ -19,16 +20,27 @@ import (
 // PushFunction - тип функции выполняющей отправку метрики.
 type PushFunction = func(string, string, *storage.MetricsStats, *resty.Client) error
 
+// maxRetryAfter - максимальное время ожидания, запрошенное сервером в заголовке Retry-After,
+// которое агент соблюдает перед повторной отправкой.
+const maxRetryAfter = time.Minute
+
 // RetryExecPushFunction - для повторной отправки запроса в случае, если сервер не отвечает. Установлено три дополнительных попыток.
+// Если сервер ограничил частоту запросов, перед повторной попыткой агент ожидает время, указанное в заголовке Retry-After.
 func RetryExecPushFunction(address, action string, metrics *storage.MetricsStats, client *resty.Client, pushFunction PushFunction) {
-	sleepIntervals := []time.Duration{0, 1, 3, 5}
+	sleepIntervals := []time.Duration{0, 1 * time.Second, 3 * time.Second, 5 * time.Second}
 
+	var retryAfter time.Duration
 	for i := 0; i < 4; i++ {
 		logger.AgentLog.Debug(fmt.Sprintf("Push metrics to server, attemption %d", i+1))
 
-		time.Sleep(sleepIntervals[i] * time.Second)
+		time.Sleep(max(sleepIntervals[i], retryAfter))
+		retryAfter = 0
 
 		err := pushFunction(address, action, metrics, client)
+		if delay, ok := checker.RetryAfter(err); ok {
+			retryAfter = min(delay, maxRetryAfter)
+			continue
+		}
 		if err != nil && (errors.Is(err, context.DeadlineExceeded) ||
 			checker.IsConnectionRefused(err) ||
 			checker.IsDBTransportError(err)) ||
@@ -62,7 +74,9 @@ func NewTask(address, action string, metrics *storage.MetricsStats, pushFunction
 
 // Do - метод для выполнения задачи.
 func (t Task) Do() {
-	// Добавляем middleware для обработки ответа
+	// Добавляем middleware для обработки ответа. Распаковка ответа должна выполняться до проверки подписи,
+	// так как сервер подписывает несжатое тело ответа
+	t.restyClient.OnAfterResponse(compress.DecompressMiddleware)
 	t.restyClient.OnAfterResponse(hasher.VerifyHashMiddleware)
 
 	RetryExecPushFunction(t.address, t.action, t.metrics, t.restyClient, t.pushFunction)
@@ -1,11 +1,14 @@
 package worker
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
 )
 
@@ -29,3 +32,29 @@ func TestNewTask(t *testing.T) {
 	assert.Equal(t, wantTask.metrics, getTask.metrics)
 	assert.Equal(t, wantTask.pushFunction("", "", nil, nil), getTask.pushFunction("", "", nil, nil))
 }
+
+func TestRetryExecPushFunction(t *testing.T) {
+	// сервер ограничил частоту запросов - агент повторяет отправку не ранее указанного времени
+	attempts := 0
+	var retried time.Duration
+	start := time.Now()
+	pushFunction := func(string, string, *storage.MetricsStats, *resty.Client) error {
+		attempts++
+		if attempts == 1 {
+			return checker.NewRetryAfterError(1500*time.Millisecond, errors.New("too many requests"))
+		}
+		retried = time.Since(start)
+		return nil
+	}
+	RetryExecPushFunction("", "", nil, nil, pushFunction)
+	assert.Equal(t, 2, attempts)
+	assert.GreaterOrEqual(t, retried, 1500*time.Millisecond)
+
+	// прочие ошибки не приводят к повторной отправке
+	attempts = 0
+	RetryExecPushFunction("", "", nil, nil, func(string, string, *storage.MetricsStats, *resty.Client) error {
+		attempts++
+		return errors.New("bad request")
+	})
+	assert.Equal(t, 1, attempts)
+}
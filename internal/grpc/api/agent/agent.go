@@ -5,15 +5,20 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/builder"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/storage"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/api/agent/impl"
 )
 
+// maxRetryAfter - максимальное время ожидания, запрошенное сервером, которое соблюдает воркер.
+const maxRetryAfter = time.Minute
+
 // Worker - структура для реализации патерна worker pool.
 type Worker struct {
 	cl                 *impl.Client
@@ -63,5 +68,12 @@ func InitWorkerAndDo(ctx context.Context, netAddr, transmittionMethod string, me
 		if err != nil {
 			logger.AgentLog.Error("do work error", zap.String("error", err.Error()))
 		}
+		// если сервер ограничил частоту запросов, воркер не берет новые задачи до истечения указанного сервером времени
+		if delay, ok := checker.RetryAfter(err); ok {
+			select {
+			case <-ctx.Done():
+			case <-time.After(min(delay, maxRetryAfter)):
+			}
+		}
 	}
 }
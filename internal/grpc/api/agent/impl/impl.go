@@ -3,16 +3,24 @@ package impl
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/compress"
+	errchecker "github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/errors/checker"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/logger"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/checker"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/agent/metrics/config"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/api/agent/interceptors/hasher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/compressor/zstd"
 	pb "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc"
 	pbModel "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc/model"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
@@ -28,9 +36,15 @@ type Client struct {
 func InitClient(netAddr string) (*Client, error) {
 	logger.AgentLog.Info("initialize new grpc client", zap.String("netAddr", netAddr))
 
+	// алгоритм сжатия сообщений выбирается в соответствии с настройками сжатия агента
+	compressorName := gzip.Name
+	if compress.GetCodec() == repositories.EncodingZstd {
+		compressorName = zstd.Name
+	}
+
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(compressorName)),
 		grpc.WithUnaryInterceptor(hasher.UnaryClientInterceptor),
 	}
 
@@ -54,6 +68,11 @@ func AddMetric(ctx context.Context, cl *Client, metricsSlice []repositories.Metr
 		return fmt.Errorf("metric slice is nil")
 	}
 
+	// идентификатор агента передается в метаданных для ограничения частоты запросов на сервере
+	if id := config.GetAgentID(); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-agent-id", id)
+	}
+
 	for _, metric := range metricsSlice {
 		m := pbModel.Metric{
 			Id:    metric.ID,
@@ -65,10 +84,17 @@ func AddMetric(ctx context.Context, cl *Client, metricsSlice []repositories.Metr
 			Metric: &m,
 		}
 		// Вызов grpc метода. В этом месте можно установить необходимые перехватчики.
-		resp, err := cl.AddMetric(ctx, &req)
+		var header metadata.MD
+		resp, err := cl.AddMetric(ctx, &req, grpc.Header(&header))
 		if err != nil {
 			if e, ok := status.FromError(err); ok {
-				return fmt.Errorf("error of add metric to server: %v", e.Message())
+				err := fmt.Errorf("error of add metric to server: %v", e.Message())
+				if e.Code() == codes.ResourceExhausted {
+					if delay, ok := retryDelay(e, header); ok {
+						return errchecker.NewRetryAfterError(delay, err)
+					}
+				}
+				return err
 			}
 			return fmt.Errorf("error of add metric to server, can't parse error: %v", err)
 		}
@@ -91,3 +117,17 @@ func AddMetric(ctx context.Context, cl *Client, metricsSlice []repositories.Metr
 	}
 	return nil
 }
+
+// retryDelay - извлекает из ответа сервера время, через которое можно повторить запрос:
+// из деталей ошибки RetryInfo, а при их отсутствии - из заголовка retry-after.
+func retryDelay(st *status.Status, header metadata.MD) (time.Duration, bool) {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.GetRetryDelay() != nil {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	if values := header.Get("retry-after"); len(values) > 0 {
+		return errchecker.ParseRetryAfter(values[0], time.Now())
+	}
+	return 0, false
+}
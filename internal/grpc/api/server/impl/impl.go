@@ -2,6 +2,7 @@ package impl
 
 import (
 	"context"
+	"errors"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
@@ -10,7 +11,9 @@ import (
 	pb "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc"
 	pbModel "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc/model"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
 )
 
 // Server - структура для реализации proto интерфейса сервера.
@@ -26,6 +29,22 @@ func NewServer(stor repositories.IStorage) *Server {
 	}
 }
 
+// storageError - преобразует ошибку записи метрики в хранилище в ошибку gRPC.
+func storageError(err error, msg string) error {
+	switch {
+	case errors.Is(err, cardinality.ErrInvalidName):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, cardinality.ErrCardinalityLimit):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, repositories.ErrTypeConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, writebehind.ErrBufferFull):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, msg)
+	}
+}
+
 // AddMetric - gRPC метод для добавления метрики на сервер.
 func (s *Server) AddMetric(ctx context.Context, req *pbModel.AddMetricRequest) (*pbModel.AddMetricResponce, error) {
 	responce := &pbModel.AddMetricResponce{}
@@ -49,7 +68,7 @@ func (s *Server) AddMetric(ctx context.Context, req *pbModel.AddMetricRequest) (
 		err := s.storage.AddGauge(ctx, metric.Id, *metric.Value)
 		if err != nil {
 			logger.ServerGRPCLog.Error("add gauge error", zap.String("error", error.Error(err)))
-			return nil, status.Error(codes.Internal, "add gauge error")
+			return nil, storageError(err, "add gauge error")
 		}
 	case "counter":
 		if metric.Delta == nil {
@@ -59,7 +78,7 @@ func (s *Server) AddMetric(ctx context.Context, req *pbModel.AddMetricRequest) (
 		err := s.storage.AddCounter(ctx, metric.Id, *metric.Delta)
 		if err != nil {
 			logger.ServerGRPCLog.Error("add counter error", zap.String("error", error.Error(err)))
-			return nil, status.Error(codes.Internal, "add counter error")
+			return nil, storageError(err, "add counter error")
 		}
 	default:
 		logger.ServerGRPCLog.Error("Invalid type of metric", zap.String("type", metric.Mtype))
@@ -72,3 +91,42 @@ func (s *Server) AddMetric(ctx context.Context, req *pbModel.AddMetricRequest) (
 	responce.Metric = req.Metric
 	return responce, nil
 }
+
+// DeleteMetrics - gRPC метод для удаления метрик, удовлетворяющих фильтру.
+// Пустой фильтр не допускается, чтобы запрос не удалил все метрики сервера.
+func (s *Server) DeleteMetrics(ctx context.Context, req *pbModel.DeleteMetricsRequest) (*pbModel.DeleteMetricsResponce, error) {
+	if s.storage == nil {
+		return nil, status.Error(codes.Internal, "storage not initialized")
+	}
+	switch req.Mtype {
+	case "", "gauge", "counter":
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid type of metric, type %s", req.Mtype)
+	}
+	filter := repositories.MetricFilter{
+		MType:  req.Mtype,
+		ID:     req.Id,
+		Prefix: req.Prefix,
+		Labels: req.Labels,
+	}
+	if filter.Empty() {
+		return nil, status.Error(codes.InvalidArgument, "metric filter is empty")
+	}
+
+	deleted, err := s.storage.DeleteMetrics(ctx, filter)
+	if err != nil {
+		logger.ServerGRPCLog.Error("delete metrics error", zap.String("error", error.Error(err)))
+		return nil, status.Error(codes.Internal, "delete metrics error")
+	}
+
+	responce := &pbModel.DeleteMetricsResponce{Metrics: make([]*pbModel.Metric, 0, len(deleted))}
+	for _, m := range deleted {
+		responce.Metrics = append(responce.Metrics, &pbModel.Metric{
+			Id:    m.ID,
+			Mtype: m.MType,
+			Delta: m.Delta,
+			Value: m.Value,
+		})
+	}
+	return responce, nil
+}
@@ -16,7 +16,11 @@ import (
 
 	pb "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc"
 	pbModel "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc/model"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -272,3 +276,61 @@ func TestServer_AddMetric(t *testing.T) {
 		assert.Equal(t, codes.Internal, e.Code())
 	}
 }
+
+func TestStorageError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{name: "invalid name", err: fmt.Errorf("%w: name is empty", cardinality.ErrInvalidName), code: codes.InvalidArgument},
+		{name: "cardinality limit", err: fmt.Errorf("%w: over limit", cardinality.ErrCardinalityLimit), code: codes.ResourceExhausted},
+		{name: "type conflict", err: repositories.TypeConflictError("Alloc", "counter", "gauge"), code: codes.AlreadyExists},
+		{name: "buffer full", err: writebehind.ErrBufferFull, code: codes.Unavailable},
+		{name: "other error", err: fmt.Errorf("database is down"), code: codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, ok := status.FromError(storageError(tt.err, "add metric error"))
+			require.True(t, ok)
+			assert.Equal(t, tt.code, st.Code())
+		})
+	}
+}
+
+func TestServer_DeleteMetrics(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(storage.NewMemStorage(
+		map[string]float64{"cpu;host=a": 1, "cpu;host=b": 2},
+		map[string]int64{"PollCount": 3},
+	))
+
+	tests := []struct {
+		name    string
+		req     *pbModel.DeleteMetricsRequest
+		code    codes.Code
+		deleted int
+	}{
+		{name: "empty filter", req: &pbModel.DeleteMetricsRequest{Mtype: "gauge"}, code: codes.InvalidArgument},
+		{name: "invalid type", req: &pbModel.DeleteMetricsRequest{Mtype: "summary", Id: "PollCount"}, code: codes.InvalidArgument},
+		{name: "nothing to delete", req: &pbModel.DeleteMetricsRequest{Id: "unknown"}, code: codes.OK},
+		{name: "delete by label", req: &pbModel.DeleteMetricsRequest{Labels: map[string]string{"host": "a"}}, code: codes.OK, deleted: 1},
+		{name: "delete by name", req: &pbModel.DeleteMetricsRequest{Mtype: "counter", Id: "PollCount"}, code: codes.OK, deleted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responce, err := srv.DeleteMetrics(ctx, tt.req)
+			if tt.code != codes.OK {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				assert.Equal(t, tt.code, st.Code())
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, responce.Metrics, tt.deleted)
+		})
+	}
+
+	_, err := srv.storage.GetMetric(ctx, "gauge", "cpu;host=b")
+	assert.NoError(t, err)
+}
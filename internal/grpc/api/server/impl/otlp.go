@@ -0,0 +1,58 @@
+package impl
+
+import (
+	"context"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/otlp"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+// MetricsService - реализация сервиса OTLP MetricsService для приема метрик OpenTelemetry на gRPC сервере.
+type MetricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	storage   repositories.MetricsWriter
+	converter *otlp.Converter
+}
+
+// NewMetricsService - фабричная функция структуры MetricsService.
+func NewMetricsService(stor repositories.MetricsWriter, conv *otlp.Converter) *MetricsService {
+	return &MetricsService{
+		storage:   stor,
+		converter: conv,
+	}
+}
+
+// Export - gRPC метод для приема метрик OTLP. Точки, которые не удалось преобразовать, возвращаются клиенту
+// в частичном успехе, остальные метрики записываются в хранилище одним батчем. Состояние серий преобразования
+// сохраняется только после успешной записи.
+func (s *MetricsService) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	if s.storage == nil {
+		return nil, status.Error(codes.Internal, "storage not initialized")
+	}
+
+	metrics, partial, update := s.converter.Convert(req)
+	defer update.Discard()
+	if err := ratelimit.GetLimiter().CheckBatch(len(metrics)); err != nil {
+		logger.ServerGRPCLog.Info("batch quota exceeded", zap.String("error", error.Error(err)))
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if len(metrics) > 0 {
+		if err := s.storage.AddMetricsFromSlice(ctx, metrics); err != nil {
+			logger.ServerGRPCLog.Error("add otlp metrics error", zap.String("error", error.Error(err)))
+			return nil, storageError(err, "add otlp metrics error")
+		}
+	}
+	update.Commit()
+	if partial != nil {
+		logger.ServerGRPCLog.Info("otlp data points rejected", zap.Int64("count", partial.GetRejectedDataPoints()),
+			zap.String("error", partial.GetErrorMessage()))
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{PartialSuccess: partial}, nil
+}
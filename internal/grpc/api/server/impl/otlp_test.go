@@ -0,0 +1,65 @@
+package impl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/otlp"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestMetricsService_Export(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	srv := NewMetricsService(stor, otlp.NewConverter(otlp.Config{}))
+	defer ratelimit.SetLimits(ratelimit.Limits{})
+
+	request := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{Name: "cpu", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+				{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.5}}}}}},
+			{Name: "memory", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+				{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 10}}}}}},
+			{Name: "rpc", Data: &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+				DataPoints: []*metricspb.ExponentialHistogramDataPoint{{}}}}},
+		}}},
+	}}}
+
+	tests := []struct {
+		name     string
+		maxBatch int
+		code     codes.Code
+	}{
+		{name: "batch quota", maxBatch: 1, code: codes.ResourceExhausted},
+		{name: "export", code: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratelimit.SetLimits(ratelimit.Limits{MaxBatchMetrics: tt.maxBatch})
+			response, err := srv.Export(ctx, request)
+			if tt.code != codes.OK {
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				assert.Equal(t, tt.code, st.Code())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), response.GetPartialSuccess().GetRejectedDataPoints())
+		})
+	}
+
+	value, err := stor.GetMetric(ctx, "gauge", "memory")
+	require.NoError(t, err)
+	assert.Equal(t, "10", value)
+
+	_, err = NewMetricsService(nil, otlp.NewConverter(otlp.Config{})).Export(ctx, request)
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
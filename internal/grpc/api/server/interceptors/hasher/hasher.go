@@ -11,7 +11,6 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
-	"github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc/model"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	httpHasher "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hasher"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
@@ -47,7 +46,7 @@ func UnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInf
 	if req != nil {
 		// извлечение сообщения от сервера и проверка подписи
 		switch r := req.(type) {
-		case *model.AddMetricRequest:
+		case proto.Message:
 			ok, err := CheckHash(r, reqHashs[0], httpHasher.GetKey())
 			if err != nil {
 				logger.ServerLog.Error("checking hash error", zap.String("error: ", error.Error(err)))
@@ -71,7 +70,7 @@ func UnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInf
 
 	// Подписываю ответ сервера
 	switch r := resp.(type) {
-	case *model.AddMetricResponce:
+	case proto.Message:
 		// подписываю ответ сервера
 		hash, err := CalkHash(r, httpHasher.GetKey())
 		if err != nil {
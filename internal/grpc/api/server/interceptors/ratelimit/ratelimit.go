@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	httpRatelimit "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+// Ключи метаданных gRPC, аналогичные заголовкам HTTP.
+const (
+	AgentIDKey    = "x-agent-id"
+	RetryAfterKey = "retry-after"
+)
+
+// ClientIdentity - определяет идентификатор клиента: идентификатор агента из метаданных x-agent-id,
+// при его отсутствии - ip адрес клиента.
+func ClientIdentity(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(AgentIDKey); len(ids) > 0 && ids[0] != "" {
+			return "agent:" + ids[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "ip:" + host
+	}
+	return "unknown"
+}
+
+// UnaryServerInterceptor - перехватчик ограничения частоты вызовов методов от одного клиента.
+// При превышении лимита возвращает ошибку с кодом ResourceExhausted, деталями RetryInfo
+// и заголовком retry-after с количеством секунд до повтора. Идентификатор клиента сохраняется в контексте вызова.
+func UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	identity := ClientIdentity(ctx)
+	if ok, delay := httpRatelimit.GetLimiter().Allow(identity, info.FullMethod); !ok {
+		logger.ServerGRPCLog.Info("rate limit exceeded", zap.String("client", identity), zap.String("method", info.FullMethod),
+			zap.Duration("retry after", delay))
+
+		if err := grpc.SetHeader(ctx, metadata.Pairs(RetryAfterKey, strconv.Itoa(httpRatelimit.RetryAfterSeconds(delay)))); err != nil {
+			logger.ServerGRPCLog.Error("failed to set retry-after header", zap.String("error", error.Error(err)))
+		}
+		st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+			st = detailed
+		}
+		return nil, st.Err()
+	}
+
+	// вызываю основной обработчик, сохранив идентификатор клиента в контексте
+	return handler(httpRatelimit.WithClientIdentity(ctx, identity), req)
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/api/server/impl"
+	pb "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc"
+	pbModel "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc/model"
+	httpRatelimit "github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestClientIdentity(t *testing.T) {
+	assert.Equal(t, "unknown", ClientIdentity(context.Background()))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AgentIDKey, "host-1"))
+	assert.Equal(t, "agent:host-1", ClientIdentity(ctx))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	httpRatelimit.SetLimits(httpRatelimit.Limits{RPS: 0.1, Burst: 1})
+	defer httpRatelimit.SetLimits(httpRatelimit.Limits{})
+
+	// Запускаю сервер на свободном порту ----------------------------------------------------------
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor),
+	)
+	defer grpcServer.Stop()
+	pb.RegisterServiceServer(grpcServer, impl.NewServer(storage.NewDefaultMemStorage()))
+
+	go func(lis net.Listener) {
+		err := grpcServer.Serve(lis)
+		if err != nil {
+			log.Printf("server stoped with error %v", err)
+		}
+	}(lis)
+
+	// Запускаю клиента -------------------------------------------------------------------------
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewServiceClient(conn)
+
+	delta := int64(5)
+	req := &pbModel.AddMetricRequest{
+		Metric: &pbModel.Metric{
+			Id:    "counter",
+			Mtype: "counter",
+			Delta: &delta,
+		},
+	}
+	send := func(agentID string) (metadata.MD, error) {
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(context.Background(), AgentIDKey, agentID)
+		_, err := client.AddMetric(ctx, req, grpc.Header(&header))
+		return header, err
+	}
+
+	_, err = send("first")
+	require.NoError(t, err)
+
+	// второй вызов от того же агента превышает лимит
+	header, err := send("first")
+	require.Error(t, err)
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Equal(t, []string{"10"}, header.Get(RetryAfterKey))
+
+	var retryInfo *errdetails.RetryInfo
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			retryInfo = info
+		}
+	}
+	require.NotNil(t, retryInfo)
+	assert.InDelta(t, 10*time.Second, retryInfo.GetRetryDelay().AsDuration(), float64(time.Second))
+
+	// лимиты разных агентов независимы
+	_, err = send("second")
+	require.NoError(t, err)
+}
@@ -0,0 +1,106 @@
+// Package zstd регистрирует в gRPC компрессор zstd. Для использования достаточно импортировать пакет,
+// после чего компрессор доступен по имени Name как на сервере, так и на клиенте.
+package zstd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name - имя, под которым компрессор зарегистрирован в gRPC.
+const Name = "zstd"
+
+func init() {
+	c := &compressor{}
+	c.poolCompressor.New = newWriterFunc(c, zstd.SpeedDefault)
+	encoding.RegisterCompressor(c)
+}
+
+// compressor - реализация интерфейса encoding.Compressor с переиспользованием кодеков через sync.Pool.
+type compressor struct {
+	poolCompressor   sync.Pool
+	poolDecompressor sync.Pool
+}
+
+// writer - сжимающий writer, который возвращается в пул при закрытии.
+type writer struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+// reader - распаковывающий reader, который возвращается в пул по окончании чтения.
+type reader struct {
+	*zstd.Decoder
+	pool *sync.Pool
+}
+
+// newWriterFunc - возвращает функцию создания writer для пула с заданным уровнем сжатия.
+func newWriterFunc(c *compressor, level zstd.EncoderLevel) func() any {
+	return func() any {
+		// ошибка возможна только при некорректных опциях, которые задаются внутри пакета
+		w, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic(err)
+		}
+		return &writer{Encoder: w, pool: &c.poolCompressor}
+	}
+}
+
+// SetLevel - устанавливает уровень сжатия зарегистрированного компрессора в шкале zstd (1..22).
+// Функцию необходимо вызывать на этапе инициализации, до начала отправки сообщений, она не потокобезопасна.
+func SetLevel(level int) error {
+	if level < 1 || level > 22 {
+		return fmt.Errorf("grpc: invalid zstd compression level: %d", level)
+	}
+	c := encoding.GetCompressor(Name).(*compressor)
+	c.poolCompressor.New = newWriterFunc(c, zstd.EncoderLevelFromZstd(level))
+	return nil
+}
+
+// Compress - возвращает writer, сжимающий данные в w.
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	z := c.poolCompressor.Get().(*writer)
+	z.Encoder.Reset(w)
+	return z, nil
+}
+
+// Close - завершает сжатие и возвращает writer в пул.
+func (z *writer) Close() error {
+	defer z.pool.Put(z)
+	return z.Encoder.Close()
+}
+
+// Decompress - возвращает reader, распаковывающий данные из r.
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	z, inPool := c.poolDecompressor.Get().(*reader)
+	if !inPool {
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &reader{Decoder: d, pool: &c.poolDecompressor}, nil
+	}
+	if err := z.Decoder.Reset(r); err != nil {
+		c.poolDecompressor.Put(z)
+		return nil, err
+	}
+	return z, nil
+}
+
+// Read - читает распакованные данные, по окончании потока reader возвращается в пул.
+func (z *reader) Read(p []byte) (n int, err error) {
+	n, err = z.Decoder.Read(p)
+	if err == io.EOF {
+		z.pool.Put(z)
+	}
+	return n, err
+}
+
+// Name - возвращает имя компрессора.
+func (c *compressor) Name() string {
+	return Name
+}
@@ -0,0 +1,52 @@
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/encoding"
+)
+
+func TestCompressor(t *testing.T) {
+	c := encoding.GetCompressor(Name)
+	require.NotNil(t, c)
+	assert.Equal(t, Name, c.Name())
+
+	roundTrip := func(data []byte) []byte {
+		var b bytes.Buffer
+		w, err := c.Compress(&b)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		r, err := c.Decompress(&b)
+		require.NoError(t, err)
+		res, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return res
+	}
+
+	// несколько итераций для проверки переиспользования кодеков из пула
+	for i := 0; i < 3; i++ {
+		data := bytes.Repeat([]byte("metric data "), 100*(i+1))
+		assert.Equal(t, data, roundTrip(data))
+	}
+
+	// изменение уровня сжатия
+	require.Error(t, SetLevel(0))
+	require.Error(t, SetLevel(23))
+	require.NoError(t, SetLevel(9))
+	data := []byte("metric data with custom level")
+	assert.Equal(t, data, roundTrip(data))
+
+	// распаковка некорректных данных
+	r, err := c.Decompress(bytes.NewReader([]byte("not compressed data")))
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	require.Error(t, err)
+}
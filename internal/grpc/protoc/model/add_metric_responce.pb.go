@@ -1,17 +1,16 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.35.2
+// 	protoc-gen-go v1.36.1
 // 	protoc        v3.21.12
 // source: model/add_metric_responce.proto
 
 package model
 
 import (
-	reflect "reflect"
-	sync "sync"
-
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
 )
 
 const (
@@ -22,12 +21,11 @@ const (
 )
 
 type AddMetricResponce struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metric        *Metric                `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`
+	Error         *string                `protobuf:"bytes,2,opt,name=error,proto3,oneof" json:"error,omitempty"` // ошибка
 	unknownFields protoimpl.UnknownFields
-
-	Metric *Metric `protobuf:"bytes,1,opt,name=metric,proto3" json:"metric,omitempty"`
-	Error  *string `protobuf:"bytes,2,opt,name=error,proto3,oneof" json:"error,omitempty"` // ошибка
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *AddMetricResponce) Reset() {
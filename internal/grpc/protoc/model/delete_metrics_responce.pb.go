@@ -0,0 +1,140 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.1
+// 	protoc        v3.21.12
+// source: model/delete_metrics_responce.proto
+
+package model
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DeleteMetricsResponce struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"` // удаленные метрики
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteMetricsResponce) Reset() {
+	*x = DeleteMetricsResponce{}
+	mi := &file_model_delete_metrics_responce_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMetricsResponce) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMetricsResponce) ProtoMessage() {}
+
+func (x *DeleteMetricsResponce) ProtoReflect() protoreflect.Message {
+	mi := &file_model_delete_metrics_responce_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMetricsResponce.ProtoReflect.Descriptor instead.
+func (*DeleteMetricsResponce) Descriptor() ([]byte, []int) {
+	return file_model_delete_metrics_responce_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DeleteMetricsResponce) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+var File_model_delete_metrics_responce_proto protoreflect.FileDescriptor
+
+var file_model_delete_metrics_responce_proto_rawDesc = []byte{
+	0x0a, 0x23, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x2f, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x5f, 0x6d,
+	0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x63, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x26, 0x67, 0x6f, 0x2e, 0x6d, 0x75, 0x73, 0x74, 0x68, 0x61,
+	0x76, 0x65, 0x2e, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x2e,
+	0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x1a, 0x12, 0x6d,
+	0x6f, 0x64, 0x65, 0x6c, 0x2f, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x22, 0x61, 0x0a, 0x15, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x4d, 0x65, 0x74, 0x72, 0x69,
+	0x63, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x63, 0x65, 0x12, 0x48, 0x0a, 0x07, 0x6d, 0x65,
+	0x74, 0x72, 0x69, 0x63, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2e, 0x2e, 0x67, 0x6f,
+	0x2e, 0x6d, 0x75, 0x73, 0x74, 0x68, 0x61, 0x76, 0x65, 0x2e, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63,
+	0x73, 0x2e, 0x67, 0x72, 0x70, 0x63, 0x2e, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x6d,
+	0x6f, 0x64, 0x65, 0x6c, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x52, 0x07, 0x6d, 0x65, 0x74,
+	0x72, 0x69, 0x63, 0x73, 0x42, 0x4a, 0x5a, 0x48, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
+	0x6f, 0x6d, 0x2f, 0x41, 0x6e, 0x74, 0x6f, 0x6e, 0x42, 0x65, 0x7a, 0x65, 0x6d, 0x73, 0x6b, 0x69,
+	0x79, 0x2f, 0x67, 0x6f, 0x2d, 0x6d, 0x75, 0x73, 0x74, 0x68, 0x61, 0x76, 0x65, 0x2d, 0x6d, 0x65,
+	0x74, 0x72, 0x69, 0x63, 0x73, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x67,
+	0x72, 0x70, 0x63, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x2f, 0x6d, 0x6f, 0x64, 0x65, 0x6c,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_model_delete_metrics_responce_proto_rawDescOnce sync.Once
+	file_model_delete_metrics_responce_proto_rawDescData = file_model_delete_metrics_responce_proto_rawDesc
+)
+
+func file_model_delete_metrics_responce_proto_rawDescGZIP() []byte {
+	file_model_delete_metrics_responce_proto_rawDescOnce.Do(func() {
+		file_model_delete_metrics_responce_proto_rawDescData = protoimpl.X.CompressGZIP(file_model_delete_metrics_responce_proto_rawDescData)
+	})
+	return file_model_delete_metrics_responce_proto_rawDescData
+}
+
+var file_model_delete_metrics_responce_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_model_delete_metrics_responce_proto_goTypes = []any{
+	(*DeleteMetricsResponce)(nil), // 0: go.musthave.metrics.grpc.service.model.DeleteMetricsResponce
+	(*Metric)(nil),                // 1: go.musthave.metrics.grpc.service.model.Metric
+}
+var file_model_delete_metrics_responce_proto_depIdxs = []int32{
+	1, // 0: go.musthave.metrics.grpc.service.model.DeleteMetricsResponce.metrics:type_name -> go.musthave.metrics.grpc.service.model.Metric
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_model_delete_metrics_responce_proto_init() }
+func file_model_delete_metrics_responce_proto_init() {
+	if File_model_delete_metrics_responce_proto != nil {
+		return
+	}
+	file_model_metric_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_model_delete_metrics_responce_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_model_delete_metrics_responce_proto_goTypes,
+		DependencyIndexes: file_model_delete_metrics_responce_proto_depIdxs,
+		MessageInfos:      file_model_delete_metrics_responce_proto_msgTypes,
+	}.Build()
+	File_model_delete_metrics_responce_proto = out.File
+	file_model_delete_metrics_responce_proto_rawDesc = nil
+	file_model_delete_metrics_responce_proto_goTypes = nil
+	file_model_delete_metrics_responce_proto_depIdxs = nil
+}
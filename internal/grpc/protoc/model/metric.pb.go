@@ -1,17 +1,16 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.35.2
+// 	protoc-gen-go v1.36.1
 // 	protoc        v3.21.12
 // source: model/metric.proto
 
 package model
 
 import (
-	reflect "reflect"
-	sync "sync"
-
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
 )
 
 const (
@@ -22,14 +21,13 @@ const (
 )
 
 type Metric struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`                // имя метрики
+	Mtype         string                 `protobuf:"bytes,2,opt,name=mtype,proto3" json:"mtype,omitempty"`          // параметр, принимающий значение gauge или counter
+	Delta         *int64                 `protobuf:"zigzag64,3,opt,name=delta,proto3,oneof" json:"delta,omitempty"` // значение метрики в случае передачи метрики типа counter
+	Value         *float64               `protobuf:"fixed64,4,opt,name=value,proto3,oneof" json:"value,omitempty"`  // значение метрики в случае передачи метрики типа gauge
 	unknownFields protoimpl.UnknownFields
-
-	Id    string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`                // имя метрики
-	Mtype string   `protobuf:"bytes,2,opt,name=mtype,proto3" json:"mtype,omitempty"`          // параметр, принимающий значение gauge или counter
-	Delta *int64   `protobuf:"zigzag64,3,opt,name=delta,proto3,oneof" json:"delta,omitempty"` // значение метрики в случае передачи метрики типа counter
-	Value *float64 `protobuf:"fixed64,4,opt,name=value,proto3,oneof" json:"value,omitempty"`  // значение метрики в случае передачи метрики типа gauge
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Metric) Reset() {
@@ -8,12 +8,10 @@ package protoc
 
 import (
 	context "context"
-
+	model "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc/model"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
-
-	model "github.com/AntonBezemskiy/go-musthave-metrics/internal/grpc/protoc/model"
 )
 
 // This is a compile-time assertion to ensure that this generated file
@@ -22,7 +20,8 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Service_AddMetric_FullMethodName = "/go.musthave.metrics.grpc.service.Service/AddMetric"
+	Service_AddMetric_FullMethodName     = "/go.musthave.metrics.grpc.service.Service/AddMetric"
+	Service_DeleteMetrics_FullMethodName = "/go.musthave.metrics.grpc.service.Service/DeleteMetrics"
 )
 
 // ServiceClient is the client API for Service service.
@@ -30,6 +29,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type ServiceClient interface {
 	AddMetric(ctx context.Context, in *model.AddMetricRequest, opts ...grpc.CallOption) (*model.AddMetricResponce, error)
+	DeleteMetrics(ctx context.Context, in *model.DeleteMetricsRequest, opts ...grpc.CallOption) (*model.DeleteMetricsResponce, error)
 }
 
 type serviceClient struct {
@@ -50,11 +50,22 @@ func (c *serviceClient) AddMetric(ctx context.Context, in *model.AddMetricReques
 	return out, nil
 }
 
+func (c *serviceClient) DeleteMetrics(ctx context.Context, in *model.DeleteMetricsRequest, opts ...grpc.CallOption) (*model.DeleteMetricsResponce, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(model.DeleteMetricsResponce)
+	err := c.cc.Invoke(ctx, Service_DeleteMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ServiceServer is the server API for Service service.
 // All implementations must embed UnimplementedServiceServer
 // for forward compatibility.
 type ServiceServer interface {
 	AddMetric(context.Context, *model.AddMetricRequest) (*model.AddMetricResponce, error)
+	DeleteMetrics(context.Context, *model.DeleteMetricsRequest) (*model.DeleteMetricsResponce, error)
 	mustEmbedUnimplementedServiceServer()
 }
 
@@ -68,6 +79,9 @@ type UnimplementedServiceServer struct{}
 func (UnimplementedServiceServer) AddMetric(context.Context, *model.AddMetricRequest) (*model.AddMetricResponce, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method AddMetric not implemented")
 }
+func (UnimplementedServiceServer) DeleteMetrics(context.Context, *model.DeleteMetricsRequest) (*model.DeleteMetricsResponce, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetrics not implemented")
+}
 func (UnimplementedServiceServer) mustEmbedUnimplementedServiceServer() {}
 func (UnimplementedServiceServer) testEmbeddedByValue()                 {}
 
@@ -107,6 +121,24 @@ func _Service_AddMetric_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Service_DeleteMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(model.DeleteMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ServiceServer).DeleteMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Service_DeleteMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ServiceServer).DeleteMetrics(ctx, req.(*model.DeleteMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Service_ServiceDesc is the grpc.ServiceDesc for Service service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -118,6 +150,10 @@ var Service_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "AddMetric",
 			Handler:    _Service_AddMetric_Handler,
 		},
+		{
+			MethodName: "DeleteMetrics",
+			Handler:    _Service_DeleteMetrics_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "server.proto",
@@ -0,0 +1,205 @@
+// Package migrate переносит метрики между хранилищами сервера: все метрики исходного хранилища
+// читаются через repositories.MetricsReader и записываются в целевое хранилище одним вызовом
+// AddMetricsFromSlice, после чего содержимое целевого хранилища сверяется с ожидаемым.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Mode - способ переноса значений метрик типа counter. Метрики типа gauge всегда заменяются значением
+// из исходного хранилища.
+type Mode string
+
+const (
+	// ModeMerge - значения counter исходного хранилища прибавляются к значениям целевого.
+	ModeMerge Mode = "merge"
+	// ModeOverwrite - значения counter целевого хранилища заменяются значениями исходного.
+	ModeOverwrite Mode = "overwrite"
+)
+
+// ParseMode - возвращает способ переноса по названию.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case ModeMerge, ModeOverwrite:
+		return Mode(s), nil
+	default:
+		return "", fmt.Errorf("unknown migration mode %q, allowed modes: %s, %s", s, ModeMerge, ModeOverwrite)
+	}
+}
+
+// Options - параметры переноса метрик.
+type Options struct {
+	Mode   Mode // способ переноса значений counter
+	DryRun bool // только рассчитать результат переноса, не записывая метрики
+	Verify bool // сверить содержимое целевого хранилища с ожидаемым после записи
+}
+
+// Target - целевое хранилище метрик.
+type Target interface {
+	repositories.MetricsReader
+	repositories.MetricsWriter
+}
+
+// Mismatch - расхождение значения метрики в целевом хранилище с ожидаемым.
+type Mismatch struct {
+	ID    string // имя метрики
+	MType string // тип метрики
+	Want  string // ожидаемое значение
+	Got   string // значение в целевом хранилище, пустое, если метрики нет
+}
+
+// Report - результат переноса метрик.
+type Report struct {
+	Read       int                    // количество метрик, прочитанных из исходного хранилища
+	Created    int                    // количество метрик, отсутствовавших в целевом хранилище
+	Updated    int                    // количество метрик, уже существовавших в целевом хранилище
+	Conflicts  []string               // имена метрик, занятые в целевом хранилище метриками другого типа
+	Written    []repositories.Metric  // метрики, записанные (или записываемые при DryRun) в целевое хранилище
+	Mismatches []Mismatch             // расхождения, найденные при сверке
+	expected   map[string]metricValue // ожидаемые значения метрик в целевом хранилище
+}
+
+// metricValue - тип и значение метрики в строковом представлении.
+type metricValue struct {
+	mtype string
+	value string
+}
+
+// format - возвращает тип и значение метрики в строковом представлении.
+func format(metric repositories.Metric) metricValue {
+	if metric.MType == "gauge" && metric.Value != nil {
+		return metricValue{mtype: metric.MType, value: fmt.Sprintf("%g", *metric.Value)}
+	}
+	if metric.MType == "counter" && metric.Delta != nil {
+		return metricValue{mtype: metric.MType, value: fmt.Sprintf("%d", *metric.Delta)}
+	}
+	return metricValue{mtype: metric.MType}
+}
+
+// Migrate - переносит все метрики из хранилища src в хранилище dst. Если имя метрики исходного хранилища
+// занято в целевом метрикой другого типа, метрики не записываются и возвращается ошибка конфликта типов.
+// Сверка выполняется чтением целевого хранилища после записи, поэтому запись в него других клиентов
+// во время переноса приводит к расхождениям.
+func Migrate(ctx context.Context, src repositories.MetricsReader, dst Target, opts Options) (Report, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeMerge
+	}
+	if _, err := ParseMode(string(opts.Mode)); err != nil {
+		return Report{}, err
+	}
+
+	source, err := src.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("read source metrics error: %w", err)
+	}
+	before, err := dst.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return Report{}, fmt.Errorf("read target metrics error: %w", err)
+	}
+	stored := make(map[string]repositories.Metric, len(before))
+	for _, metric := range before {
+		stored[metric.ID] = metric
+	}
+
+	report := Report{
+		Read:     len(source),
+		Written:  make([]repositories.Metric, 0, len(source)),
+		expected: make(map[string]metricValue, len(source)),
+	}
+	sort.Slice(source, func(i, j int) bool { return source[i].ID < source[j].ID })
+	for _, metric := range source {
+		prev, ok := stored[metric.ID]
+		if !ok {
+			report.Created++
+		} else if prev.MType != metric.MType {
+			report.Conflicts = append(report.Conflicts, metric.ID)
+			continue
+		} else {
+			report.Updated++
+		}
+		written, expected := plan(metric, prev, ok, opts.Mode)
+		report.Written = append(report.Written, written)
+		report.expected[metric.ID] = format(expected)
+	}
+	if len(report.Conflicts) > 0 {
+		first := report.Conflicts[0]
+		return report, fmt.Errorf("%d metrics conflict with target: %w", len(report.Conflicts),
+			repositories.TypeConflictError(first, otherType(stored[first].MType), stored[first].MType))
+	}
+	if opts.DryRun || len(report.Written) == 0 {
+		return report, nil
+	}
+
+	if err := dst.AddMetricsFromSlice(ctx, report.Written); err != nil {
+		return report, fmt.Errorf("write target metrics error: %w", err)
+	}
+	if opts.Verify {
+		mismatches, err := verify(ctx, dst, report.expected)
+		if err != nil {
+			return report, err
+		}
+		report.Mismatches = mismatches
+		if len(mismatches) > 0 {
+			return report, fmt.Errorf("verification found %d mismatched metrics", len(mismatches))
+		}
+	}
+	return report, nil
+}
+
+// plan - возвращает метрику для записи в целевое хранилище и ожидаемое значение метрики после записи.
+// prev - метрика целевого хранилища, exists - существует ли она.
+func plan(metric, prev repositories.Metric, exists bool, mode Mode) (written, expected repositories.Metric) {
+	if metric.MType != "counter" || metric.Delta == nil || !exists || prev.Delta == nil {
+		return metric, metric
+	}
+	if mode == ModeOverwrite {
+		// значение counter увеличивается при записи, поэтому записывается разница значений
+		delta := *metric.Delta - *prev.Delta
+		return repositories.Metric{ID: metric.ID, MType: metric.MType, Delta: &delta}, metric
+	}
+	sum := *prev.Delta + *metric.Delta
+	return metric, repositories.Metric{ID: metric.ID, MType: metric.MType, Delta: &sum}
+}
+
+// verify - сверяет метрики целевого хранилища с ожидаемыми значениями.
+func verify(ctx context.Context, dst repositories.MetricsReader, expected map[string]metricValue) ([]Mismatch, error) {
+	after, err := dst.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read target metrics for verification error: %w", err)
+	}
+	actual := make(map[string]metricValue, len(after))
+	for _, metric := range after {
+		actual[metric.ID] = format(metric)
+	}
+
+	mismatches := make([]Mismatch, 0)
+	for id, want := range expected {
+		got, ok := actual[id]
+		if ok && got == want {
+			continue
+		}
+		mismatch := Mismatch{ID: id, MType: want.mtype, Want: want.value}
+		if ok {
+			mismatch.Got = got.value
+			if got.mtype != want.mtype {
+				mismatch.Got = got.mtype + " " + got.value
+			}
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].ID < mismatches[j].ID })
+	return mismatches, nil
+}
+
+// otherType - возвращает тип метрики, отличный от mtype.
+func otherType(mtype string) string {
+	if mtype == "counter" {
+		return "gauge"
+	}
+	return "counter"
+}
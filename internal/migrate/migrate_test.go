@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// lossyStorage - хранилище, теряющее записанные метрики.
+type lossyStorage struct {
+	*storage.MemStorage
+}
+
+func (s lossyStorage) AddMetricsFromSlice(_ context.Context, _ []repositories.Metric) error {
+	return nil
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("overwrite")
+	require.NoError(t, err)
+	assert.Equal(t, ModeOverwrite, mode)
+	_, err = ParseMode("replace")
+	assert.Error(t, err)
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     Mode
+		dryRun   bool
+		wantTemp string
+		wantReqs string
+	}{
+		{name: "merge", mode: ModeMerge, wantTemp: "36.6", wantReqs: "15"},
+		{name: "overwrite", mode: ModeOverwrite, wantTemp: "36.6", wantReqs: "10"},
+		{name: "default mode", wantTemp: "36.6", wantReqs: "15"},
+		{name: "dry run", mode: ModeMerge, dryRun: true, wantTemp: "1", wantReqs: "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			src := storage.NewMemStorage(map[string]float64{"temp": 36.6, "load": 0.5}, map[string]int64{"requests": 10})
+			dst := storage.NewMemStorage(map[string]float64{"temp": 1}, map[string]int64{"requests": 5})
+
+			report, err := Migrate(ctx, src, dst, Options{Mode: tt.mode, DryRun: tt.dryRun, Verify: true})
+			require.NoError(t, err)
+			assert.Equal(t, 3, report.Read)
+			assert.Equal(t, 1, report.Created)
+			assert.Equal(t, 2, report.Updated)
+			assert.Len(t, report.Written, 3)
+			assert.Empty(t, report.Mismatches)
+
+			temp, err := dst.GetMetric(ctx, "gauge", "temp")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTemp, temp)
+			requests, err := dst.GetMetric(ctx, "counter", "requests")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantReqs, requests)
+		})
+	}
+}
+
+func TestMigrateConflict(t *testing.T) {
+	ctx := context.Background()
+	src := storage.NewMemStorage(map[string]float64{"temp": 1, "load": 2}, map[string]int64{})
+	dst := storage.NewMemStorage(map[string]float64{}, map[string]int64{"temp": 5})
+
+	report, err := Migrate(ctx, src, dst, Options{Mode: ModeMerge})
+	assert.True(t, errors.Is(err, repositories.ErrTypeConflict))
+	assert.Equal(t, []string{"temp"}, report.Conflicts)
+
+	// при конфликте не записывается ни одна метрика
+	metrics, err := dst.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 1)
+}
+
+func TestMigrateVerify(t *testing.T) {
+	ctx := context.Background()
+	src := storage.NewMemStorage(map[string]float64{"temp": 1}, map[string]int64{"requests": 3})
+	dst := lossyStorage{MemStorage: storage.NewMemStorage(map[string]float64{}, map[string]int64{"requests": 1})}
+
+	report, err := Migrate(ctx, src, dst, Options{Mode: ModeOverwrite, Verify: true})
+	assert.Error(t, err)
+	assert.Equal(t, []Mismatch{
+		{ID: "requests", MType: "counter", Want: "3", Got: "1"},
+		{ID: "temp", MType: "gauge", Want: "1"},
+	}, report.Mismatches)
+}
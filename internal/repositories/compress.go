@@ -2,23 +2,168 @@ package repositories
 
 import (
 	"compress/gzip"
+	"fmt"
 	"io"
 	"net/http"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Поддерживаемые алгоритмы сжатия в виде значений заголовков Content-Encoding и Accept-Encoding.
+const (
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+)
+
+// NewEncoder - создает io.WriteCloser, сжимающий данные алгоритмом encoding с уровнем сжатия level.
+// Нулевой уровень означает уровень сжатия по умолчанию для выбранного алгоритма.
+func NewEncoder(w io.Writer, encoding string, level int) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case EncodingZstd:
+		encoderLevel := zstd.SpeedDefault
+		if level != 0 {
+			encoderLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		return getZstdEncoder(w, encoderLevel)
+	case EncodingBrotli:
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+// NewDecoder - создает io.ReadCloser, распаковывающий данные, сжатые алгоритмом encoding.
+func NewDecoder(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingZstd:
+		return getZstdDecoder(r)
+	case EncodingBrotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+// Пулы кодеков zstd. Кодек zstd с параллелизмом по умолчанию запускает GOMAXPROCS горутин и выделяет
+// крупные буферы, поэтому кодеки переиспользуются между запросами и работают в одной горутине.
+var (
+	zstdEncoders [zstd.SpeedBestCompression + 1]sync.Pool // пулы сжимающих кодеков по уровню сжатия
+	zstdDecoders sync.Pool
 )
 
+// zstdEncoder - сжимающий кодек zstd, который возвращается в пул при закрытии.
+type zstdEncoder struct {
+	*zstd.Encoder
+	pool   *sync.Pool
+	closed bool
+}
+
+// getZstdEncoder - возвращает из пула сжимающий кодек zstd с уровнем сжатия level, пишущий в w.
+func getZstdEncoder(w io.Writer, level zstd.EncoderLevel) (*zstdEncoder, error) {
+	pool := &zstdEncoders[level]
+	if z, ok := pool.Get().(*zstdEncoder); ok {
+		z.Encoder.Reset(w)
+		z.closed = false
+		return z, nil
+	}
+	enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdEncoder{Encoder: enc, pool: pool}, nil
+}
+
+// Close - завершает сжатие и возвращает кодек в пул. Повторное закрытие ничего не делает.
+func (z *zstdEncoder) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	err := z.Encoder.Close()
+	// кодек не должен удерживать writer запроса, пока лежит в пуле
+	z.Encoder.Reset(nil)
+	z.pool.Put(z)
+	return err
+}
+
+// zstdDecoder - распаковывающий кодек zstd, который возвращается в пул при закрытии.
+type zstdDecoder struct {
+	*zstd.Decoder
+	closed bool
+}
+
+// getZstdDecoder - возвращает из пула распаковывающий кодек zstd, читающий из r.
+func getZstdDecoder(r io.Reader) (*zstdDecoder, error) {
+	z, ok := zstdDecoders.Get().(*zstdDecoder)
+	if !ok {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		z = &zstdDecoder{Decoder: dec}
+	}
+	if err := z.Decoder.Reset(r); err != nil {
+		zstdDecoders.Put(z)
+		return nil, err
+	}
+	z.closed = false
+	return z, nil
+}
+
+// Close - возвращает кодек в пул. Кодек не закрывается, чтобы его можно было переиспользовать.
+func (z *zstdDecoder) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	// Reset(nil) освобождает источник данных и не возвращает ошибку
+	_ = z.Decoder.Reset(nil)
+	zstdDecoders.Put(z)
+	return nil
+}
+
 // CompressWriter реализует интерфейс http.ResponseWriter и позволяет прозрачно для сервера
 // сжимать передаваемые данные и выставлять правильные HTTP-заголовки.
 type CompressWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	w        http.ResponseWriter
+	zw       io.WriteCloser
+	encoding string
 }
 
-// NewCompressWriter - фабричная функция для создания структуры CompressWriter.
+// NewCompressWriter - фабричная функция для создания структуры CompressWriter, сжимающей данные в формате gzip.
 func NewCompressWriter(w http.ResponseWriter) *CompressWriter {
 	return &CompressWriter{
-		w:  w,
-		zw: gzip.NewWriter(w),
+		w:        w,
+		zw:       gzip.NewWriter(w),
+		encoding: EncodingGzip,
+	}
+}
+
+// NewEncodingCompressWriter - фабричная функция для создания структуры CompressWriter, сжимающей данные
+// алгоритмом encoding.
+func NewEncodingCompressWriter(w http.ResponseWriter, encoding string, level int) (*CompressWriter, error) {
+	zw, err := NewEncoder(w, encoding, level)
+	if err != nil {
+		return nil, err
 	}
+	return &CompressWriter{
+		w:        w,
+		zw:       zw,
+		encoding: encoding,
+	}, nil
 }
 
 // Header - установка заголовка.
@@ -30,7 +175,7 @@ func (c *CompressWriter) Header() http.Header {
 func (c *CompressWriter) Write(p []byte) (int, error) {
 	// Устанавливаю заголовок о том, что данные сжаты, в основном на случай, когда в теле ответа будет содержаться ошибка
 	// и агенту нужно будет корректно распаковать полученное от сервера тело с ошибкой
-	c.w.Header().Set("Content-Encoding", "gzip")
+	c.w.Header().Set("Content-Encoding", c.encoding)
 
 	return c.zw.Write(p)
 }
@@ -39,12 +184,12 @@ func (c *CompressWriter) Write(p []byte) (int, error) {
 func (c *CompressWriter) WriteHeader(statusCode int) {
 	// Устанавливаю заголовок о том, что данные сжаты, в основном на случай, когда в теле ответа будет содержаться ошибка
 	// и агенту нужно будет корректно распаковать полученное от сервера тело с ошибкой
-	c.w.Header().Set("Content-Encoding", "gzip")
+	c.w.Header().Set("Content-Encoding", c.encoding)
 
 	c.w.WriteHeader(statusCode)
 }
 
-// Close закрывает gzip.Writer и досылает все данные из буфера.
+// Close закрывает сжимающий writer и досылает все данные из буфера.
 func (c *CompressWriter) Close() error {
 	return c.zw.Close()
 }
@@ -53,12 +198,18 @@ func (c *CompressWriter) Close() error {
 // декомпрессировать получаемые от клиента данные.
 type CompressReader struct {
 	r  io.ReadCloser
-	zr *gzip.Reader
+	zr io.ReadCloser
 }
 
-// NewCompressReader - фабричная функци для создания структуры CompressReader.
+// NewCompressReader - фабричная функци для создания структуры CompressReader, распаковывающей данные в формате gzip.
 func NewCompressReader(r io.ReadCloser) (*CompressReader, error) {
-	zr, err := gzip.NewReader(r)
+	return NewEncodingCompressReader(r, EncodingGzip)
+}
+
+// NewEncodingCompressReader - фабричная функци для создания структуры CompressReader, распаковывающей данные,
+// сжатые алгоритмом encoding.
+func NewEncodingCompressReader(r io.ReadCloser, encoding string) (*CompressReader, error) {
+	zr, err := NewDecoder(r, encoding)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +225,7 @@ func (c CompressReader) Read(p []byte) (n int, err error) {
 	return c.zr.Read(p)
 }
 
-// Close - обертка над gzip.Reader_Close.
+// Close - закрывает исходный поток и распаковщик.
 func (c *CompressReader) Close() error {
 	if err := c.r.Close(); err != nil {
 		return err
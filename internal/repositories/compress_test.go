@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncoderDecoder(t *testing.T) {
+	data := []byte(strings.Repeat(`{"id":"Alloc","type":"gauge","value":1.5}`, 100))
+	tests := []struct {
+		name     string
+		encoding string
+		level    int
+	}{
+		{name: "gzip", encoding: EncodingGzip},
+		{name: "zstd", encoding: EncodingZstd},
+		{name: "zstd best compression", encoding: EncodingZstd, level: 19},
+		{name: "brotli", encoding: EncodingBrotli, level: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// кодеки из пула переиспользуются, поэтому каждое следующее сжатие должно давать тот же результат
+			for i := 0; i < 3; i++ {
+				var buf bytes.Buffer
+				w, err := NewEncoder(&buf, tt.encoding, tt.level)
+				require.NoError(t, err)
+				_, err = w.Write(data)
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+
+				r, err := NewDecoder(&buf, tt.encoding)
+				require.NoError(t, err)
+				got, err := io.ReadAll(r)
+				require.NoError(t, err)
+				require.NoError(t, r.Close())
+				assert.Equal(t, data, got)
+			}
+		})
+	}
+
+	_, err := NewEncoder(io.Discard, "deflate", 0)
+	assert.Error(t, err)
+	_, err = NewDecoder(strings.NewReader(""), "deflate")
+	assert.Error(t, err)
+}
+
+func TestZstdPoolDoubleClose(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewEncoder(&buf, EncodingZstd, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	// повторное закрытие не должно второй раз возвращать кодек в пул
+	require.NoError(t, w.Close())
+	first, err := NewEncoder(io.Discard, EncodingZstd, 0)
+	require.NoError(t, err)
+	second, err := NewEncoder(io.Discard, EncodingZstd, 0)
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+
+	r, err := NewDecoder(bytes.NewReader(buf.Bytes()), EncodingZstd)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Close())
+	firstReader, err := NewDecoder(bytes.NewReader(buf.Bytes()), EncodingZstd)
+	require.NoError(t, err)
+	secondReader, err := NewDecoder(bytes.NewReader(buf.Bytes()), EncodingZstd)
+	require.NoError(t, err)
+	assert.NotSame(t, firstReader, secondReader)
+}
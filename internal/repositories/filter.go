@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"strings"
+)
+
+// ParseName - разбирает имя метрики в формате Graphite "name;key=value;key2=value2" на базовое имя и метки.
+// Части имени без знака '=' не считаются метками и игнорируются.
+func ParseName(id string) (string, map[string]string) {
+	name, tags, found := strings.Cut(id, ";")
+	if !found {
+		return id, nil
+	}
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(tags, ";") {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			continue
+		}
+		labels[key] = value
+	}
+	return name, labels
+}
+
+// MetricFilter - условия отбора метрик. Пустые поля не участвуют в отборе.
+type MetricFilter struct {
+	MType  string            // тип метрики: gauge или counter
+	ID     string            // точное имя метрики
+	Prefix string            // префикс имени метрики
+	Labels map[string]string // метки, которые должна содержать метрика
+}
+
+// Empty - проверяет, что фильтр не содержит условий отбора по имени и меткам.
+func (f MetricFilter) Empty() bool {
+	return f.ID == "" && f.Prefix == "" && len(f.Labels) == 0
+}
+
+// Match - проверяет, удовлетворяет ли метрика условиям отбора.
+func (f MetricFilter) Match(mtype, id string) bool {
+	if f.MType != "" && f.MType != mtype {
+		return false
+	}
+	if f.ID != "" && f.ID != id {
+		return false
+	}
+	if f.Prefix != "" && !strings.HasPrefix(id, f.Prefix) {
+		return false
+	}
+	if len(f.Labels) > 0 {
+		_, labels := ParseName(id)
+		for key, value := range f.Labels {
+			if v, ok := labels[key]; !ok || v != value {
+				return false
+			}
+		}
+	}
+	return true
+}
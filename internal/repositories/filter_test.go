@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		wantName   string
+		wantLabels map[string]string
+	}{
+		{
+			name:     "without labels",
+			id:       "Alloc",
+			wantName: "Alloc",
+		},
+		{
+			name:       "with labels",
+			id:         "cpu;host=a;dc=eu",
+			wantName:   "cpu",
+			wantLabels: map[string]string{"host": "a", "dc": "eu"},
+		},
+		{
+			name:       "parts without value are ignored",
+			id:         "cpu;host=a;raw;=b",
+			wantName:   "cpu",
+			wantLabels: map[string]string{"host": "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotName, gotLabels := ParseName(tt.id)
+			assert.Equal(t, tt.wantName, gotName)
+			if tt.wantLabels == nil {
+				assert.Empty(t, gotLabels)
+				return
+			}
+			assert.Equal(t, tt.wantLabels, gotLabels)
+		})
+	}
+}
+
+func TestMetricFilter(t *testing.T) {
+	assert.True(t, MetricFilter{}.Empty())
+	assert.True(t, MetricFilter{MType: "gauge"}.Empty())
+	assert.False(t, MetricFilter{Prefix: "cpu"}.Empty())
+
+	tests := []struct {
+		name   string
+		filter MetricFilter
+		mtype  string
+		id     string
+		want   bool
+	}{
+		{name: "exact name", filter: MetricFilter{ID: "Alloc"}, mtype: "gauge", id: "Alloc", want: true},
+		{name: "other name", filter: MetricFilter{ID: "Alloc"}, mtype: "gauge", id: "Alloc2", want: false},
+		{name: "other type", filter: MetricFilter{MType: "counter", ID: "Alloc"}, mtype: "gauge", id: "Alloc", want: false},
+		{name: "prefix", filter: MetricFilter{Prefix: "cpu"}, mtype: "gauge", id: "cpu;host=a", want: true},
+		{name: "other prefix", filter: MetricFilter{Prefix: "mem"}, mtype: "gauge", id: "cpu;host=a", want: false},
+		{name: "label", filter: MetricFilter{Labels: map[string]string{"host": "a"}}, mtype: "counter", id: "cpu;host=a;dc=eu", want: true},
+		{name: "other label value", filter: MetricFilter{Labels: map[string]string{"host": "b"}}, mtype: "counter", id: "cpu;host=a", want: false},
+		{name: "missing label", filter: MetricFilter{Labels: map[string]string{"dc": "eu"}}, mtype: "counter", id: "cpu;host=a", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(tt.mtype, tt.id))
+		})
+	}
+}
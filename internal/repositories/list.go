@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Порядок сортировки списка метрик.
+const (
+	SortByName  = "name"  // по имени метрики
+	SortByValue = "value" // по значению метрики, метрики с равными значениями - по имени
+)
+
+// ErrInvalidCursor - курсор страницы поврежден или получен для другого порядка сортировки.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor - позиция в списке метрик: последняя метрика предыдущей страницы.
+type Cursor struct {
+	Sort  string  `json:"s"`           // порядок сортировки, для которого получен курсор
+	Name  string  `json:"n"`           // имя метрики
+	Value float64 `json:"v,omitempty"` // значение метрики, используется при сортировке по значению
+}
+
+// String - кодирует курсор в строку для параметра запроса.
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor - разбирает курсор, полученный методом String, для списка с порядком сортировки sort.
+func ParseCursor(s, sort string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("%w: cursor is for sort by %s, not by %s", ErrInvalidCursor, cursor.Sort, sort)
+	}
+	return &cursor, nil
+}
+
+// ListOptions - условия отбора, порядок сортировки и размер страницы списка метрик. Пустые поля не участвуют в отборе.
+type ListOptions struct {
+	MType  string         // тип метрики: gauge или counter
+	Prefix string         // префикс имени метрики
+	Match  *regexp.Regexp // регулярное выражение, которому должно соответствовать имя метрики
+	Sort   string         // порядок сортировки: SortByName или SortByValue, по умолчанию по имени
+	Limit  int            // максимальное количество метрик на странице, 0 - без ограничения
+	After  *Cursor        // курсор, после которого начинается страница
+}
+
+// MetricsPage - страница списка метрик.
+type MetricsPage struct {
+	Metrics []Metric `json:"metrics"`        // метрики страницы
+	Next    string   `json:"next,omitempty"` // курсор следующей страницы, пустой для последней страницы
+}
+
+// Validate - проверяет параметры списка метрик.
+func (o ListOptions) Validate() error {
+	if o.MType != "" && o.MType != "gauge" && o.MType != "counter" {
+		return fmt.Errorf("invalid metric type %s", o.MType)
+	}
+	if o.Sort != "" && o.Sort != SortByName && o.Sort != SortByValue {
+		return fmt.Errorf("invalid sort %q, allowed: %s, %s", o.Sort, SortByName, SortByValue)
+	}
+	if o.Limit < 0 {
+		return fmt.Errorf("invalid limit %d", o.Limit)
+	}
+	if o.After != nil && o.After.Sort != o.SortBy() {
+		return fmt.Errorf("%w: cursor is for sort by %s, not by %s", ErrInvalidCursor, o.After.Sort, o.SortBy())
+	}
+	return nil
+}
+
+// SortBy - возвращает порядок сортировки с учетом значения по умолчанию.
+func (o ListOptions) SortBy() string {
+	if o.Sort == "" {
+		return SortByName
+	}
+	return o.Sort
+}
+
+// SortValue - возвращает значение метрики, по которому сортируется список: value для gauge и delta для counter.
+func SortValue(metric Metric) float64 {
+	if metric.Value != nil {
+		return *metric.Value
+	}
+	if metric.Delta != nil {
+		return float64(*metric.Delta)
+	}
+	return 0
+}
+
+// Filter - проверяет, удовлетворяет ли метрика условиям отбора, без учета курсора.
+func (o ListOptions) Filter(metric Metric) bool {
+	if o.MType != "" && o.MType != metric.MType {
+		return false
+	}
+	if o.Prefix != "" && !strings.HasPrefix(metric.ID, o.Prefix) {
+		return false
+	}
+	return o.Match == nil || o.Match.MatchString(metric.ID)
+}
+
+// Compare - сравнивает положение метрик a и b в списке.
+func (o ListOptions) Compare(a, b Metric) int {
+	if o.SortBy() == SortByValue {
+		if c := cmp.Compare(SortValue(a), SortValue(b)); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// afterCursor - проверяет, что метрика находится в списке после курсора.
+func (o ListOptions) afterCursor(metric Metric) bool {
+	if o.After == nil {
+		return true
+	}
+	return o.Compare(metric, Metric{ID: o.After.Name, Value: &o.After.Value}) > 0
+}
+
+// NewPage - формирует страницу из метрик, отобранных и отсортированных хранилищем. Чтобы определить, есть ли
+// следующая страница, хранилище возвращает на одну метрику больше лимита.
+func NewPage(metrics []Metric, opts ListOptions) MetricsPage {
+	page := MetricsPage{Metrics: metrics}
+	if page.Metrics == nil {
+		page.Metrics = make([]Metric, 0)
+	}
+	if opts.Limit > 0 && len(metrics) > opts.Limit {
+		page.Metrics = metrics[:opts.Limit]
+		last := page.Metrics[opts.Limit-1]
+		page.Next = Cursor{Sort: opts.SortBy(), Name: last.ID, Value: SortValue(last)}.String()
+	}
+	return page
+}
+
+// ListSlice - формирует страницу списка из всех метрик хранилища. Используется хранилищами,
+// которые не могут отобрать и отсортировать метрики эффективнее.
+func ListSlice(metrics []Metric, opts ListOptions) MetricsPage {
+	selected := make([]Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		if opts.Filter(metric) && opts.afterCursor(metric) {
+			selected = append(selected, metric)
+		}
+	}
+	slices.SortFunc(selected, opts.Compare)
+	return NewPage(selected, opts)
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{Sort: SortByValue, Name: "cpu;host=a", Value: -1.5}
+	got, err := ParseCursor(cursor.String(), SortByValue)
+	require.NoError(t, err)
+	assert.Equal(t, cursor, *got)
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+	}{
+		{name: "not base64", cursor: "!!!", sort: SortByName},
+		{name: "not json", cursor: "bm90IGpzb24", sort: SortByName},
+		{name: "other sort", cursor: cursor.String(), sort: SortByName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCursor(tt.cursor, tt.sort)
+			assert.ErrorIs(t, err, ErrInvalidCursor)
+		})
+	}
+}
+
+func TestListOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantErr bool
+	}{
+		{name: "default", opts: ListOptions{}},
+		{name: "sort by value", opts: ListOptions{MType: "counter", Sort: SortByValue, Limit: 10}},
+		{name: "invalid type", opts: ListOptions{MType: "summary"}, wantErr: true},
+		{name: "invalid sort", opts: ListOptions{Sort: "updated"}, wantErr: true},
+		{name: "negative limit", opts: ListOptions{Limit: -1}, wantErr: true},
+		{name: "cursor for other sort", opts: ListOptions{After: &Cursor{Sort: SortByValue}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestListSlice(t *testing.T) {
+	value := func(v float64) *float64 { return &v }
+	delta := func(d int64) *int64 { return &d }
+	metrics := []Metric{
+		{ID: "b", MType: "gauge", Value: value(2)},
+		{ID: "c", MType: "counter", Delta: delta(2)},
+		{ID: "a", MType: "gauge", Value: value(3)},
+	}
+
+	page := ListSlice(metrics, ListOptions{Sort: SortByValue, Limit: 2})
+	require.Len(t, page.Metrics, 2)
+	assert.Equal(t, "b", page.Metrics[0].ID)
+	assert.Equal(t, "c", page.Metrics[1].ID)
+	require.NotEmpty(t, page.Next)
+
+	after, err := ParseCursor(page.Next, SortByValue)
+	require.NoError(t, err)
+	assert.Equal(t, Cursor{Sort: SortByValue, Name: "c", Value: 2}, *after)
+	page = ListSlice(metrics, ListOptions{Sort: SortByValue, Limit: 2, After: after})
+	require.Len(t, page.Metrics, 1)
+	assert.Equal(t, "a", page.Metrics[0].ID)
+	assert.Empty(t, page.Next)
+
+	// исходный слайс не изменяется
+	assert.Equal(t, "b", metrics[0].ID)
+}
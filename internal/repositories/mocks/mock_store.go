@@ -66,6 +66,21 @@ func (mr *MockMetricsReaderMockRecorder) GetAllMetricsSlice(arg0 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllMetricsSlice", reflect.TypeOf((*MockMetricsReader)(nil).GetAllMetricsSlice), arg0)
 }
 
+// ListMetrics mocks base method.
+func (m *MockMetricsReader) ListMetrics(arg0 context.Context, arg1 repositories.ListOptions) (repositories.MetricsPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", arg0, arg1)
+	ret0, _ := ret[0].(repositories.MetricsPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockMetricsReaderMockRecorder) ListMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockMetricsReader)(nil).ListMetrics), arg0, arg1)
+}
+
 // GetMetric mocks base method.
 func (m *MockMetricsReader) GetMetric(arg0 context.Context, arg1, arg2 string) (string, error) {
 	m.ctrl.T.Helper()
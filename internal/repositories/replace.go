@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotSupported - операция не поддерживается хранилищем.
+var ErrNotSupported = errors.New("operation is not supported by storage")
+
+// ReplaceMetrics - заменяет все метрики хранилища stor метриками из слайса, если хранилище реализует
+// интерфейс MetricsReplacer, иначе возвращает ErrNotSupported. Функция используется обертками над
+// хранилищем, чтобы передать замену метрик обернутому хранилищу.
+func ReplaceMetrics(ctx context.Context, stor any, metrics []Metric) error {
+	replacer, ok := stor.(MetricsReplacer)
+	if !ok {
+		return fmt.Errorf("replace metrics: %w", ErrNotSupported)
+	}
+	return replacer.ReplaceMetrics(ctx, metrics)
+}
+
+// ValidateMetric - проверяет, что тип метрики известен, а ее значение задано.
+func ValidateMetric(metric Metric) error {
+	switch metric.MType {
+	case "gauge":
+		if metric.Value == nil {
+			return fmt.Errorf("invalid metric, value of gauge metric is nil")
+		}
+	case "counter":
+		if metric.Delta == nil {
+			return fmt.Errorf("invalid metric, delta of counter metric is nil")
+		}
+	default:
+		return fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
+	}
+	return nil
+}
+
+// ValidateReplacement - проверяет метрики, которыми заменяется содержимое хранилища: каждая метрика
+// должна быть корректной, а имя метрики не должно повторяться.
+func ValidateReplacement(metrics []Metric) error {
+	seen := make(map[string]struct{}, len(metrics))
+	for _, metric := range metrics {
+		if err := ValidateMetric(metric); err != nil {
+			return err
+		}
+		if _, ok := seen[metric.ID]; ok {
+			return fmt.Errorf("invalid metrics, metric %s is repeated", metric.ID)
+		}
+		seen[metric.ID] = struct{}{}
+	}
+	return nil
+}
@@ -2,9 +2,20 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
 )
 
+// ErrTypeConflict - метрика с таким именем уже хранится с другим типом.
+// Имя метрики уникально среди метрик всех типов: запись метрики, имя которой занято метрикой другого типа,
+// отклоняется всеми хранилищами, а хранимая метрика не изменяется.
+var ErrTypeConflict = errors.New("metric type conflict")
+
+// TypeConflictError - возвращает ошибку записи метрики name типа mtype, имя которой занято метрикой типа stored.
+func TypeConflictError(name, mtype, stored string) error {
+	return fmt.Errorf("%w: metric %s is stored as %s, can not write it as %s", ErrTypeConflict, name, stored, mtype)
+}
+
 // Интерфесы хранилища метрик.
 type (
 	// MetricsReader - интерфейс для получения метрик из хранилища.
@@ -12,6 +23,7 @@ type (
 		GetMetric(ctx context.Context, typeMetric string, nameMetric string) (string, error) // Метод для получения метрики по типу и имени метрики.
 		GetAllMetrics(context.Context) (string, error)                                       // Возвращает все хранимые в сервисе метрики в виде строки
 		GetAllMetricsSlice(context.Context) ([]Metric, error)                                // Возвращает все хранимые в сервисе метрики в виде слайса метрик
+		ListMetrics(context.Context, ListOptions) (MetricsPage, error)                       // Возвращает страницу отобранных и отсортированных метрик
 	}
 
 	// MetricsWriter - интерфейс для добавления метрик в хранилище.
@@ -21,6 +33,27 @@ type (
 		AddMetricsFromSlice(context.Context, []Metric) error // Добавляет в сервис метрики из слайса метрик
 	}
 
+	// MetricsDeleter - интерфейс для удаления метрик из хранилища.
+	MetricsDeleter interface {
+		DeleteMetrics(context.Context, MetricFilter) ([]Metric, error) // Удаляет метрики, удовлетворяющие фильтру, и возвращает удаленные метрики
+		ExpireMetrics(context.Context, TTL) ([]Metric, error)          // Удаляет метрики, не обновлявшиеся дольше времени жизни, и возвращает удаленные метрики
+	}
+
+	// TimedMetricsReader - интерфейс для получения метрик вместе со временем их последнего обновления.
+	TimedMetricsReader interface {
+		GetAllTimedMetrics(context.Context) ([]TimedMetric, error) // Возвращает все хранимые метрики со временем последнего обновления
+	}
+
+	// TimedMetricsWriter - интерфейс для восстановления метрик вместе со временем их последнего обновления.
+	TimedMetricsWriter interface {
+		AddTimedMetrics(context.Context, []TimedMetric) error // Добавляет метрики, сохраняя время их последнего обновления
+	}
+
+	// MetricsReplacer - интерфейс для замены всех метрик хранилища.
+	MetricsReplacer interface {
+		ReplaceMetrics(context.Context, []Metric) error // Заменяет все хранимые метрики метриками из слайса
+	}
+
 	// StorageStarter - интерфейс для инициализации хранилища.
 	StorageStarter interface {
 		Bootstrap(context.Context) error // Инициализирует хранилище метрик
@@ -30,6 +63,7 @@ type (
 	IStorage interface {
 		MetricsReader
 		MetricsWriter
+		MetricsDeleter
 		StorageStarter
 	}
 
@@ -0,0 +1,354 @@
+// Package storagetest содержит набор тестов, которому должна удовлетворять каждая реализация
+// интерфейса repositories.IStorage, чтобы хранилища метрик были взаимозаменяемы.
+package storagetest
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Factory - создает пустое хранилище метрик для одного теста.
+type Factory func(t *testing.T) repositories.IStorage
+
+// Run - запускает набор тестов хранилища метрик. Для каждого теста хранилище создается заново.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, stor repositories.IStorage)
+	}{
+		{name: "gauge is overwritten", run: testGauge},
+		{name: "counter is accumulated", run: testCounter},
+		{name: "unknown metric", run: testUnknownMetric},
+		{name: "metrics from slice", run: testMetricsFromSlice},
+		{name: "invalid metrics in slice", run: testInvalidSlice},
+		{name: "type conflict", run: testTypeConflict},
+		{name: "type conflict in slice", run: testTypeConflictInSlice},
+		{name: "delete metrics", run: testDeleteMetrics},
+		{name: "expire metrics", run: testExpireMetrics},
+		{name: "replace metrics", run: testReplaceMetrics},
+		{name: "list metrics", run: testListMetrics},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := newStorage(t)
+			require.NoError(t, stor.Bootstrap(context.Background()))
+			tt.run(t, stor)
+		})
+	}
+}
+
+func value(v float64) *float64 {
+	return &v
+}
+
+func delta(d int64) *int64 {
+	return &d
+}
+
+// names - возвращает отсортированные имена метрик вида "тип/имя".
+func names(metrics []repositories.Metric) []string {
+	result := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		result = append(result, m.MType+"/"+m.ID)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// stored - возвращает имена всех метрик хранилища.
+func stored(t *testing.T, stor repositories.IStorage) []string {
+	metrics, err := stor.GetAllMetricsSlice(context.Background())
+	require.NoError(t, err)
+	return names(metrics)
+}
+
+func testGauge(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", -2.25))
+
+	got, err := stor.GetMetric(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "-2.25", got)
+}
+
+func testCounter(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+
+	got, err := stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "7", got)
+}
+
+func testUnknownMetric(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+
+	_, err := stor.GetMetric(ctx, "gauge", "unknown")
+	assert.Error(t, err)
+	_, err = stor.GetMetric(ctx, "counter", "Alloc")
+	assert.Error(t, err)
+	_, err = stor.GetMetric(ctx, "summary", "Alloc")
+	assert.Error(t, err)
+}
+
+func testMetricsFromSlice(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "Alloc", MType: "gauge", Value: value(2)},
+		{ID: "PollCount", MType: "counter", Delta: delta(2)},
+		{ID: "PollCount", MType: "counter", Delta: delta(3)},
+	}))
+
+	assert.Equal(t, []string{"counter/PollCount", "gauge/Alloc"}, stored(t, stor))
+	got, err := stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "6", got)
+}
+
+func testInvalidSlice(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	assert.Error(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "Alloc", MType: "gauge", Value: value(2)},
+		{ID: "PollCount", MType: "summary", Delta: delta(2)},
+	}))
+	assert.Empty(t, stored(t, stor), "invalid slice must not be saved partially")
+}
+
+func testTypeConflict(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 2))
+
+	assert.ErrorIs(t, stor.AddCounter(ctx, "Alloc", 1), repositories.ErrTypeConflict)
+	assert.ErrorIs(t, stor.AddGauge(ctx, "PollCount", 1), repositories.ErrTypeConflict)
+
+	// хранимые метрики не изменились
+	assert.Equal(t, []string{"counter/PollCount", "gauge/Alloc"}, stored(t, stor))
+	got, err := stor.GetMetric(ctx, "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", got)
+	got, err = stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "2", got)
+}
+
+func testTypeConflictInSlice(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+
+	// конфликт с хранимой метрикой отклоняет весь слайс
+	err := stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "Frees", MType: "gauge", Value: value(2)},
+		{ID: "Alloc", MType: "counter", Delta: delta(1)},
+	})
+	assert.ErrorIs(t, err, repositories.ErrTypeConflict)
+	assert.Equal(t, []string{"gauge/Alloc"}, stored(t, stor))
+
+	// конфликт внутри слайса
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "Mallocs", MType: "counter", Delta: delta(1)},
+		{ID: "Mallocs", MType: "gauge", Value: value(2)},
+	})
+	assert.ErrorIs(t, err, repositories.ErrTypeConflict)
+	assert.Equal(t, []string{"gauge/Alloc"}, stored(t, stor))
+}
+
+func testDeleteMetrics(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "cpu;host=a", MType: "gauge", Value: value(1)},
+		{ID: "cpu;host=b", MType: "gauge", Value: value(2)},
+		{ID: "requests;host=a", MType: "counter", Delta: delta(3)},
+		{ID: "Alloc", MType: "gauge", Value: value(4)},
+		{ID: "PollCount", MType: "counter", Delta: delta(5)},
+		{ID: "under_score", MType: "counter", Delta: delta(6)},
+		{ID: "underXscore", MType: "counter", Delta: delta(7)},
+	}))
+
+	deleted, err := stor.DeleteMetrics(ctx, repositories.MetricFilter{ID: "unknown"})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{MType: "counter", ID: "Alloc"})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{MType: "gauge", ID: "Alloc"})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.NotNil(t, deleted[0].Value)
+	assert.Equal(t, 4.0, *deleted[0].Value)
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"counter/requests;host=a", "gauge/cpu;host=a"}, names(deleted))
+
+	// символы шаблонов SQL в префиксе не имеют специального значения
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{Prefix: "under_"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"counter/under_score"}, names(deleted))
+
+	assert.Equal(t, []string{"counter/PollCount", "counter/underXscore", "gauge/cpu;host=b"}, stored(t, stor))
+}
+
+func testExpireMetrics(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+
+	// время жизни не задано или еще не истекло
+	expired, err := stor.ExpireMetrics(ctx, repositories.TTL{})
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	expired, err = stor.ExpireMetrics(ctx, repositories.TTL{Gauge: time.Hour, Counter: time.Hour})
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	time.Sleep(10 * time.Millisecond)
+	expired, err = stor.ExpireMetrics(ctx, repositories.TTL{Gauge: time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gauge/Alloc"}, names(expired))
+	assert.Equal(t, []string{"counter/PollCount"}, stored(t, stor))
+}
+
+func testReplaceMetrics(t *testing.T, stor repositories.IStorage) {
+	if _, ok := stor.(repositories.MetricsReplacer); !ok {
+		t.Skip("storage does not implement repositories.MetricsReplacer")
+	}
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 2))
+
+	// некорректная замена не изменяет хранилище
+	assert.Error(t, repositories.ReplaceMetrics(ctx, stor, []repositories.Metric{
+		{ID: "Frees", MType: "gauge", Value: value(1)},
+		{ID: "Frees", MType: "counter", Delta: delta(1)},
+	}))
+	assert.Error(t, repositories.ReplaceMetrics(ctx, stor, []repositories.Metric{
+		{ID: "Frees", MType: "gauge"},
+	}))
+	assert.Equal(t, []string{"counter/PollCount", "gauge/Alloc"}, stored(t, stor))
+
+	// counter заменяется, а не суммируется; метрика может сменить тип
+	require.NoError(t, repositories.ReplaceMetrics(ctx, stor, []repositories.Metric{
+		{ID: "PollCount", MType: "counter", Delta: delta(5)},
+		{ID: "Alloc", MType: "counter", Delta: delta(1)},
+		{ID: "Frees", MType: "gauge", Value: value(3)},
+	}))
+	assert.Equal(t, []string{"counter/Alloc", "counter/PollCount", "gauge/Frees"}, stored(t, stor))
+	got, err := stor.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "5", got)
+	got, err = stor.GetMetric(ctx, "counter", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1", got)
+
+	require.NoError(t, repositories.ReplaceMetrics(ctx, stor, nil))
+	assert.Empty(t, stored(t, stor))
+}
+
+// listAll - читает список метрик по страницам и возвращает имена метрик в порядке списка.
+func listAll(t *testing.T, stor repositories.IStorage, opts repositories.ListOptions) []string {
+	result := make([]string, 0)
+	for {
+		page, err := stor.ListMetrics(context.Background(), opts)
+		require.NoError(t, err)
+		if opts.Limit > 0 {
+			require.LessOrEqual(t, len(page.Metrics), opts.Limit)
+		}
+		for _, m := range page.Metrics {
+			result = append(result, m.ID)
+		}
+		if page.Next == "" {
+			return result
+		}
+		opts.After, err = repositories.ParseCursor(page.Next, opts.SortBy())
+		require.NoError(t, err)
+	}
+}
+
+func testListMetrics(t *testing.T, stor repositories.IStorage) {
+	ctx := context.Background()
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "cpu.user", MType: "gauge", Value: value(0.5)},
+		{ID: "cpu.system", MType: "gauge", Value: value(7)},
+		{ID: "cpu.idle", MType: "gauge", Value: value(-1)},
+		{ID: "Cpu.total", MType: "counter", Delta: delta(7)},
+		{ID: "requests", MType: "counter", Delta: delta(3)},
+		{ID: "cpu_count", MType: "counter", Delta: delta(2)},
+	}))
+
+	tests := []struct {
+		name string
+		opts repositories.ListOptions
+		want []string
+	}{
+		{
+			name: "all by name",
+			want: []string{"Cpu.total", "cpu.idle", "cpu.system", "cpu.user", "cpu_count", "requests"},
+		},
+		{
+			name: "all by value",
+			opts: repositories.ListOptions{Sort: repositories.SortByValue},
+			want: []string{"cpu.idle", "cpu.user", "cpu_count", "requests", "Cpu.total", "cpu.system"},
+		},
+		{
+			name: "type and prefix",
+			opts: repositories.ListOptions{MType: "gauge", Prefix: "cpu."},
+			want: []string{"cpu.idle", "cpu.system", "cpu.user"},
+		},
+		{
+			name: "prefix is case sensitive",
+			opts: repositories.ListOptions{Prefix: "Cpu"},
+			want: []string{"Cpu.total"},
+		},
+		{
+			name: "prefix with like wildcard",
+			opts: repositories.ListOptions{Prefix: "cpu_"},
+			want: []string{"cpu_count"},
+		},
+		{
+			name: "match",
+			opts: repositories.ListOptions{Match: regexp.MustCompile(`^cpu\.(user|idle)$`)},
+			want: []string{"cpu.idle", "cpu.user"},
+		},
+		{
+			// регулярное выражение проверяется движком RE2: \b - граница слова, \pL - буква Unicode
+			name: "match with RE2 syntax",
+			opts: repositories.ListOptions{Match: regexp.MustCompile(`(?i)^\pL+\b.total$|count\b`)},
+			want: []string{"Cpu.total", "cpu_count"},
+		},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{0, 1, 2, 100} {
+			opts := tt.opts
+			opts.Limit = limit
+			assert.Equal(t, tt.want, listAll(t, stor, opts), "%s, limit %d", tt.name, limit)
+		}
+	}
+
+	// курсор, полученный для другого порядка сортировки, отклоняется
+	page, err := stor.ListMetrics(ctx, repositories.ListOptions{Limit: 1})
+	require.NoError(t, err)
+	_, err = repositories.ParseCursor(page.Next, repositories.SortByValue)
+	assert.ErrorIs(t, err, repositories.ErrInvalidCursor)
+
+	// пустой список
+	page, err = stor.ListMetrics(ctx, repositories.ListOptions{Prefix: "mem"})
+	require.NoError(t, err)
+	assert.NotNil(t, page.Metrics)
+	assert.Empty(t, page.Metrics)
+	assert.Empty(t, page.Next)
+}
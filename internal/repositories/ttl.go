@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"strings"
+	"time"
+)
+
+// TTL - время жизни метрик, которые не обновлялись. Нулевое значение отключает удаление метрик.
+type TTL struct {
+	Gauge   time.Duration            // время жизни метрик типа gauge
+	Counter time.Duration            // время жизни метрик типа counter
+	Metrics map[string]time.Duration // время жизни отдельных метрик; ключ - имя метрики или префикс имени, оканчивающийся на '*'
+}
+
+// Enabled - проверяет, задано ли время жизни хотя бы для одной метрики.
+func (t TTL) Enabled() bool {
+	if t.Gauge > 0 || t.Counter > 0 {
+		return true
+	}
+	for _, ttl := range t.Metrics {
+		if ttl > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// For - возвращает время жизни метрики. Точное совпадение имени имеет приоритет над префиксом,
+// более длинный префикс - над более коротким, настройки отдельных метрик - над настройками типа.
+func (t TTL) For(mtype, id string) time.Duration {
+	if ttl, ok := t.Metrics[id]; ok {
+		return ttl
+	}
+	bestLen := -1
+	var best time.Duration
+	for pattern, ttl := range t.Metrics {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if !ok || !strings.HasPrefix(id, prefix) || len(prefix) <= bestLen {
+			continue
+		}
+		best = ttl
+		bestLen = len(prefix)
+	}
+	if bestLen >= 0 {
+		return best
+	}
+	switch mtype {
+	case "gauge":
+		return t.Gauge
+	case "counter":
+		return t.Counter
+	default:
+		return 0
+	}
+}
+
+// Expired - проверяет, истекло ли время жизни метрики, последний раз обновленной в момент updated.
+func (t TTL) Expired(mtype, id string, updated, now time.Time) bool {
+	ttl := t.For(mtype, id)
+	return ttl > 0 && now.Sub(updated) > ttl
+}
+
+// TimedMetric - метрика со временем последнего обновления.
+type TimedMetric struct {
+	Metric
+	Updated *time.Time `json:"updated,omitempty"` // время последнего обновления метрики
+}
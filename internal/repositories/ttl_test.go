@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTL(t *testing.T) {
+	assert.False(t, TTL{}.Enabled())
+	assert.False(t, TTL{Metrics: map[string]time.Duration{"a": 0}}.Enabled())
+	assert.True(t, TTL{Counter: time.Minute}.Enabled())
+	assert.True(t, TTL{Metrics: map[string]time.Duration{"a": time.Minute}}.Enabled())
+
+	ttl := TTL{
+		Gauge:   time.Hour,
+		Counter: 2 * time.Hour,
+		Metrics: map[string]time.Duration{
+			"host.*":      time.Minute,
+			"host.disk*":  2 * time.Minute,
+			"host.disk.c": 0,
+		},
+	}
+	tests := []struct {
+		name  string
+		mtype string
+		id    string
+		want  time.Duration
+	}{
+		{name: "gauge", mtype: "gauge", id: "Alloc", want: time.Hour},
+		{name: "counter", mtype: "counter", id: "PollCount", want: 2 * time.Hour},
+		{name: "prefix", mtype: "gauge", id: "host.cpu", want: time.Minute},
+		{name: "longest prefix", mtype: "gauge", id: "host.disk.a", want: 2 * time.Minute},
+		{name: "exact name disables expiry", mtype: "gauge", id: "host.disk.c", want: 0},
+		{name: "unknown type", mtype: "summary", id: "Alloc", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ttl.For(tt.mtype, tt.id))
+		})
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, ttl.Expired("gauge", "host.cpu", now.Add(-2*time.Minute), now))
+	assert.False(t, ttl.Expired("gauge", "host.cpu", now.Add(-30*time.Second), now))
+	assert.False(t, ttl.Expired("gauge", "host.disk.c", now.Add(-24*time.Hour), now))
+}
@@ -0,0 +1,321 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// State - состояние правила оповещения.
+type State string
+
+// Состояния правила оповещения.
+const (
+	StateInactive State = "inactive" // условие не выполняется
+	StatePending  State = "pending"  // условие выполняется меньше заданного времени
+	StateFiring   State = "firing"   // условие выполняется дольше заданного времени
+	StateResolved State = "resolved" // условие сработавшего правила перестало выполняться
+)
+
+// ResolvedRetention - время, в течение которого оповещение в состоянии resolved возвращается в списке оповещений.
+const ResolvedRetention = 15 * time.Minute
+
+// DefaultInterval - период проверки правил оповещения по умолчанию.
+const DefaultInterval = 15 * time.Second
+
+// Alert - состояние правила оповещения.
+type Alert struct {
+	Name        string            `json:"name"`
+	Expr        string            `json:"expr"`
+	State       State             `json:"state"`
+	Value       *float64          `json:"value,omitempty"` // последнее вычисленное значение условия
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	ActiveAt    *time.Time        `json:"active_at,omitempty"`   // время, с которого выполняется условие
+	FiredAt     *time.Time        `json:"fired_at,omitempty"`    // время срабатывания правила
+	ResolvedAt  *time.Time        `json:"resolved_at,omitempty"` // время, когда условие перестало выполняться
+}
+
+// sample - значение счетчика в момент проверки правила.
+type sample struct {
+	time  time.Time
+	value float64
+}
+
+// ruleState - правило оповещения и его состояние.
+type ruleState struct {
+	rule    Rule
+	alert   Alert
+	samples []sample // значения счетчика для расчета скорости роста
+}
+
+// Notifier - получатель оповещений, перешедших в состояние firing или resolved.
+type Notifier interface {
+	Notify(alerts []Alert)
+}
+
+// Engine - проверяет правила оповещения и хранит их состояния.
+type Engine struct {
+	mu       sync.Mutex
+	rules    []*ruleState
+	notifier Notifier
+}
+
+// NewEngine - фабричная функция структуры Engine.
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// SetRules - заменяет правила оповещения. Правила с прежними именем и условием сохраняют свое состояние.
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	previous := make(map[string]*ruleState, len(e.rules))
+	for _, rs := range e.rules {
+		previous[rs.rule.Name] = rs
+	}
+	states := make([]*ruleState, 0, len(rules))
+	for _, rule := range rules {
+		rs, ok := previous[rule.Name]
+		if !ok || rs.rule.Expr != rule.Expr {
+			rs = &ruleState{alert: Alert{State: StateInactive}}
+		}
+		rs.rule = rule
+		rs.alert.Name = rule.Name
+		rs.alert.Expr = rule.Expr
+		rs.alert.Labels = rule.Labels
+		rs.alert.Annotations = rule.Annotations
+		states = append(states, rs)
+	}
+	e.rules = states
+}
+
+// SetNotifier - устанавливает получателя оповещений, перешедших в состояние firing или resolved.
+func (e *Engine) SetNotifier(n Notifier) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.notifier = n
+}
+
+// RulesCount - возвращает количество правил оповещения.
+func (e *Engine) RulesCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.rules)
+}
+
+// Evaluate - проверяет правила оповещения по текущим значениям метрик хранилища.
+func (e *Engine) Evaluate(ctx context.Context, stor repositories.MetricsReader, now time.Time) error {
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return err
+	}
+	values := make(map[[2]string]float64, len(metrics))
+	for _, m := range metrics {
+		values[[2]string{m.MType, canonicalName(m.ID)}] = repositories.SortValue(m)
+	}
+
+	e.mu.Lock()
+	var changed []Alert
+	for _, rs := range e.rules {
+		value, ok := values[[2]string{rs.rule.Condition.MType, canonicalName(rs.rule.Condition.Metric)}]
+		if ok && rs.rule.Condition.Rate {
+			value, ok = rs.rate(now, value)
+		}
+		if ok {
+			rs.alert.Value = &value
+		} else {
+			rs.alert.Value = nil
+		}
+		if rs.transition(ok && rs.rule.Condition.Compare(value), now) {
+			changed = append(changed, rs.alert)
+		}
+	}
+	notifier := e.notifier
+	e.mu.Unlock()
+
+	if notifier != nil && len(changed) > 0 {
+		notifier.Notify(changed)
+	}
+	return nil
+}
+
+// canonicalName - возвращает имя метрики с метками, упорядоченными по ключу, чтобы имя правила совпадало
+// с именем метрики хранилища независимо от порядка меток.
+func canonicalName(id string) string {
+	name, labels := repositories.ParseName(id)
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, key := range keys {
+		b.WriteString(";" + key + "=" + labels[key])
+	}
+	return b.String()
+}
+
+// rate - добавляет значение счетчика и возвращает скорость его роста в секунду. Сброс счетчика, например
+// после перезапуска сервера с хранением в памяти, учитывается как рост от нуля.
+func (rs *ruleState) rate(now time.Time, value float64) (float64, bool) {
+	rs.samples = append(rs.samples, sample{time: now, value: value})
+	if window := rs.rule.Condition.Window; window > 0 {
+		// хранится одно значение не позже начала интервала, чтобы скорость считалась по всему интервалу
+		for len(rs.samples) > 2 && !rs.samples[1].time.After(now.Add(-window)) {
+			rs.samples = rs.samples[1:]
+		}
+	} else if len(rs.samples) > 2 {
+		rs.samples = rs.samples[len(rs.samples)-2:]
+	}
+	if len(rs.samples) < 2 {
+		return 0, false
+	}
+
+	var increase float64
+	for i := 1; i < len(rs.samples); i++ {
+		delta := rs.samples[i].value - rs.samples[i-1].value
+		if delta < 0 {
+			delta = rs.samples[i].value
+		}
+		increase += delta
+	}
+	seconds := now.Sub(rs.samples[0].time).Seconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+	return increase / seconds, true
+}
+
+// transition - изменяет состояние правила по результату проверки условия. Возвращает true, если правило
+// перешло в состояние firing или resolved.
+func (rs *ruleState) transition(active bool, now time.Time) bool {
+	alert := &rs.alert
+	if active {
+		switch alert.State {
+		case StateInactive, StateResolved:
+			alert.State = StatePending
+			alert.ActiveAt = &now
+			alert.FiredAt = nil
+			alert.ResolvedAt = nil
+		}
+		if alert.State == StatePending && now.Sub(*alert.ActiveAt) >= rs.rule.For {
+			alert.State = StateFiring
+			alert.FiredAt = &now
+			logger.ServerLog.Info("alert is firing", zap.String("rule", rs.rule.Name))
+			return true
+		}
+		return false
+	}
+
+	switch alert.State {
+	case StatePending:
+		alert.State = StateInactive
+		alert.ActiveAt = nil
+	case StateFiring:
+		alert.State = StateResolved
+		alert.ResolvedAt = &now
+		logger.ServerLog.Info("alert is resolved", zap.String("rule", rs.rule.Name))
+		return true
+	case StateResolved:
+		if now.Sub(*alert.ResolvedAt) >= ResolvedRetention {
+			*alert = Alert{Name: alert.Name, Expr: alert.Expr, State: StateInactive, Value: alert.Value,
+				Labels: alert.Labels, Annotations: alert.Annotations}
+		}
+	}
+	return false
+}
+
+// Alerts - возвращает оповещения в состояниях pending, firing и resolved, отсортированные по имени правила.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alerts := make([]Alert, 0, len(e.rules))
+	for _, rs := range e.rules {
+		if rs.alert.State != StateInactive {
+			alerts = append(alerts, rs.alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Name < alerts[j].Name })
+	return alerts
+}
+
+var (
+	rulesPath string                          // путь к файлу правил оповещения
+	interval  time.Duration = DefaultInterval // период проверки правил оповещения
+	engine                  = NewEngine()
+)
+
+// SetRulesPath - устанавливает путь к файлу правил оповещения.
+func SetRulesPath(path string) {
+	rulesPath = path
+}
+
+// GetRulesPath - возвращает путь к файлу правил оповещения.
+func GetRulesPath() string {
+	return rulesPath
+}
+
+// SetInterval - устанавливает период проверки правил оповещения.
+func SetInterval(i time.Duration) {
+	interval = i
+}
+
+// GetInterval - возвращает период проверки правил оповещения.
+func GetInterval() time.Duration {
+	return interval
+}
+
+// GetEngine - возвращает проверку правил оповещения сервера.
+func GetEngine() *Engine {
+	return engine
+}
+
+// Reload - загружает правила оповещения из файла. При ошибке чтения или разбора файла прежние правила
+// сохраняются.
+func Reload() error {
+	if rulesPath == "" {
+		return nil
+	}
+	rules, err := LoadRules(rulesPath)
+	if err != nil {
+		return err
+	}
+	engine.SetRules(rules)
+	logger.ServerLog.Info("alerting rules loaded", zap.String("path", rulesPath), zap.Int("count", len(rules)))
+	return nil
+}
+
+// Run - периодически проверяет правила оповещения до отмены контекста.
+// Если файл правил не задан, сразу возвращает управление.
+func Run(ctx context.Context, stor repositories.MetricsReader) {
+	if rulesPath == "" || interval <= 0 {
+		return
+	}
+	logger.ServerLog.Debug("starting alerting rules evaluation", zap.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := engine.Evaluate(ctx, stor, now); err != nil {
+				logger.ServerLog.Error("evaluate alerting rules error", zap.String("error", error.Error(err)))
+			}
+		}
+	}
+}
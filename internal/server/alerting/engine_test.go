@@ -0,0 +1,215 @@
+package alerting
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// mustRules - разбирает правила оповещения для теста.
+func mustRules(t *testing.T, data string) []Rule {
+	rules, err := ParseRules([]byte(data))
+	require.NoError(t, err)
+	return rules
+}
+
+// alertState - возвращает состояние правила, отсутствующее в списке оповещений правило неактивно.
+func alertState(engine *Engine, name string) State {
+	for _, alert := range engine.Alerts() {
+		if alert.Name == name {
+			return alert.State
+		}
+	}
+	return StateInactive
+}
+
+func TestEngineThreshold(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	engine := NewEngine()
+	engine.SetRules(mustRules(t, `rules: [{name: HighHeap, expr: gauge HeapAlloc > 100, for: 2m}]`))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// метрики нет - условие не выполняется
+	require.NoError(t, engine.Evaluate(ctx, stor, start))
+	assert.Empty(t, engine.Alerts())
+
+	tests := []struct {
+		name  string
+		value float64
+		after time.Duration
+		state State
+	}{
+		{name: "below threshold", value: 50, after: 0, state: StateInactive},
+		{name: "condition starts", value: 150, after: time.Minute, state: StatePending},
+		{name: "condition holds less than for", value: 200, after: 2 * time.Minute, state: StatePending},
+		{name: "condition holds for", value: 200, after: 3 * time.Minute, state: StateFiring},
+		{name: "still firing", value: 300, after: 4 * time.Minute, state: StateFiring},
+		{name: "condition stops", value: 10, after: 5 * time.Minute, state: StateResolved},
+		{name: "resolved is kept", value: 10, after: 10 * time.Minute, state: StateResolved},
+		{name: "resolved expires", value: 10, after: 20 * time.Minute, state: StateInactive},
+		{name: "pending again", value: 150, after: 21 * time.Minute, state: StatePending},
+		{name: "pending is cancelled", value: 10, after: 22 * time.Minute, state: StateInactive},
+	}
+	for _, tt := range tests {
+		require.NoError(t, stor.AddGauge(ctx, "HeapAlloc", tt.value))
+		require.NoError(t, engine.Evaluate(ctx, stor, start.Add(tt.after)))
+		assert.Equal(t, tt.state, alertState(engine, "HighHeap"), tt.name)
+	}
+}
+
+func TestEngineFiringAlert(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewMemStorage(map[string]float64{"HeapAlloc": 2e9}, nil)
+	engine := NewEngine()
+	engine.SetRules(mustRules(t, `
+rules:
+  - name: HighHeap
+    expr: gauge HeapAlloc > 1e9
+    labels: {severity: critical}
+`))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// правило без времени выполнения условия срабатывает сразу
+	require.NoError(t, engine.Evaluate(ctx, stor, now))
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, 2e9, *alerts[0].Value)
+	assert.Equal(t, now, *alerts[0].ActiveAt)
+	assert.Equal(t, now, *alerts[0].FiredAt)
+	assert.Equal(t, map[string]string{"severity": "critical"}, alerts[0].Labels)
+
+	// перезагрузка правил сохраняет состояние неизмененных правил
+	engine.SetRules(mustRules(t, `rules: [{name: HighHeap, expr: gauge HeapAlloc > 1e9}, {name: Other, expr: gauge Other > 1}]`))
+	assert.Equal(t, StateFiring, alertState(engine, "HighHeap"))
+	assert.Equal(t, 2, engine.RulesCount())
+
+	// измененное условие сбрасывает состояние
+	engine.SetRules(mustRules(t, `rules: [{name: HighHeap, expr: gauge HeapAlloc > 3e9}]`))
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestEngineLabelOrder(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewMemStorage(map[string]float64{"cpu;host=a;dc=eu": 0.9}, nil)
+	engine := NewEngine()
+	engine.SetRules(mustRules(t, `
+rules:
+  - {name: Graphite, expr: "gauge cpu;dc=eu;host=a > 0.5"}
+  - {name: Selector, expr: 'gauge cpu{dc="eu", host="a"} > 0.5'}
+  - {name: OtherHost, expr: 'gauge cpu{host="b", dc="eu"} > 0.5'}
+`))
+
+	// метки правила сравниваются с метками метрики независимо от порядка
+	require.NoError(t, engine.Evaluate(ctx, stor, time.Now()))
+	assert.Equal(t, StateFiring, alertState(engine, "Graphite"))
+	assert.Equal(t, StateFiring, alertState(engine, "Selector"))
+	assert.Equal(t, StateInactive, alertState(engine, "OtherHost"))
+}
+
+func TestEngineRate(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	engine := NewEngine()
+	engine.SetRules(mustRules(t, `
+rules:
+  - name: AgentStopped
+    expr: rate(counter PollCount) == 0
+    for: 5m
+  - name: FastPolling
+    expr: rate(counter PollCount[2m]) > 1
+`))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		delta   int64
+		after   time.Duration
+		stopped State
+		fast    State
+	}{
+		{name: "first sample", delta: 60, after: 0, stopped: StateInactive, fast: StateInactive},
+		{name: "counter grows", delta: 240, after: time.Minute, stopped: StateInactive, fast: StateFiring},
+		{name: "window rate", delta: 0, after: 2 * time.Minute, stopped: StatePending, fast: StateFiring},
+		{name: "window rate drops", delta: 0, after: 3 * time.Minute, stopped: StatePending, fast: StateResolved},
+		{name: "counter stopped for", delta: 0, after: 7 * time.Minute, stopped: StateFiring, fast: StateResolved},
+		{name: "counter grows again", delta: 1, after: 8 * time.Minute, stopped: StateResolved, fast: StateResolved},
+	}
+	for _, tt := range tests {
+		if tt.delta > 0 {
+			require.NoError(t, stor.AddCounter(ctx, "PollCount", tt.delta))
+		}
+		require.NoError(t, engine.Evaluate(ctx, stor, start.Add(tt.after)))
+		assert.Equal(t, tt.stopped, alertState(engine, "AgentStopped"), tt.name)
+		assert.Equal(t, tt.fast, alertState(engine, "FastPolling"), tt.name)
+	}
+}
+
+func TestEngineRateCounterReset(t *testing.T) {
+	rs := &ruleState{rule: Rule{Condition: Condition{Rate: true, MType: "counter", Metric: "PollCount"}}}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, ok := rs.rate(start, 100)
+	assert.False(t, ok)
+	// счетчик сброшен до 30: рост считается от нуля
+	rate, ok := rs.rate(start.Add(10*time.Second), 30)
+	require.True(t, ok)
+	assert.Equal(t, 3.0, rate)
+}
+
+func TestReload(t *testing.T) {
+	defer SetRulesPath("")
+	defer GetEngine().SetRules(nil)
+
+	// файл правил не задан
+	require.NoError(t, Reload())
+	assert.Equal(t, 0, GetEngine().RulesCount())
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{name: A, expr: gauge A > 1}]"), 0644))
+	SetRulesPath(path)
+	require.NoError(t, Reload())
+	assert.Equal(t, 1, GetEngine().RulesCount())
+
+	// при ошибке в файле прежние правила сохраняются
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{name: A}]"), 0644))
+	assert.Error(t, Reload())
+	assert.Equal(t, 1, GetEngine().RulesCount())
+}
+
+// notifierFunc - получатель оповещений для теста.
+type notifierFunc func(alerts []Alert)
+
+func (f notifierFunc) Notify(alerts []Alert) {
+	f(alerts)
+}
+
+func TestEngineNotifier(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	engine := NewEngine()
+	engine.SetRules(mustRules(t, `rules: [{name: HighHeap, expr: gauge HeapAlloc > 100, for: 1m}]`))
+	var notified []State
+	engine.SetNotifier(notifierFunc(func(alerts []Alert) {
+		for _, alert := range alerts {
+			notified = append(notified, alert.State)
+		}
+	}))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// получатель уведомляется только о срабатывании и разрешении оповещения
+	values := []float64{150, 150, 150, 10, 10}
+	for i, value := range values {
+		require.NoError(t, stor.AddGauge(ctx, "HeapAlloc", value))
+		require.NoError(t, engine.Evaluate(ctx, stor, start.Add(time.Duration(i)*time.Minute)))
+	}
+	assert.Equal(t, []State{StateFiring, StateResolved}, notified)
+}
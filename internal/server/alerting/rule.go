@@ -0,0 +1,257 @@
+// Package alerting периодически проверяет правила оповещения по значениям метрик хранилища. Правило
+// переходит в состояние pending, когда его условие выполняется, в состояние firing, когда условие выполняется
+// дольше заданного времени, и в состояние resolved, когда условие сработавшего правила перестает выполняться.
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidRule - ошибка разбора правила оповещения.
+var ErrInvalidRule = errors.New("invalid alerting rule")
+
+// Операторы сравнения условия правила.
+var operators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// Condition - условие правила: сравнение значения метрики или скорости роста счетчика с порогом.
+type Condition struct {
+	Rate      bool          // сравнивается скорость роста counter в секунду, а не значение метрики
+	Window    time.Duration // интервал расчета скорости роста, 0 - интервал между двумя последними проверками
+	MType     string        // тип метрики: gauge или counter
+	Metric    string        // имя метрики
+	Op        string        // оператор сравнения
+	Threshold float64       // пороговое значение
+}
+
+// ParseCondition - разбирает условие вида "gauge HeapAlloc > 1e9" или "rate(counter PollCount[5m]) == 0".
+// Метки метрики задаются в формате Graphite "cpu;host=a" или селектором запросов /api/query
+// cpu{host="a"}, в селекторе допускается только оператор "=". Порядок меток не учитывается.
+func ParseCondition(expr string) (Condition, error) {
+	var c Condition
+	s := strings.TrimSpace(expr)
+
+	// оператор ищется после имени метрики, чтобы символы оператора в метках имени не учитывались
+	var rest string
+	if after, ok := strings.CutPrefix(s, "rate("); ok {
+		inner, tail, ok := strings.Cut(after, ")")
+		if !ok {
+			return Condition{}, fmt.Errorf("%w: unclosed rate in %q", ErrInvalidRule, expr)
+		}
+		c.Rate = true
+		if metric, window, ok := strings.Cut(inner, "["); ok {
+			window, ok = strings.CutSuffix(window, "]")
+			if !ok {
+				return Condition{}, fmt.Errorf("%w: unclosed window in %q", ErrInvalidRule, expr)
+			}
+			d, err := time.ParseDuration(window)
+			if err != nil || d <= 0 {
+				return Condition{}, fmt.Errorf("%w: invalid window %q", ErrInvalidRule, window)
+			}
+			c.Window = d
+			inner = metric
+		}
+		mtype, metric, _ := strings.Cut(strings.TrimSpace(inner), " ")
+		metric, extra, err := splitName(strings.TrimSpace(metric))
+		if err != nil {
+			return Condition{}, fmt.Errorf("%w: %v in %q", ErrInvalidRule, err, expr)
+		}
+		if metric == "" || strings.TrimSpace(extra) != "" {
+			return Condition{}, fmt.Errorf("%w: expected rate(counter name) in %q", ErrInvalidRule, expr)
+		}
+		c.MType, c.Metric = mtype, metric
+		rest = tail
+	} else {
+		mtype, tail, _ := strings.Cut(s, " ")
+		c.MType = mtype
+		metric, tail, err := splitName(strings.TrimSpace(tail))
+		if err != nil {
+			return Condition{}, fmt.Errorf("%w: %v in %q", ErrInvalidRule, err, expr)
+		}
+		c.Metric, rest = metric, tail
+		if c.Metric == "" {
+			return Condition{}, fmt.Errorf("%w: expected type and name of metric in %q", ErrInvalidRule, expr)
+		}
+	}
+
+	switch c.MType {
+	case "gauge":
+		if c.Rate {
+			return Condition{}, fmt.Errorf("%w: rate is defined only for counter in %q", ErrInvalidRule, expr)
+		}
+	case "counter":
+	default:
+		return Condition{}, fmt.Errorf("%w: invalid type of metric %q", ErrInvalidRule, c.MType)
+	}
+
+	rest = strings.TrimSpace(rest)
+	for _, op := range operators {
+		if value, ok := strings.CutPrefix(rest, op); ok {
+			threshold, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return Condition{}, fmt.Errorf("%w: invalid threshold in %q", ErrInvalidRule, expr)
+			}
+			c.Op, c.Threshold = op, threshold
+			return c, nil
+		}
+	}
+	return Condition{}, fmt.Errorf("%w: expected comparison operator in %q", ErrInvalidRule, expr)
+}
+
+// splitName - отделяет имя метрики от оператора сравнения. Имя заканчивается пробелом или символом оператора.
+// Имя с метками в формате Graphite "name;key=value" содержит знак '=', поэтому заканчивается только пробелом.
+// Селектор name{key="value"} преобразуется в имя в формате Graphite.
+func splitName(s string) (name, rest string, err error) {
+	if brace := strings.IndexByte(s, '{'); brace > 0 && !strings.ContainsAny(s[:brace], " \t;<>=!") {
+		return parseSelector(s[:brace], s[brace+1:])
+	}
+	end := strings.IndexAny(s, " \t")
+	if end < 0 {
+		end = len(s)
+	}
+	if !strings.Contains(s[:end], ";") {
+		if op := strings.IndexAny(s[:end], "<>=!"); op >= 0 {
+			end = op
+		}
+	}
+	return s[:end], s[end:], nil
+}
+
+// parseSelector - разбирает метки селектора key="value", key2="value2"} после открывающей скобки и
+// возвращает имя в формате Graphite и остаток выражения после закрывающей скобки.
+func parseSelector(name, s string) (string, string, error) {
+	var b strings.Builder
+	b.WriteString(name)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if rest, ok := strings.CutPrefix(s, "}"); ok {
+			return b.String(), rest, nil
+		}
+		key, value, ok := strings.Cut(s, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t,;{}!\"") {
+			return "", "", fmt.Errorf("invalid label matcher in selector %s{", name)
+		}
+		value = strings.TrimLeft(value, " \t")
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil || quoted[0] != '"' {
+			return "", "", fmt.Errorf("label %s must have quoted value with operator =", key)
+		}
+		unquoted, _ := strconv.Unquote(quoted)
+		if strings.ContainsAny(unquoted, ";=") {
+			return "", "", fmt.Errorf("label %s value must not contain ';' or '='", key)
+		}
+		b.WriteString(";" + key + "=" + unquoted)
+		s = strings.TrimLeft(value[len(quoted):], " \t")
+		if rest, ok := strings.CutPrefix(s, ","); ok {
+			s = rest
+		} else if !strings.HasPrefix(s, "}") {
+			return "", "", fmt.Errorf("unclosed selector %s{", name)
+		}
+	}
+}
+
+// Compare - сравнивает значение с порогом условия.
+func (c Condition) Compare(value float64) bool {
+	switch c.Op {
+	case ">":
+		return value > c.Threshold
+	case ">=":
+		return value >= c.Threshold
+	case "<":
+		return value < c.Threshold
+	case "<=":
+		return value <= c.Threshold
+	case "==":
+		return value == c.Threshold
+	case "!=":
+		return value != c.Threshold
+	}
+	return false
+}
+
+// Rule - правило оповещения.
+type Rule struct {
+	Name        string
+	Expr        string
+	Condition   Condition
+	For         time.Duration     // время выполнения условия, после которого правило срабатывает
+	Labels      map[string]string // метки оповещения, например severity
+	Annotations map[string]string // описание оповещения
+}
+
+// ruleConfig - правило оповещения в файле правил.
+type ruleConfig struct {
+	Name        string            `yaml:"name"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// rulesFile - файл правил оповещения.
+type rulesFile struct {
+	Rules []ruleConfig `yaml:"rules"`
+}
+
+// ParseRules - разбирает правила оповещения в формате YAML или JSON. Пример:
+//
+//	rules:
+//	  - name: HighHeap
+//	    expr: gauge HeapAlloc > 1e9
+//	    for: 2m
+//	    labels: {severity: critical}
+func ParseRules(data []byte) ([]Rule, error) {
+	var file rulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse alerting rules error: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	names := make(map[string]struct{}, len(file.Rules))
+	for _, r := range file.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("%w: rule without name", ErrInvalidRule)
+		}
+		if _, ok := names[r.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate rule name %q", ErrInvalidRule, r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		condition, err := ParseCondition(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		var duration time.Duration
+		if r.For != "" {
+			duration, err = time.ParseDuration(r.For)
+			if err != nil || duration < 0 {
+				return nil, fmt.Errorf("%w: rule %q has invalid duration %q", ErrInvalidRule, r.Name, r.For)
+			}
+		}
+		rules = append(rules, Rule{
+			Name:        r.Name,
+			Expr:        r.Expr,
+			Condition:   condition,
+			For:         duration,
+			Labels:      r.Labels,
+			Annotations: r.Annotations,
+		})
+	}
+	return rules, nil
+}
+
+// LoadRules - читает правила оповещения из файла.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read alerting rules error: %w", err)
+	}
+	return ParseRules(data)
+}
@@ -0,0 +1,133 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    Condition
+		wantErr bool
+	}{
+		{
+			name: "gauge threshold",
+			expr: "gauge HeapAlloc > 1e9",
+			want: Condition{MType: "gauge", Metric: "HeapAlloc", Op: ">", Threshold: 1e9},
+		},
+		{
+			name: "without spaces",
+			expr: "counter PollCount>=10",
+			want: Condition{MType: "counter", Metric: "PollCount", Op: ">=", Threshold: 10},
+		},
+		{
+			name: "name with labels",
+			expr: "gauge cpu;host=a;dc=eu != 0",
+			want: Condition{MType: "gauge", Metric: "cpu;host=a;dc=eu", Op: "!=", Threshold: 0},
+		},
+		{
+			name: "query selector",
+			expr: `gauge cpu{host="a", dc="eu"}>0.5`,
+			want: Condition{MType: "gauge", Metric: "cpu;host=a;dc=eu", Op: ">", Threshold: 0.5},
+		},
+		{
+			name: "counter rate of query selector",
+			expr: `rate(counter requests{code="500"}[1m]) > 1`,
+			want: Condition{Rate: true, Window: time.Minute, MType: "counter", Metric: "requests;code=500", Op: ">", Threshold: 1},
+		},
+		{
+			name: "counter rate",
+			expr: "rate(counter PollCount) == 0",
+			want: Condition{Rate: true, MType: "counter", Metric: "PollCount", Op: "==", Threshold: 0},
+		},
+		{
+			name: "counter rate with window",
+			expr: "rate(counter PollCount[5m]) < 0.5",
+			want: Condition{Rate: true, Window: 5 * time.Minute, MType: "counter", Metric: "PollCount", Op: "<", Threshold: 0.5},
+		},
+		{name: "unknown type", expr: "histogram Latency > 1", wantErr: true},
+		{name: "gauge rate", expr: "rate(gauge Alloc) > 1", wantErr: true},
+		{name: "without operator", expr: "gauge Alloc 1", wantErr: true},
+		{name: "invalid threshold", expr: "gauge Alloc > many", wantErr: true},
+		{name: "unclosed rate", expr: "rate(counter PollCount == 0", wantErr: true},
+		{name: "invalid window", expr: "rate(counter PollCount[five]) == 0", wantErr: true},
+		{name: "without name", expr: "gauge", wantErr: true},
+		{name: "selector with regexp", expr: `gauge cpu{host=~"a.*"} > 0`, wantErr: true},
+		{name: "selector with negation", expr: `gauge cpu{host!="a"} > 0`, wantErr: true},
+		{name: "unclosed selector", expr: `gauge cpu{host="a" > 0`, wantErr: true},
+		{name: "unquoted selector value", expr: `gauge cpu{host=a} > 0`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCondition(tt.expr)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRule)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	yamlRules := `
+rules:
+  - name: HighHeap
+    expr: gauge HeapAlloc > 1e9
+    for: 2m
+    labels:
+      severity: critical
+    annotations:
+      summary: heap is too large
+  - name: AgentStopped
+    expr: rate(counter PollCount) == 0
+    for: 5m
+`
+	rules, err := ParseRules([]byte(yamlRules))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "HighHeap", rules[0].Name)
+	assert.Equal(t, 2*time.Minute, rules[0].For)
+	assert.Equal(t, map[string]string{"severity": "critical"}, rules[0].Labels)
+	assert.Equal(t, map[string]string{"summary": "heap is too large"}, rules[0].Annotations)
+	assert.True(t, rules[1].Condition.Rate)
+
+	// файл правил в формате JSON
+	jsonRules := `{"rules": [{"name": "HighHeap", "expr": "gauge HeapAlloc > 1e9"}]}`
+	rules, err = ParseRules([]byte(jsonRules))
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, time.Duration(0), rules[0].For)
+
+	invalid := []string{
+		`rules: [{expr: "gauge A > 1"}]`,
+		`rules: [{name: A, expr: "gauge A > 1"}, {name: A, expr: "gauge B > 1"}]`,
+		`rules: [{name: A, expr: "gauge A"}]`,
+		`rules: [{name: A, expr: "gauge A > 1", for: soon}]`,
+		`rules: {name: A}`,
+	}
+	for _, data := range invalid {
+		_, err := ParseRules([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{name: A, expr: gauge A > 1}]"), 0644))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	_, err = LoadRules(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
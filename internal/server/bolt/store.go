@@ -0,0 +1,464 @@
+// Package bolt реализует хранилище метрик во встроенной базе данных bbolt. Хранилище предназначено для
+// развертываний без PostgreSQL: каждая запись метрик фиксируется в файле транзакцией, поэтому метрики
+// не теряются при аварийном завершении сервера, в отличие от периодического сохранения в файл.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// openTimeout - время ожидания блокировки файла базы данных, занятого другим процессом.
+const openTimeout = 5 * time.Second
+
+// bucketMetrics - раздел базы данных с метриками. Ключ - имя метрики, значение - запись record.
+var bucketMetrics = []byte("metrics")
+
+// Коды типов метрик в записи.
+const (
+	typeGauge   byte = 1
+	typeCounter byte = 2
+)
+
+// recordSize - размер записи метрики: тип, значение и время последнего обновления.
+const recordSize = 1 + 8 + 8
+
+// record - метрика в представлении базы данных.
+type record struct {
+	mtype   byte
+	bits    uint64 // значение gauge в представлении math.Float64bits или значение counter
+	updated int64  // время последнего обновления в наносекундах Unix
+}
+
+// encode - кодирует запись метрики.
+func (r record) encode() []byte {
+	buf := make([]byte, recordSize)
+	buf[0] = r.mtype
+	binary.BigEndian.PutUint64(buf[1:9], r.bits)
+	binary.BigEndian.PutUint64(buf[9:17], uint64(r.updated))
+	return buf
+}
+
+// decode - декодирует запись метрики.
+func decode(name, buf []byte) (record, error) {
+	if len(buf) != recordSize || (buf[0] != typeGauge && buf[0] != typeCounter) {
+		return record{}, fmt.Errorf("corrupted record of metric %s", name)
+	}
+	return record{
+		mtype:   buf[0],
+		bits:    binary.BigEndian.Uint64(buf[1:9]),
+		updated: int64(binary.BigEndian.Uint64(buf[9:17])),
+	}, nil
+}
+
+// typeName - возвращает название типа метрики записи.
+func (r record) typeName() string {
+	if r.mtype == typeGauge {
+		return "gauge"
+	}
+	return "counter"
+}
+
+// metric - возвращает метрику записи.
+func (r record) metric(name string) repositories.Metric {
+	metric := repositories.Metric{ID: name, MType: r.typeName()}
+	if r.mtype == typeGauge {
+		value := math.Float64frombits(r.bits)
+		metric.Value = &value
+	} else {
+		delta := int64(r.bits)
+		metric.Delta = &delta
+	}
+	return metric
+}
+
+// typeCode - возвращает код типа метрики.
+func typeCode(mtype string) (byte, error) {
+	switch mtype {
+	case "gauge":
+		return typeGauge, nil
+	case "counter":
+		return typeCounter, nil
+	default:
+		return 0, fmt.Errorf("invalid metric, undefined type of metric: %s", mtype)
+	}
+}
+
+// Store - хранилище метрик во встроенной базе данных bbolt.
+type Store struct {
+	db  *bbolt.DB
+	now func() time.Time
+}
+
+// Open - открывает файл базы данных, создавая его при необходимости.
+func Open(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("open storage file %s error: %w", path, err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// Close - закрывает файл базы данных.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Bootstrap - реализует метод Bootstrap интерфейса repositories.StorageStarter, создавая раздел метрик.
+func (s *Store) Bootstrap(_ context.Context) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketMetrics)
+		return err
+	})
+}
+
+// bucket - возвращает раздел метрик транзакции.
+func bucket(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	b := tx.Bucket(bucketMetrics)
+	if b == nil {
+		return nil, errors.New("storage is not bootstrapped")
+	}
+	return b, nil
+}
+
+// put - записывает метрику в раздел: gauge заменяется, counter увеличивается.
+// Метрика не записывается, если ее имя занято метрикой другого типа.
+func put(b *bbolt.Bucket, metric repositories.Metric, now int64) error {
+	mtype, err := typeCode(metric.MType)
+	if err != nil {
+		return err
+	}
+	r := record{mtype: mtype, updated: now}
+	if mtype == typeGauge {
+		if metric.Value == nil {
+			return fmt.Errorf("invalid metric, value of gauge metric is nil")
+		}
+		r.bits = math.Float64bits(*metric.Value)
+	} else {
+		if metric.Delta == nil {
+			return fmt.Errorf("invalid metric, delta of counter metric is nil")
+		}
+		r.bits = uint64(*metric.Delta)
+	}
+
+	key := []byte(metric.ID)
+	if buf := b.Get(key); buf != nil {
+		stored, err := decode(key, buf)
+		if err != nil {
+			return err
+		}
+		if stored.mtype != mtype {
+			return repositories.TypeConflictError(metric.ID, metric.MType, stored.typeName())
+		}
+		if mtype == typeCounter {
+			r.bits = uint64(int64(stored.bits) + *metric.Delta)
+		}
+	}
+	return b.Put(key, r.encode())
+}
+
+// write - записывает метрики одной транзакцией. Одиночные записи разных горутин объединяются в общие
+// транзакции, чтобы не синхронизировать файл на диске для каждой метрики.
+func (s *Store) write(metrics []repositories.Metric, batch bool) error {
+	now := s.now().UnixNano()
+	fn := func(tx *bbolt.Tx) error {
+		b, err := bucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, metric := range metrics {
+			if err := put(b, metric, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if batch {
+		return s.db.Batch(fn)
+	}
+	return s.db.Update(fn)
+}
+
+// AddGauge - реализует метод AddGauge интерфейса repositories.MetricsWriter.
+func (s *Store) AddGauge(_ context.Context, name string, value float64) error {
+	return s.write([]repositories.Metric{{ID: name, MType: "gauge", Value: &value}}, true)
+}
+
+// AddCounter - реализует метод AddCounter интерфейса repositories.MetricsWriter.
+func (s *Store) AddCounter(_ context.Context, name string, value int64) error {
+	return s.write([]repositories.Metric{{ID: name, MType: "counter", Delta: &value}}, true)
+}
+
+// AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.MetricsWriter.
+// Метрики записываются одной транзакцией: некорректная метрика или конфликт типов отклоняют весь слайс.
+func (s *Store) AddMetricsFromSlice(_ context.Context, metrics []repositories.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	return s.write(metrics, false)
+}
+
+// ReplaceMetrics - реализует метод ReplaceMetrics интерфейса repositories.MetricsReplacer.
+// Раздел метрик пересоздается и заполняется метриками слайса одной транзакцией.
+func (s *Store) ReplaceMetrics(_ context.Context, metrics []repositories.Metric) error {
+	if err := repositories.ValidateReplacement(metrics); err != nil {
+		return err
+	}
+	now := s.now().UnixNano()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if _, err := bucket(tx); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket(bucketMetrics); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(bucketMetrics)
+		if err != nil {
+			return err
+		}
+		for _, metric := range metrics {
+			if err := put(b, metric, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetMetric - реализует метод GetMetric интерфейса repositories.MetricsReader.
+func (s *Store) GetMetric(_ context.Context, metricType, name string) (string, error) {
+	if _, err := typeCode(metricType); err != nil {
+		return "", fmt.Errorf("whrong type of metric")
+	}
+	var metric repositories.Metric
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b, err := bucket(tx)
+		if err != nil {
+			return err
+		}
+		key := []byte(name)
+		buf := b.Get(key)
+		if buf == nil {
+			return fmt.Errorf("metric %s of type %s not found", name, metricType)
+		}
+		r, err := decode(key, buf)
+		if err != nil {
+			return err
+		}
+		metric = r.metric(name)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if metric.MType != metricType {
+		return "", fmt.Errorf("metric type is different, metric type in storage is: %s, metric type in request is: %s", metric.MType, metricType)
+	}
+	if metric.MType == "gauge" {
+		return fmt.Sprintf("%g", *metric.Value), nil
+	}
+	return fmt.Sprintf("%d", *metric.Delta), nil
+}
+
+// scan - передает в fn метрики раздела, упорядоченные по имени.
+func (s *Store) scan(fn func(name string, r record)) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		b, err := bucket(tx)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			r, err := decode(k, v)
+			if err != nil {
+				return err
+			}
+			fn(string(k), r)
+			return nil
+		})
+	})
+}
+
+// GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.MetricsReader.
+func (s *Store) GetAllMetricsSlice(_ context.Context) ([]repositories.Metric, error) {
+	result := make([]repositories.Metric, 0)
+	err := s.scan(func(name string, r record) {
+		result = append(result, r.metric(name))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+// Ключи базы данных упорядочены по имени метрики, поэтому при сортировке по имени читаются только метрики
+// страницы, начиная с курсора. При сортировке по значению отобранные метрики сортируются в памяти.
+func (s *Store) ListMetrics(_ context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	if opts.SortBy() != repositories.SortByName {
+		metrics := make([]repositories.Metric, 0)
+		err := s.scan(func(name string, r record) {
+			if metric := r.metric(name); opts.Filter(metric) {
+				metrics = append(metrics, metric)
+			}
+		})
+		if err != nil {
+			return repositories.MetricsPage{}, err
+		}
+		return repositories.ListSlice(metrics, opts), nil
+	}
+
+	prefix := []byte(opts.Prefix)
+	start := prefix
+	if opts.After != nil && opts.After.Name > opts.Prefix {
+		start = []byte(opts.After.Name)
+	}
+	metrics := make([]repositories.Metric, 0)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b, err := bucket(tx)
+		if err != nil {
+			return err
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(start); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if opts.Limit > 0 && len(metrics) > opts.Limit {
+				break
+			}
+			if opts.After != nil && string(k) <= opts.After.Name {
+				continue
+			}
+			r, err := decode(k, v)
+			if err != nil {
+				return err
+			}
+			if metric := r.metric(string(k)); opts.Filter(metric) {
+				metrics = append(metrics, metric)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	return repositories.NewPage(metrics, opts), nil
+}
+
+// GetAllMetrics - реализует метод GetAllMetrics интерфейса repositories.MetricsReader.
+func (s *Store) GetAllMetrics(ctx context.Context) (string, error) {
+	metrics, err := s.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return "", err
+	}
+	var result strings.Builder
+	for _, metric := range metrics {
+		if metric.MType == "gauge" {
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %g\n", metric.MType, metric.ID, *metric.Value)
+		} else {
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %d\n", metric.MType, metric.ID, *metric.Delta)
+		}
+	}
+	return result.String(), nil
+}
+
+// deleteIf - удаляет метрики с именами, начинающимися с prefix, для которых функция match возвращает true,
+// и возвращает удаленные метрики.
+func (s *Store) deleteIf(prefix string, match func(name string, r record) bool) ([]repositories.Metric, error) {
+	deleted := make([]repositories.Metric, 0)
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := bucket(tx)
+		if err != nil {
+			return err
+		}
+		var keys [][]byte
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			r, err := decode(k, v)
+			if err != nil {
+				return err
+			}
+			if !match(string(k), r) {
+				continue
+			}
+			keys = append(keys, append([]byte(nil), k...))
+			deleted = append(deleted, r.metric(string(k)))
+		}
+		// ключи удаляются после обхода, так как удаление во время обхода курсором пропускает записи
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+func (s *Store) DeleteMetrics(_ context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	prefix := filter.Prefix
+	if filter.ID != "" {
+		prefix = filter.ID
+	}
+	return s.deleteIf(prefix, func(name string, r record) bool {
+		return filter.Match(r.typeName(), name)
+	})
+}
+
+// ExpireMetrics - реализует метод ExpireMetrics интерфейса repositories.MetricsDeleter.
+func (s *Store) ExpireMetrics(_ context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	if !ttl.Enabled() {
+		return nil, nil
+	}
+	now := s.now()
+	return s.deleteIf("", func(name string, r record) bool {
+		return ttl.Expired(r.typeName(), name, time.Unix(0, r.updated), now)
+	})
+}
+
+// GetAllTimedMetrics - реализует метод GetAllTimedMetrics интерфейса repositories.TimedMetricsReader.
+func (s *Store) GetAllTimedMetrics(_ context.Context) ([]repositories.TimedMetric, error) {
+	result := make([]repositories.TimedMetric, 0)
+	err := s.scan(func(name string, r record) {
+		updated := time.Unix(0, r.updated)
+		result = append(result, repositories.TimedMetric{Metric: r.metric(name), Updated: &updated})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AddTimedMetrics - реализует метод AddTimedMetrics интерфейса repositories.TimedMetricsWriter.
+// Метрики записываются одной транзакцией, метрики без времени обновления считаются обновленными
+// в момент добавления.
+func (s *Store) AddTimedMetrics(_ context.Context, metrics []repositories.TimedMetric) error {
+	now := s.now().UnixNano()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := bucket(tx)
+		if err != nil {
+			return err
+		}
+		for _, metric := range metrics {
+			updated := now
+			if metric.Updated != nil {
+				updated = metric.Updated.UnixNano()
+			}
+			if err := put(b, metric.Metric, updated); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
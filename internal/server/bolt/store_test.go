@@ -0,0 +1,138 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
+)
+
+// openTemp - открывает хранилище во временном файле и закрывает его по окончании теста.
+func openTemp(t *testing.T) *Store {
+	stor, err := Open(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = stor.Close() })
+	return stor
+}
+
+func TestStoreConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) repositories.IStorage {
+		return openTemp(t)
+	})
+}
+
+func TestStore_GetMetric(t *testing.T) {
+	ctx := context.Background()
+	stor := openTemp(t)
+	require.NoError(t, stor.Bootstrap(ctx))
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 12.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+
+	tests := []struct {
+		name    string
+		mtype   string
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{name: "gauge", mtype: "gauge", id: "Alloc", want: "12.5"},
+		{name: "counter", mtype: "counter", id: "PollCount", want: "7"},
+		{name: "other type", mtype: "counter", id: "Alloc", wantErr: true},
+		{name: "unknown metric", mtype: "gauge", id: "unknown", wantErr: true},
+		{name: "unknown type", mtype: "histogram", id: "Alloc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stor.GetMetric(ctx, tt.mtype, tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	all, err := stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "type: gauge, name: Alloc, value: 12.5\ntype: counter, name: PollCount, value: 7\n", all)
+}
+
+func TestStore_NotBootstrapped(t *testing.T) {
+	ctx := context.Background()
+	stor := openTemp(t)
+	assert.Error(t, stor.AddGauge(ctx, "temp", 1))
+	_, err := stor.GetAllMetricsSlice(ctx)
+	assert.Error(t, err)
+}
+
+func TestStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	stor, err := Open(path)
+	require.NoError(t, err)
+	require.NoError(t, stor.Bootstrap(ctx))
+	require.NoError(t, stor.AddGauge(ctx, "temp", 36.6))
+	require.NoError(t, stor.AddCounter(ctx, "requests", 5))
+
+	// слайс с конфликтом типов не записывается целиком
+	value := 1.0
+	delta := int64(10)
+	err = stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "requests", MType: "counter", Delta: &delta},
+		{ID: "requests", MType: "gauge", Value: &value},
+	})
+	assert.True(t, errors.Is(err, repositories.ErrTypeConflict))
+	require.NoError(t, stor.Close())
+
+	// метрики сохраняются после повторного открытия файла
+	stor, err = Open(path)
+	require.NoError(t, err)
+	defer stor.Close()
+	require.NoError(t, stor.Bootstrap(ctx))
+
+	got, err := stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "36.6", got)
+	got, err = stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", got)
+}
+
+func TestStore_TimedMetrics(t *testing.T) {
+	ctx := context.Background()
+	stor := openTemp(t)
+	require.NoError(t, stor.Bootstrap(ctx))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stor.now = func() time.Time { return now }
+
+	updated := now.Add(-time.Hour)
+	value := 1.5
+	delta := int64(2)
+	require.NoError(t, stor.AddTimedMetrics(ctx, []repositories.TimedMetric{
+		{Metric: repositories.Metric{ID: "old", MType: "gauge", Value: &value}, Updated: &updated},
+		{Metric: repositories.Metric{ID: "fresh", MType: "counter", Delta: &delta}},
+	}))
+
+	metrics, err := stor.GetAllTimedMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "fresh", metrics[0].ID)
+	assert.True(t, now.Equal(*metrics[0].Updated))
+	assert.Equal(t, "old", metrics[1].ID)
+	assert.True(t, updated.Equal(*metrics[1].Updated))
+
+	expired, err := stor.ExpireMetrics(ctx, repositories.TTL{Gauge: time.Minute})
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "old", expired[0].ID)
+}
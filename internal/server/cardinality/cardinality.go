@@ -0,0 +1,287 @@
+// Package cardinality ограничивает количество различных серий метрик, хранимых сервером, и проверяет имена метрик.
+// Серией считается пара "тип - имя метрики". Учитывается, какой клиент создал каждую серию,
+// что позволяет ограничивать количество серий для отдельного агента и находить основных создателей серий.
+package cardinality
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Policy - политика обработки метрик, создающих серии сверх лимита.
+type Policy string
+
+// Политики обработки метрик сверх лимита.
+const (
+	PolicyReject Policy = "reject" // запрос отклоняется с ошибкой
+	PolicyDrop   Policy = "drop"   // метрики новых серий молча отбрасываются, остальные метрики сохраняются
+	PolicyLog    Policy = "log"    // метрики сохраняются, превышение лимита только логируется
+)
+
+// RestoredClient - клиент, которому приписываются серии, загруженные из хранилища при старте сервера.
+const RestoredClient = "restored"
+
+// ErrCardinalityLimit - превышен лимит количества серий.
+var ErrCardinalityLimit = errors.New("series cardinality limit exceeded")
+
+// ParsePolicy - разбирает название политики. Пустая строка означает политику reject.
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case "":
+		return PolicyReject, nil
+	case PolicyReject, PolicyDrop, PolicyLog:
+		return Policy(s), nil
+	default:
+		return "", fmt.Errorf("unknown cardinality policy: %s", s)
+	}
+}
+
+// Limits - ограничения количества серий. Нулевое значение лимита отключает соответствующее ограничение.
+type Limits struct {
+	MaxSeries          int    // максимальное количество серий на сервере
+	MaxSeriesPerClient int    // максимальное количество серий, созданных одним клиентом
+	Policy             Policy // политика обработки метрик сверх лимита
+}
+
+// clientStats - статистика клиента: количество созданных серий и метрик, превысивших лимит.
+type clientStats struct {
+	series   int
+	overflow int64
+}
+
+// Tracker - учитывает серии метрик и их создателей.
+type Tracker struct {
+	mu      sync.Mutex
+	limits  Limits
+	series  map[string]string // серия -> клиент, создавший серию
+	clients map[string]*clientStats
+}
+
+// NewTracker - фабричная функция структуры Tracker.
+func NewTracker(limits Limits) *Tracker {
+	if limits.Policy == "" {
+		limits.Policy = PolicyReject
+	}
+	return &Tracker{
+		limits:  limits,
+		series:  make(map[string]string),
+		clients: make(map[string]*clientStats),
+	}
+}
+
+// Limits - возвращает ограничения количества серий.
+func (t *Tracker) Limits() Limits {
+	return t.limits
+}
+
+// seriesKey - ключ серии метрики.
+func seriesKey(mtype, name string) string {
+	return mtype + "/" + name
+}
+
+// stats - возвращает статистику клиента, создавая ее при необходимости. Вызывается под блокировкой.
+func (t *Tracker) stats(client string) *clientStats {
+	s, ok := t.clients[client]
+	if !ok {
+		s = &clientStats{}
+		t.clients[client] = s
+	}
+	return s
+}
+
+// Seed - регистрирует серии, уже существующие в хранилище. Лимиты при этом не проверяются.
+func (t *Tracker) Seed(metrics []repositories.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.stats(RestoredClient)
+	for _, m := range metrics {
+		key := seriesKey(m.MType, m.ID)
+		if _, ok := t.series[key]; ok {
+			continue
+		}
+		t.series[key] = RestoredClient
+		s.series++
+	}
+}
+
+// Admit - проверяет, может ли клиент записать метрики, и регистрирует новые серии.
+// Возвращает метрики, которые следует сохранить. При политике reject превышение лимита любой метрикой
+// приводит к ошибке ErrCardinalityLimit для всего набора, и новые серии не регистрируются.
+func (t *Tracker) Admit(client string, metrics []repositories.Metric) ([]repositories.Metric, error) {
+	admitted, _, err := t.admit(client, metrics)
+	return admitted, err
+}
+
+// admit - реализует Admit и дополнительно возвращает по одной метрике для каждой зарегистрированной новой серии,
+// чтобы освободить серии, если запись метрик в хранилище не удалась.
+func (t *Tracker) admit(client string, metrics []repositories.Metric) (admitted, created []repositories.Metric, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.stats(client)
+	total := len(t.series)
+	clientSeries := s.series
+
+	// решения по новым сериям: true - серия принимается
+	decisions := make(map[string]bool)
+	var overflow int64
+	for _, m := range metrics {
+		key := seriesKey(m.MType, m.ID)
+		if _, ok := t.series[key]; ok {
+			continue
+		}
+		if _, ok := decisions[key]; ok {
+			continue
+		}
+		if t.exceeds(total, clientSeries) {
+			overflow++
+			if t.limits.Policy != PolicyLog {
+				decisions[key] = false
+				continue
+			}
+			logger.ServerLog.Warn("series cardinality limit exceeded", zap.String("client", client),
+				zap.String("type", m.MType), zap.String("name", m.ID))
+		}
+		decisions[key] = true
+		total++
+		clientSeries++
+	}
+	s.overflow += overflow
+
+	if overflow > 0 && t.limits.Policy == PolicyReject {
+		return nil, nil, fmt.Errorf("%w: client %s, %d new series over limit", ErrCardinalityLimit, client, overflow)
+	}
+
+	dropped := false
+	for _, m := range metrics {
+		key := seriesKey(m.MType, m.ID)
+		accepted, ok := decisions[key]
+		if !ok {
+			continue
+		}
+		if !accepted {
+			dropped = true
+			continue
+		}
+		if _, registered := t.series[key]; registered {
+			continue
+		}
+		t.series[key] = client
+		created = append(created, m)
+	}
+	s.series = clientSeries
+	if !dropped {
+		return metrics, created, nil
+	}
+
+	logger.ServerLog.Debug("metrics of new series dropped by cardinality limit", zap.String("client", client),
+		zap.Int64("count", overflow))
+	admitted = make([]repositories.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if accepted, ok := decisions[seriesKey(m.MType, m.ID)]; ok && !accepted {
+			continue
+		}
+		admitted = append(admitted, m)
+	}
+	return admitted, created, nil
+}
+
+// Forget - удаляет из учета серии удаленных метрик, освобождая лимиты создавших их клиентов.
+func (t *Tracker) Forget(metrics []repositories.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, m := range metrics {
+		key := seriesKey(m.MType, m.ID)
+		client, ok := t.series[key]
+		if !ok {
+			continue
+		}
+		delete(t.series, key)
+		if s, ok := t.clients[client]; ok && s.series > 0 {
+			s.series--
+		}
+	}
+}
+
+// exceeds - проверяет, превысит ли создание новой серии лимиты. Вызывается под блокировкой.
+func (t *Tracker) exceeds(total, clientSeries int) bool {
+	if t.limits.MaxSeries > 0 && total >= t.limits.MaxSeries {
+		return true
+	}
+	return t.limits.MaxSeriesPerClient > 0 && clientSeries >= t.limits.MaxSeriesPerClient
+}
+
+// ClientReport - статистика клиента в отчете о сериях.
+type ClientReport struct {
+	Client   string `json:"client"`   // идентификатор клиента
+	Series   int    `json:"series"`   // количество серий, созданных клиентом
+	Overflow int64  `json:"overflow"` // количество новых серий клиента, превысивших лимит
+}
+
+// Report - отчет о количестве серий на сервере.
+type Report struct {
+	TotalSeries        int            `json:"total_series"`          // количество серий на сервере
+	MaxSeries          int            `json:"max_series"`            // лимит количества серий на сервере
+	MaxSeriesPerClient int            `json:"max_series_per_client"` // лимит количества серий одного клиента
+	Policy             Policy         `json:"policy"`                // политика обработки метрик сверх лимита
+	Overflow           int64          `json:"overflow"`              // общее количество новых серий, превысивших лимит
+	TopClients         []ClientReport `json:"top_clients"`           // клиенты, создавшие больше всего серий
+}
+
+// Report - формирует отчет о сериях с limit клиентами, создавшими больше всего серий.
+// Неположительный limit означает отчет по всем клиентам.
+func (t *Tracker) Report(limit int) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := Report{
+		TotalSeries:        len(t.series),
+		MaxSeries:          t.limits.MaxSeries,
+		MaxSeriesPerClient: t.limits.MaxSeriesPerClient,
+		Policy:             t.limits.Policy,
+		TopClients:         make([]ClientReport, 0, len(t.clients)),
+	}
+	for client, s := range t.clients {
+		report.Overflow += s.overflow
+		if s.series == 0 && s.overflow == 0 {
+			continue
+		}
+		report.TopClients = append(report.TopClients, ClientReport{Client: client, Series: s.series, Overflow: s.overflow})
+	}
+	sort.Slice(report.TopClients, func(i, j int) bool {
+		a, b := report.TopClients[i], report.TopClients[j]
+		if a.Series != b.Series {
+			return a.Series > b.Series
+		}
+		if a.Overflow != b.Overflow {
+			return a.Overflow > b.Overflow
+		}
+		return a.Client < b.Client
+	})
+	if limit > 0 && len(report.TopClients) > limit {
+		report.TopClients = report.TopClients[:limit]
+	}
+	return report
+}
+
+// tracker - учет серий, используемый сервером.
+var tracker = NewTracker(Limits{})
+
+// SetLimits - устанавливает ограничения количества серий, сбрасывая накопленный учет серий.
+func SetLimits(l Limits) {
+	tracker = NewTracker(l)
+}
+
+// GetTracker - возвращает установленный учет серий.
+func GetTracker() *Tracker {
+	return tracker
+}
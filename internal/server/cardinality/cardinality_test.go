@@ -0,0 +1,179 @@
+package cardinality
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    Policy
+		wantErr bool
+	}{
+		{value: "", want: PolicyReject},
+		{value: "reject", want: PolicyReject},
+		{value: "drop", want: PolicyDrop},
+		{value: "log", want: PolicyLog},
+		{value: "ignore", wantErr: true},
+	} {
+		got, err := ParsePolicy(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+// series - создает слайс метрик типа counter с заданными именами.
+func series(names ...string) []repositories.Metric {
+	metrics := make([]repositories.Metric, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, repositories.Metric{ID: name, MType: "counter"})
+	}
+	return metrics
+}
+
+func TestTrackerAdmit(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		tr := NewTracker(Limits{MaxSeries: 3, MaxSeriesPerClient: 2})
+
+		admitted, err := tr.Admit("agent:a", series("a1", "a2", "a1"))
+		require.NoError(t, err)
+		assert.Len(t, admitted, 3)
+
+		// превышение лимита клиента отклоняет весь набор и не регистрирует новые серии
+		_, err = tr.Admit("agent:a", series("a1", "a3"))
+		assert.ErrorIs(t, err, ErrCardinalityLimit)
+
+		// существующие серии принимаются
+		_, err = tr.Admit("agent:a", series("a1", "a2"))
+		assert.NoError(t, err)
+
+		// серия с тем же именем, но другим типом считается отдельной серией
+		_, err = tr.Admit("agent:b", []repositories.Metric{{ID: "a1", MType: "gauge"}})
+		assert.NoError(t, err)
+
+		// превышение общего лимита
+		_, err = tr.Admit("agent:c", series("c1"))
+		assert.ErrorIs(t, err, ErrCardinalityLimit)
+
+		// серии, созданные другим клиентом, принимаются от любого клиента
+		_, err = tr.Admit("agent:c", series("a1"))
+		assert.NoError(t, err)
+
+		report := tr.Report(0)
+		assert.Equal(t, 3, report.TotalSeries)
+		assert.Equal(t, int64(2), report.Overflow)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		tr := NewTracker(Limits{MaxSeriesPerClient: 2, Policy: PolicyDrop})
+
+		admitted, err := tr.Admit("agent:a", series("a1", "a2", "a3", "a1", "a3"))
+		require.NoError(t, err)
+		assert.Equal(t, series("a1", "a2", "a1"), admitted)
+
+		admitted, err = tr.Admit("agent:a", series("a3"))
+		require.NoError(t, err)
+		assert.Empty(t, admitted)
+
+		report := tr.Report(0)
+		assert.Equal(t, 2, report.TotalSeries)
+		assert.Equal(t, []ClientReport{{Client: "agent:a", Series: 2, Overflow: 2}}, report.TopClients)
+	})
+
+	t.Run("log", func(t *testing.T) {
+		tr := NewTracker(Limits{MaxSeries: 1, Policy: PolicyLog})
+
+		admitted, err := tr.Admit("agent:a", series("a1", "a2"))
+		require.NoError(t, err)
+		assert.Len(t, admitted, 2)
+
+		report := tr.Report(0)
+		assert.Equal(t, 2, report.TotalSeries)
+		assert.Equal(t, int64(1), report.Overflow)
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		tr := NewTracker(Limits{})
+		admitted, err := tr.Admit("agent:a", series("a1", "a2", "a3"))
+		require.NoError(t, err)
+		assert.Len(t, admitted, 3)
+		assert.Equal(t, PolicyReject, tr.Limits().Policy)
+	})
+}
+
+func TestTrackerSeed(t *testing.T) {
+	tr := NewTracker(Limits{MaxSeries: 2})
+	tr.Seed(series("s1", "s2", "s1"))
+
+	_, err := tr.Admit("agent:a", series("s1"))
+	assert.NoError(t, err)
+	_, err = tr.Admit("agent:a", series("a1"))
+	assert.ErrorIs(t, err, ErrCardinalityLimit)
+
+	report := tr.Report(0)
+	assert.Equal(t, 2, report.TotalSeries)
+	assert.Equal(t, []ClientReport{
+		{Client: RestoredClient, Series: 2},
+		{Client: "agent:a", Overflow: 1},
+	}, report.TopClients)
+}
+
+func TestTrackerReport(t *testing.T) {
+	tr := NewTracker(Limits{MaxSeries: 100, MaxSeriesPerClient: 10, Policy: PolicyDrop})
+	_, err := tr.Admit("agent:a", series("a1"))
+	require.NoError(t, err)
+	_, err = tr.Admit("agent:b", series("b1", "b2", "b3"))
+	require.NoError(t, err)
+	_, err = tr.Admit("agent:c", series("c1", "c2"))
+	require.NoError(t, err)
+	_, err = tr.Admit("agent:d", series("d1", "d2"))
+	require.NoError(t, err)
+
+	report := tr.Report(3)
+	assert.Equal(t, Report{
+		TotalSeries:        8,
+		MaxSeries:          100,
+		MaxSeriesPerClient: 10,
+		Policy:             PolicyDrop,
+		TopClients: []ClientReport{
+			{Client: "agent:b", Series: 3},
+			{Client: "agent:c", Series: 2},
+			{Client: "agent:d", Series: 2},
+		},
+	}, report)
+
+	assert.Len(t, tr.Report(0).TopClients, 4)
+}
+
+func TestSetLimits(t *testing.T) {
+	defer SetLimits(Limits{})
+
+	SetLimits(Limits{MaxSeries: 5, Policy: PolicyLog})
+	assert.Equal(t, Limits{MaxSeries: 5, Policy: PolicyLog}, GetTracker().Limits())
+}
+
+func TestTrackerForget(t *testing.T) {
+	tracker := NewTracker(Limits{MaxSeriesPerClient: 2})
+	_, err := tracker.Admit("agent", series("a", "b"))
+	require.NoError(t, err)
+	_, err = tracker.Admit("agent", series("c"))
+	require.ErrorIs(t, err, ErrCardinalityLimit)
+
+	// удаление неизвестной серии ни на что не влияет
+	tracker.Forget(series("a", "unknown"))
+	assert.Equal(t, 1, tracker.Report(0).TotalSeries)
+
+	admitted, err := tracker.Admit("agent", series("c"))
+	require.NoError(t, err)
+	assert.Equal(t, series("c"), admitted)
+	assert.Equal(t, []ClientReport{{Client: "agent", Series: 2, Overflow: 1}}, tracker.Report(0).TopClients)
+}
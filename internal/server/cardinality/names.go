@@ -0,0 +1,84 @@
+package cardinality
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMaxNameLength - максимальная длина имени метрики по умолчанию, совпадает с размером колонки id в базе данных.
+const DefaultMaxNameLength = 128
+
+// nameSpecialChars - символы, допустимые в имени метрики помимо букв и цифр.
+// Символы ';' и '=' используются для записи меток в имени метрики в формате Graphite: name;key=value.
+const nameSpecialChars = "_-.:/;= "
+
+// ErrInvalidName - имя метрики не удовлетворяет правилам именования.
+var ErrInvalidName = errors.New("invalid metric name")
+
+// NameRules - правила именования метрик.
+type NameRules struct {
+	MaxLength int            // максимальная длина имени в байтах, 0 - длина по умолчанию
+	Allow     *regexp.Regexp // необязательное регулярное выражение, которому должно соответствовать имя
+}
+
+// ParseNameRules - создает правила именования метрик. Пустой pattern отключает проверку регулярным выражением.
+func ParseNameRules(maxLength int, pattern string) (NameRules, error) {
+	rules := NameRules{MaxLength: maxLength}
+	if pattern != "" {
+		allow, err := regexp.Compile(pattern)
+		if err != nil {
+			return NameRules{}, fmt.Errorf("compile metric name pattern error: %w", err)
+		}
+		rules.Allow = allow
+	}
+	return rules, nil
+}
+
+// Validate - проверяет имя метрики: имя не пустое, не длиннее допустимого, состоит из букв, цифр
+// и символов "_-.:/;= " и соответствует регулярному выражению, если оно задано.
+func (r NameRules) Validate(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is empty", ErrInvalidName)
+	}
+	maxLength := r.MaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxNameLength
+	}
+	if len(name) > maxLength {
+		return fmt.Errorf("%w: name length %d exceeds limit %d", ErrInvalidName, len(name), maxLength)
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("%w: name is not valid utf-8", ErrInvalidName)
+	}
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && !strings.ContainsRune(nameSpecialChars, c) {
+			return fmt.Errorf("%w: character %q is not allowed", ErrInvalidName, c)
+		}
+	}
+	if r.Allow != nil && !r.Allow.MatchString(name) {
+		return fmt.Errorf("%w: name does not match pattern %s", ErrInvalidName, r.Allow)
+	}
+	return nil
+}
+
+// nameRules - правила именования метрик, применяемые сервером.
+var nameRules NameRules
+
+// SetNameRules - устанавливает правила именования метрик.
+func SetNameRules(r NameRules) {
+	nameRules = r
+}
+
+// GetNameRules - возвращает правила именования метрик.
+func GetNameRules() NameRules {
+	return nameRules
+}
+
+// ValidateName - проверяет имя метрики по установленным правилам именования.
+func ValidateName(name string) error {
+	return nameRules.Validate(name)
+}
@@ -0,0 +1,59 @@
+package cardinality
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameRulesValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxLength  int
+		pattern    string
+		metricName string
+		wantErr    bool
+	}{
+		{name: "simple name", metricName: "PollCount"},
+		{name: "name with spaces and digits", metricName: "good caunter metric 2"},
+		{name: "name with labels", metricName: "cpu.load;host=web-1;dc=eu:1"},
+		{name: "unicode letters", metricName: "загрузка_cpu"},
+		{name: "empty name", metricName: "", wantErr: true},
+		{name: "default max length", metricName: strings.Repeat("a", DefaultMaxNameLength)},
+		{name: "exceed default max length", metricName: strings.Repeat("a", DefaultMaxNameLength+1), wantErr: true},
+		{name: "custom max length", maxLength: 5, metricName: "abcdef", wantErr: true},
+		{name: "forbidden character", metricName: "cpu{host}", wantErr: true},
+		{name: "control character", metricName: "cpu\nload", wantErr: true},
+		{name: "invalid utf-8", metricName: "cpu\xff", wantErr: true},
+		{name: "match pattern", pattern: `^[a-z_]+$`, metricName: "heap_alloc"},
+		{name: "not match pattern", pattern: `^[a-z_]+$`, metricName: "HeapAlloc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseNameRules(tt.maxLength, tt.pattern)
+			require.NoError(t, err)
+
+			err = rules.Validate(tt.metricName)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidName)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseNameRules(t *testing.T) {
+	_, err := ParseNameRules(0, "[")
+	assert.Error(t, err)
+
+	defer SetNameRules(NameRules{})
+	rules, err := ParseNameRules(3, "")
+	require.NoError(t, err)
+	SetNameRules(rules)
+	assert.Equal(t, 3, GetNameRules().MaxLength)
+	assert.NoError(t, ValidateName("abc"))
+	assert.ErrorIs(t, ValidateName("abcd"), ErrInvalidName)
+}
@@ -0,0 +1,135 @@
+package cardinality
+
+import (
+	"context"
+	"sync"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+// Storage - обертка над хранилищем метрик, проверяющая имена метрик и лимиты количества серий перед записью.
+// Клиент, создающий серию, определяется по идентификатору из контекста запроса.
+// Удаление метрик и удаление их серий из учета выполняются под блокировкой mu, исключающей запись метрик,
+// чтобы серия, заново созданная между удалением и Forget, не выпала из учета.
+type Storage struct {
+	repositories.IStorage
+	tracker *Tracker
+	mu      sync.RWMutex // запись метрик - RLock, удаление метрик - Lock
+}
+
+// NewStorage - фабричная функция структуры Storage.
+func NewStorage(stor repositories.IStorage, tracker *Tracker) *Storage {
+	return &Storage{
+		IStorage: stor,
+		tracker:  tracker,
+	}
+}
+
+// admit - проверяет метрики и возвращает те из них, которые следует сохранить, и метрики новых серий.
+func (s *Storage) admit(ctx context.Context, metrics []repositories.Metric) (admitted, created []repositories.Metric, err error) {
+	for _, m := range metrics {
+		if err := ValidateName(m.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+	return s.tracker.admit(ratelimit.ClientIdentityFromContext(ctx), metrics)
+}
+
+// release - освобождает серии, созданные при неудачной записи метрик в хранилище, например при конфликте типов.
+func (s *Storage) release(created []repositories.Metric, err error) error {
+	if err != nil {
+		s.tracker.Forget(created)
+	}
+	return err
+}
+
+// AddGauge - добавляет метрику типа gauge после проверки имени и лимитов.
+func (s *Storage) AddGauge(ctx context.Context, name string, value float64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	admitted, created, err := s.admit(ctx, []repositories.Metric{{ID: name, MType: "gauge"}})
+	if err != nil || len(admitted) == 0 {
+		return err
+	}
+	return s.release(created, s.IStorage.AddGauge(ctx, name, value))
+}
+
+// AddCounter - добавляет метрику типа counter после проверки имени и лимитов.
+func (s *Storage) AddCounter(ctx context.Context, name string, value int64) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	admitted, created, err := s.admit(ctx, []repositories.Metric{{ID: name, MType: "counter"}})
+	if err != nil || len(admitted) == 0 {
+		return err
+	}
+	return s.release(created, s.IStorage.AddCounter(ctx, name, value))
+}
+
+// AddMetricsFromSlice - добавляет метрики из слайса. Метрика с некорректным именем отклоняет весь слайс.
+func (s *Storage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	admitted, created, err := s.admit(ctx, metrics)
+	if err != nil || len(admitted) == 0 {
+		return err
+	}
+	return s.release(created, s.IStorage.AddMetricsFromSlice(ctx, admitted))
+}
+
+// ReplaceMetrics - заменяет все метрики хранилища метриками из слайса после проверки имен.
+// Лимиты серий не проверяются: серии замененных метрик удаляются из учета, а серии новых метрик
+// регистрируются как восстановленные.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	for _, m := range metrics {
+		if err := ValidateName(m.ID); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.IStorage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return err
+	}
+	if err := repositories.ReplaceMetrics(ctx, s.IStorage, metrics); err != nil {
+		return err
+	}
+	s.tracker.Forget(previous)
+	s.tracker.Seed(metrics)
+	return nil
+}
+
+// DeleteMetrics - удаляет метрики, удовлетворяющие фильтру, и удаляет их серии из учета.
+func (s *Storage) DeleteMetrics(ctx context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted, err := s.IStorage.DeleteMetrics(ctx, filter)
+	s.tracker.Forget(deleted)
+	return deleted, err
+}
+
+// ExpireMetrics - удаляет устаревшие метрики и удаляет их серии из учета.
+func (s *Storage) ExpireMetrics(ctx context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired, err := s.IStorage.ExpireMetrics(ctx, ttl)
+	s.tracker.Forget(expired)
+	return expired, err
+}
+
+// Seed - регистрирует в учете серий метрики, уже сохраненные в хранилище.
+func (s *Storage) Seed(ctx context.Context) error {
+	metrics, err := s.IStorage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return err
+	}
+	s.tracker.Seed(metrics)
+	return nil
+}
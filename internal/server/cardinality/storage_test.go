@@ -0,0 +1,156 @@
+package cardinality
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestStorage(t *testing.T) {
+	mem := storage.NewDefaultMemStorage()
+	require.NoError(t, mem.AddGauge(context.Background(), "stored", 1))
+
+	stor := NewStorage(mem, NewTracker(Limits{MaxSeriesPerClient: 2, Policy: PolicyDrop}))
+	require.NoError(t, stor.Seed(context.Background()))
+
+	ctx := ratelimit.WithClientIdentity(context.Background(), "agent:a")
+
+	// некорректные имена метрик
+	assert.ErrorIs(t, stor.AddGauge(ctx, "", 1), ErrInvalidName)
+	assert.ErrorIs(t, stor.AddCounter(ctx, strings.Repeat("a", DefaultMaxNameLength+1), 1), ErrInvalidName)
+
+	delta := int64(3)
+	value := 2.5
+	err := stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "good", MType: "counter", Delta: &delta},
+		{ID: "bad{name}", MType: "gauge", Value: &value},
+	})
+	assert.ErrorIs(t, err, ErrInvalidName)
+	_, err = stor.GetMetric(ctx, "counter", "good")
+	assert.Error(t, err, "batch with invalid name must not be saved")
+
+	// метрики сверх лимита клиента отбрасываются
+	require.NoError(t, stor.AddGauge(ctx, "first", 1))
+	require.NoError(t, stor.AddCounter(ctx, "second", 2))
+	require.NoError(t, stor.AddCounter(ctx, "third", 3))
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "second", MType: "counter", Delta: &delta},
+		{ID: "fourth", MType: "gauge", Value: &value},
+	}))
+
+	got, err := stor.GetMetric(ctx, "counter", "second")
+	require.NoError(t, err)
+	assert.Equal(t, "5", got)
+	_, err = stor.GetMetric(ctx, "counter", "third")
+	assert.Error(t, err)
+	_, err = stor.GetMetric(ctx, "gauge", "fourth")
+	assert.Error(t, err)
+
+	// лимит другого клиента не исчерпан
+	other := ratelimit.WithClientIdentity(context.Background(), "agent:b")
+	require.NoError(t, stor.AddCounter(other, "third", 3))
+	got, err = stor.GetMetric(ctx, "counter", "third")
+	require.NoError(t, err)
+	assert.Equal(t, "3", got)
+
+	report := stor.tracker.Report(0)
+	assert.Equal(t, []ClientReport{
+		{Client: "agent:a", Series: 2, Overflow: 2},
+		{Client: "agent:b", Series: 1},
+		{Client: RestoredClient, Series: 1},
+	}, report.TopClients)
+}
+
+func TestStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(_ *testing.T) repositories.IStorage {
+		return NewStorage(storage.NewDefaultMemStorage(), NewTracker(Limits{}))
+	})
+}
+
+func TestStorageReleasesRejectedSeries(t *testing.T) {
+	tracker := NewTracker(Limits{MaxSeries: 3})
+	stor := NewStorage(storage.NewDefaultMemStorage(), tracker)
+	ctx := context.Background()
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	assert.ErrorIs(t, stor.AddCounter(ctx, "Alloc", 1), repositories.ErrTypeConflict)
+	delta := int64(1)
+	value := 1.0
+	assert.ErrorIs(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "PollCount", MType: "gauge", Value: &value},
+	}), repositories.ErrTypeConflict)
+
+	// серии отклоненных метрик не занимают лимит
+	assert.Equal(t, 1, tracker.Report(0).TotalSeries)
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 1))
+	require.NoError(t, stor.AddCounter(ctx, "Frees", 1))
+}
+
+// slowDeleteStorage - хранилище, которое после удаления метрик сообщает об этом в deleted
+// и ждет записи метрики, но не дольше wait.
+type slowDeleteStorage struct {
+	*storage.MemStorage
+	deleted chan struct{}
+	written chan struct{}
+	wait    time.Duration
+}
+
+func (s *slowDeleteStorage) AddGauge(ctx context.Context, name string, value float64) error {
+	defer func() { s.written <- struct{}{} }()
+	return s.MemStorage.AddGauge(ctx, name, value)
+}
+
+func (s *slowDeleteStorage) DeleteMetrics(ctx context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	deleted, err := s.MemStorage.DeleteMetrics(ctx, filter)
+	close(s.deleted)
+	select {
+	case <-s.written:
+	case <-time.After(s.wait):
+	}
+	return deleted, err
+}
+
+func TestStorageKeepsSeriesRecreatedDuringDelete(t *testing.T) {
+	mem := &slowDeleteStorage{
+		MemStorage: storage.NewDefaultMemStorage(),
+		deleted:    make(chan struct{}),
+		written:    make(chan struct{}, 2),
+		wait:       50 * time.Millisecond,
+	}
+	tracker := NewTracker(Limits{MaxSeries: 10})
+	stor := NewStorage(mem, tracker)
+	ctx := context.Background()
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	<-mem.written
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := stor.DeleteMetrics(ctx, repositories.MetricFilter{ID: "Alloc"})
+		assert.NoError(t, err)
+	}()
+	<-mem.deleted
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, stor.AddGauge(ctx, "Alloc", 2))
+	}()
+	wg.Wait()
+
+	// серия метрики, записанной во время удаления, остается в учете
+	metrics, err := mem.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(metrics), tracker.Report(0).TotalSeries)
+}
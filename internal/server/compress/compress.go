@@ -5,12 +5,14 @@ package compress
 import (
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 
 	"go.uber.org/zap"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
 )
 
 var contentTypes = []string{
@@ -19,46 +21,149 @@ var contentTypes = []string{
 	"",
 }
 
-// GzipMiddleware - мидлварь для замены оригинального http.ResponseWriter на ResponseWriter сжимающий данные,
-// если клиент поддерживает сжатие.
-func GzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
+// preferredEncodings - алгоритмы сжатия ответа в порядке предпочтения сервера.
+// Используется при равных весах алгоритмов в заголовке Accept-Encoding.
+var preferredEncodings = []string{
+	repositories.EncodingZstd,
+	repositories.EncodingBrotli,
+	repositories.EncodingGzip,
+}
+
+// requestEncodings - алгоритмы сжатия, которыми клиент может сжимать тело запроса.
+var requestEncodings = []string{
+	repositories.EncodingGzip,
+	repositories.EncodingZstd,
+	repositories.EncodingBrotli,
+}
+
+// NegotiateEncoding - выбирает алгоритм сжатия ответа по заголовку Accept-Encoding с учетом весов q.
+// Возвращает пустую строку, если клиент не поддерживает ни один из алгоритмов сервера.
+func NegotiateEncoding(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		weights[name] = q
+	}
+
+	best := ""
+	bestWeight := 0.0
+	for _, encoding := range preferredEncodings {
+		q, ok := weights[encoding]
+		if !ok {
+			// звездочка задает вес для всех алгоритмов, не перечисленных явно
+			q, ok = weights["*"]
+		}
+		if ok && q > bestWeight {
+			best = encoding
+			bestWeight = q
+		}
+	}
+	return best
+}
+
+// requestCodings - разбирает заголовок Content-Encoding тела запроса. Кодировки перечисляются в порядке их
+// применения клиентом, x-gzip считается синонимом gzip, identity пропускается. Возвращает false, если
+// кодировка не поддерживается сервером.
+func requestCodings(contentEncoding string) ([]string, bool) {
+	codings := make([]string, 0, 1)
+	for _, coding := range strings.Split(contentEncoding, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		switch {
+		case coding == "" || coding == "identity":
+			continue
+		case coding == "x-gzip":
+			coding = repositories.EncodingGzip
+		case !slices.Contains(requestEncodings, coding):
+			return nil, false
+		}
+		codings = append(codings, coding)
+	}
+	return codings, true
+}
+
+// Middleware - мидлварь для замены оригинального http.ResponseWriter на ResponseWriter сжимающий данные,
+// если клиент поддерживает сжатие. Алгоритм сжатия ответа (zstd, br или gzip) выбирается по заголовку Accept-Encoding.
+// Тело запроса распаковывается в соответствии с заголовком Content-Encoding, который может перечислять
+// несколько кодировок; на тело с неподдерживаемой кодировкой, например deflate, сервер отвечает статусом 415.
+// Размер распакованного тела ограничен квотой ratelimit.Limits.MaxBodySize.
+func Middleware(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// проверяем, что клиент отправил серверу сжатые данные
+		contentEncoding := r.Header.Get("Content-Encoding")
+		codings, ok := requestCodings(contentEncoding)
+		if !ok {
+			logger.ServerLog.Debug("unsupported content encoding", zap.String("Content-Encoding", contentEncoding))
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if len(codings) > 0 {
+			logger.ServerLog.Debug("client push encoding data, needed decompress", zap.String("Content-Encoding", contentEncoding))
+			// кодировки снимаются в порядке, обратном порядку их применения
+			body := r.Body
+			for i := len(codings) - 1; i >= 0; i-- {
+				// оборачиваем тело запроса в io.Reader с поддержкой декомпрессии
+				cr, err := repositories.NewEncodingCompressReader(body, codings[i])
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				defer cr.Close()
+				body = cr
+			}
+			// меняем тело запроса на новое
+			r.Body = body
+			// квота на размер тела ограничивает и распакованные данные: небольшое сжатое тело может
+			// распаковаться в гигабайты
+			if maxSize := ratelimit.GetLimiter().Limits().MaxBodySize; maxSize > 0 {
+				r.Body = http.MaxBytesReader(w, body, maxSize)
+			}
+		}
+
 		// по умолчанию устанавливаем оригинальный http.ResponseWriter как тот,
 		// который будем передавать следующей функции
 		ow := w
 
-		// проверяем, что клиент умеет получать от сервера сжатые данные в формате gzip
+		// проверяем, что клиент умеет получать от сервера сжатые данные
 		acceptEncoding := r.Header.Get("Accept-Encoding")
-		supportsGzip := strings.Contains(acceptEncoding, "gzip")
+		encoding := NegotiateEncoding(acceptEncoding)
 		contentType := r.Header.Get("Content-Type")
-		if supportsGzip && slices.Contains(contentTypes, contentType) {
+		if encoding != "" && slices.Contains(contentTypes, contentType) {
 			logger.ServerLog.Debug("client accept encoding, compress answer data", zap.String("Accept-Encoding", acceptEncoding),
-				zap.String("Content-Type", contentType))
+				zap.String("encoding", encoding), zap.String("Content-Type", contentType))
 			// оборачиваем оригинальный http.ResponseWriter новым с поддержкой сжатия
-			cw := repositories.NewCompressWriter(w)
-			// меняем оригинальный http.ResponseWriter на новый
-			ow = cw
-			// не забываем отправить клиенту все сжатые данные после завершения middleware
-			defer cw.Close()
-		}
-
-		// проверяем, что клиент отправил серверу сжатые данные в формате gzip
-		contentEncoding := r.Header.Get("Content-Encoding")
-		sendsGzip := strings.Contains(contentEncoding, "gzip")
-		if sendsGzip {
-			logger.ServerLog.Debug("client push encoding data, needed decompress", zap.String("Content-Encoding", contentEncoding))
-			// оборачиваем тело запроса в io.Reader с поддержкой декомпрессии
-			cr, err := repositories.NewCompressReader(r.Body)
+			cw, err := repositories.NewEncodingCompressWriter(w, encoding, 0)
 			if err != nil {
+				logger.ServerLog.Error("create compress writer error", zap.String("error", error.Error(err)))
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
-			// меняем тело запроса на новое
-			r.Body = cr
-			defer cr.Close()
+			w.Header().Add("Vary", "Accept-Encoding")
+			// меняем оригинальный http.ResponseWriter на новый
+			ow = cw
+			// не забываем отправить клиенту все сжатые данные после завершения middleware
+			defer cw.Close()
 		}
 
 		// передаём управление хендлеру
 		h.ServeHTTP(ow, r)
 	}
 }
+
+// GzipMiddleware - прежнее имя Middleware, когда поддерживалось только сжатие gzip.
+//
+// Deprecated: используйте Middleware.
+func GzipMiddleware(h http.HandlerFunc) http.HandlerFunc {
+	return Middleware(h)
+}
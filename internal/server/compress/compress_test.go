@@ -0,0 +1,226 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{
+			name:           "empty header",
+			acceptEncoding: "",
+			want:           "",
+		},
+		{
+			name:           "only gzip",
+			acceptEncoding: "gzip",
+			want:           repositories.EncodingGzip,
+		},
+		{
+			name:           "server preference with equal weights",
+			acceptEncoding: "gzip, deflate, br, zstd",
+			want:           repositories.EncodingZstd,
+		},
+		{
+			name:           "client weights",
+			acceptEncoding: "zstd;q=0.5, gzip;q=0.8, br;q=0.1",
+			want:           repositories.EncodingGzip,
+		},
+		{
+			name:           "zero weight disables encoding",
+			acceptEncoding: "zstd;q=0, br",
+			want:           repositories.EncodingBrotli,
+		},
+		{
+			name:           "wildcard",
+			acceptEncoding: "*",
+			want:           repositories.EncodingZstd,
+		},
+		{
+			name:           "wildcard with excluded encodings",
+			acceptEncoding: "zstd;q=0, br;q=0, *;q=0.3",
+			want:           repositories.EncodingGzip,
+		},
+		{
+			name:           "unsupported encodings",
+			acceptEncoding: "deflate, compress",
+			want:           "",
+		},
+		{
+			name:           "invalid weight",
+			acceptEncoding: "zstd;q=abc, gzip",
+			want:           repositories.EncodingGzip,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NegotiateEncoding(tt.acceptEncoding))
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	body := []byte(`{"id":"gauge","type":"gauge","value":1.5}`)
+
+	// обработчик возвращает клиенту полученное тело запроса
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	handler := Middleware(echo)
+
+	compressBody := func(encoding string) []byte {
+		var b bytes.Buffer
+		w, err := repositories.NewEncoder(&b, encoding, 0)
+		require.NoError(t, err)
+		_, err = w.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return b.Bytes()
+	}
+
+	for _, requestEncoding := range []string{repositories.EncodingGzip, repositories.EncodingZstd, repositories.EncodingBrotli} {
+		for _, acceptEncoding := range []string{"", repositories.EncodingGzip, repositories.EncodingZstd, repositories.EncodingBrotli} {
+			t.Run(requestEncoding+" to "+acceptEncoding, func(t *testing.T) {
+				request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(compressBody(requestEncoding)))
+				request.Header.Set("Content-Type", "application/json")
+				request.Header.Set("Content-Encoding", requestEncoding)
+				request.Header.Set("Accept-Encoding", acceptEncoding)
+				w := httptest.NewRecorder()
+				handler(w, request)
+
+				res := w.Result()
+				defer res.Body.Close()
+				assert.Equal(t, http.StatusOK, res.StatusCode)
+				assert.Equal(t, acceptEncoding, res.Header.Get("Content-Encoding"))
+
+				data, err := io.ReadAll(res.Body)
+				require.NoError(t, err)
+				if acceptEncoding != "" {
+					r, err := repositories.NewDecoder(bytes.NewReader(data), acceptEncoding)
+					require.NoError(t, err)
+					data, err = io.ReadAll(r)
+					require.NoError(t, err)
+				}
+				assert.Equal(t, body, data)
+			})
+		}
+	}
+
+	// неподдерживаемый алгоритм сжатия тела запроса
+	{
+		request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(body))
+		request.Header.Set("Content-Encoding", "deflate")
+		w := httptest.NewRecorder()
+		handler(w, request)
+
+		res := w.Result()
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	}
+	// некорректные сжатые данные
+	{
+		request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(body))
+		request.Header.Set("Content-Encoding", repositories.EncodingGzip)
+		w := httptest.NewRecorder()
+		handler(w, request)
+
+		res := w.Result()
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	}
+}
+
+func TestMiddlewareDecompressedBodySize(t *testing.T) {
+	ratelimit.SetLimits(ratelimit.Limits{MaxBodySize: 4096})
+	defer ratelimit.SetLimits(ratelimit.Limits{})
+
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			require.ErrorAs(t, err, &maxBytesErr)
+			ratelimit.QuotaExceeded(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, encoding := range []string{repositories.EncodingGzip, repositories.EncodingZstd, repositories.EncodingBrotli} {
+		t.Run(encoding, func(t *testing.T) {
+			for size, code := range map[int]int{1024: http.StatusOK, 1 << 20: http.StatusTooManyRequests} {
+				// сжатое тело меньше квоты, распакованное может быть больше
+				var b bytes.Buffer
+				w, err := repositories.NewEncoder(&b, encoding, 0)
+				require.NoError(t, err)
+				_, err = w.Write(make([]byte, size))
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+				require.Less(t, b.Len(), 4096)
+
+				request := httptest.NewRequest(http.MethodPost, "/updates/", &b)
+				request.Header.Set("Content-Encoding", encoding)
+				rec := httptest.NewRecorder()
+				handler(rec, request)
+				assert.Equal(t, code, rec.Code, size)
+			}
+		})
+	}
+}
+
+func TestMiddlewareContentEncodings(t *testing.T) {
+	body := []byte(`{"id":"gauge","type":"gauge","value":1.5}`)
+	encode := func(data []byte, encoding string) []byte {
+		var b bytes.Buffer
+		w, err := repositories.NewEncoder(&b, encoding, 0)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            []byte
+		code            int
+	}{
+		{name: "identity", contentEncoding: "identity", body: body, code: http.StatusOK},
+		{name: "x-gzip", contentEncoding: "x-gzip", body: encode(body, repositories.EncodingGzip), code: http.StatusOK},
+		{name: "upper case with identity", contentEncoding: "GZIP, identity", body: encode(body, repositories.EncodingGzip), code: http.StatusOK},
+		{name: "several codings", contentEncoding: "gzip, zstd",
+			body: encode(encode(body, repositories.EncodingGzip), repositories.EncodingZstd), code: http.StatusOK},
+		{name: "unsupported coding in list", contentEncoding: "gzip, deflate", body: body, code: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// прежнее имя мидлвари продолжает работать
+			handler := GzipMiddleware(func(w http.ResponseWriter, r *http.Request) {
+				data, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, body, data)
+			})
+			request := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(tt.body))
+			request.Header.Set("Content-Encoding", tt.contentEncoding)
+			w := httptest.NewRecorder()
+			handler(w, request)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
@@ -20,6 +20,67 @@ type Configs struct {
 	DatabaseDSN   string                `json:"database_dsn"`   // аналог переменной окружения DATABASE_DSN или флага -d
 	CryptoKey     string                `json:"crypto_key"`     // аналог переменной окружения CRYPTO_KEY или флага -crypto-key
 	TrustedSubnet string                `json:"trusted_subnet"` // аналог переменной окружения TRUSTED_SUBNET или флага -t
+
+	RateLimitRPS    float64            `json:"rate_limit_rps"`    // аналог переменной окружения RATE_LIMIT_RPS или флага -rate-limit
+	RateLimitBurst  int                `json:"rate_limit_burst"`  // аналог переменной окружения RATE_LIMIT_BURST или флага -rate-burst
+	RouteRateLimits map[string]float64 `json:"route_rate_limits"` // ограничение частоты запросов для отдельных маршрутов и gRPC методов
+	MaxBatchMetrics int                `json:"max_batch_metrics"` // аналог переменной окружения MAX_BATCH_METRICS или флага -max-batch
+	MaxBodySize     int64              `json:"max_body_size"`     // аналог переменной окружения MAX_BODY_SIZE или флага -max-body
+
+	MaxSeries           int    `json:"max_series"`             // аналог переменной окружения MAX_SERIES или флага -max-series
+	MaxSeriesPerAgent   int    `json:"max_series_per_agent"`   // аналог переменной окружения MAX_SERIES_PER_AGENT или флага -max-series-per-agent
+	CardinalityPolicy   string `json:"cardinality_policy"`     // аналог переменной окружения CARDINALITY_POLICY или флага -cardinality-policy
+	MetricNameMaxLength int    `json:"metric_name_max_length"` // аналог переменной окружения METRIC_NAME_MAX_LENGTH или флага -name-max-length
+	MetricNamePattern   string `json:"metric_name_pattern"`    // аналог переменной окружения METRIC_NAME_PATTERN или флага -name-pattern
+
+	GaugeTTL       repositories.Duration            `json:"gauge_ttl"`       // аналог переменной окружения GAUGE_TTL или флага -gauge-ttl
+	CounterTTL     repositories.Duration            `json:"counter_ttl"`     // аналог переменной окружения COUNTER_TTL или флага -counter-ttl
+	MetricTTL      map[string]repositories.Duration `json:"metric_ttl"`      // время жизни отдельных метрик или групп метрик с префиксом вида "name*"
+	ExpireInterval repositories.Duration            `json:"expire_interval"` // аналог переменной окружения EXPIRE_INTERVAL или флага -expire-interval
+
+	DBMaxConns          int                   `json:"db_max_conns"`           // аналог переменной окружения DB_MAX_CONNS или флага -db-max-conns
+	DBMinConns          int                   `json:"db_min_conns"`           // аналог переменной окружения DB_MIN_CONNS или флага -db-min-conns
+	DBMaxConnLifetime   repositories.Duration `json:"db_max_conn_lifetime"`   // аналог переменной окружения DB_MAX_CONN_LIFETIME или флага -db-max-conn-lifetime
+	DBMaxConnIdleTime   repositories.Duration `json:"db_max_conn_idle_time"`  // аналог переменной окружения DB_MAX_CONN_IDLE_TIME или флага -db-max-conn-idle-time
+	DBHealthCheckPeriod repositories.Duration `json:"db_health_check_period"` // аналог переменной окружения DB_HEALTH_CHECK_PERIOD или флага -db-health-check-period
+	DBStatementCache    int                   `json:"db_statement_cache"`     // аналог переменной окружения DB_STATEMENT_CACHE или флага -db-statement-cache
+	DBConnectTimeout    repositories.Duration `json:"db_connect_timeout"`     // аналог переменной окружения DB_CONNECT_TIMEOUT или флага -db-connect-timeout
+
+	WriteBehindInterval   repositories.Duration `json:"write_behind_interval"`    // аналог переменной окружения WRITE_BEHIND_INTERVAL или флага -write-behind-interval
+	WriteBehindFlushSize  int                   `json:"write_behind_flush_size"`  // аналог переменной окружения WRITE_BEHIND_FLUSH_SIZE или флага -write-behind-flush-size
+	WriteBehindMaxPending int                   `json:"write_behind_max_pending"` // аналог переменной окружения WRITE_BEHIND_MAX_PENDING или флага -write-behind-max-pending
+	WriteBehindMaxWait    repositories.Duration `json:"write_behind_max_wait"`    // аналог переменной окружения WRITE_BEHIND_MAX_WAIT или флага -write-behind-max-wait
+
+	ReadCacheTTL    repositories.Duration `json:"read_cache_ttl"`    // аналог переменной окружения READ_CACHE_TTL или флага -read-cache-ttl
+	ReadCacheNotify bool                  `json:"read_cache_notify"` // аналог переменной окружения READ_CACHE_NOTIFY или флага -read-cache-notify
+
+	MemShards int `json:"mem_shards"` // аналог переменной окружения MEM_SHARDS или флага -mem-shards
+
+	KVStoragePath string `json:"kv_storage_path"` // аналог переменной окружения KV_STORAGE_PATH или флага -kv-path
+
+	StreamHeartbeat repositories.Duration `json:"stream_heartbeat"` // аналог переменной окружения STREAM_HEARTBEAT или флага -stream-heartbeat
+	StreamBuffer    int                   `json:"stream_buffer"`    // аналог переменной окружения STREAM_BUFFER или флага -stream-buffer
+
+	AlertRules    string                `json:"alert_rules"`    // аналог переменной окружения ALERT_RULES или флага -alert-rules
+	AlertInterval repositories.Duration `json:"alert_interval"` // аналог переменной окружения ALERT_INTERVAL или флага -alert-interval
+
+	NotifyConfig string `json:"notify_config"` // аналог переменной окружения NOTIFY_CONFIG или флага -notify-config
+
+	History                bool                  `json:"history"`                  // аналог переменной окружения HISTORY или флага -history
+	HistoryTiers           string                `json:"history_tiers"`            // аналог переменной окружения HISTORY_TIERS или флага -history-tiers
+	HistoryCompactInterval repositories.Duration `json:"history_compact_interval"` // аналог переменной окружения HISTORY_COMPACT_INTERVAL или флага -history-compact-interval
+
+	RecordingRules    string                `json:"recording_rules"`    // аналог переменной окружения RECORDING_RULES или флага -recording-rules
+	RecordingInterval repositories.Duration `json:"recording_interval"` // аналог переменной окружения RECORDING_INTERVAL или флага -recording-interval
+
+	InfluxTags     string `json:"influx_tags"`     // аналог переменной окружения INFLUX_TAGS или флага -influx-tags
+	InfluxCounters bool   `json:"influx_counters"` // аналог переменной окружения INFLUX_COUNTERS или флага -influx-counters
+
+	GraphiteAddress  string `json:"graphite_address"`  // аналог переменной окружения GRAPHITE_ADDRESS или флага -graphite-address
+	GraphiteCounters string `json:"graphite_counters"` // аналог переменной окружения GRAPHITE_COUNTERS или флага -graphite-counters
+
+	OTLPResource           string `json:"otlp_resource"`            // аналог переменной окружения OTLP_RESOURCE или флага -otlp-resource
+	OTLPResourceAttributes string `json:"otlp_resource_attributes"` // аналог переменной окружения OTLP_RESOURCE_ATTRIBUTES или флага -otlp-resource-attributes
 }
 
 // ParseConfigFile - функция для переопределения параметров конфигурации из файла конфигурации.
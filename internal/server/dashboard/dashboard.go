@@ -0,0 +1,186 @@
+// Package dashboard содержит веб-интерфейс сервера метрик: таблицу метрик с поиском и сортировкой,
+// которая обновляется через Server-Sent Events. Файлы интерфейса встроены в бинарный файл сервера
+// и не загружают ресурсы со сторонних серверов, поэтому интерфейс работает без доступа в интернет.
+package dashboard
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Prefix - путь, по которому доступны файлы интерфейса.
+const Prefix = "/dashboard/"
+
+// EventsInterval - период, с которым проверяются изменения метрик для потоков событий.
+const EventsInterval = time.Second
+
+//go:embed static
+var static embed.FS
+
+var (
+	closing   = make(chan struct{})
+	closeOnce sync.Once
+)
+
+// CloseStreams - завершает открытые потоки событий, чтобы сервер мог остановиться, не дожидаясь
+// отключения браузеров.
+func CloseStreams() {
+	closeOnce.Do(func() {
+		close(closing)
+	})
+}
+
+// Handler - возвращает обработчик страницы интерфейса и ее файлов. Запрос к корню сервера возвращает
+// страницу index.html, запрос Prefix + имя - файл из каталога static.
+func Handler() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		name := strings.TrimPrefix(req.URL.Path, Prefix)
+		if req.URL.Path == "/" {
+			name = "index.html"
+		}
+		data, err := fs.ReadFile(static, path.Join("static", path.Clean("/"+name)))
+		if err != nil {
+			http.NotFound(res, req)
+			return
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		res.Header().Set("Content-Type", contentType)
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Header().Set("Status-Code", "200")
+		if _, err := res.Write(data); err != nil {
+			logger.ServerLog.Error("write dashboard file error", zap.String("error", error.Error(err)))
+		}
+	}
+}
+
+// snapshot - последние отправленные клиенту значения метрик.
+type snapshot map[string]repositories.Metric
+
+// diff - возвращает метрики, изменившиеся по сравнению со снимком, и имена удаленных метрик,
+// и обновляет снимок.
+func (s snapshot) diff(metrics []repositories.Metric) (changed []repositories.Metric, removed []string) {
+	seen := make(map[string]struct{}, len(metrics))
+	for _, metric := range metrics {
+		seen[metric.ID] = struct{}{}
+		if prev, ok := s[metric.ID]; ok && equal(prev, metric) {
+			continue
+		}
+		s[metric.ID] = metric
+		changed = append(changed, metric)
+	}
+	for id := range s {
+		if _, ok := seen[id]; !ok {
+			delete(s, id)
+			removed = append(removed, id)
+		}
+	}
+	return changed, removed
+}
+
+// equal - сравнивает тип и значение метрик.
+func equal(a, b repositories.Metric) bool {
+	if a.MType != b.MType || (a.Value == nil) != (b.Value == nil) || (a.Delta == nil) != (b.Delta == nil) {
+		return false
+	}
+	return (a.Value == nil || *a.Value == *b.Value) && (a.Delta == nil || *a.Delta == *b.Delta)
+}
+
+// writeEvent - записывает событие name с данными data в формате Server-Sent Events.
+func writeEvent(res http.ResponseWriter, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	return http.NewResponseController(res).Flush()
+}
+
+// Events - поток Server-Sent Events для интерфейса. Первое событие update содержит все метрики хранилища,
+// следующие - метрики, изменившиеся с предыдущего опроса. Событие remove содержит имена удаленных метрик.
+// Хранилище опрашивает общий для всех потоков poller.
+func Events(res http.ResponseWriter, req *http.Request, poller *Poller) {
+	metrics, changes, unsubscribe, err := poller.Subscribe(req.Context())
+	if err != nil {
+		logger.ServerLog.Error("get metrics for dashboard error", zap.String("error", error.Error(err)))
+		http.Error(res, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer unsubscribe()
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.Header().Set("Status-Code", "200")
+	if err := writeEvent(res, "update", metrics); err != nil {
+		logger.ServerLog.Debug("dashboard events stream is closed", zap.String("error", error.Error(err)))
+		return
+	}
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-closing:
+			return
+		case c, ok := <-changes:
+			if !ok {
+				// поток не успевал забирать изменения, браузер переподключится и получит все метрики
+				return
+			}
+			if err := sendChange(res, c); err != nil {
+				logger.ServerLog.Debug("dashboard events stream is closed", zap.String("error", error.Error(err)))
+				return
+			}
+		}
+	}
+}
+
+// sendChange - отправляет клиенту изменения метрик. Если метрики не изменились, отправляется комментарий.
+func sendChange(res http.ResponseWriter, c change) error {
+	if c.changed != nil {
+		if err := writeEvent(res, "update", c.changed); err != nil {
+			return err
+		}
+	}
+	if c.removed != nil {
+		if err := writeEvent(res, "remove", c.removed); err != nil {
+			return err
+		}
+	}
+	if c.changed == nil && c.removed == nil {
+		// комментарий не дает прокси закрыть соединение без данных
+		if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+			return err
+		}
+		return http.NewResponseController(res).Flush()
+	}
+	return nil
+}
+
+// EventsHandler - обертка над Events для возможности установить хранилище метрик. Все потоки событий
+// обработчика используют один опрос хранилища.
+func EventsHandler(stor repositories.MetricsReader) http.HandlerFunc {
+	poller := NewPoller(stor, EventsInterval)
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		Events(res, req, poller)
+	}
+	return fn
+}
@@ -0,0 +1,199 @@
+package dashboard
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestHandler(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/", Handler())
+	r.Get(Prefix+"*", Handler())
+
+	tests := []struct {
+		name        string
+		path        string
+		code        int
+		contentType string
+		contains    string
+	}{
+		{name: "index", path: "/", code: 200, contentType: "text/html", contains: "/dashboard/app.js"},
+		{name: "script", path: "/dashboard/app.js", code: 200, contentType: "text/javascript", contains: "EventSource"},
+		{name: "style", path: "/dashboard/style.css", code: 200, contentType: "text/css"},
+		{name: "unknown file", path: "/dashboard/missing.js", code: 404},
+		{name: "path outside static", path: "/dashboard/../dashboard.go", code: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, tt.code, res.StatusCode)
+			if tt.code != 200 {
+				return
+			}
+			assert.Contains(t, res.Header.Get("Content-Type"), tt.contentType)
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Contains(t, string(body), tt.contains)
+			// интерфейс не загружает ресурсы со сторонних серверов
+			assert.NotContains(t, string(body), "https://")
+		})
+	}
+}
+
+// event - событие потока Server-Sent Events.
+type event struct {
+	name string
+	data string
+}
+
+// readEvent - читает из потока следующее событие, пропуская комментарии.
+func readEvent(t *testing.T, reader *bufio.Reader) event {
+	var e event
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.name != "":
+			return e
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewMemStorage(map[string]float64{"Alloc": 1}, map[string]int64{"PollCount": 2})
+	poller := NewPoller(stor, 10*time.Millisecond)
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		Events(res, req, poller)
+	}))
+	defer srv.Close()
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	request, err := http.NewRequestWithContext(reqCtx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	reader := bufio.NewReader(res.Body)
+
+	// первое событие содержит все метрики
+	first := readEvent(t, reader)
+	assert.Equal(t, "update", first.name)
+	var metrics []repositories.Metric
+	require.NoError(t, json.Unmarshal([]byte(first.data), &metrics))
+	assert.Len(t, metrics, 2)
+
+	// следующие события содержат только изменения
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	changed := readEvent(t, reader)
+	assert.Equal(t, "update", changed.name)
+	assert.JSONEq(t, `[{"id":"PollCount","type":"counter","delta":5}]`, changed.data)
+
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{ID: "Alloc"})
+	require.NoError(t, err)
+	removed := readEvent(t, reader)
+	assert.Equal(t, "remove", removed.name)
+	assert.JSONEq(t, `["Alloc"]`, removed.data)
+}
+
+func TestEventsEmptyStorage(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/dashboard/events", nil)
+	ctx, cancel := context.WithTimeout(request.Context(), 50*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	Events(w, request.WithContext(ctx), NewPoller(storage.NewDefaultMemStorage(), 10*time.Millisecond))
+
+	// пустое хранилище отправляет пустой список, затем только комментарии
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "event: update\ndata: []\n\n"), body)
+	assert.Contains(t, body, ": ping\n\n")
+	assert.Equal(t, 1, strings.Count(body, "event:"))
+}
+
+// countingStorage - хранилище в памяти, считающее чтения всех метрик.
+type countingStorage struct {
+	*storage.MemStorage
+	reads atomic.Int64
+}
+
+func (s *countingStorage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	s.reads.Add(1)
+	return s.MemStorage.GetAllMetricsSlice(ctx)
+}
+
+func TestPollerShared(t *testing.T) {
+	ctx := context.Background()
+	stor := &countingStorage{MemStorage: storage.NewMemStorage(map[string]float64{"Alloc": 1}, nil)}
+	poller := NewPoller(stor, 20*time.Millisecond)
+
+	// все потоки получают изменения одного опроса хранилища
+	const streams = 5
+	changes := make([]<-chan change, 0, streams)
+	for i := 0; i < streams; i++ {
+		metrics, c, unsubscribe, err := poller.Subscribe(ctx)
+		require.NoError(t, err)
+		defer unsubscribe()
+		assert.Len(t, metrics, 1)
+		changes = append(changes, c)
+	}
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 2))
+	for _, c := range changes {
+		for update := range c {
+			if update.changed != nil {
+				require.Len(t, update.changed, 1)
+				assert.Equal(t, 2.0, *update.changed[0].Value)
+				break
+			}
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	// за 100 мс при периоде 20 мс опросов не больше, чем для одного потока
+	assert.LessOrEqual(t, stor.reads.Load(), int64(10))
+}
+
+func TestPollerStopsWithoutStreams(t *testing.T) {
+	ctx := context.Background()
+	stor := &countingStorage{MemStorage: storage.NewDefaultMemStorage()}
+	poller := NewPoller(stor, 5*time.Millisecond)
+
+	_, _, unsubscribe, err := poller.Subscribe(ctx)
+	require.NoError(t, err)
+	unsubscribe()
+	reads := stor.reads.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.LessOrEqual(t, stor.reads.Load(), reads+1, "storage must not be polled without streams")
+
+	// новый поток получает значения нового опроса
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	metrics, _, unsubscribe, err := poller.Subscribe(ctx)
+	require.NoError(t, err)
+	defer unsubscribe()
+	assert.Len(t, metrics, 1)
+}
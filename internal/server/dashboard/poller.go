@@ -0,0 +1,143 @@
+package dashboard
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// subscriberBuffer - количество изменений, которые поток событий может не забрать, прежде чем будет отключен.
+const subscriberBuffer = 16
+
+// change - изменения метрик между двумя опросами хранилища. Пустое изменение означает, что метрики
+// не изменились, и используется потоками событий для отправки комментария.
+type change struct {
+	changed []repositories.Metric
+	removed []string
+}
+
+// Poller - общий для всех потоков событий опрос хранилища. Пока открыт хотя бы один поток, хранилище
+// опрашивается одной горутиной с периодом interval, а изменения рассылаются всем потокам, поэтому
+// нагрузка на хранилище не зависит от количества открытых страниц интерфейса.
+type Poller struct {
+	storage  repositories.MetricsReader
+	interval time.Duration
+
+	pollMu sync.Mutex // не дает выполнять опросы одновременно
+
+	mu      sync.Mutex
+	current snapshot // значения метрик последнего опроса
+	ready   bool     // current получен опросом после подключения первого потока
+	subs    map[chan change]struct{}
+	stop    chan struct{} // закрывается, когда отключается последний поток, nil - опрос не запущен
+}
+
+// NewPoller - фабричная функция структуры Poller.
+func NewPoller(stor repositories.MetricsReader, interval time.Duration) *Poller {
+	return &Poller{
+		storage:  stor,
+		interval: interval,
+		current:  make(snapshot),
+		subs:     make(map[chan change]struct{}),
+	}
+}
+
+// Subscribe - подключает поток событий. Возвращает все метрики хранилища, канал последующих изменений
+// и функцию отключения. Канал закрывается, если поток не успевает забирать изменения.
+func (p *Poller) Subscribe(ctx context.Context) ([]repositories.Metric, <-chan change, func(), error) {
+	p.mu.Lock()
+	ready := p.ready
+	p.mu.Unlock()
+	if !ready {
+		if err := p.poll(ctx); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := make(chan change, subscriberBuffer)
+	p.subs[c] = struct{}{}
+	if p.stop == nil {
+		p.stop = make(chan struct{})
+		go p.run(p.stop)
+	}
+	return p.current.metrics(), c, func() { p.unsubscribe(c) }, nil
+}
+
+// unsubscribe - отключает поток событий и останавливает опрос, если потоков не осталось.
+func (p *Poller) unsubscribe(c chan change) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remove(c)
+	if len(p.subs) == 0 && p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+		// без опроса значения устаревают, поэтому следующий поток получит значения нового опроса
+		p.ready = false
+	}
+}
+
+// remove - удаляет поток событий и закрывает его канал. Вызывается под блокировкой mu.
+func (p *Poller) remove(c chan change) {
+	if _, ok := p.subs[c]; !ok {
+		return
+	}
+	delete(p.subs, c)
+	close(c)
+}
+
+// run - опрашивает хранилище до закрытия stop.
+func (p *Poller) run(stop chan struct{}) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if err := p.poll(context.Background()); err != nil {
+			logger.ServerLog.Error("poll metrics for dashboard error", zap.String("error", error.Error(err)))
+		}
+	}
+}
+
+// poll - читает метрики хранилища и рассылает изменения подключенным потокам.
+func (p *Poller) poll(ctx context.Context) error {
+	p.pollMu.Lock()
+	defer p.pollMu.Unlock()
+	metrics, err := p.storage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	changed, removed := p.current.diff(metrics)
+	p.ready = true
+	for c := range p.subs {
+		select {
+		case c <- change{changed: changed, removed: removed}:
+		default:
+			p.remove(c)
+		}
+	}
+	return nil
+}
+
+// metrics - возвращает метрики снимка, упорядоченные по имени.
+func (s snapshot) metrics() []repositories.Metric {
+	result := make([]repositories.Metric, 0, len(s))
+	for _, metric := range s {
+		result = append(result, metric)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
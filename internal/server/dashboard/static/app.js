@@ -0,0 +1,290 @@
+// Таблица метрик сервера. Значения приходят событиями потока /dashboard/events, график изменения
+// строится по значениям, полученным с момента открытия страницы. Если на сервере включена история
+// значений метрик, график дополняется значениями за последний час из /api/history.
+"use strict";
+
+(function () {
+    const HISTORY_SIZE = 60;
+    const HISTORY_RANGE_SECONDS = 3600;
+    const HISTORY_REQUESTS = 4; // количество одновременных запросов истории
+    const SVG_NS = "http://www.w3.org/2000/svg";
+
+    // метрики по имени: {id, type, value, history, updated}
+    const metrics = new Map();
+    const state = { sort: "id", desc: false, search: "", type: "" };
+
+    const body = document.getElementById("metrics");
+    const search = document.getElementById("search");
+    const typeSelect = document.getElementById("type");
+    const count = document.getElementById("count");
+    const empty = document.getElementById("empty");
+    const status = document.getElementById("status");
+
+    // загрузка истории: historyEnabled равен false, если история на сервере отключена
+    let historyEnabled = true;
+    let historyActive = 0;
+    const historyQueue = [];
+
+    function metricValue(m) {
+        return m.type === "counter" ? m.delta : m.value;
+    }
+
+    function formatValue(v) {
+        if (Number.isInteger(v)) {
+            return v.toLocaleString("en-US");
+        }
+        return Number(v.toPrecision(8)).toString();
+    }
+
+    function formatTime(date) {
+        return date.toLocaleTimeString();
+    }
+
+    // update - применяет изменения метрик. Если snapshot равен true, список содержит все метрики сервера
+    // и метрики, которых в нем нет, удаляются.
+    function update(list, snapshot) {
+        const now = new Date();
+        if (snapshot) {
+            const ids = new Set(list.map(function (m) { return m.id; }));
+            for (const id of metrics.keys()) {
+                if (!ids.has(id)) {
+                    metrics.delete(id);
+                }
+            }
+        }
+        for (const m of list) {
+            const value = metricValue(m);
+            let entry = metrics.get(m.id);
+            if (!entry || entry.type !== m.type) {
+                entry = { id: m.id, type: m.type, history: [] };
+                metrics.set(m.id, entry);
+                requestHistory(entry);
+            } else if (snapshot && entry.value === value) {
+                continue;
+            }
+            const flash = entry.history.length > 0;
+            entry.value = value;
+            entry.updated = now;
+            entry.flash = flash;
+            entry.history.push(value);
+            if (entry.history.length > HISTORY_SIZE) {
+                entry.history.shift();
+            }
+        }
+        render();
+    }
+
+    // requestHistory - ставит в очередь загрузку истории значений метрики для графика.
+    function requestHistory(entry) {
+        if (!historyEnabled) {
+            return;
+        }
+        historyQueue.push(entry);
+        loadQueuedHistory();
+    }
+
+    function loadQueuedHistory() {
+        while (historyEnabled && historyActive < HISTORY_REQUESTS && historyQueue.length > 0) {
+            const entry = historyQueue.shift();
+            if (metrics.get(entry.id) !== entry) {
+                continue;
+            }
+            historyActive++;
+            loadHistory(entry).finally(function () {
+                historyActive--;
+                loadQueuedHistory();
+            });
+        }
+    }
+
+    function loadHistory(entry) {
+        const params = new URLSearchParams({
+            type: entry.type,
+            name: entry.id,
+            from: String(Math.floor(Date.now() / 1000) - HISTORY_RANGE_SECONDS),
+            step: Math.floor(HISTORY_RANGE_SECONDS / HISTORY_SIZE) + "s",
+        });
+        return fetch("/api/history?" + params).then(function (res) {
+            if (res.status === 404) {
+                // история значений на сервере отключена
+                historyEnabled = false;
+                historyQueue.length = 0;
+                return null;
+            }
+            return res.ok ? res.json() : null;
+        }).then(function (data) {
+            if (!data || data.points.length === 0 || metrics.get(entry.id) !== entry) {
+                return;
+            }
+            entry.history = historyValues(entry, data.points).concat(entry.history).slice(-HISTORY_SIZE);
+            render();
+        }).catch(function () {
+            // без истории график строится только по значениям потока событий
+        });
+    }
+
+    // historyValues - значения графика по точкам истории. Для gauge это последнее значение интервала,
+    // для counter история хранит приращения, поэтому значение в конце интервала восстанавливается
+    // вычитанием последующих приращений из первого значения, полученного страницей.
+    function historyValues(entry, points) {
+        if (entry.type !== "counter") {
+            return points.map(function (p) { return p.last; });
+        }
+        const values = new Array(points.length);
+        let total = entry.history.length > 0 ? entry.history[0] : entry.value;
+        for (let i = points.length - 1; i >= 0; i--) {
+            values[i] = total;
+            total -= points[i].sum;
+        }
+        return values;
+    }
+
+    function remove(ids) {
+        for (const id of ids) {
+            metrics.delete(id);
+        }
+        render();
+    }
+
+    function sparkline(history) {
+        const width = 120;
+        const height = 24;
+        const svg = document.createElementNS(SVG_NS, "svg");
+        svg.setAttribute("class", "sparkline");
+        svg.setAttribute("width", width);
+        svg.setAttribute("height", height);
+        if (history.length < 2) {
+            return svg;
+        }
+        const min = Math.min(...history);
+        const max = Math.max(...history);
+        const span = max - min || 1;
+        const step = width / (HISTORY_SIZE - 1);
+        const offset = width - step * (history.length - 1);
+        const points = history.map(function (v, i) {
+            const x = offset + i * step;
+            const y = height - 2 - ((v - min) / span) * (height - 4);
+            return x.toFixed(1) + "," + y.toFixed(1);
+        });
+        const line = document.createElementNS(SVG_NS, "polyline");
+        line.setAttribute("points", points.join(" "));
+        svg.appendChild(line);
+        return svg;
+    }
+
+    function compare(a, b) {
+        let result;
+        switch (state.sort) {
+        case "value":
+            result = a.value - b.value;
+            break;
+        case "type":
+            result = a.type.localeCompare(b.type);
+            break;
+        case "updated":
+            result = a.updated - b.updated;
+            break;
+        default:
+            result = 0;
+        }
+        if (result === 0) {
+            result = a.id < b.id ? -1 : a.id > b.id ? 1 : 0;
+        }
+        return state.desc ? -result : result;
+    }
+
+    function cell(text, className) {
+        const td = document.createElement("td");
+        td.textContent = text;
+        if (className) {
+            td.className = className;
+        }
+        return td;
+    }
+
+    function render() {
+        const query = state.search.toLowerCase();
+        const rows = [];
+        for (const entry of metrics.values()) {
+            if (state.type && entry.type !== state.type) {
+                continue;
+            }
+            if (query && !entry.id.toLowerCase().includes(query)) {
+                continue;
+            }
+            rows.push(entry);
+        }
+        rows.sort(compare);
+
+        const fragment = document.createDocumentFragment();
+        for (const entry of rows) {
+            const tr = document.createElement("tr");
+            if (entry.flash) {
+                tr.className = "flash";
+                entry.flash = false;
+            }
+            tr.appendChild(cell(entry.id, "name"));
+            tr.appendChild(cell(entry.type));
+            tr.appendChild(cell(formatValue(entry.value), "numeric"));
+            const trend = document.createElement("td");
+            trend.appendChild(sparkline(entry.history));
+            tr.appendChild(trend);
+            tr.appendChild(cell(formatTime(entry.updated), "updated"));
+            fragment.appendChild(tr);
+        }
+        body.replaceChildren(fragment);
+        count.textContent = rows.length + " of " + metrics.size;
+        empty.hidden = rows.length > 0;
+    }
+
+    function setStatus(name) {
+        status.textContent = name;
+        status.className = "status status-" + name;
+    }
+
+    function connect() {
+        let loaded = false;
+        const source = new EventSource("/dashboard/events");
+        source.addEventListener("open", function () {
+            setStatus("live");
+        });
+        source.addEventListener("update", function (event) {
+            // первое событие соединения, в том числе после переподключения, содержит все метрики
+            update(JSON.parse(event.data), !loaded);
+            loaded = true;
+        });
+        source.addEventListener("remove", function (event) {
+            remove(JSON.parse(event.data));
+        });
+        source.addEventListener("error", function () {
+            loaded = false;
+            setStatus(source.readyState === EventSource.CLOSED ? "offline" : "connecting");
+        });
+    }
+
+    for (const th of document.querySelectorAll("th.sortable")) {
+        th.addEventListener("click", function () {
+            const sort = th.dataset.sort;
+            state.desc = state.sort === sort ? !state.desc : false;
+            state.sort = sort;
+            for (const other of document.querySelectorAll("th.sortable")) {
+                other.classList.remove("asc", "desc");
+            }
+            th.classList.add(state.desc ? "desc" : "asc");
+            render();
+        });
+    }
+    document.querySelector('th[data-sort="id"]').classList.add("asc");
+
+    search.addEventListener("input", function () {
+        state.search = search.value;
+        render();
+    });
+    typeSelect.addEventListener("change", function () {
+        state.type = typeSelect.value;
+        render();
+    });
+
+    render();
+    connect();
+})();
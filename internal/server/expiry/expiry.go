@@ -0,0 +1,75 @@
+// Package expiry периодически удаляет из хранилища метрики, которые не обновлялись дольше заданного времени жизни,
+// например метрики выведенных из эксплуатации хостов.
+package expiry
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// DefaultInterval - период проверки устаревших метрик по умолчанию.
+const DefaultInterval = time.Minute
+
+var (
+	ttl      repositories.TTL                   // время жизни метрик
+	interval time.Duration    = DefaultInterval // период проверки устаревших метрик
+)
+
+// SetTTL - устанавливает время жизни метрик.
+func SetTTL(t repositories.TTL) {
+	ttl = t
+}
+
+// GetTTL - возвращает время жизни метрик.
+func GetTTL() repositories.TTL {
+	return ttl
+}
+
+// SetInterval - устанавливает период проверки устаревших метрик.
+func SetInterval(i time.Duration) {
+	interval = i
+}
+
+// GetInterval - возвращает период проверки устаревших метрик.
+func GetInterval() time.Duration {
+	return interval
+}
+
+// Expire - однократно удаляет устаревшие метрики из хранилища.
+func Expire(ctx context.Context, stor repositories.MetricsDeleter) error {
+	expired, err := stor.ExpireMetrics(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	if len(expired) > 0 {
+		logger.ServerLog.Info("expired metrics deleted", zap.Int("count", len(expired)))
+	}
+	return nil
+}
+
+// Run - периодически удаляет устаревшие метрики до отмены контекста.
+// Если время жизни метрик не задано, сразу возвращает управление.
+func Run(ctx context.Context, stor repositories.MetricsDeleter) {
+	if !ttl.Enabled() || interval <= 0 {
+		return
+	}
+	logger.ServerLog.Debug("starting expire metrics", zap.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Expire(ctx, stor); err != nil {
+				logger.ServerLog.Error("expire metrics error", zap.String("error", error.Error(err)))
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestSettings(t *testing.T) {
+	prevTTL, prevInterval := GetTTL(), GetInterval()
+	defer func() {
+		SetTTL(prevTTL)
+		SetInterval(prevInterval)
+	}()
+
+	want := repositories.TTL{Gauge: time.Minute, Metrics: map[string]time.Duration{"host.*": time.Hour}}
+	SetTTL(want)
+	assert.Equal(t, want, GetTTL())
+	SetInterval(time.Second)
+	assert.Equal(t, time.Second, GetInterval())
+}
+
+func TestRun(t *testing.T) {
+	prevTTL, prevInterval := GetTTL(), GetInterval()
+	defer func() {
+		SetTTL(prevTTL)
+		SetInterval(prevInterval)
+	}()
+
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(ctx, "gauge", 1))
+	require.NoError(t, stor.AddCounter(ctx, "counter", 1))
+
+	// время жизни не задано, Run сразу возвращает управление
+	SetTTL(repositories.TTL{})
+	Run(ctx, stor)
+
+	SetTTL(repositories.TTL{Gauge: time.Millisecond})
+	SetInterval(5 * time.Millisecond)
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		Run(runCtx, stor)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		_, err := stor.GetMetric(ctx, "gauge", "gauge")
+		return err != nil
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	_, err := stor.GetMetric(ctx, "counter", "counter")
+	assert.NoError(t, err)
+}
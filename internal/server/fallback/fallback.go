@@ -0,0 +1,186 @@
+// Package fallback позволяет серверу отдавать метрики, пока база данных недоступна.
+// Обертка над хранилищем хранит в памяти последние известные значения метрик и отвечает ими на запросы чтения,
+// если хранилище вернуло ошибку и не отвечает на проверку соединения. Запись метрик при недоступной базе данных
+// завершается ошибкой хранилища.
+package fallback
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// Pinger - интерфейс проверки соединения с хранилищем.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Storage - обертка над хранилищем, отвечающая на запросы чтения последними известными значениями метрик,
+// если хранилище недоступно.
+type Storage struct {
+	repositories.IStorage
+	pinger Pinger
+	cache  *storage.MemStorage
+}
+
+// NewStorage - фабричная функция структуры Storage. Хранилище считается недоступным, если pinger
+// возвращает ошибку. Если pinger равен nil, используется само хранилище, когда оно реализует Pinger.
+func NewStorage(stor repositories.IStorage, pinger Pinger) *Storage {
+	if pinger == nil {
+		pinger, _ = stor.(Pinger)
+	}
+	return &Storage{
+		IStorage: stor,
+		pinger:   pinger,
+		cache:    storage.NewDefaultMemStorage(),
+	}
+}
+
+// Warm - загружает в кеш все метрики хранилища.
+func (s *Storage) Warm(ctx context.Context) error {
+	metrics, err := s.IStorage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return err
+	}
+	s.cache.Replace(metrics)
+	return nil
+}
+
+// requestErrors - ошибки, вызванные самим запросом, а не соединением с хранилищем.
+// При таких ошибках хранилище не проверяется и ответ из кеша не отдается.
+var requestErrors = []error{
+	sql.ErrNoRows,
+	repositories.ErrTypeConflict,
+	repositories.ErrInvalidCursor,
+	repositories.ErrNotSupported,
+	context.Canceled,
+}
+
+// unavailable - проверяет, что ошибка чтения вызвана недоступностью хранилища.
+func (s *Storage) unavailable(ctx context.Context, err error) bool {
+	if s.pinger == nil {
+		return false
+	}
+	for _, reqErr := range requestErrors {
+		if errors.Is(err, reqErr) {
+			return false
+		}
+	}
+	if pingErr := s.pinger.PingContext(ctx); pingErr != nil {
+		logger.ServerLog.Warn("storage is not available, serving cached metrics", zap.String("error", error.Error(err)))
+		return true
+	}
+	return false
+}
+
+// GetMetric - возвращает значение метрики из хранилища или из кеша, если хранилище недоступно.
+func (s *Storage) GetMetric(ctx context.Context, metricType, name string) (string, error) {
+	value, err := s.IStorage.GetMetric(ctx, metricType, name)
+	if err != nil && s.unavailable(ctx, err) {
+		return s.cache.GetMetric(ctx, metricType, name)
+	}
+	return value, err
+}
+
+// GetAllMetrics - возвращает все метрики из хранилища или из кеша, если хранилище недоступно.
+func (s *Storage) GetAllMetrics(ctx context.Context) (string, error) {
+	result, err := s.IStorage.GetAllMetrics(ctx)
+	if err != nil && s.unavailable(ctx, err) {
+		return s.cache.GetAllMetrics(ctx)
+	}
+	return result, err
+}
+
+// GetAllMetricsSlice - возвращает все метрики из хранилища, обновляя ими кеш,
+// или из кеша, если хранилище недоступно.
+func (s *Storage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	metrics, err := s.IStorage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		if s.unavailable(ctx, err) {
+			return s.cache.GetAllMetricsSlice(ctx)
+		}
+		return nil, err
+	}
+	s.cache.Replace(metrics)
+	return metrics, nil
+}
+
+// ListMetrics - возвращает страницу списка метрик из хранилища или из кеша, если хранилище недоступно.
+func (s *Storage) ListMetrics(ctx context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	page, err := s.IStorage.ListMetrics(ctx, opts)
+	if err != nil && s.unavailable(ctx, err) {
+		return s.cache.ListMetrics(ctx, opts)
+	}
+	return page, err
+}
+
+// AddGauge - добавляет метрику типа gauge в хранилище и в кеш.
+func (s *Storage) AddGauge(ctx context.Context, name string, value float64) error {
+	if err := s.IStorage.AddGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.sync(s.cache.AddGauge(ctx, name, value))
+	return nil
+}
+
+// AddCounter - добавляет метрику типа counter в хранилище и в кеш.
+func (s *Storage) AddCounter(ctx context.Context, name string, value int64) error {
+	if err := s.IStorage.AddCounter(ctx, name, value); err != nil {
+		return err
+	}
+	s.sync(s.cache.AddCounter(ctx, name, value))
+	return nil
+}
+
+// AddMetricsFromSlice - добавляет метрики из слайса в хранилище и в кеш.
+func (s *Storage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if err := s.IStorage.AddMetricsFromSlice(ctx, metrics); err != nil {
+		return err
+	}
+	s.sync(s.cache.AddMetricsFromSlice(ctx, metrics))
+	return nil
+}
+
+// ReplaceMetrics - заменяет все метрики хранилища и кеша метриками из слайса.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	if err := repositories.ReplaceMetrics(ctx, s.IStorage, metrics); err != nil {
+		return err
+	}
+	s.cache.Replace(metrics)
+	return nil
+}
+
+// DeleteMetrics - удаляет метрики, удовлетворяющие фильтру, из хранилища и из кеша.
+func (s *Storage) DeleteMetrics(ctx context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	deleted, err := s.IStorage.DeleteMetrics(ctx, filter)
+	if err != nil {
+		return deleted, err
+	}
+	_, cacheErr := s.cache.DeleteMetrics(ctx, filter)
+	s.sync(cacheErr)
+	return deleted, nil
+}
+
+// ExpireMetrics - удаляет устаревшие метрики из хранилища и из кеша.
+func (s *Storage) ExpireMetrics(ctx context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	expired, err := s.IStorage.ExpireMetrics(ctx, ttl)
+	for _, m := range expired {
+		_, cacheErr := s.cache.DeleteMetrics(ctx, repositories.MetricFilter{MType: m.MType, ID: m.ID})
+		s.sync(cacheErr)
+	}
+	return expired, err
+}
+
+// sync - логирует ошибку обновления кеша. Кеш, расходящийся с хранилищем, исправляется при следующем
+// чтении всех метрик, поэтому ошибка не возвращается клиенту.
+func (s *Storage) sync(err error) {
+	if err != nil {
+		logger.ServerLog.Debug("update metrics cache error", zap.String("error", error.Error(err)))
+	}
+}
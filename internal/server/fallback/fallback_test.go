@@ -0,0 +1,225 @@
+package fallback
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+var errDown = errors.New("connection refused")
+
+// flakyStorage - хранилище, которое возвращает ошибку на любой запрос, пока down равно true.
+type flakyStorage struct {
+	*storage.MemStorage
+	down bool
+}
+
+func (s *flakyStorage) GetMetric(ctx context.Context, metricType, name string) (string, error) {
+	if s.down {
+		return "", errDown
+	}
+	return s.MemStorage.GetMetric(ctx, metricType, name)
+}
+
+func (s *flakyStorage) GetAllMetrics(ctx context.Context) (string, error) {
+	if s.down {
+		return "", errDown
+	}
+	return s.MemStorage.GetAllMetrics(ctx)
+}
+
+func (s *flakyStorage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	if s.down {
+		return nil, errDown
+	}
+	return s.MemStorage.GetAllMetricsSlice(ctx)
+}
+
+func (s *flakyStorage) ListMetrics(ctx context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	if s.down {
+		return repositories.MetricsPage{}, errDown
+	}
+	return s.MemStorage.ListMetrics(ctx, opts)
+}
+
+func (s *flakyStorage) AddGauge(ctx context.Context, name string, value float64) error {
+	if s.down {
+		return errDown
+	}
+	return s.MemStorage.AddGauge(ctx, name, value)
+}
+
+func (s *flakyStorage) AddCounter(ctx context.Context, name string, value int64) error {
+	if s.down {
+		return errDown
+	}
+	return s.MemStorage.AddCounter(ctx, name, value)
+}
+
+func (s *flakyStorage) PingContext(_ context.Context) error {
+	if s.down {
+		return errDown
+	}
+	return nil
+}
+
+func TestStorageServesCacheWhenDown(t *testing.T) {
+	ctx := context.Background()
+	stor := &flakyStorage{MemStorage: storage.NewDefaultMemStorage()}
+	require.NoError(t, stor.AddGauge(ctx, "temp", 36.6))
+
+	cached := NewStorage(stor, nil)
+	require.NoError(t, cached.Warm(ctx))
+	require.NoError(t, cached.AddCounter(ctx, "requests", 3))
+	require.NoError(t, cached.AddCounter(ctx, "requests", 2))
+
+	stor.down = true
+
+	value, err := cached.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "36.6", value)
+	value, err = cached.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+
+	metrics, err := cached.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	_, err = cached.GetAllMetrics(ctx)
+	assert.NoError(t, err)
+	page, err := cached.ListMetrics(ctx, repositories.ListOptions{MType: "counter"})
+	require.NoError(t, err)
+	require.Len(t, page.Metrics, 1)
+	assert.Equal(t, "requests", page.Metrics[0].ID)
+
+	// запись при недоступном хранилище завершается ошибкой и не меняет кеш
+	assert.ErrorIs(t, cached.AddCounter(ctx, "requests", 10), errDown)
+	value, err = cached.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+}
+
+// alivePinger - проверка соединения, которая всегда завершается успешно.
+type alivePinger struct{}
+
+func (alivePinger) PingContext(_ context.Context) error {
+	return nil
+}
+
+func TestStoragePassesErrorWhenAlive(t *testing.T) {
+	ctx := context.Background()
+	stor := &flakyStorage{MemStorage: storage.NewDefaultMemStorage()}
+	require.NoError(t, stor.AddGauge(ctx, "temp", 1))
+
+	cached := NewStorage(stor, alivePinger{})
+	require.NoError(t, cached.Warm(ctx))
+	stor.down = true
+
+	_, err := cached.GetMetric(ctx, "gauge", "temp")
+	assert.ErrorIs(t, err, errDown)
+	_, err = cached.GetAllMetricsSlice(ctx)
+	assert.ErrorIs(t, err, errDown)
+}
+
+func TestStorageRefreshesCache(t *testing.T) {
+	ctx := context.Background()
+	stor := &flakyStorage{MemStorage: storage.NewDefaultMemStorage()}
+	cached := NewStorage(stor, nil)
+
+	// метрика, записанная в обход обертки, попадает в кеш при чтении всех метрик
+	require.NoError(t, stor.AddGauge(ctx, "direct", 2.5))
+	_, err := cached.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, cached.AddGauge(ctx, "removed", 1))
+	deleted, err := cached.DeleteMetrics(ctx, repositories.MetricFilter{ID: "removed"})
+	require.NoError(t, err)
+	assert.Len(t, deleted, 1)
+
+	stor.down = true
+	value, err := cached.GetMetric(ctx, "gauge", "direct")
+	require.NoError(t, err)
+	assert.Equal(t, "2.5", value)
+	_, err = cached.GetMetric(ctx, "gauge", "removed")
+	assert.Error(t, err)
+}
+
+// countingPinger - проверка соединения, которая считает вызовы и всегда завершается ошибкой.
+type countingPinger struct {
+	calls int
+}
+
+func (p *countingPinger) PingContext(_ context.Context) error {
+	p.calls++
+	return errDown
+}
+
+// failingStorage - хранилище, которое возвращает заданную ошибку на запрос метрики.
+type failingStorage struct {
+	*storage.MemStorage
+	err error
+}
+
+func (s *failingStorage) GetMetric(_ context.Context, _, _ string) (string, error) {
+	return "", s.err
+}
+
+func TestStorageSkipsPingOnRequestErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantPing  bool
+		wantCache bool
+	}{
+		{
+			name: "no rows",
+			err:  sql.ErrNoRows,
+		},
+		{
+			name: "type conflict",
+			err:  repositories.TypeConflictError("temp", "counter", "gauge"),
+		},
+		{
+			name: "wrapped no rows",
+			err:  fmt.Errorf("get metric: %w", sql.ErrNoRows),
+		},
+		{
+			name: "canceled",
+			err:  context.Canceled,
+		},
+		{
+			name:      "connection error",
+			err:       errDown,
+			wantPing:  true,
+			wantCache: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			stor := &failingStorage{MemStorage: storage.NewDefaultMemStorage(), err: tt.err}
+			require.NoError(t, stor.AddGauge(ctx, "temp", 1))
+			pinger := &countingPinger{}
+
+			cached := NewStorage(stor, pinger)
+			require.NoError(t, cached.Warm(ctx))
+
+			value, err := cached.GetMetric(ctx, "gauge", "temp")
+			assert.Equal(t, tt.wantPing, pinger.calls > 0)
+			if tt.wantCache {
+				require.NoError(t, err)
+				assert.Equal(t, "1", value)
+				return
+			}
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
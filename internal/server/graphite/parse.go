@@ -0,0 +1,92 @@
+// Package graphite принимает метрики по текстовому протоколу Graphite через TCP и UDP. Каждая строка имеет
+// вид "path value timestamp": путь с частями, разделенными точками, становится именем метрики, а значение
+// записывается как gauge или, если путь соответствует одному из шаблонов, как прирост counter.
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// ErrInvalidLine - ошибка разбора строки протокола.
+var ErrInvalidLine = errors.New("invalid graphite line")
+
+// Patterns - шаблоны путей метрик, значения которых записываются как counter. Шаблон состоит из частей,
+// разделенных точками, в каждой части допустимы символы подстановки '*', '?' и классы '[...]', как в path.Match.
+// Символ подстановки не совпадает с точкой, поэтому шаблон "stats.*.requests" совпадает только с путями из трех частей.
+type Patterns []string
+
+// ParsePatterns - разбирает список шаблонов, разделенных запятыми, и проверяет их синтаксис.
+func ParsePatterns(s string) (Patterns, error) {
+	var patterns Patterns
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid graphite counter pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Match - проверяет, соответствует ли путь метрики без меток одному из шаблонов.
+func (p Patterns) Match(metricPath string) bool {
+	parts := strings.Split(metricPath, ".")
+	for _, pattern := range p {
+		patternParts := strings.Split(pattern, ".")
+		if len(patternParts) != len(parts) {
+			continue
+		}
+		matched := true
+		for i := range parts {
+			if ok, _ := path.Match(patternParts[i], parts[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseLine - разбирает строку "path value [timestamp]" в метрику. Путь может содержать метки в формате
+// тегов Graphite: "cpu.load;host=a". Время не используется, потому что хранилище хранит только текущие значения.
+// Значение counter должно быть неотрицательным целым числом.
+func ParseLine(line string, counters Patterns) (repositories.Metric, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return repositories.Metric{}, fmt.Errorf("%w: expected \"path value timestamp\", got %q", ErrInvalidLine, line)
+	}
+	id := fields[0]
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return repositories.Metric{}, fmt.Errorf("%w: invalid value %q", ErrInvalidLine, fields[1])
+	}
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return repositories.Metric{}, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidLine, fields[2])
+		}
+	}
+
+	name, _ := repositories.ParseName(id)
+	if counters.Match(name) {
+		if value < 0 || value != math.Trunc(value) || value > math.MaxInt64 {
+			return repositories.Metric{}, fmt.Errorf("%w: value of counter %s must be a non-negative integer, got %s",
+				ErrInvalidLine, id, fields[1])
+		}
+		delta := int64(value)
+		return repositories.Metric{ID: id, MType: "counter", Delta: &delta}, nil
+	}
+	return repositories.Metric{ID: id, MType: "gauge", Value: &value}, nil
+}
@@ -0,0 +1,81 @@
+package graphite
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns(" stats.*.requests, ,app.errors_[ab]")
+	require.NoError(t, err)
+	assert.Equal(t, Patterns{"stats.*.requests", "app.errors_[ab]"}, patterns)
+
+	patterns, err = ParsePatterns("")
+	require.NoError(t, err)
+	assert.Empty(t, patterns)
+
+	_, err = ParsePatterns("stats.[")
+	assert.Error(t, err)
+}
+
+func TestPatternsMatch(t *testing.T) {
+	patterns := Patterns{"stats.*.requests", "app.errors_?"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "stats.web.requests", want: true},
+		{path: "stats.web.eu.requests", want: false},
+		{path: "stats.requests", want: false},
+		{path: "app.errors_a", want: true},
+		{path: "app.errors_ab", want: false},
+		{path: "cpu.load", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, patterns.Match(tt.path))
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	counters := Patterns{"stats.*.requests"}
+	tests := []struct {
+		name    string
+		line    string
+		want    string
+		wantErr bool
+	}{
+		{name: "gauge", line: "servers.web-1.cpu.load 0.75 1700000000", want: "gauge servers.web-1.cpu.load 0.75"},
+		{name: "without timestamp", line: "memory.free 1024", want: "gauge memory.free 1024"},
+		{name: "negative timestamp", line: "memory.free 1024 -1", want: "gauge memory.free 1024"},
+		{name: "tags", line: "cpu.load;host=a;dc=eu 1.5 1700000000", want: "gauge cpu.load;host=a;dc=eu 1.5"},
+		{name: "counter", line: "stats.web.requests 42 1700000000", want: "counter stats.web.requests 42"},
+		{name: "counter with tags", line: "stats.web.requests;path=/a 3", want: "counter stats.web.requests;path=/a 3"},
+		{name: "fractional counter", line: "stats.web.requests 1.5", wantErr: true},
+		{name: "negative counter", line: "stats.web.requests -1", wantErr: true},
+		{name: "without value", line: "memory.free", wantErr: true},
+		{name: "invalid value", line: "memory.free abc", wantErr: true},
+		{name: "not a number", line: "memory.free NaN", wantErr: true},
+		{name: "invalid timestamp", line: "memory.free 1 now", wantErr: true},
+		{name: "extra fields", line: "memory.free 1 2 3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, err := ParseLine(tt.line, counters)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrInvalidLine))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metric.MType+" "+metric.ID+" "+strconv.FormatFloat(repositories.SortValue(metric), 'f', -1, 64))
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ipfilter"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/tools/ipchecker"
+)
+
+// DefaultBatchSize - наибольшее количество метрик, записываемых одним запросом к хранилищу, если квота
+// на размер батча не задана.
+const DefaultBatchSize = 1000
+
+// maxDatagramSize - наибольший размер UDP датаграммы.
+const maxDatagramSize = 64 * 1024
+
+// Config - параметры приема метрик по протоколу Graphite.
+type Config struct {
+	Address  string   // адрес TCP и UDP, пустой адрес отключает прием
+	Counters Patterns // шаблоны путей метрик, записываемых как counter
+}
+
+// Server - прием метрик по протоколу Graphite на одном адресе через TCP и UDP. Строки TCP соединения
+// записываются в хранилище батчами: батч записывается, когда прочитаны все полученные данные или батч заполнен.
+// Метрики из одной UDP датаграммы записываются вместе.
+type Server struct {
+	cfg  Config
+	stor repositories.MetricsWriter
+
+	mu     sync.Mutex
+	ln     net.Listener
+	udp    net.PacketConn
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewServer - фабричная функция структуры Server.
+func NewServer(cfg Config, stor repositories.MetricsWriter) *Server {
+	return &Server{cfg: cfg, stor: stor, conns: make(map[net.Conn]struct{})}
+}
+
+// Start - открывает TCP и UDP порты и начинает прием метрик. Если в адресе указан порт 0, UDP использует
+// порт, выбранный для TCP.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.cfg.Address)
+	if err != nil {
+		return err
+	}
+	udp, err := net.ListenPacket("udp", ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	s.ln, s.udp = ln, udp
+	s.mu.Unlock()
+
+	s.wg.Add(2)
+	go s.acceptTCP(ln)
+	go s.serveUDP(udp)
+	return nil
+}
+
+// Addr - возвращает адрес, на котором принимаются метрики, или nil, если сервер не запущен.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Shutdown - прекращает прием новых соединений и датаграмм и ждет, пока открытые соединения запишут уже
+// полученные строки. Если контекст отменяется раньше, соединения закрываются принудительно.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	// чтение из соединений прерывается, данные, уже полученные соединением, обрабатываются
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) acceptTCP(ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.ServerLog.Error("accept graphite connection error", zap.String("error", error.Error(err)))
+			}
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	if !trusted(conn.RemoteAddr()) {
+		return
+	}
+	ctx := ratelimit.WithClientIdentity(context.Background(), identity(conn.RemoteAddr()))
+	reader := bufio.NewReader(conn)
+	batch := make([]repositories.Metric, 0)
+	for {
+		line, err := reader.ReadString('\n')
+		// строка без перевода строки при ошибке чтения может быть неполной, она записывается только в конце потока
+		if err == nil || errors.Is(err, io.EOF) {
+			if metric, ok := s.parse(line, conn.RemoteAddr()); ok {
+				batch = append(batch, metric)
+			}
+		}
+		if len(batch) > 0 && (err != nil || reader.Buffered() == 0 || len(batch) >= batchSize()) {
+			s.write(ctx, batch)
+			batch = make([]repositories.Metric, 0)
+		}
+		if err != nil {
+			var netErr net.Error
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+				logger.ServerLog.Error("read graphite connection error", zap.String("address", conn.RemoteAddr().String()),
+					zap.String("error", error.Error(err)))
+			}
+			return
+		}
+	}
+}
+
+func (s *Server) serveUDP(udp net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.ServerLog.Error("read graphite datagram error", zap.String("error", error.Error(err)))
+			}
+			return
+		}
+		if !trusted(addr) {
+			continue
+		}
+
+		ctx := ratelimit.WithClientIdentity(context.Background(), identity(addr))
+		batch := make([]repositories.Metric, 0)
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if metric, ok := s.parse(line, addr); ok {
+				batch = append(batch, metric)
+			}
+			if len(batch) >= batchSize() {
+				s.write(ctx, batch)
+				batch = make([]repositories.Metric, 0)
+			}
+		}
+		if len(batch) > 0 {
+			s.write(ctx, batch)
+		}
+	}
+}
+
+// parse - разбирает строку протокола. Пустые строки пропускаются, некорректные строки логируются и пропускаются,
+// чтобы одна ошибка клиента не прерывала прием остальных метрик.
+func (s *Server) parse(line string, addr net.Addr) (repositories.Metric, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return repositories.Metric{}, false
+	}
+	metric, err := ParseLine(line, s.cfg.Counters)
+	if err != nil {
+		logger.ServerLog.Info("skip graphite line", zap.String("address", addr.String()), zap.String("error", error.Error(err)))
+		return repositories.Metric{}, false
+	}
+	return metric, true
+}
+
+func (s *Server) write(ctx context.Context, batch []repositories.Metric) {
+	if err := s.stor.AddMetricsFromSlice(ctx, batch); err != nil {
+		logger.ServerLog.Error("add graphite metrics into server error", zap.String("identity", ratelimit.ClientIdentityFromContext(ctx)),
+			zap.String("error", error.Error(err)))
+	}
+}
+
+// batchSize - возвращает размер батча: квоту на количество метрик в батче, если она задана.
+func batchSize() int {
+	if size := ratelimit.GetLimiter().Limits().MaxBatchMetrics; size > 0 {
+		return size
+	}
+	return DefaultBatchSize
+}
+
+// trusted - проверяет, что адрес клиента входит в доверенную подсеть, если она задана.
+func trusted(addr net.Addr) bool {
+	subnet := ipfilter.GetTrustedSubnet()
+	if subnet == "" {
+		return true
+	}
+	ok, err := ipchecker.InTrustedSubNet(subnet, addr.String())
+	if err != nil {
+		logger.ServerLog.Error("in trusted subNet check error", zap.String("error", error.Error(err)))
+		return false
+	}
+	if !ok {
+		logger.ServerLog.Info("graphite client not in trusted sub net", zap.String("address", addr.String()))
+	}
+	return ok
+}
+
+// identity - возвращает идентификатор клиента для ограничений количества метрик клиента.
+func identity(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return "ip:" + host
+}
+
+var config Config
+
+// SetConfig - устанавливает параметры приема метрик по протоколу Graphite.
+func SetConfig(cfg Config) {
+	config = cfg
+}
+
+// GetConfig - возвращает параметры приема метрик по протоколу Graphite.
+func GetConfig() Config {
+	return config
+}
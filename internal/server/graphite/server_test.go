@@ -0,0 +1,127 @@
+package graphite
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ipfilter"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// startServer - запускает прием метрик на свободном порту локального адреса.
+func startServer(t *testing.T, stor *storage.MemStorage) *Server {
+	srv := NewServer(Config{Address: "127.0.0.1:0", Counters: Patterns{"stats.*.requests"}}, stor)
+	require.NoError(t, srv.Start())
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv
+}
+
+// metricValue - ждет появления метрики в хранилище и возвращает ее значение.
+func metricValue(t *testing.T, stor *storage.MemStorage, mtype, id string) string {
+	var value string
+	require.Eventually(t, func() bool {
+		var err error
+		value, err = stor.GetMetric(context.Background(), mtype, id)
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "metric %s %s was not stored", mtype, id)
+	return value
+}
+
+func TestServerTCP(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	srv := startServer(t, stor)
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("cpu.load;host=a 0.5 1700000000\ninvalid line here now\nstats.web.requests 3\nstats.web.requests 4\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "0.5", metricValue(t, stor, "gauge", "cpu.load;host=a"))
+	require.Eventually(t, func() bool {
+		value, err := stor.GetMetric(context.Background(), "counter", "stats.web.requests")
+		return err == nil && value == "7"
+	}, time.Second, 10*time.Millisecond)
+
+	// строка без перевода строки записывается после закрытия соединения
+	_, err = conn.Write([]byte("memory.free 1024"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	assert.Equal(t, "1024", metricValue(t, stor, "gauge", "memory.free"))
+}
+
+func TestServerUDP(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	srv := startServer(t, stor)
+
+	conn, err := net.Dial("udp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("disk.used 75 1700000000\nstats.db.requests 2"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "75", metricValue(t, stor, "gauge", "disk.used"))
+	assert.Equal(t, "2", metricValue(t, stor, "counter", "stats.db.requests"))
+}
+
+func TestServerTrustedSubnet(t *testing.T) {
+	defer ipfilter.SetTrustedSubnet(ipfilter.GetTrustedSubnet())
+	ipfilter.SetTrustedSubnet("10.0.0.0/8")
+	stor := storage.NewDefaultMemStorage()
+	srv := NewServer(Config{Address: "127.0.0.1:0"}, stor)
+	require.NoError(t, srv.Start())
+	// сервер останавливается до восстановления доверенной подсети
+	defer srv.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("cpu.load 1\n"))
+	require.NoError(t, err)
+	// соединение клиента не из доверенной подсети закрывается сервером
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	conn.Close()
+
+	udp, err := net.Dial("udp", srv.Addr().String())
+	require.NoError(t, err)
+	defer udp.Close()
+	_, err = udp.Write([]byte("cpu.load 1"))
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	_, err = stor.GetMetric(context.Background(), "gauge", "cpu.load")
+	assert.Error(t, err)
+}
+
+func TestServerShutdown(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	srv := NewServer(Config{Address: "127.0.0.1:0"}, stor)
+	require.NoError(t, srv.Start())
+	addr := srv.Addr().String()
+
+	// открытое соединение не мешает остановке, полученные строки записываются
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("cpu.load 2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "2", metricValue(t, stor, "gauge", "cpu.load"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	_, err = net.DialTimeout("tcp", addr, 100*time.Millisecond)
+	assert.Error(t, err)
+
+	// адрес занят - запуск возвращает ошибку
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.Error(t, NewServer(Config{Address: ln.Addr().String()}, stor).Start())
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Alerts - возвращает оповещения в состояниях pending, firing и resolved. Параметр запроса state
+// оставляет оповещения в одном состоянии.
+func Alerts(res http.ResponseWriter, req *http.Request, engine *alerting.Engine) {
+	state := alerting.State(req.URL.Query().Get("state"))
+	switch state {
+	case "", alerting.StatePending, alerting.StateFiring, alerting.StateResolved:
+	default:
+		http.Error(res, fmt.Sprintf("invalid state of alert: %s", state), http.StatusBadRequest)
+		return
+	}
+
+	alerts := engine.Alerts()
+	if state != "" {
+		filtered := make([]alerting.Alert, 0, len(alerts))
+		for _, alert := range alerts {
+			if alert.State == state {
+				filtered = append(filtered, alert)
+			}
+		}
+		alerts = filtered
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(alerts); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// AlertsHandler - обертка над Alerts для возможности установить проверку правил оповещения.
+func AlertsHandler(engine *alerting.Engine) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		Alerts(res, req, engine)
+	}
+	return fn
+}
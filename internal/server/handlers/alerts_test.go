@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestAlerts(t *testing.T) {
+	rules, err := alerting.ParseRules([]byte(`
+rules:
+  - name: HighHeap
+    expr: gauge HeapAlloc > 100
+  - name: LowHeap
+    expr: gauge HeapAlloc < 1000
+    for: 1h
+  - name: Quiet
+    expr: gauge HeapAlloc < 0
+`))
+	require.NoError(t, err)
+	engine := alerting.NewEngine()
+	engine.SetRules(rules)
+	stor := storage.NewMemStorage(map[string]float64{"HeapAlloc": 500}, nil)
+	require.NoError(t, engine.Evaluate(context.Background(), stor, time.Now()))
+
+	r := chi.NewRouter()
+	r.Get("/api/alerts", AlertsHandler(engine))
+
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		want  map[string]alerting.State
+	}{
+		{name: "all alerts", query: "", code: 200,
+			want: map[string]alerting.State{"HighHeap": alerting.StateFiring, "LowHeap": alerting.StatePending}},
+		{name: "firing alerts", query: "?state=firing", code: 200,
+			want: map[string]alerting.State{"HighHeap": alerting.StateFiring}},
+		{name: "resolved alerts", query: "?state=resolved", code: 200, want: map[string]alerting.State{}},
+		{name: "invalid state", query: "?state=inactive", code: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := serve(r, http.MethodGet, "/api/alerts"+tt.query, nil)
+			require.Equal(t, tt.code, res.StatusCode)
+			if tt.code != 200 {
+				return
+			}
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			var alerts []alerting.Alert
+			require.NoError(t, json.Unmarshal([]byte(body), &alerts))
+			got := make(map[string]alerting.State, len(alerts))
+			for _, alert := range alerts {
+				got[alert.Name] = alert.State
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
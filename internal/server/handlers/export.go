@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+// Форматы выгрузки и загрузки метрик.
+const (
+	FormatJSON   = "json"   // массив метрик JSON
+	FormatCSV    = "csv"    // таблица с колонками id, type, delta, value
+	FormatNDJSON = "ndjson" // метрика JSON на каждой строке
+)
+
+// Способы загрузки метрик.
+const (
+	ImportMerge   = "merge"   // метрики добавляются к хранимым так же, как при обновлении метрик агентом
+	ImportReplace = "replace" // хранимые метрики заменяются загружаемыми
+)
+
+// csvHeader - заголовок таблицы метрик в формате CSV.
+var csvHeader = []string{"id", "type", "delta", "value"}
+
+// contentTypes - тип содержимого ответа для каждого формата выгрузки.
+var contentTypes = map[string]string{
+	FormatJSON:   "application/json",
+	FormatCSV:    "text/csv",
+	FormatNDJSON: "application/x-ndjson",
+}
+
+// parseFormat - возвращает формат из параметра запроса format, по умолчанию JSON.
+func parseFormat(req *http.Request) (string, error) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		return FormatJSON, nil
+	}
+	if _, ok := contentTypes[format]; !ok {
+		return "", fmt.Errorf("unknown format %q, allowed formats: %s, %s, %s", format, FormatJSON, FormatCSV, FormatNDJSON)
+	}
+	return format, nil
+}
+
+// metricWriter - записывает метрики в ответ по одной, не собирая выгрузку целиком в памяти.
+type metricWriter interface {
+	Write(metric repositories.Metric) error
+	Close() error
+}
+
+// jsonWriter - записывает метрики массивом JSON.
+type jsonWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (j *jsonWriter) Write(metric repositories.Metric) error {
+	data, err := json.Marshal(metric)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if j.count == 0 {
+		sep = "[\n"
+	}
+	j.count++
+	if _, err := j.w.WriteString(sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	if _, err := j.w.WriteString(end); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// ndjsonWriter - записывает метрики JSON по одной на строке.
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(metric repositories.Metric) error {
+	return n.enc.Encode(metric)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
+
+// csvWriter - записывает метрики таблицей CSV.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(metric repositories.Metric) error {
+	record := []string{metric.ID, metric.MType, "", ""}
+	if metric.Delta != nil {
+		record[2] = strconv.FormatInt(*metric.Delta, 10)
+	}
+	if metric.Value != nil {
+		record[3] = strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// newMetricWriter - возвращает запись метрик в формате format.
+func newMetricWriter(w io.Writer, format string) (metricWriter, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw}, nil
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	default:
+		return &jsonWriter{w: bufio.NewWriter(w)}, nil
+	}
+}
+
+// ExportMetrics - выгружает все метрики сервера в формате из параметра запроса format: json, csv или ndjson.
+// Метрики записываются в ответ по мере кодирования.
+func ExportMetrics(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader) {
+	format, err := parseFormat(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, err := storage.GetAllMetricsSlice(req.Context())
+	if err != nil {
+		logger.ServerLog.Error("export metrics error", zap.String("error", error.Error(err)))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", contentTypes[format])
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="metrics.%s"`, format))
+	res.Header().Set("Status-Code", "200")
+
+	writer, err := newMetricWriter(res, format)
+	if err == nil {
+		for _, metric := range metrics {
+			if err = writer.Write(metric); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+	}
+}
+
+// ImportResult - результат загрузки метрик.
+type ImportResult struct {
+	Imported int    `json:"imported"` // количество загруженных метрик
+	Mode     string `json:"mode"`     // способ загрузки
+}
+
+// readMetrics - читает метрики из тела запроса в формате format.
+func readMetrics(r io.Reader, format string) ([]repositories.Metric, error) {
+	switch format {
+	case FormatCSV:
+		return readCSVMetrics(r)
+	case FormatNDJSON:
+		metrics := make([]repositories.Metric, 0)
+		dec := json.NewDecoder(r)
+		for line := 1; ; line++ {
+			var metric repositories.Metric
+			if err := dec.Decode(&metric); err != nil {
+				if errors.Is(err, io.EOF) {
+					return metrics, nil
+				}
+				return nil, fmt.Errorf("record %d: %w", line, err)
+			}
+			metrics = append(metrics, metric)
+		}
+	default:
+		metrics := make([]repositories.Metric, 0)
+		if err := json.NewDecoder(r).Decode(&metrics); err != nil {
+			return nil, err
+		}
+		return metrics, nil
+	}
+}
+
+// readCSVMetrics - читает метрики из таблицы CSV. Порядок колонок задается заголовком.
+func readCSVMetrics(r io.Reader) ([]repositories.Metric, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range csvHeader {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv header has no column %s", name)
+		}
+	}
+
+	metrics := make([]repositories.Metric, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return metrics, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		metric := repositories.Metric{ID: record[columns["id"]], MType: record[columns["type"]]}
+		if s := record[columns["delta"]]; s != "" {
+			delta, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid delta: %w", line, err)
+			}
+			metric.Delta = &delta
+		}
+		if s := record[columns["value"]]; s != "" {
+			value, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value: %w", line, err)
+			}
+			metric.Value = &value
+		}
+		metrics = append(metrics, metric)
+	}
+}
+
+// validateImport - проверяет загружаемые метрики до записи в хранилище.
+func validateImport(metrics []repositories.Metric, mode string) error {
+	if len(metrics) == 0 {
+		return errors.New("no metrics to import")
+	}
+	for i, metric := range metrics {
+		if metric.ID == "" {
+			return fmt.Errorf("record %d: metric name is empty", i+1)
+		}
+		if err := repositories.ValidateMetric(metric); err != nil {
+			return fmt.Errorf("record %d: %w", i+1, err)
+		}
+	}
+	if mode == ImportReplace {
+		return repositories.ValidateReplacement(metrics)
+	}
+	return nil
+}
+
+// ImportMetrics - загружает метрики из тела запроса в формате из параметра format. Параметр mode задает
+// способ загрузки: merge добавляет метрики к хранимым, replace заменяет ими все хранимые метрики.
+// Метрики проверяются до записи и записываются в хранилище одной операцией: при ошибке не записывается
+// ни одна метрика.
+func ImportMetrics(res http.ResponseWriter, req *http.Request, storage repositories.MetricsWriter) {
+	format, err := parseFormat(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode := req.URL.Query().Get("mode")
+	if mode == "" {
+		mode = ImportMerge
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		http.Error(res, fmt.Sprintf("unknown import mode %q, allowed modes: %s, %s", mode, ImportMerge, ImportReplace), http.StatusBadRequest)
+		return
+	}
+
+	metrics, err := readMetrics(req.Body, format)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			ratelimit.QuotaExceeded(res, err)
+			return
+		}
+		http.Error(res, "decode metrics error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateImport(metrics, mode); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if mode == ImportReplace {
+		err = repositories.ReplaceMetrics(req.Context(), storage, metrics)
+	} else {
+		err = storage.AddMetricsFromSlice(req.Context(), metrics)
+	}
+	if err != nil {
+		logger.ServerLog.Error("import metrics error", zap.String("mode", mode), zap.String("error", error.Error(err)))
+		http.Error(res, err.Error(), storageErrorStatus(err))
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(ImportResult{Imported: len(metrics), Mode: mode}); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// ExportMetricsHandler - обертка над ExportMetrics для возможности установить хранилище метрик.
+func ExportMetricsHandler(stor repositories.MetricsReader) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		ExportMetrics(res, req, stor)
+	}
+	return fn
+}
+
+// ImportMetricsHandler - обертка над ImportMetrics для возможности установить хранилище метрик.
+func ImportMetricsHandler(stor repositories.MetricsWriter) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		ImportMetrics(res, req, stor)
+	}
+	return fn
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// writerOnly - хранилище, не поддерживающее замену метрик.
+type writerOnly struct {
+	repositories.MetricsWriter
+}
+
+func exportRouter(src repositories.MetricsReader, dst repositories.MetricsWriter) *chi.Mux {
+	r := chi.NewRouter()
+	r.Get("/api/export", ExportMetricsHandler(src))
+	r.Post("/api/import", ImportMetricsHandler(dst))
+	return r
+}
+
+func serve(r http.Handler, method, path string, body io.Reader) (*http.Response, string) {
+	request := httptest.NewRequest(method, path, body)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	res := w.Result()
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	return res, string(data)
+}
+
+func TestExportMetrics(t *testing.T) {
+	src := storage.NewMemStorage(map[string]float64{"Alloc": 1.5}, map[string]int64{"PollCount": 3})
+	r := exportRouter(src, nil)
+
+	tests := []struct {
+		name        string
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{name: "default format", path: "/api/export", code: 200, contentType: "application/json",
+			body: "[\n{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":1.5},\n{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":3}\n]\n"},
+		{name: "csv", path: "/api/export?format=csv", code: 200, contentType: "text/csv",
+			body: "id,type,delta,value\nAlloc,gauge,,1.5\nPollCount,counter,3,\n"},
+		{name: "ndjson", path: "/api/export?format=ndjson", code: 200, contentType: "application/x-ndjson",
+			body: "{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":1.5}\n{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":3}\n"},
+		{name: "unknown format", path: "/api/export?format=xml", code: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := serve(r, http.MethodGet, tt.path, nil)
+			require.Equal(t, tt.code, res.StatusCode)
+			if tt.code != 200 {
+				return
+			}
+			assert.Equal(t, tt.contentType, res.Header.Get("Content-Type"))
+			assert.Equal(t, tt.body, body)
+		})
+	}
+
+	// пустое хранилище выгружается пустым массивом
+	res, body := serve(exportRouter(storage.NewDefaultMemStorage(), nil), http.MethodGet, "/api/export", nil)
+	require.Equal(t, 200, res.StatusCode)
+	var metrics []repositories.Metric
+	require.NoError(t, json.Unmarshal([]byte(body), &metrics))
+	assert.Empty(t, metrics)
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			src := storage.NewMemStorage(map[string]float64{"Alloc": 1.5, "Frees": -2e-10}, map[string]int64{"PollCount": 3})
+			dst := storage.NewDefaultMemStorage()
+			r := exportRouter(src, dst)
+
+			_, exported := serve(r, http.MethodGet, "/api/export?format="+format, nil)
+			res, body := serve(r, http.MethodPost, "/api/import?format="+format, strings.NewReader(exported))
+			require.Equal(t, 200, res.StatusCode, body)
+
+			var result ImportResult
+			require.NoError(t, json.Unmarshal([]byte(body), &result))
+			assert.Equal(t, ImportResult{Imported: 3, Mode: ImportMerge}, result)
+
+			want, err := src.GetAllMetricsSlice(context.Background())
+			require.NoError(t, err)
+			got, err := dst.GetAllMetricsSlice(context.Background())
+			require.NoError(t, err)
+			assert.ElementsMatch(t, want, got)
+		})
+	}
+}
+
+func TestImportMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		code     int
+		stored   map[string]string // ожидаемые значения метрик после загрузки
+		missing  []string          // метрики, которых не должно быть после загрузки
+		readOnly bool              // хранилище не поддерживает замену метрик
+	}{
+		{
+			name:   "merge adds counters",
+			path:   "/api/import",
+			body:   `[{"id":"PollCount","type":"counter","delta":2},{"id":"Sys","type":"gauge","value":7}]`,
+			code:   200,
+			stored: map[string]string{"PollCount": "7", "Sys": "7", "Alloc": "1"},
+		},
+		{
+			name:    "replace drops other metrics",
+			path:    "/api/import?mode=replace&format=csv",
+			body:    "type,id,value,delta\ncounter,PollCount,,2\n",
+			code:    200,
+			stored:  map[string]string{"PollCount": "2"},
+			missing: []string{"Alloc"},
+		},
+		{
+			name:   "ndjson",
+			path:   "/api/import?format=ndjson",
+			body:   "{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":4}\n\n{\"id\":\"Sys\",\"type\":\"gauge\",\"value\":1}\n",
+			code:   200,
+			stored: map[string]string{"Alloc": "4", "Sys": "1"},
+		},
+		{name: "unknown mode", path: "/api/import?mode=append", body: `[]`, code: 400},
+		{name: "unknown format", path: "/api/import?format=xml", body: `[]`, code: 400},
+		{name: "empty import", path: "/api/import?mode=replace", body: `[]`, code: 400, stored: map[string]string{"Alloc": "1"}},
+		{name: "invalid json", path: "/api/import", body: `[{"id":`, code: 400},
+		{name: "empty name", path: "/api/import", body: `[{"id":"","type":"gauge","value":1}]`, code: 400},
+		{name: "missing value", path: "/api/import?format=csv", body: "id,type,delta,value\nSys,gauge,,\n", code: 400},
+		{name: "invalid csv value", path: "/api/import?format=csv", body: "id,type,delta,value\nSys,gauge,,abc\n", code: 400},
+		{name: "csv without column", path: "/api/import?format=csv", body: "id,type,value\nSys,gauge,1\n", code: 400},
+		{
+			name:   "invalid metric rejects whole import",
+			path:   "/api/import",
+			body:   `[{"id":"Sys","type":"gauge","value":1},{"id":"Frees","type":"summary","value":1}]`,
+			code:   400,
+			stored: map[string]string{"Alloc": "1"}, missing: []string{"Sys"},
+		},
+		{
+			name: "repeated metric in replace",
+			path: "/api/import?mode=replace",
+			body: `[{"id":"Sys","type":"gauge","value":1},{"id":"Sys","type":"gauge","value":2}]`,
+			code: 400, stored: map[string]string{"Alloc": "1"},
+		},
+		{
+			name: "type conflict",
+			path: "/api/import",
+			body: `[{"id":"Sys","type":"gauge","value":1},{"id":"Alloc","type":"counter","delta":1}]`,
+			code: 409, stored: map[string]string{"Alloc": "1"}, missing: []string{"Sys"},
+		},
+		{
+			name:     "replace not supported",
+			path:     "/api/import?mode=replace",
+			body:     `[{"id":"Sys","type":"gauge","value":1}]`,
+			code:     501,
+			readOnly: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stor := storage.NewMemStorage(map[string]float64{"Alloc": 1}, map[string]int64{"PollCount": 5})
+			var dst repositories.MetricsWriter = stor
+			if tt.readOnly {
+				dst = writerOnly{MetricsWriter: stor}
+			}
+			res, body := serve(exportRouter(nil, dst), http.MethodPost, tt.path, strings.NewReader(tt.body))
+			require.Equal(t, tt.code, res.StatusCode, body)
+
+			metrics, err := stor.GetAllMetricsSlice(context.Background())
+			require.NoError(t, err)
+			stored := make(map[string]string, len(metrics))
+			for _, m := range metrics {
+				value, err := stor.GetMetric(context.Background(), m.MType, m.ID)
+				require.NoError(t, err)
+				stored[m.ID] = value
+			}
+			for name, want := range tt.stored {
+				assert.Equal(t, want, stored[name], name)
+			}
+			for _, name := range tt.missing {
+				assert.NotContains(t, stored, name)
+			}
+		})
+	}
+}
@@ -2,19 +2,28 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/readcache"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
 )
 
 var (
@@ -66,14 +75,46 @@ func GetGlobal(res http.ResponseWriter, req *http.Request, storage repositories.
 	}
 }
 
-// PingDatabase - проверка связи с базой данных.
-func PingDatabase(res http.ResponseWriter, req *http.Request, db *sql.DB) {
+// DatabasePinger - интерфейс проверки связи с базой данных.
+type DatabasePinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// poolStater - интерфейс получения статистики пула соединений с базой данных.
+type poolStater interface {
+	PoolStats() (pg.PoolStats, bool)
+}
+
+// PingDatabase - проверка связи с базой данных. Если соединения с базой данных устанавливаются через пул,
+// в ответе возвращается статистика пула в формате JSON.
+func PingDatabase(res http.ResponseWriter, req *http.Request, db DatabasePinger) {
+	if db == nil {
+		http.Error(res, "database is not configured", http.StatusInternalServerError)
+		return
+	}
 	if err := db.PingContext(req.Context()); err != nil {
 		logger.ServerLog.Error("fail to ping database", zap.String("error", error.Error(err)))
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	res.WriteHeader(http.StatusOK)
+
+	stater, ok := db.(poolStater)
+	if !ok {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+	stats, ok := stater.PoolStats()
+	if !ok {
+		res.WriteHeader(http.StatusOK)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(stats); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
 }
 
 // GetMetricJSON - возвращает метрику в json представлении.
@@ -176,15 +217,28 @@ func UpdateMetricsBatch(res http.ResponseWriter, req *http.Request, storage repo
 	metrics := make([]repositories.Metric, 0)
 
 	if err := json.NewDecoder(req.Body).Decode(&metrics); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logger.ServerLog.Info("body size quota exceeded", zap.String("address", req.URL.String()))
+			ratelimit.QuotaExceeded(res, err)
+			return
+		}
 		logger.ServerLog.Error("Decode message error", zap.String("address", req.URL.String()))
 		http.Error(res, "Decode message error", http.StatusInternalServerError)
 		return
 	}
 
+	// проверяю квоту на количество метрик в батче
+	if err := ratelimit.GetLimiter().CheckBatch(len(metrics)); err != nil {
+		logger.ServerLog.Info("batch quota exceeded", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		ratelimit.QuotaExceeded(res, err)
+		return
+	}
+
 	err := storage.AddMetricsFromSlice(req.Context(), metrics)
 	if err != nil {
 		logger.ServerLog.Error("add metric into server error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		http.Error(res, err.Error(), storageErrorStatus(err))
 		return
 	}
 
@@ -236,7 +290,7 @@ func UpdateMetricsJSON(res http.ResponseWriter, req *http.Request, storage repos
 		err := storage.AddGauge(req.Context(), metrics.ID, *metrics.Value)
 		if err != nil {
 			logger.ServerLog.Error("add gauge error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	case "counter":
@@ -248,7 +302,7 @@ func UpdateMetricsJSON(res http.ResponseWriter, req *http.Request, storage repos
 		err := storage.AddCounter(req.Context(), metrics.ID, *metrics.Delta)
 		if err != nil {
 			logger.ServerLog.Error("add counter error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	default:
@@ -309,7 +363,7 @@ func UpdateMetrics(res http.ResponseWriter, req *http.Request, storage repositor
 		err = storage.AddGauge(req.Context(), metricName, value)
 		if err != nil {
 			logger.ServerLog.Error("add gauge error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	case "counter":
@@ -321,7 +375,7 @@ func UpdateMetrics(res http.ResponseWriter, req *http.Request, storage repositor
 		err = storage.AddCounter(req.Context(), metricName, value)
 		if err != nil {
 			logger.ServerLog.Error("add counter error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			http.Error(res, err.Error(), storageErrorStatus(err))
 			return
 		}
 	default:
@@ -332,6 +386,159 @@ func UpdateMetrics(res http.ResponseWriter, req *http.Request, storage repositor
 	res.WriteHeader(http.StatusOK)
 }
 
+// DeleteMetric - удаляет метрику по типу и имени из пути запроса и возвращает удаленную метрику в формате JSON.
+func DeleteMetric(res http.ResponseWriter, req *http.Request, storage repositories.MetricsDeleter) {
+	metricType := chi.URLParam(req, "metricType")
+	metricName := chi.URLParam(req, "metricName")
+	if metricType != "gauge" && metricType != "counter" {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := storage.DeleteMetrics(req.Context(), repositories.MetricFilter{MType: metricType, ID: metricName})
+	if err != nil {
+		logger.ServerLog.Error("delete metric error", zap.String("error", error.Error(err)))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(deleted) == 0 {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(deleted[0]); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// DeleteMetricsResult - результат удаления метрик.
+type DeleteMetricsResult struct {
+	Deleted int                   `json:"deleted"` // количество удаленных метрик
+	Metrics []repositories.Metric `json:"metrics"` // удаленные метрики
+}
+
+// parseMetricFilter - разбирает условия отбора метрик из параметров запроса type, name, prefix и label.
+// Параметр label задается в виде key=value и может повторяться.
+func parseMetricFilter(query url.Values) (repositories.MetricFilter, error) {
+	filter := repositories.MetricFilter{
+		MType:  query.Get("type"),
+		ID:     query.Get("name"),
+		Prefix: query.Get("prefix"),
+	}
+	switch filter.MType {
+	case "", "gauge", "counter":
+	default:
+		return repositories.MetricFilter{}, fmt.Errorf("invalid type of metric: %s", filter.MType)
+	}
+	for _, label := range query["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return repositories.MetricFilter{}, fmt.Errorf("invalid label: %s", label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[key] = value
+	}
+	return filter, nil
+}
+
+// DeleteMetrics - удаляет метрики, удовлетворяющие условиям из параметров запроса.
+// Запрос без условий отбора по имени, префиксу или меткам отклоняется, чтобы не удалить все метрики сервера.
+func DeleteMetrics(res http.ResponseWriter, req *http.Request, storage repositories.MetricsDeleter) {
+	filter, err := parseMetricFilter(req.URL.Query())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Empty() {
+		http.Error(res, "metric filter is empty", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := storage.DeleteMetrics(req.Context(), filter)
+	if err != nil {
+		logger.ServerLog.Error("delete metrics error", zap.String("error", error.Error(err)))
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if deleted == nil {
+		deleted = []repositories.Metric{}
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(DeleteMetricsResult{Deleted: len(deleted), Metrics: deleted}); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// storageErrorStatus - возвращает статус ответа для ошибки записи метрик в хранилище.
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, cardinality.ErrInvalidName):
+		return http.StatusBadRequest
+	case errors.Is(err, cardinality.ErrCardinalityLimit):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, repositories.ErrTypeConflict):
+		return http.StatusConflict
+	case errors.Is(err, writebehind.ErrBufferFull):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, repositories.ErrNotSupported):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// defaultReportLimit - количество клиентов в отчете о сериях по умолчанию.
+const defaultReportLimit = 10
+
+// CardinalityReport - возвращает отчет о количестве серий метрик и клиентах, создавших больше всего серий.
+// Количество клиентов в отчете задается параметром запроса limit.
+func CardinalityReport(res http.ResponseWriter, req *http.Request, tracker *cardinality.Tracker) {
+	res.Header().Set("Content-Type", "application/json")
+
+	limit := defaultReportLimit
+	if value := req.URL.Query().Get("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 0 {
+			http.Error(res, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	// устанавливаю заголовок таким образом вместо WriteHeader(http.StatusOK), потому что
+	// далее в методе Write в middleware необходимо установить заголовок Hash со значением хэша,
+	// а после WriteHeader заголовки уже не устанавливаются
+	res.Header().Set("Status-Code", "200")
+
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(tracker.Report(limit)); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// CacheStats - возвращает счетчики попаданий и промахов кеша чтения метрик.
+func CacheStats(res http.ResponseWriter, _ *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(readcache.GetStats()); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
 // GetGlobalHandler - обертка над GetGlobal для возможности установить хранилище метрик.
 func GetGlobalHandler(stor repositories.MetricsReader) http.HandlerFunc {
 	fn := func(res http.ResponseWriter, req *http.Request) {
@@ -341,7 +548,7 @@ func GetGlobalHandler(stor repositories.MetricsReader) http.HandlerFunc {
 }
 
 // PingDatabaseHandler - обертка над PingDatabase для возможности установить базу данных.
-func PingDatabaseHandler(db *sql.DB) http.HandlerFunc {
+func PingDatabaseHandler(db DatabasePinger) http.HandlerFunc {
 	fn := func(res http.ResponseWriter, req *http.Request) {
 		PingDatabase(res, req, db)
 	}
@@ -388,6 +595,38 @@ func GetMetricHandler(stor repositories.MetricsReader) http.HandlerFunc {
 	return fn
 }
 
+// DeleteMetricHandler - обертка над DeleteMetric для возможности установить хранилище метрик.
+func DeleteMetricHandler(stor repositories.MetricsDeleter) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		DeleteMetric(res, req, stor)
+	}
+	return fn
+}
+
+// DeleteMetricsHandler - обертка над DeleteMetrics для возможности установить хранилище метрик.
+func DeleteMetricsHandler(stor repositories.MetricsDeleter) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		DeleteMetrics(res, req, stor)
+	}
+	return fn
+}
+
+// CardinalityReportHandler - обертка над CardinalityReport для возможности установить учет серий.
+func CardinalityReportHandler(tracker *cardinality.Tracker) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		CardinalityReport(res, req, tracker)
+	}
+	return fn
+}
+
+// CacheStatsHandler - обертка над CacheStats.
+func CacheStatsHandler() http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		CacheStats(res, req)
+	}
+	return fn
+}
+
 // OtherRequestHandler - обертка над OtherRequest для возможности установить хранилище метрик.
 func OtherRequestHandler() http.HandlerFunc {
 	fn := func(res http.ResponseWriter, req *http.Request) {
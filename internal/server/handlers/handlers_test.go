@@ -16,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -28,8 +29,13 @@ import (
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/mocks"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/pg"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/readcache"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/saver"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
 )
 
 func TestOtherRequest(t *testing.T) {
@@ -285,6 +291,90 @@ func TestPingDatabase(t *testing.T) {
 	}
 }
 
+// fakePinger - проверка соединения с базой данных, возвращающая заданную ошибку.
+type fakePinger struct {
+	err error
+}
+
+func (p fakePinger) PingContext(_ context.Context) error {
+	return p.err
+}
+
+// fakePoolPinger - проверка соединения с базой данных, работающей через пул соединений.
+type fakePoolPinger struct {
+	fakePinger
+	stats pg.PoolStats
+	pool  bool
+}
+
+func (p fakePoolPinger) PoolStats() (pg.PoolStats, bool) {
+	return p.stats, p.pool
+}
+
+func TestPingDatabasePoolStats(t *testing.T) {
+	stats := pg.PoolStats{TotalConns: 4, IdleConns: 3, AcquiredConns: 1, MaxConns: 10, AcquireCount: 42}
+
+	tests := []struct {
+		name       string
+		db         DatabasePinger
+		statusCode int
+		stats      *pg.PoolStats
+	}{
+		{
+			name:       "database is not configured",
+			db:         nil,
+			statusCode: 500,
+		},
+		{
+			name:       "failure ping",
+			db:         fakePinger{err: errors.New("connection refused")},
+			statusCode: 500,
+		},
+		{
+			name:       "ping without pool",
+			db:         fakePinger{},
+			statusCode: 200,
+		},
+		{
+			name:       "store without pool",
+			db:         fakePoolPinger{},
+			statusCode: 200,
+		},
+		{
+			name:       "pool stats",
+			db:         fakePoolPinger{stats: stats, pool: true},
+			statusCode: 200,
+			stats:      &stats,
+		},
+		{
+			name:       "failure ping with pool",
+			db:         fakePoolPinger{fakePinger: fakePinger{err: errors.New("connection refused")}, stats: stats, pool: true},
+			statusCode: 500,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Get("/ping", PingDatabaseHandler(tt.db))
+
+			request := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+			if tt.stats == nil {
+				return
+			}
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			var got pg.PoolStats
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, *tt.stats, got)
+		})
+	}
+}
+
 func TestGetMetricJSON(t *testing.T) {
 	{
 		stor := storage.NewMemStorage(map[string]float64{"testgauge1": 3.134, "testgauge2": 10, "alloc": 233184}, map[string]int64{"testcount1": 4, "testcount2": 1})
@@ -679,10 +769,11 @@ func TestGetMetricJSON(t *testing.T) {
 
 func TestUpdateMetricsBatch(t *testing.T) {
 	tests := []struct {
-		name string
-		body []byte
-		stor repositories.MetricsWriter
-		code int
+		name   string
+		body   []byte
+		stor   repositories.MetricsWriter
+		limits ratelimit.Limits
+		code   int
 	}{
 		{
 			name: "Storage is nil",
@@ -696,9 +787,26 @@ func TestUpdateMetricsBatch(t *testing.T) {
 			stor: storage.NewDefaultMemStorage(),
 			code: 500,
 		},
+		{
+			name:   "Batch within quota",
+			body:   []byte(`[{"id":"first","type":"counter","delta":1},{"id":"second","type":"gauge","value":1.5}]`),
+			stor:   storage.NewDefaultMemStorage(),
+			limits: ratelimit.Limits{MaxBatchMetrics: 2},
+			code:   200,
+		},
+		{
+			name:   "Batch quota exceeded",
+			body:   []byte(`[{"id":"first","type":"counter","delta":1},{"id":"second","type":"gauge","value":1.5},{"id":"third","type":"counter","delta":2}]`),
+			stor:   storage.NewDefaultMemStorage(),
+			limits: ratelimit.Limits{MaxBatchMetrics: 2},
+			code:   429,
+		},
 	}
+	defer ratelimit.SetLimits(ratelimit.Limits{})
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			ratelimit.SetLimits(tt.limits)
+
 			r := chi.NewRouter()
 			r.Post("/", func(res http.ResponseWriter, req *http.Request) {
 				UpdateMetricsBatch(res, req, tt.stor)
@@ -712,6 +820,9 @@ func TestUpdateMetricsBatch(t *testing.T) {
 			defer res.Body.Close() // Закрываем тело ответа
 			// проверяем код ответа
 			assert.Equal(t, tt.code, res.StatusCode)
+			if tt.code == http.StatusTooManyRequests {
+				assert.Equal(t, "1", res.Header.Get(ratelimit.RetryAfterHeader))
+			}
 		})
 	}
 }
@@ -1317,3 +1428,202 @@ func BenchmarkUpdateMetricsJSON(b *testing.B) {
 		}
 	}
 }
+
+func TestUpdateMetricsCardinality(t *testing.T) {
+	tracker := cardinality.NewTracker(cardinality.Limits{MaxSeries: 1})
+	stor := cardinality.NewStorage(storage.NewDefaultMemStorage(), tracker)
+
+	r := chi.NewRouter()
+	r.Post("/update/", UpdateMetricsJSONHandler(stor))
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", UpdateMetricsHandler(stor))
+	r.Post("/updates/", UpdateMetricsBatchHandler(stor))
+	r.Get("/api/cardinality", CardinalityReportHandler(tracker))
+
+	send := func(method, path, body string) *http.Response {
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{name: "empty name in json", method: http.MethodPost, path: "/update/", body: `{"id":"","type":"counter","delta":1}`, code: 400},
+		{name: "long name in json", method: http.MethodPost, path: "/update/",
+			body: `{"id":"` + strings.Repeat("a", 200) + `","type":"counter","delta":1}`, code: 400},
+		{name: "invalid name in url", method: http.MethodPost, path: "/update/gauge/cpu%7Bhost%7D/1", code: 400},
+		{name: "invalid name in batch", method: http.MethodPost, path: "/updates/", body: `[{"id":"a*b","type":"counter","delta":1}]`, code: 400},
+		{name: "first series", method: http.MethodPost, path: "/update/counter/first/1", code: 200},
+		{name: "series limit exceeded", method: http.MethodPost, path: "/update/counter/second/1", code: 422},
+		{name: "series limit exceeded in batch", method: http.MethodPost, path: "/updates/", body: `[{"id":"first","type":"counter","delta":1},{"id":"third","type":"counter","delta":1}]`, code: 422},
+		{name: "existing series", method: http.MethodPost, path: "/update/", body: `{"id":"first","type":"counter","delta":1}`, code: 200},
+		{name: "report", method: http.MethodGet, path: "/api/cardinality?limit=1", code: 200},
+		{name: "report with invalid limit", method: http.MethodGet, path: "/api/cardinality?limit=many", code: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := send(tt.method, tt.path, tt.body)
+			defer res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+		})
+	}
+
+	res := send(http.MethodGet, "/api/cardinality", "")
+	defer res.Body.Close()
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	var report cardinality.Report
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(t, 1, report.TotalSeries)
+	assert.Equal(t, int64(2), report.Overflow)
+	assert.Equal(t, []cardinality.ClientReport{{Client: "unknown", Series: 1, Overflow: 2}}, report.TopClients)
+}
+
+func TestDeleteMetrics(t *testing.T) {
+	tracker := cardinality.NewTracker(cardinality.Limits{MaxSeries: 4})
+	stor := cardinality.NewStorage(storage.NewMemStorage(
+		map[string]float64{"cpu;host=a": 1, "cpu;host=b": 2, "Alloc": 3},
+		map[string]int64{"PollCount": 4},
+	), tracker)
+	require.NoError(t, stor.Seed(context.Background()))
+
+	r := chi.NewRouter()
+	r.Delete("/value/{metricType}/{metricName}", DeleteMetricHandler(stor))
+	r.Delete("/api/metrics", DeleteMetricsHandler(stor))
+
+	send := func(path string) *http.Response {
+		request := httptest.NewRequest(http.MethodDelete, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		code    int
+		deleted int
+	}{
+		{name: "invalid type", path: "/value/summary/Alloc", code: 400},
+		{name: "unknown metric", path: "/value/gauge/unknown", code: 404},
+		{name: "wrong type of metric", path: "/value/counter/Alloc", code: 404},
+		{name: "delete one metric", path: "/value/gauge/Alloc", code: 200},
+		{name: "empty filter", path: "/api/metrics?type=gauge", code: 400},
+		{name: "invalid type in filter", path: "/api/metrics?type=summary&prefix=cpu", code: 400},
+		{name: "invalid label", path: "/api/metrics?label=host", code: 400},
+		{name: "delete by label", path: "/api/metrics?label=host%3Da", code: 200, deleted: 1},
+		{name: "nothing to delete", path: "/api/metrics?prefix=mem", code: 200, deleted: 0},
+		{name: "delete by prefix", path: "/api/metrics?prefix=cpu&type=gauge", code: 200, deleted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := send(tt.path)
+			defer res.Body.Close()
+			require.Equal(t, tt.code, res.StatusCode)
+			if tt.code != 200 || !strings.HasPrefix(tt.path, "/api/metrics") {
+				return
+			}
+			var result DeleteMetricsResult
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+			assert.Equal(t, tt.deleted, result.Deleted)
+			assert.Len(t, result.Metrics, tt.deleted)
+		})
+	}
+
+	// удаленная метрика возвращается в ответе
+	res := send("/value/counter/PollCount")
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	var metric repositories.Metric
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&metric))
+	assert.Equal(t, "PollCount", metric.ID)
+	require.NotNil(t, metric.Delta)
+	assert.Equal(t, int64(4), *metric.Delta)
+
+	// серии удаленных метрик освобождают лимит
+	metrics, err := stor.GetAllMetricsSlice(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+	assert.Equal(t, 0, tracker.Report(0).TotalSeries)
+}
+
+func TestUpdateMetricsTypeConflict(t *testing.T) {
+	stor := storage.NewMemStorage(map[string]float64{"Alloc": 1}, map[string]int64{"PollCount": 1})
+
+	r := chi.NewRouter()
+	r.Post("/update/", UpdateMetricsJSONHandler(stor))
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", UpdateMetricsHandler(stor))
+	r.Post("/updates/", UpdateMetricsBatchHandler(stor))
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		code int
+	}{
+		{name: "counter named as gauge", path: "/update/counter/Alloc/1", code: 409},
+		{name: "gauge named as counter in json", path: "/update/", body: `{"id":"PollCount","type":"gauge","value":1}`, code: 409},
+		{name: "conflict in batch", path: "/updates/", body: `[{"id":"Frees","type":"gauge","value":1},{"id":"Frees","type":"counter","delta":1}]`, code: 409},
+		{name: "same type", path: "/update/gauge/Alloc/2", code: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+		})
+	}
+
+	_, err := stor.GetMetric(context.Background(), "gauge", "Frees")
+	assert.Error(t, err)
+}
+
+func TestUpdateMetricsBufferFull(t *testing.T) {
+	stor := writebehind.NewStorage(storage.NewDefaultMemStorage(),
+		writebehind.Config{FlushInterval: time.Hour, MaxPending: 1, MaxWait: time.Millisecond})
+	require.NoError(t, stor.AddGauge(context.Background(), "Alloc", 1))
+
+	r := chi.NewRouter()
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", UpdateMetricsHandler(stor))
+
+	request := httptest.NewRequest(http.MethodPost, "/update/gauge/Frees/1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestCacheStats(t *testing.T) {
+	readcache.ResetStats()
+	defer readcache.ResetStats()
+	readcache.SetConfig(readcache.Config{TTL: time.Minute})
+	defer readcache.SetConfig(readcache.Config{})
+
+	stor := readcache.NewStorage(storage.NewMemStorage(map[string]float64{"Alloc": 1}, map[string]int64{}), time.Minute, nil)
+	for i := 0; i < 3; i++ {
+		_, err := stor.GetMetric(context.Background(), "gauge", "Alloc")
+		require.NoError(t, err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/api/cache", CacheStatsHandler())
+	request := httptest.NewRequest(http.MethodGet, "/api/cache", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, request)
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	var stats readcache.Stats
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&stats))
+	assert.Equal(t, readcache.Stats{Enabled: true, Hits: 2, Misses: 1}, stats)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// defaultHistoryRange - интервал запроса истории, если его начало не задано.
+const defaultHistoryRange = time.Hour
+
+// historyPoint - значение истории в ответе.
+type historyPoint struct {
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Sum   float64   `json:"sum"`
+	Count int64     `json:"count"`
+	Last  float64   `json:"last"`
+}
+
+// historyResponse - ответ на запрос истории метрики.
+type historyResponse struct {
+	Type   string         `json:"type"`
+	Name   string         `json:"name"`
+	Tier   string         `json:"tier"` // уровень хранения, с которого получены значения
+	Points []historyPoint `json:"points"`
+}
+
+// parseHistoryTime - разбирает время в формате RFC3339 или в секундах Unix. Пустое значение заменяется def.
+func parseHistoryTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or unix seconds", value)
+	}
+	return t, nil
+}
+
+// History - возвращает значения метрики за интервал времени. Параметры запроса: type и name - тип и имя
+// метрики, from и to - начало и конец интервала, по умолчанию последний час, step - длительность интервала,
+// по которому объединяются значения. Уровень хранения выбирается по началу интервала и шагу.
+func History(res http.ResponseWriter, req *http.Request, hist *history.History) {
+	if hist == nil {
+		http.Error(res, "history of metrics is disabled", http.StatusNotFound)
+		return
+	}
+
+	query := req.URL.Query()
+	mtype, name := query.Get("type"), query.Get("name")
+	if mtype != "gauge" && mtype != "counter" {
+		http.Error(res, fmt.Sprintf("invalid type of metric: %s", mtype), http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		http.Error(res, "name of metric is required", http.StatusBadRequest)
+		return
+	}
+	to, err := parseHistoryTime(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := parseHistoryTime(query.Get("from"), to.Add(-defaultHistoryRange))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		http.Error(res, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	var step time.Duration
+	if value := query.Get("step"); value != "" {
+		step, err = time.ParseDuration(value)
+		if err != nil || step <= 0 {
+			http.Error(res, fmt.Sprintf("invalid step: %s", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tier, points, err := hist.Query(req.Context(), mtype, name, from, to, step)
+	if err != nil {
+		logger.ServerLog.Error("query history error", zap.String("error", error.Error(err)))
+		http.Error(res, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := historyResponse{Type: mtype, Name: name, Tier: tier.String(), Points: make([]historyPoint, 0, len(points))}
+	for _, p := range points {
+		response.Points = append(response.Points, historyPoint{
+			Time: p.Time.UTC(), Min: p.Min, Max: p.Max, Avg: p.Avg(), Sum: p.Sum, Count: p.Count, Last: p.Last,
+		})
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(response); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// HistoryHandler - обертка над History для возможности установить историю значений метрик.
+func HistoryHandler(hist *history.History) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		History(res, req, hist)
+	}
+	return fn
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+)
+
+func TestHistory(t *testing.T) {
+	hist := history.New(history.NewMemStore(), []history.Tier{
+		{Retention: 2 * time.Hour},
+		{Resolution: time.Minute, Retention: 24 * time.Hour},
+	})
+	now := time.Now()
+	one, two := 1.0, 3.0
+	hist.Record(now.Add(-2*time.Second), repositories.Metric{ID: "Alloc", MType: "gauge", Value: &one})
+	hist.Record(now.Add(-time.Second), repositories.Metric{ID: "Alloc", MType: "gauge", Value: &two})
+
+	r := chi.NewRouter()
+	r.Get("/api/history", HistoryHandler(hist))
+	from := strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		query  string
+		code   int
+		tier   string
+		points int
+	}{
+		{name: "raw values", query: "?type=gauge&name=Alloc", code: 200, tier: "raw:2h", points: 2},
+		{name: "rollup by step", query: "?type=gauge&name=Alloc&step=1h&from=" + from, code: 200, tier: "1m:1d", points: 1},
+		{name: "rfc3339 range", query: "?type=gauge&name=Alloc&from=" + now.Add(-time.Minute).UTC().Format(time.RFC3339) +
+			"&to=" + now.Add(-1500*time.Millisecond).UTC().Format(time.RFC3339Nano), code: 200, tier: "raw:2h", points: 1},
+		{name: "unknown metric", query: "?type=counter&name=Alloc", code: 200, tier: "raw:2h", points: 0},
+		{name: "invalid type", query: "?type=histogram&name=Alloc", code: 400},
+		{name: "without name", query: "?type=gauge", code: 400},
+		{name: "invalid time", query: "?type=gauge&name=Alloc&from=yesterday", code: 400},
+		{name: "empty range", query: "?type=gauge&name=Alloc&from=" + from + "&to=" + from, code: 400},
+		{name: "invalid step", query: "?type=gauge&name=Alloc&step=-1m", code: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := serve(r, http.MethodGet, "/api/history"+tt.query, nil)
+			require.Equal(t, tt.code, res.StatusCode, body)
+			if tt.code != 200 {
+				return
+			}
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			var response historyResponse
+			require.NoError(t, json.Unmarshal([]byte(body), &response))
+			assert.Equal(t, tt.tier, response.Tier)
+			assert.Len(t, response.Points, tt.points)
+		})
+	}
+
+	// история отключена
+	disabled := chi.NewRouter()
+	disabled.Get("/api/history", HistoryHandler(nil))
+	res, _ := serve(disabled, http.MethodGet, "/api/history?type=gauge&name=Alloc", nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
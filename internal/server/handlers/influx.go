@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/influx"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+// InfluxWrite - принимает метрики в формате InfluxDB line protocol, как /api/v2/write и /write в InfluxDB.
+// Параметры запроса InfluxDB, например bucket и precision, не используются. При успехе отвечает 204 No Content.
+func InfluxWrite(res http.ResponseWriter, req *http.Request, storage repositories.MetricsWriter, conv *influx.Converter) {
+	if storage == nil {
+		http.Error(res, "Storage not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logger.ServerLog.Info("body size quota exceeded", zap.String("address", req.URL.String()))
+			ratelimit.QuotaExceeded(res, err)
+			return
+		}
+		logger.ServerLog.Error("read body error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, "read body error", http.StatusInternalServerError)
+		return
+	}
+	points, err := influx.ParseLines(body)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metrics, update := conv.Convert(points)
+	defer update.Discard()
+
+	// проверяю квоту на количество метрик в батче
+	if err := ratelimit.GetLimiter().CheckBatch(len(metrics)); err != nil {
+		logger.ServerLog.Info("batch quota exceeded", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		ratelimit.QuotaExceeded(res, err)
+		return
+	}
+	if len(metrics) > 0 {
+		if err := storage.AddMetricsFromSlice(req.Context(), metrics); err != nil {
+			logger.ServerLog.Error("add metric into server error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
+			return
+		}
+	}
+	update.Commit()
+
+	logger.ServerLog.Debug("successful write line protocol metrics", zap.String("address", req.URL.String()),
+		zap.Int("count", len(metrics)))
+	res.Header().Set("Status-Code", "204")
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// InfluxWriteHandler - обертка над InfluxWrite для возможности установить хранилище метрик и преобразование точек.
+func InfluxWriteHandler(stor repositories.MetricsWriter, conv *influx.Converter) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		InfluxWrite(res, req, stor, conv)
+	}
+	return fn
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/influx"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestInfluxWrite(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	r := chi.NewRouter()
+	handler := InfluxWriteHandler(stor, influx.NewConverter(influx.Config{Tags: influx.TagsAsLabels, Counters: true}))
+	r.Post("/api/v2/write", handler)
+	r.Post("/write", handler)
+	defer ratelimit.SetLimits(ratelimit.Limits{})
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		maxBatch int
+		code     int
+	}{
+		{name: "v2 write", path: "/api/v2/write?bucket=metrics&precision=s", body: "cpu,host=a usage=1.5 1700000000\nhttp requests_total=10i", code: 204},
+		{name: "v1 write", path: "/write?db=metrics", body: "mem value=42", code: 204},
+		{name: "empty body", path: "/write", body: "", code: 204},
+		{name: "invalid line", path: "/api/v2/write", body: "cpu usage=abc", code: 400},
+		{name: "batch quota", path: "/api/v2/write", body: "cpu a=1,b=2,c=3\nhttp requests_total=12i", maxBatch: 2, code: 429},
+		{name: "counter increase", path: "/write", body: "http requests_total=15i", code: 204},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratelimit.SetLimits(ratelimit.Limits{MaxBatchMetrics: tt.maxBatch})
+			res, body := serve(r, http.MethodPost, tt.path, strings.NewReader(tt.body))
+			assert.Equal(t, tt.code, res.StatusCode, body)
+		})
+	}
+
+	ctx := context.Background()
+	gauge, err := stor.GetMetric(ctx, "gauge", "cpu_usage;host=a")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", gauge)
+	gauge, err = stor.GetMetric(ctx, "gauge", "mem")
+	require.NoError(t, err)
+	assert.Equal(t, "42", gauge)
+	counter, err := stor.GetMetric(ctx, "counter", "http_requests_total")
+	require.NoError(t, err)
+	// первое значение counter только запоминается, отклоненный по квоте запрос не меняет последнее значение
+	assert.Equal(t, "5", counter)
+	_, err = stor.GetMetric(ctx, "gauge", "cpu_a")
+	assert.Error(t, err)
+
+	// без хранилища запрос не обрабатывается
+	res, _ := serve(InfluxWriteHandler(nil, influx.NewConverter(influx.Config{})), http.MethodPost, "/write", strings.NewReader("mem value=1"))
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+}
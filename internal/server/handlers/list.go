@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Размер страницы списка метрик.
+const (
+	DefaultListLimit = 100  // размер страницы, если параметр limit не задан
+	MaxListLimit     = 1000 // наибольший размер страницы
+)
+
+// parseListOptions - разбирает параметры списка метрик из параметров запроса type, prefix, match, sort, limit и after.
+func parseListOptions(query url.Values) (repositories.ListOptions, error) {
+	opts := repositories.ListOptions{
+		MType:  query.Get("type"),
+		Prefix: query.Get("prefix"),
+		Sort:   query.Get("sort"),
+		Limit:  DefaultListLimit,
+	}
+	if match := query.Get("match"); match != "" {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return repositories.ListOptions{}, fmt.Errorf("invalid match: %w", err)
+		}
+		opts.Match = re
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxListLimit {
+			return repositories.ListOptions{}, fmt.Errorf("invalid limit %q, allowed from 1 to %d", limit, MaxListLimit)
+		}
+		opts.Limit = n
+	}
+	if err := opts.Validate(); err != nil {
+		return repositories.ListOptions{}, err
+	}
+	if after := query.Get("after"); after != "" {
+		cursor, err := repositories.ParseCursor(after, opts.SortBy())
+		if err != nil {
+			return repositories.ListOptions{}, err
+		}
+		opts.After = cursor
+	}
+	return opts, nil
+}
+
+// ListMetrics - возвращает страницу списка метрик в формате JSON. Параметры запроса: type - тип метрики,
+// prefix - префикс имени, match - регулярное выражение для имени, sort - порядок сортировки name или value,
+// limit - размер страницы, after - курсор next из предыдущей страницы.
+func ListMetrics(res http.ResponseWriter, req *http.Request, storage repositories.MetricsReader) {
+	opts, err := parseListOptions(req.URL.Query())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := storage.ListMetrics(req.Context(), opts)
+	if err != nil {
+		logger.ServerLog.Error("list metrics error", zap.String("error", error.Error(err)))
+		if errors.Is(err, repositories.ErrInvalidCursor) {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(page); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// ListMetricsHandler - обертка над ListMetrics для возможности установить хранилище метрик.
+func ListMetricsHandler(stor repositories.MetricsReader) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		ListMetrics(res, req, stor)
+	}
+	return fn
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestListMetrics(t *testing.T) {
+	stor := storage.NewMemStorage(
+		map[string]float64{"cpu;host=a": 3, "cpu;host=b": 1, "Alloc": 2},
+		map[string]int64{"PollCount": 10},
+	)
+	r := chi.NewRouter()
+	r.Get("/api/metrics", ListMetricsHandler(stor))
+
+	list := func(query string) (*http.Response, repositories.MetricsPage) {
+		res, body := serve(r, http.MethodGet, "/api/metrics?"+query, nil)
+		var page repositories.MetricsPage
+		if res.StatusCode == 200 {
+			require.NoError(t, json.Unmarshal([]byte(body), &page))
+		}
+		return res, page
+	}
+	ids := func(page repositories.MetricsPage) []string {
+		result := make([]string, 0, len(page.Metrics))
+		for _, m := range page.Metrics {
+			result = append(result, m.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		code  int
+		want  []string
+	}{
+		{name: "all", query: "", code: 200, want: []string{"Alloc", "PollCount", "cpu;host=a", "cpu;host=b"}},
+		{name: "by type", query: "type=counter", code: 200, want: []string{"PollCount"}},
+		{name: "by prefix sorted by value", query: "prefix=cpu&sort=value", code: 200, want: []string{"cpu;host=b", "cpu;host=a"}},
+		{name: "by regexp", query: "match=" + url.QueryEscape("host=(a|c)$"), code: 200, want: []string{"cpu;host=a"}},
+		{name: "invalid type", query: "type=summary", code: 400},
+		{name: "invalid regexp", query: "match=" + url.QueryEscape("cpu("), code: 400},
+		{name: "invalid sort", query: "sort=updated", code: 400},
+		{name: "zero limit", query: "limit=0", code: 400},
+		{name: "too large limit", query: "limit=100000", code: 400},
+		{name: "invalid cursor", query: "after=abc", code: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, page := list(tt.query)
+			require.Equal(t, tt.code, res.StatusCode)
+			if tt.code != 200 {
+				return
+			}
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			assert.Equal(t, tt.want, ids(page))
+			assert.Empty(t, page.Next)
+		})
+	}
+
+	// постраничное чтение по значению
+	got := make([]string, 0)
+	query := "sort=value&limit=3"
+	for {
+		res, page := list(query)
+		require.Equal(t, 200, res.StatusCode)
+		got = append(got, ids(page)...)
+		if page.Next == "" {
+			break
+		}
+		query = "sort=value&limit=3&after=" + page.Next
+	}
+	assert.Equal(t, []string{"cpu;host=b", "Alloc", "cpu;host=a", "PollCount"}, got)
+
+	// курсор, полученный при сортировке по значению, не подходит для сортировки по имени
+	_, page := list("sort=value&limit=1")
+	res, _ := list("limit=1&after=" + page.Next)
+	assert.Equal(t, 400, res.StatusCode)
+	assert.False(t, strings.Contains(page.Next, "="), "cursor must be safe in query string")
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/otlp"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+// Типы содержимого запросов OTLP/HTTP.
+const (
+	otlpProtobuf = "application/x-protobuf"
+	otlpJSON     = "application/json"
+)
+
+// OTLPMetrics - принимает метрики OpenTelemetry по протоколу OTLP/HTTP в формате protobuf или JSON.
+// Ответ ExportMetricsServiceResponse кодируется в формате запроса, точки, которые не удалось преобразовать,
+// возвращаются в частичном успехе.
+func OTLPMetrics(res http.ResponseWriter, req *http.Request, storage repositories.MetricsWriter, conv *otlp.Converter) {
+	if storage == nil {
+		http.Error(res, "Storage not initialized", http.StatusInternalServerError)
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if contentType != otlpProtobuf && contentType != otlpJSON {
+		http.Error(res, "unsupported content type, expected "+otlpProtobuf+" or "+otlpJSON, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logger.ServerLog.Info("body size quota exceeded", zap.String("address", req.URL.String()))
+			ratelimit.QuotaExceeded(res, err)
+			return
+		}
+		logger.ServerLog.Error("read body error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		http.Error(res, "read body error", http.StatusInternalServerError)
+		return
+	}
+	request := &colmetricspb.ExportMetricsServiceRequest{}
+	if contentType == otlpJSON {
+		err = protojson.Unmarshal(body, request)
+	} else {
+		err = proto.Unmarshal(body, request)
+	}
+	if err != nil {
+		http.Error(res, "decode otlp request error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, partial, update := conv.Convert(request)
+	defer update.Discard()
+	// проверяю квоту на количество метрик в батче
+	if err := ratelimit.GetLimiter().CheckBatch(len(metrics)); err != nil {
+		logger.ServerLog.Info("batch quota exceeded", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+		ratelimit.QuotaExceeded(res, err)
+		return
+	}
+	if len(metrics) > 0 {
+		if err := storage.AddMetricsFromSlice(req.Context(), metrics); err != nil {
+			logger.ServerLog.Error("add metric into server error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), storageErrorStatus(err))
+			return
+		}
+	}
+	update.Commit()
+	if partial != nil {
+		logger.ServerLog.Info("otlp data points rejected", zap.Int64("count", partial.GetRejectedDataPoints()),
+			zap.String("error", partial.GetErrorMessage()))
+	}
+
+	response := &colmetricspb.ExportMetricsServiceResponse{PartialSuccess: partial}
+	var data []byte
+	if contentType == otlpJSON {
+		data, err = protojson.Marshal(response)
+	} else {
+		data, err = proto.Marshal(response)
+	}
+	if err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		http.Error(res, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", contentType)
+	res.Header().Set("Status-Code", "200")
+	if _, err := res.Write(data); err != nil {
+		logger.ServerLog.Error("error writing response", zap.String("error", error.Error(err)))
+	}
+}
+
+// OTLPMetricsHandler - обертка над OTLPMetrics для возможности установить хранилище метрик и преобразование метрик OTLP.
+func OTLPMetricsHandler(stor repositories.MetricsWriter, conv *otlp.Converter) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		OTLPMetrics(res, req, stor, conv)
+	}
+	return fn
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/otlp"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	handler := OTLPMetricsHandler(stor, otlp.NewConverter(otlp.Config{Resource: otlp.ResourceAsLabels, Attributes: []string{"service.name"}}))
+	defer ratelimit.SetLimits(ratelimit.Limits{})
+
+	request := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{{Key: "service.name",
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "api"}}}}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{Name: "cpu", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+				{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1.5}}}}}},
+			{Name: "requests", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{IsMonotonic: true,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints:             []*metricspb.NumberDataPoint{{Value: &metricspb.NumberDataPoint_AsInt{AsInt: 3}}}}}},
+			{Name: "rpc", Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+				DataPoints: []*metricspb.SummaryDataPoint{{}}}}},
+		}}},
+	}}}
+	protobufBody, err := proto.Marshal(request)
+	require.NoError(t, err)
+	jsonBody, err := protojson.Marshal(request)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		maxBatch    int
+		code        int
+		rejected    int64
+	}{
+		{name: "protobuf", contentType: "application/x-protobuf", body: protobufBody, code: 200, rejected: 1},
+		{name: "json", contentType: "application/json; charset=utf-8", body: jsonBody, code: 200, rejected: 1},
+		{name: "empty request", contentType: "application/x-protobuf", code: 200},
+		{name: "unsupported content type", contentType: "text/plain", body: protobufBody, code: 415},
+		{name: "invalid protobuf", contentType: "application/x-protobuf", body: []byte{0xff, 0xff}, code: 400},
+		{name: "invalid json", contentType: "application/json", body: []byte("{"), code: 400},
+		{name: "batch quota", contentType: "application/x-protobuf", body: protobufBody, maxBatch: 1, code: 429},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratelimit.SetLimits(ratelimit.Limits{MaxBatchMetrics: tt.maxBatch})
+			req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			handler(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.Equal(t, tt.code, res.StatusCode, string(body))
+			if tt.code != 200 {
+				return
+			}
+
+			// ответ кодируется в формате запроса
+			response := &colmetricspb.ExportMetricsServiceResponse{}
+			if res.Header.Get("Content-Type") == "application/json" {
+				require.NoError(t, protojson.Unmarshal(body, response))
+			} else {
+				require.NoError(t, proto.Unmarshal(body, response))
+			}
+			assert.Equal(t, tt.rejected, response.GetPartialSuccess().GetRejectedDataPoints())
+		})
+	}
+
+	ctx := context.Background()
+	gauge, err := stor.GetMetric(ctx, "gauge", "cpu;service.name=api")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", gauge)
+	counter, err := stor.GetMetric(ctx, "counter", "requests;service.name=api")
+	require.NoError(t, err)
+	assert.Equal(t, "6", counter)
+
+	// без хранилища запрос не обрабатывается
+	w := httptest.NewRecorder()
+	OTLPMetricsHandler(nil, otlp.NewConverter(otlp.Config{}))(w, httptest.NewRequest(http.MethodPost, "/v1/metrics", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestOTLPMetricsCommitAfterWrite(t *testing.T) {
+	stor := storage.NewDefaultMemStorage()
+	handler := OTLPMetricsHandler(stor, otlp.NewConverter(otlp.Config{}))
+	defer ratelimit.SetLimits(ratelimit.Limits{})
+
+	send := func(value int64, maxBatch int) int {
+		ratelimit.SetLimits(ratelimit.Limits{MaxBatchMetrics: maxBatch})
+		body, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+				{Name: "requests", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{IsMonotonic: true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints:             []*metricspb.NumberDataPoint{{StartTimeUnixNano: 1, Value: &metricspb.NumberDataPoint_AsInt{AsInt: value}}}}}},
+				{Name: "cpu", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+					{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1}}}}}},
+			}}},
+		}}})
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	// первое накопленное значение только запоминается, отклоненный запрос не меняет состояние серии
+	assert.Equal(t, http.StatusOK, send(10, 0))
+	assert.Equal(t, http.StatusTooManyRequests, send(15, 1))
+	assert.Equal(t, http.StatusOK, send(15, 0))
+
+	counter, err := stor.GetMetric(context.Background(), "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", counter)
+}
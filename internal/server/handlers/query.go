@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/query"
+)
+
+// querySeries - серия в ответе на запрос. Значение - пара из времени в секундах Unix и строки с числом.
+type querySeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  []any             `json:"value,omitempty"`
+	Values [][]any           `json:"values,omitempty"`
+}
+
+// queryResponse - ответ на запрос: vector для запроса в момент времени, matrix для запроса интервала.
+type queryResponse struct {
+	ResultType string        `json:"resultType"`
+	Result     []querySeries `json:"result"`
+}
+
+// querySample - преобразует значение серии в пару из времени и строки с числом.
+func querySample(s query.Sample) []any {
+	seconds := float64(s.Time.UnixNano()) / float64(time.Second)
+	return []any{seconds, strconv.FormatFloat(s.Value, 'f', -1, 64)}
+}
+
+// Query - вычисляет запрос на языке, похожем на PromQL. Параметр query - текст запроса. Если заданы start, end
+// и step, запрос вычисляется на интервале с шагом step, иначе в момент time, по умолчанию текущий.
+func Query(res http.ResponseWriter, req *http.Request, stor repositories.MetricsReader, hist *history.History) {
+	params := req.URL.Query()
+	expr, err := query.Parse(params.Get("query"))
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	engine := query.NewEngine(stor, hist)
+	response := queryResponse{ResultType: "vector"}
+	var result []query.Series
+	if params.Get("start") != "" || params.Get("end") != "" || params.Get("step") != "" {
+		response.ResultType = "matrix"
+		end, err := parseHistoryTime(params.Get("end"), time.Now())
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start, err := parseHistoryTime(params.Get("start"), end.Add(-defaultHistoryRange))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		step, err := time.ParseDuration(params.Get("step"))
+		if err != nil || step <= 0 {
+			http.Error(res, fmt.Sprintf("invalid step: %s", params.Get("step")), http.StatusBadRequest)
+			return
+		}
+		result, err = engine.Range(req.Context(), expr, start, end, step)
+		if err != nil {
+			queryError(res, err)
+			return
+		}
+	} else {
+		t, err := parseHistoryTime(params.Get("time"), time.Time{})
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err = engine.Instant(req.Context(), expr, t)
+		if err != nil {
+			queryError(res, err)
+			return
+		}
+	}
+
+	response.Result = make([]querySeries, 0, len(result))
+	for _, s := range result {
+		series := querySeries{Metric: s.Labels}
+		if response.ResultType == "vector" {
+			series.Value = querySample(s.Samples[0])
+		} else {
+			series.Values = make([][]any, 0, len(s.Samples))
+			for _, sample := range s.Samples {
+				series.Values = append(series.Values, querySample(sample))
+			}
+		}
+		response.Result = append(response.Result, series)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Status-Code", "200")
+
+	enc := json.NewEncoder(res)
+	if err := enc.Encode(response); err != nil {
+		logger.ServerLog.Error("error encoding response", zap.String("error", error.Error(err)))
+		return
+	}
+}
+
+// queryError - отвечает на ошибку вычисления запроса: ошибки запроса возвращаются клиенту, остальные логируются.
+func queryError(res http.ResponseWriter, err error) {
+	if errors.Is(err, query.ErrInvalidQuery) || errors.Is(err, query.ErrHistoryDisabled) || errors.Is(err, query.ErrTooManyPoints) {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.ServerLog.Error("evaluate query error", zap.String("error", error.Error(err)))
+	http.Error(res, "internal server error", http.StatusInternalServerError)
+}
+
+// QueryHandler - обертка над Query для возможности установить хранилище и историю значений метрик.
+func QueryHandler(stor repositories.MetricsReader, hist *history.History) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		Query(res, req, stor, hist)
+	}
+	return fn
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestQuery(t *testing.T) {
+	stor := storage.NewMemStorage(map[string]float64{"cpu;host=a": 3, "cpu;host=b": 5}, map[string]int64{"requests": 6})
+	hist := history.New(history.NewMemStore(), []history.Tier{{Retention: 2 * time.Hour}})
+	now := time.Now()
+	delta := int64(6)
+	hist.Record(now.Add(-10*time.Second), repositories.Metric{ID: "requests", MType: "counter", Delta: &delta})
+
+	r := chi.NewRouter()
+	r.Get("/api/query", QueryHandler(stor, hist))
+	unix := func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+
+	tests := []struct {
+		name       string
+		query      string
+		code       int
+		resultType string
+		series     int
+		samples    int
+	}{
+		{name: "current values", query: "?query=cpu", code: 200, resultType: "vector", series: 2, samples: 1},
+		{name: "aggregation", query: "?query=" + url.QueryEscape("sum by (host) (cpu)"), code: 200, resultType: "vector", series: 2, samples: 1},
+		{name: "rate at time", query: "?query=" + url.QueryEscape("rate(requests[1m])") + "&time=" + unix(now),
+			code: 200, resultType: "vector", series: 1, samples: 1},
+		{name: "range", query: "?query=" + url.QueryEscape("increase(requests[1m])") + "&start=" + unix(now.Add(-time.Minute)) +
+			"&end=" + unix(now) + "&step=30s", code: 200, resultType: "matrix", series: 1, samples: 3},
+		{name: "no matches", query: "?query=mem", code: 200, resultType: "vector"},
+		{name: "invalid query", query: "?query=" + url.QueryEscape("rate(cpu)"), code: 400},
+		{name: "empty query", query: "", code: 400},
+		{name: "invalid time", query: "?query=cpu&time=yesterday", code: 400},
+		{name: "range without step", query: "?query=cpu&start=" + unix(now.Add(-time.Minute)), code: 400},
+		{name: "too many points", query: "?query=cpu&start=" + unix(now.Add(-time.Hour)) + "&step=100ms", code: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := serve(r, http.MethodGet, "/api/query"+tt.query, nil)
+			require.Equal(t, tt.code, res.StatusCode, body)
+			if tt.code != 200 {
+				return
+			}
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			var response struct {
+				ResultType string `json:"resultType"`
+				Result     []struct {
+					Metric map[string]string `json:"metric"`
+					Value  []any             `json:"value"`
+					Values [][]any           `json:"values"`
+				} `json:"result"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(body), &response))
+			assert.Equal(t, tt.resultType, response.ResultType)
+			require.Len(t, response.Result, tt.series)
+			for _, s := range response.Result {
+				if tt.resultType == "vector" {
+					assert.Len(t, s.Value, 2)
+				} else {
+					assert.Len(t, s.Values, tt.samples)
+				}
+			}
+		})
+	}
+
+	// значение в ответе - строка с числом
+	res, body := serve(r, http.MethodGet, "/api/query?query="+url.QueryEscape("sum(cpu)"), nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, body, `"8"`)
+
+	// без истории доступны только текущие значения
+	disabled := chi.NewRouter()
+	disabled.Get("/api/query", QueryHandler(stor, nil))
+	res, _ = serve(disabled, http.MethodGet, "/api/query?query=cpu", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res, _ = serve(disabled, http.MethodGet, "/api/query?query="+url.QueryEscape("rate(requests[1m])"), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/stream"
+)
+
+// streamRetry - задержка переподключения клиента после разрыва соединения, в миллисекундах.
+const streamRetry = 1000
+
+// parseLastEventID - возвращает номер последнего полученного клиентом события из заголовка Last-Event-ID,
+// который браузер отправляет при переподключении, или из параметра запроса last_event_id.
+func parseLastEventID(req *http.Request) (uint64, error) {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid last event id: %s", value)
+	}
+	return id, nil
+}
+
+// writeStreamEvent - отправляет клиенту событие записи метрики.
+func writeStreamEvent(res http.ResponseWriter, event stream.Event) error {
+	payload, err := json.Marshal(event.Metric)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(res, "id: %d\nevent: metric\ndata: %s\n\n", event.ID, payload)
+	return err
+}
+
+// StreamMetrics - поток Server-Sent Events с метриками, принятыми сервером. Для counter событие содержит
+// принятое приращение. Параметры запроса type, name, prefix и label отбирают метрики так же, как при удалении.
+// При переподключении клиент получает пропущенные события, если они еще хранятся на сервере, иначе
+// событие reset с номером последнего события: клиенту следует заново получить текущие значения метрик.
+// При отсутствии событий отправляется комментарий heartbeat.
+func StreamMetrics(res http.ResponseWriter, req *http.Request, hub *stream.Hub, heartbeat time.Duration) {
+	filter, err := parseMetricFilter(req.URL.Query())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lastID, err := parseLastEventID(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub, backlog, lost := hub.Subscribe(filter, lastID)
+	defer sub.Close()
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.Header().Set("Status-Code", "200")
+
+	rc := http.NewResponseController(res)
+	send := func() error {
+		if _, err := fmt.Fprintf(res, "retry: %d\n\n", streamRetry); err != nil {
+			return err
+		}
+		if lost {
+			if _, err := fmt.Fprintf(res, "event: reset\ndata: {\"last_id\":%d}\n\n", hub.LastID()); err != nil {
+				return err
+			}
+		}
+		for _, event := range backlog {
+			if err := writeStreamEvent(res, event); err != nil {
+				return err
+			}
+		}
+		return rc.Flush()
+	}
+	if err := send(); err != nil {
+		logger.ServerLog.Debug("metrics stream is closed", zap.String("error", error.Error(err)))
+		return
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// подписка отменена при остановке сервера или из-за отставания клиента,
+				// клиент переподключится и получит пропущенные события
+				return
+			}
+			err = writeStreamEvent(res, event)
+		case <-ticker.C:
+			_, err = fmt.Fprint(res, ": heartbeat\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			logger.ServerLog.Debug("metrics stream is closed", zap.String("error", error.Error(err)))
+			return
+		}
+	}
+}
+
+// StreamMetricsHandler - обертка над StreamMetrics для возможности установить хаб событий.
+func StreamMetricsHandler(hub *stream.Hub) http.HandlerFunc {
+	fn := func(res http.ResponseWriter, req *http.Request) {
+		StreamMetrics(res, req, hub, stream.GetConfig().Heartbeat)
+	}
+	return fn
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/stream"
+)
+
+// sseEvent - событие потока Server-Sent Events.
+type sseEvent struct {
+	id   string
+	name string
+	data string
+}
+
+// readSSEEvent - читает из потока следующее событие, пропуская комментарии и поле retry.
+func readSSEEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	var e sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.name != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// openStream - подключается к потоку событий и возвращает читатель тела ответа.
+func openStream(t *testing.T, ctx context.Context, url, lastEventID string) (*http.Response, *bufio.Reader) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	return res, bufio.NewReader(res.Body)
+}
+
+func TestStreamMetrics(t *testing.T) {
+	hub := stream.NewHub(10)
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		StreamMetrics(res, req, hub, 10*time.Millisecond)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res, reader := openStream(t, ctx, srv.URL+"?type=counter", "")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// ожидание подписки: первым отправляется поле retry
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "retry: 1000\n", line)
+
+	value := 1.5
+	delta := int64(3)
+	hub.Publish(
+		repositories.Metric{ID: "Alloc", MType: "gauge", Value: &value},
+		repositories.Metric{ID: "PollCount", MType: "counter", Delta: &delta},
+	)
+	event := readSSEEvent(t, reader)
+	assert.Equal(t, sseEvent{id: "2", name: "metric", data: `{"id":"PollCount","type":"counter","delta":3}`}, event)
+
+	// при отсутствии событий отправляется комментарий
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == ": heartbeat\n" {
+			break
+		}
+	}
+
+	// переподключение с номером последнего полученного события возвращает пропущенные события
+	hub.Publish(repositories.Metric{ID: "PollCount", MType: "counter", Delta: &delta})
+	resumed, resumedReader := openStream(t, ctx, srv.URL, "1")
+	defer resumed.Body.Close()
+	assert.Equal(t, "2", readSSEEvent(t, resumedReader).id)
+	assert.Equal(t, "3", readSSEEvent(t, resumedReader).id)
+
+	// номер события, неизвестный серверу, приводит к событию reset
+	reset, resetReader := openStream(t, ctx, srv.URL, "100")
+	defer reset.Body.Close()
+	assert.Equal(t, sseEvent{name: "reset", data: `{"last_id":3}`}, readSSEEvent(t, resetReader))
+}
+
+func TestStreamMetricsBadRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header string
+	}{
+		{name: "invalid type", target: "/api/stream?type=histogram"},
+		{name: "invalid label", target: "/api/stream?label=host"},
+		{name: "invalid last event id header", target: "/api/stream", header: "abc"},
+		{name: "invalid last event id parameter", target: "/api/stream?last_event_id=-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				request.Header.Set("Last-Event-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			StreamMetrics(w, request, stream.NewHub(10), time.Second)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestStreamMetricsHubClosed(t *testing.T) {
+	hub := stream.NewHub(10)
+	hub.Close()
+
+	// при остановке сервера поток завершается
+	request := httptest.NewRequest(http.MethodGet, "/api/stream", nil)
+	w := httptest.NewRecorder()
+	StreamMetrics(w, request, hub, time.Second)
+	assert.Equal(t, "retry: 1000\n\n", w.Body.String())
+}
@@ -79,3 +79,47 @@ func HashMiddleware(handler http.Handler) http.HandlerFunc {
 	}
 	return logFn
 }
+
+// SignedMiddleware - middleware для запросов, изменяющих данные сервера в обход агентов. В отличие от
+// HashMiddleware запрос без подписи отклоняется, а если ключ не установлен, запросы отклоняются все.
+// У запроса без тела, например DELETE, подписывается строка RequestTarget: метод и адрес запроса.
+func SignedMiddleware(handler http.Handler) http.HandlerFunc {
+	checked := HashMiddleware(handler)
+	return func(res http.ResponseWriter, req *http.Request) {
+		if GetKey() == "" {
+			logger.ServerLog.Info("signed request rejected, key is not set", zap.String("address", req.URL.String()))
+			http.Error(res, "signing key is not set on server", http.StatusForbidden)
+			return
+		}
+		reqHash := req.Header.Get("HashSHA256")
+		if reqHash == "" || req.Header.Get("Hash") == "none" {
+			logger.ServerLog.Info("unsigned request rejected", zap.String("address", req.URL.String()))
+			http.Error(res, "request is not signed", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			logger.ServerLog.Error("read body error", zap.String("address", req.URL.String()), zap.String("error", error.Error(err)))
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		// подпись тела проверяет HashMiddleware, подпись запроса без тела проверяется здесь
+		if len(body) == 0 {
+			ok, err := repositories.CheckHash([]byte(RequestTarget(req)), reqHash, GetKey())
+			if err != nil || !ok {
+				logger.ServerLog.Info("signature of request target is not valid", zap.String("address", req.URL.String()))
+				http.Error(res, "signature is not valid", http.StatusBadRequest)
+				return
+			}
+		}
+		checked(res, req)
+	}
+}
+
+// RequestTarget - возвращает строку, которая подписывается у запроса без тела: метод и адрес запроса
+// с параметрами, например "DELETE /api/metrics?prefix=cpu".
+func RequestTarget(req *http.Request) string {
+	return req.Method + " " + req.URL.RequestURI()
+}
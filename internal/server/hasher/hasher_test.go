@@ -176,3 +176,83 @@ func TestHashMiddleware(t *testing.T) {
 		assert.Equal(t, 500, res.StatusCode)
 	}
 }
+
+func TestSignedMiddleware(t *testing.T) {
+	defer SetKey("")
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+	hash, err := repositories.CalkHash(body, "import key")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		key        string
+		header     map[string]string
+		statusCode int
+	}{
+		{name: "key is not set", key: "", header: map[string]string{"HashSHA256": hash}, statusCode: 403},
+		{name: "unsigned request", key: "import key", statusCode: 401},
+		{name: "hash disabled", key: "import key", header: map[string]string{"Hash": "none", "HashSHA256": hash}, statusCode: 401},
+		{name: "wrong signature", key: "other key", header: map[string]string{"HashSHA256": hash}, statusCode: 400},
+		{name: "signed request", key: "import key", header: map[string]string{"HashSHA256": hash}, statusCode: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetKey(tt.key)
+			r := chi.NewRouter()
+			r.Post("/api/import", SignedMiddleware(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+				res.WriteHeader(200)
+			})))
+
+			request := httptest.NewRequest(http.MethodPost, "/api/import", bytes.NewReader(body))
+			for k, v := range tt.header {
+				request.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+		})
+	}
+}
+
+func TestSignedMiddlewareWithoutBody(t *testing.T) {
+	defer SetKey("")
+	SetKey("delete key")
+	sign := func(target string) string {
+		hash, err := repositories.CalkHash([]byte(target), "delete key")
+		require.NoError(t, err)
+		return hash
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		hash       string
+		statusCode int
+	}{
+		{name: "signed request", target: "/api/metrics?prefix=cpu", hash: sign("DELETE /api/metrics?prefix=cpu"), statusCode: 200},
+		{name: "signature of other query", target: "/api/metrics?prefix=a", hash: sign("DELETE /api/metrics?prefix=cpu"), statusCode: 400},
+		{name: "signature of other method", target: "/api/metrics?prefix=cpu", hash: sign("GET /api/metrics?prefix=cpu"), statusCode: 400},
+		{name: "invalid signature", target: "/api/metrics", hash: "zz", statusCode: 400},
+		{name: "unsigned request", target: "/api/metrics", statusCode: 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Delete("/api/metrics", SignedMiddleware(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+				res.WriteHeader(200)
+			})))
+
+			request := httptest.NewRequest(http.MethodDelete, tt.target, nil)
+			if tt.hash != "" {
+				request.Header.Set("HashSHA256", tt.hash)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.statusCode, res.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package history
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Параметры истории по умолчанию.
+const (
+	DefaultFlushInterval   = time.Second // период записи накопленных сырых значений в хранилище
+	DefaultCompactInterval = time.Minute // период вычисления агрегатов и удаления устаревших значений
+)
+
+// History - история значений метрик. Сырые значения накапливаются в памяти и записываются в хранилище
+// пакетами, агрегаты уровней вычисляются сжатием.
+type History struct {
+	store Store
+	tiers []Tier
+
+	mu      sync.Mutex
+	pending []Point
+
+	compactMu  sync.Mutex
+	watermarks []time.Time // время, до которого вычислены агрегаты уровня
+}
+
+// New - фабричная функция структуры History. Уровни должны быть проверены функцией ParseTiers.
+func New(store Store, tiers []Tier) *History {
+	return &History{
+		store:      store,
+		tiers:      tiers,
+		watermarks: make([]time.Time, len(tiers)),
+	}
+}
+
+// Tiers - возвращает уровни хранения истории.
+func (h *History) Tiers() []Tier {
+	return h.tiers
+}
+
+// Record - добавляет сырые значения метрик, записанные в момент t.
+func (h *History) Record(t time.Time, metrics ...repositories.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, m := range metrics {
+		h.pending = append(h.pending, NewPoint(m, t))
+	}
+}
+
+// Flush - записывает накопленные сырые значения в хранилище. Значения одной метрики с одинаковым временем
+// с точностью до микросекунды объединяются, чтобы приращения counter из одного пакета не заменяли друг друга.
+func (h *History) Flush(ctx context.Context) error {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = nil
+	h.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	points := Rollup(pending, time.Microsecond)
+	if err := h.store.AddPoints(ctx, 0, points); err != nil {
+		// значения возвращаются в буфер, чтобы записать их при следующей попытке
+		h.mu.Lock()
+		h.pending = append(pending, h.pending...)
+		h.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Compact - вычисляет агрегаты каждого уровня из значений предыдущего уровня за завершившиеся интервалы
+// и удаляет значения, время хранения которых истекло. После запуска сервера агрегаты пересчитываются за все
+// время хранения предыдущего уровня, повторное вычисление агрегата заменяет прежний.
+func (h *History) Compact(ctx context.Context, now time.Time) error {
+	if err := h.Flush(ctx); err != nil {
+		return err
+	}
+	h.compactMu.Lock()
+	defer h.compactMu.Unlock()
+
+	for i := 1; i < len(h.tiers); i++ {
+		source, target := h.tiers[i-1], h.tiers[i]
+		end := now.Truncate(target.Resolution)
+		start := h.watermarks[i]
+		if start.IsZero() {
+			start = now.Add(-source.Retention).Truncate(target.Resolution)
+		}
+		if !start.Before(end) {
+			continue
+		}
+		points, err := h.store.Points(ctx, source.Resolution, "", "", start, end)
+		if err != nil {
+			return err
+		}
+		if rollups := Rollup(points, target.Resolution); len(rollups) > 0 {
+			if err := h.store.AddPoints(ctx, target.Resolution, rollups); err != nil {
+				return err
+			}
+			logger.ServerLog.Debug("history rolled up", zap.String("tier", target.String()),
+				zap.Int("source", len(points)), zap.Int("rollups", len(rollups)))
+		}
+		h.watermarks[i] = end
+	}
+
+	for _, tier := range h.tiers {
+		if err := h.store.DeletePoints(ctx, tier.Resolution, now.Add(-tier.Retention)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pickTier - выбирает уровень для запроса интервала, начинающегося в from, с шагом step. Из уровней, хранящих
+// значения с момента from, выбирается самый грубый уровень с интервалом агрегата не больше шага. Если значения
+// с момента from не хранит ни один уровень, выбирается уровень с наибольшим временем хранения.
+func (h *History) pickTier(now, from time.Time, step time.Duration) int {
+	picked, longest := -1, 0
+	for i, tier := range h.tiers {
+		if tier.Retention >= h.tiers[longest].Retention {
+			longest = i
+		}
+		if from.Before(now.Add(-tier.Retention)) {
+			continue
+		}
+		if picked < 0 || tier.Resolution <= step {
+			picked = i
+		}
+	}
+	if picked < 0 {
+		return longest
+	}
+	return picked
+}
+
+// points - возвращает значения метрики уровня i за интервал [from, to). Значения за интервалы, агрегаты
+// которых еще не вычислены сжатием, вычисляются из значений предыдущего уровня.
+func (h *History) points(ctx context.Context, i int, mtype, id string, from, to time.Time) ([]Point, error) {
+	split := to
+	if i > 0 {
+		h.compactMu.Lock()
+		watermark := h.watermarks[i]
+		h.compactMu.Unlock()
+		if watermark.Before(to) {
+			split = watermark
+			if split.Before(from) {
+				split = from
+			}
+		}
+	}
+	points, err := h.store.Points(ctx, h.tiers[i].Resolution, mtype, id, from, split)
+	if err != nil {
+		return nil, err
+	}
+	if split.Before(to) {
+		tail, err := h.points(ctx, i-1, mtype, id, split, to)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, Rollup(tail, h.tiers[i].Resolution)...)
+	}
+	return points, nil
+}
+
+// Query - возвращает значения метрики за интервал [from, to) с уровня, выбранного по началу интервала и шагу.
+// Если шаг больше интервала агрегата уровня, значения объединяются в агрегаты за интервалы длительностью step.
+func (h *History) Query(ctx context.Context, mtype, id string, from, to time.Time, step time.Duration) (Tier, []Point, error) {
+	i := h.pickTier(time.Now(), from, step)
+	tier := h.tiers[i]
+	// недавние сырые значения могут быть еще не записаны в хранилище
+	if err := h.Flush(ctx); err != nil {
+		return tier, nil, err
+	}
+	points, err := h.points(ctx, i, mtype, id, from, to)
+	if err != nil {
+		return tier, nil, err
+	}
+	if step > tier.Resolution {
+		points = Rollup(points, step)
+	}
+	return tier, points, nil
+}
+
+// Run - периодически записывает накопленные сырые значения и выполняет сжатие истории до отмены контекста.
+// Первое сжатие выполняется сразу, чтобы вычислить агрегаты за время остановки сервера. При отмене контекста
+// накопленные значения записываются в хранилище.
+func (h *History) Run(ctx context.Context, flushInterval, compactInterval time.Duration) {
+	logger.ServerLog.Debug("starting history compaction", zap.Duration("interval", compactInterval))
+	if err := h.Compact(ctx, time.Now()); err != nil {
+		logger.ServerLog.Error("compact history error", zap.String("error", error.Error(err)))
+	}
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+	compact := time.NewTicker(compactInterval)
+	defer compact.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := h.Flush(ctx); err != nil {
+				logger.ServerLog.Error("flush history error", zap.String("error", error.Error(err)))
+			}
+			return
+		case <-flush.C:
+			if err := h.Flush(ctx); err != nil {
+				logger.ServerLog.Error("flush history error", zap.String("error", error.Error(err)))
+			}
+		case now := <-compact.C:
+			if err := h.Compact(ctx, now); err != nil {
+				logger.ServerLog.Error("compact history error", zap.String("error", error.Error(err)))
+			}
+		}
+	}
+}
+
+// Config - настройки истории значений метрик.
+type Config struct {
+	Enabled         bool
+	Tiers           []Tier
+	CompactInterval time.Duration
+}
+
+var (
+	config  = Config{CompactInterval: DefaultCompactInterval}
+	store   Store    // хранилище истории, если не задано - история хранится в памяти
+	current *History // история сервера, nil - история отключена
+)
+
+// SetConfig - устанавливает настройки истории.
+func SetConfig(cfg Config) {
+	config = cfg
+}
+
+// GetConfig - возвращает настройки истории.
+func GetConfig() Config {
+	return config
+}
+
+// SetStore - устанавливает хранилище истории.
+func SetStore(s Store) {
+	store = s
+}
+
+// Open - создает историю сервера по установленным настройкам. Если история отключена, возвращает nil.
+func Open() *History {
+	if !config.Enabled {
+		current = nil
+		return nil
+	}
+	s := store
+	if s == nil {
+		s = NewMemStore()
+	}
+	tiers := config.Tiers
+	if len(tiers) == 0 {
+		tiers, _ = ParseTiers(DefaultTiers)
+	}
+	current = New(s, tiers)
+	return current
+}
+
+// Get - возвращает историю сервера, созданную функцией Open, или nil, если история отключена.
+func Get() *History {
+	return current
+}
@@ -0,0 +1,187 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func gauge(id string, value float64) repositories.Metric {
+	return repositories.Metric{ID: id, MType: "gauge", Value: &value}
+}
+
+func counter(id string, delta int64) repositories.Metric {
+	return repositories.Metric{ID: id, MType: "counter", Delta: &delta}
+}
+
+func TestHistoryCompact(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	tiers, err := ParseTiers("raw:2h,1m:1d,1h:30d")
+	require.NoError(t, err)
+	h := New(store, tiers)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// значения за три минуты, четвертая минута не завершена
+	for i := 0; i < 4; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		h.Record(at, gauge("Alloc", float64(i)), counter("PollCount", 1))
+		h.Record(at.Add(30*time.Second), gauge("Alloc", float64(i+10)), counter("PollCount", 2))
+	}
+	require.NoError(t, h.Compact(ctx, start.Add(3*time.Minute+40*time.Second)))
+
+	minutes, err := store.Points(ctx, time.Minute, "gauge", "Alloc", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, minutes, 3)
+	assert.Equal(t, Point{MType: "gauge", ID: "Alloc", Time: start.Add(time.Minute), Min: 1, Max: 11, Sum: 12, Count: 2, Last: 11}, minutes[1])
+
+	counters, err := store.Points(ctx, time.Minute, "counter", "PollCount", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, counters, 3)
+	assert.Equal(t, 3.0, counters[0].Sum)
+
+	// часовой интервал не завершен - часовых агрегатов нет
+	hours, err := store.Points(ctx, time.Hour, "", "", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, hours)
+
+	// следующее сжатие дополняет минутные агрегаты и вычисляет часовой агрегат
+	require.NoError(t, h.Compact(ctx, start.Add(time.Hour)))
+	minutes, err = store.Points(ctx, time.Minute, "gauge", "Alloc", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, minutes, 4)
+	hours, err = store.Points(ctx, time.Hour, "gauge", "Alloc", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, hours, 1)
+	assert.Equal(t, Point{MType: "gauge", ID: "Alloc", Time: start, Min: 0, Max: 13, Sum: 52, Count: 8, Last: 13}, hours[0])
+
+	// время хранения сырых значений истекло
+	require.NoError(t, h.Compact(ctx, start.Add(3*time.Hour)))
+	raw, err := store.Points(ctx, 0, "", "", start, start.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, raw)
+	minutes, err = store.Points(ctx, time.Minute, "gauge", "Alloc", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, minutes, 4)
+}
+
+func TestHistoryFlushMergesCounters(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	h := New(store, []Tier{{Retention: time.Hour}})
+	at := time.Now()
+
+	// приращения одного пакета не заменяют друг друга
+	h.Record(at, counter("PollCount", 1), counter("PollCount", 2))
+	require.NoError(t, h.Flush(ctx))
+	points, err := store.Points(ctx, 0, "counter", "PollCount", at.Add(-time.Second), at.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.Equal(t, 3.0, points[0].Sum)
+}
+
+func TestHistoryPickTier(t *testing.T) {
+	tiers, err := ParseTiers(DefaultTiers)
+	require.NoError(t, err)
+	h := New(NewMemStore(), tiers)
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		from       time.Duration
+		step       time.Duration
+		resolution time.Duration
+	}{
+		{name: "recent without step", from: time.Hour, resolution: 0},
+		{name: "recent with minute step", from: time.Hour, step: time.Minute, resolution: time.Minute},
+		{name: "recent with small step", from: time.Hour, step: 10 * time.Second, resolution: 0},
+		{name: "recent with day step", from: time.Hour, step: 24 * time.Hour, resolution: time.Hour},
+		{name: "week ago", from: 7 * 24 * time.Hour, resolution: time.Minute},
+		{name: "week ago with small step", from: 7 * 24 * time.Hour, step: time.Second, resolution: time.Minute},
+		{name: "half a year ago", from: 180 * 24 * time.Hour, resolution: time.Hour},
+		{name: "beyond retention", from: 2 * 365 * 24 * time.Hour, resolution: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.resolution, h.tiers[h.pickTier(now, now.Add(-tt.from), tt.step)].Resolution)
+		})
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	ctx := context.Background()
+	h := New(NewMemStore(), []Tier{{Retention: time.Hour}, {Resolution: time.Minute, Retention: 24 * time.Hour}})
+	now := time.Now()
+
+	// недавние сырые значения доступны до записи в хранилище
+	h.Record(now.Add(-2*time.Second), gauge("Alloc", 1))
+	h.Record(now.Add(-time.Second), gauge("Alloc", 3))
+	tier, points, err := h.Query(ctx, "gauge", "Alloc", now.Add(-time.Minute), now, 0)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), tier.Resolution)
+	assert.Len(t, points, 2)
+
+	// минутные агрегаты еще не вычислены сжатием и вычисляются из сырых значений, значения объединяются
+	// по шагу запроса
+	tier, points, err = h.Query(ctx, "gauge", "Alloc", now.Add(-time.Minute), now, 10*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, tier.Resolution)
+	require.NotEmpty(t, points)
+	assert.Equal(t, 3.0, points[len(points)-1].Last)
+	var count int64
+	for _, p := range points {
+		count += p.Count
+	}
+	assert.Equal(t, int64(2), count)
+}
+
+func TestHistoryQueryCompacted(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	h := New(store, []Tier{{Retention: time.Hour}, {Resolution: time.Minute, Retention: 24 * time.Hour}})
+	now := time.Now()
+	compacted := now.Truncate(time.Minute)
+
+	// агрегат, вычисленный сжатием, используется, даже если сырые значения уже удалены
+	require.NoError(t, store.AddPoints(ctx, time.Minute, []Point{
+		{MType: "gauge", ID: "Alloc", Time: compacted.Add(-time.Minute), Min: 5, Max: 5, Sum: 5, Count: 1, Last: 5},
+	}))
+	h.watermarks[1] = compacted
+	h.Record(compacted.Add(time.Millisecond), gauge("Alloc", 7))
+
+	_, points, err := h.Query(ctx, "gauge", "Alloc", now.Add(-2*time.Hour), now.Add(time.Minute), 0)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, 5.0, points[0].Last)
+	assert.Equal(t, 7.0, points[1].Last)
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	h := New(store, []Tier{{Retention: time.Hour}})
+	stor := NewStorage(storage.NewDefaultMemStorage(), h)
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 2))
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{gauge("Alloc", 2.5)}))
+	// ошибочная запись и замена метрик не добавляются в историю
+	assert.Error(t, stor.AddCounter(ctx, "Alloc", 1))
+	require.NoError(t, stor.ReplaceMetrics(ctx, []repositories.Metric{gauge("Other", 1)}))
+	require.NoError(t, h.Flush(ctx))
+
+	points, err := store.Points(ctx, 0, "", "", time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	assert.Equal(t, "Alloc", points[0].ID)
+	assert.Equal(t, 1.5, points[0].Last)
+	assert.Equal(t, 2.5, points[1].Last)
+	assert.Equal(t, "PollCount", points[2].ID)
+	assert.Equal(t, 2.0, points[2].Sum)
+}
@@ -0,0 +1,125 @@
+// Package historytest содержит набор тестов, которому должна удовлетворять каждая реализация
+// интерфейса history.Store, чтобы хранилища истории были взаимозаменяемы.
+package historytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+)
+
+// Factory - создает пустое хранилище истории для одного теста.
+type Factory func(t *testing.T) history.Store
+
+// Run - запускает набор тестов хранилища истории. Для каждого теста хранилище создается заново.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store history.Store)
+	}{
+		{name: "points of series", run: testPoints},
+		{name: "point is replaced", run: testReplace},
+		{name: "tiers are separated", run: testTiers},
+		{name: "delete points", run: testDelete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+// start - время первого значения в тестах, округленное до секунды, чтобы точность хранилища не влияла на сравнение.
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func point(mtype, id string, offset time.Duration, value float64) history.Point {
+	return history.Point{MType: mtype, ID: id, Time: start.Add(offset), Min: value, Max: value, Sum: value, Count: 1, Last: value}
+}
+
+// requirePoints - проверяет значения без учета часового пояса времени.
+func requirePoints(t *testing.T, expected, actual []history.Point) {
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		assert.True(t, expected[i].Time.Equal(actual[i].Time), "time of point %d", i)
+		actual[i].Time = expected[i].Time
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func testPoints(t *testing.T, store history.Store) {
+	ctx := context.Background()
+	points := []history.Point{
+		point("gauge", "b", 2*time.Second, 3),
+		point("gauge", "a", time.Second, 2),
+		point("gauge", "a", 0, 1),
+		point("counter", "a", 0, 5),
+		point("gauge", "a", 3*time.Second, 4),
+	}
+	require.NoError(t, store.AddPoints(ctx, 0, points))
+
+	// значения одной метрики за полуоткрытый интервал
+	got, err := store.Points(ctx, 0, "gauge", "a", start, start.Add(3*time.Second))
+	require.NoError(t, err)
+	requirePoints(t, []history.Point{point("gauge", "a", 0, 1), point("gauge", "a", time.Second, 2)}, got)
+
+	// значения всех метрик упорядочены по имени, типу и времени
+	got, err = store.Points(ctx, 0, "", "", start, start.Add(time.Minute))
+	require.NoError(t, err)
+	requirePoints(t, []history.Point{
+		point("counter", "a", 0, 5),
+		point("gauge", "a", 0, 1),
+		point("gauge", "a", time.Second, 2),
+		point("gauge", "a", 3*time.Second, 4),
+		point("gauge", "b", 2*time.Second, 3),
+	}, got)
+
+	got, err = store.Points(ctx, 0, "gauge", "missing", start, start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func testReplace(t *testing.T, store history.Store) {
+	ctx := context.Background()
+	require.NoError(t, store.AddPoints(ctx, time.Minute, []history.Point{point("gauge", "a", 0, 1)}))
+	replaced := history.Point{MType: "gauge", ID: "a", Time: start, Min: 1, Max: 5, Sum: 9, Count: 3, Last: 3}
+	require.NoError(t, store.AddPoints(ctx, time.Minute, []history.Point{replaced}))
+
+	got, err := store.Points(ctx, time.Minute, "gauge", "a", start, start.Add(time.Minute))
+	require.NoError(t, err)
+	requirePoints(t, []history.Point{replaced}, got)
+}
+
+func testTiers(t *testing.T, store history.Store) {
+	ctx := context.Background()
+	require.NoError(t, store.AddPoints(ctx, 0, []history.Point{point("gauge", "a", 0, 1)}))
+	require.NoError(t, store.AddPoints(ctx, time.Hour, []history.Point{point("gauge", "a", 0, 2)}))
+
+	got, err := store.Points(ctx, time.Hour, "gauge", "a", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	requirePoints(t, []history.Point{point("gauge", "a", 0, 2)}, got)
+
+	// удаление значений одного уровня не затрагивает другие уровни
+	require.NoError(t, store.DeletePoints(ctx, 0, start.Add(time.Hour)))
+	got, err = store.Points(ctx, time.Hour, "gauge", "a", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+}
+
+func testDelete(t *testing.T, store history.Store) {
+	ctx := context.Background()
+	require.NoError(t, store.AddPoints(ctx, 0, []history.Point{
+		point("gauge", "a", 0, 1),
+		point("gauge", "a", time.Minute, 2),
+		point("gauge", "b", 0, 3),
+	}))
+	require.NoError(t, store.DeletePoints(ctx, 0, start.Add(time.Minute)))
+
+	got, err := store.Points(ctx, 0, "", "", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	requirePoints(t, []history.Point{point("gauge", "a", time.Minute, 2)}, got)
+}
@@ -0,0 +1,193 @@
+// Package history хранит историю значений метрик по уровням хранения: сырые значения и агрегаты за интервалы
+// (rollup) с разным временем хранения, например сырые значения за сутки, минутные агрегаты за 30 дней и часовые
+// за год. Фоновое сжатие вычисляет агрегаты следующего уровня из значений предыдущего и удаляет устаревшие
+// значения, а запросы интервала времени автоматически выбирают подходящий уровень.
+package history
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// ErrInvalidTiers - ошибка разбора уровней хранения истории.
+var ErrInvalidTiers = errors.New("invalid history tiers")
+
+// DefaultTiers - уровни хранения истории по умолчанию.
+const DefaultTiers = "raw:24h,1m:30d,1h:1y"
+
+// Point - значение метрики на уровне хранения. Для сырого значения Count равно 1, а остальные поля равны
+// значению gauge или приращению counter. Для агрегата Time - начало интервала, Min, Max и Last - наименьшее,
+// наибольшее и последнее значение за интервал, Sum и Count - сумма и количество значений. Для counter
+// Sum - приращение счетчика за интервал.
+type Point struct {
+	MType string
+	ID    string
+	Time  time.Time
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count int64
+	Last  float64
+}
+
+// NewPoint - создает сырое значение метрики.
+func NewPoint(metric repositories.Metric, t time.Time) Point {
+	v := repositories.SortValue(metric)
+	return Point{MType: metric.MType, ID: metric.ID, Time: t, Min: v, Max: v, Sum: v, Count: 1, Last: v}
+}
+
+// Avg - возвращает среднее значение за интервал.
+func (p Point) Avg() float64 {
+	if p.Count == 0 {
+		return 0
+	}
+	return p.Sum / float64(p.Count)
+}
+
+// merge - добавляет к агрегату более позднее значение или агрегат.
+func (p *Point) merge(next Point) {
+	if p.Count == 0 {
+		p.Min, p.Max = next.Min, next.Max
+	} else {
+		p.Min = math.Min(p.Min, next.Min)
+		p.Max = math.Max(p.Max, next.Max)
+	}
+	p.Sum += next.Sum
+	p.Count += next.Count
+	p.Last = next.Last
+}
+
+// Rollup - объединяет значения в агрегаты за интервалы длительностью resolution. Агрегаты упорядочены
+// по метрике и началу интервала.
+func Rollup(points []Point, resolution time.Duration) []Point {
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	type key struct {
+		mtype, id string
+		start     int64
+	}
+	buckets := make(map[key]*Point)
+	for _, p := range sorted {
+		start := p.Time.Truncate(resolution)
+		k := key{p.MType, p.ID, start.UnixNano()}
+		bucket, ok := buckets[k]
+		if !ok {
+			bucket = &Point{MType: p.MType, ID: p.ID, Time: start}
+			buckets[k] = bucket
+		}
+		bucket.merge(p)
+	}
+
+	result := make([]Point, 0, len(buckets))
+	for _, bucket := range buckets {
+		result = append(result, *bucket)
+	}
+	SortPoints(result)
+	return result
+}
+
+// SortPoints - упорядочивает значения по типу и имени метрики и по времени.
+func SortPoints(points []Point) {
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].ID != points[j].ID {
+			return points[i].ID < points[j].ID
+		}
+		if points[i].MType != points[j].MType {
+			return points[i].MType < points[j].MType
+		}
+		return points[i].Time.Before(points[j].Time)
+	})
+}
+
+// Tier - уровень хранения истории.
+type Tier struct {
+	Resolution time.Duration // длительность интервала агрегата, 0 - сырые значения
+	Retention  time.Duration // время хранения значений уровня
+}
+
+// String - возвращает уровень в формате ParseTiers.
+func (t Tier) String() string {
+	resolution := "raw"
+	if t.Resolution > 0 {
+		resolution = formatDuration(t.Resolution)
+	}
+	return resolution + ":" + formatDuration(t.Retention)
+}
+
+// ParseTiers - разбирает уровни хранения вида "raw:24h,1m:30d,1h:1y": длительность интервала агрегата и время
+// хранения через двоеточие. Первый уровень должен хранить сырые значения, интервал каждого следующего уровня
+// должен быть кратен интервалу предыдущего. Кроме единиц time.ParseDuration допускаются дни "d" и годы "y".
+func ParseTiers(s string) ([]Tier, error) {
+	var tiers []Tier
+	for _, part := range strings.Split(s, ",") {
+		resolution, retention, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: expected resolution:retention in %q", ErrInvalidTiers, part)
+		}
+		var tier Tier
+		if resolution != "raw" {
+			d, err := ParseDuration(resolution)
+			if err != nil || d < time.Second || d%time.Second != 0 {
+				return nil, fmt.Errorf("%w: resolution %q must be a whole number of seconds", ErrInvalidTiers, resolution)
+			}
+			tier.Resolution = d
+		}
+		d, err := ParseDuration(retention)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%w: invalid retention %q", ErrInvalidTiers, retention)
+		}
+		tier.Retention = d
+		tiers = append(tiers, tier)
+	}
+
+	if tiers[0].Resolution != 0 {
+		return nil, fmt.Errorf("%w: first tier must keep raw values", ErrInvalidTiers)
+	}
+	for i := 1; i < len(tiers); i++ {
+		previous, current := tiers[i-1].Resolution, tiers[i].Resolution
+		if current == 0 || current <= previous || previous > 0 && current%previous != 0 {
+			return nil, fmt.Errorf("%w: resolution of tier %s must be a multiple of resolution of previous tier", ErrInvalidTiers, tiers[i])
+		}
+		if tiers[i].Retention < current {
+			return nil, fmt.Errorf("%w: retention of tier %s is shorter than its resolution", ErrInvalidTiers, tiers[i])
+		}
+	}
+	return tiers, nil
+}
+
+// ParseDuration - разбирает длительность, допуская кроме единиц time.ParseDuration дни "d" и годы "y".
+func ParseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "y": 365 * 24 * time.Hour} {
+		if number, ok := strings.CutSuffix(s, suffix); ok {
+			n, err := strconv.Atoi(number)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// formatDuration - форматирует длительность, используя дни и годы для длительностей, кратных им.
+func formatDuration(d time.Duration) string {
+	const day, year = 24 * time.Hour, 365 * 24 * time.Hour
+	switch {
+	case d%year == 0:
+		return strconv.Itoa(int(d/year)) + "y"
+	case d%day == 0:
+		return strconv.Itoa(int(d/day)) + "d"
+	}
+	s := d.String()
+	s = strings.Replace(s, "m0s", "m", 1)
+	return strings.Replace(s, "h0m", "h", 1)
+}
@@ -0,0 +1,77 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers(DefaultTiers)
+	require.NoError(t, err)
+	assert.Equal(t, []Tier{
+		{Resolution: 0, Retention: 24 * time.Hour},
+		{Resolution: time.Minute, Retention: 30 * 24 * time.Hour},
+		{Resolution: time.Hour, Retention: 365 * 24 * time.Hour},
+	}, tiers)
+	assert.Equal(t, "raw:1d", tiers[0].String())
+	assert.Equal(t, "1m:30d", tiers[1].String())
+	assert.Equal(t, "1h:1y", tiers[2].String())
+
+	tiers, err = ParseTiers("raw:90m, 10s:2h")
+	require.NoError(t, err)
+	assert.Equal(t, []Tier{{Resolution: 0, Retention: 90 * time.Minute}, {Resolution: 10 * time.Second, Retention: 2 * time.Hour}}, tiers)
+
+	tests := []struct {
+		name  string
+		tiers string
+	}{
+		{name: "empty", tiers: ""},
+		{name: "without retention", tiers: "raw"},
+		{name: "first tier is not raw", tiers: "1m:1d"},
+		{name: "second raw tier", tiers: "raw:1d,raw:2d"},
+		{name: "resolution is not increasing", tiers: "raw:1d,1h:30d,1m:1y"},
+		{name: "resolution is not a multiple", tiers: "raw:1d,2m:30d,3m:1y"},
+		{name: "fractional seconds", tiers: "raw:1d,1500ms:30d"},
+		{name: "retention is shorter than resolution", tiers: "raw:1d,1h:30m"},
+		{name: "invalid retention", tiers: "raw:forever"},
+		{name: "zero retention", tiers: "raw:0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTiers(tt.tiers)
+			assert.ErrorIs(t, err, ErrInvalidTiers)
+		})
+	}
+}
+
+func TestRollup(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	raw := func(mtype, id string, offset time.Duration, value float64) Point {
+		return Point{MType: mtype, ID: id, Time: start.Add(offset), Min: value, Max: value, Sum: value, Count: 1, Last: value}
+	}
+	points := []Point{
+		raw("gauge", "a", 70*time.Second, 8),
+		raw("gauge", "a", 10*time.Second, 4),
+		raw("gauge", "a", 20*time.Second, 2),
+		raw("gauge", "a", 50*time.Second, 6),
+		raw("counter", "c", 5*time.Second, 3),
+		raw("counter", "c", 15*time.Second, 4),
+	}
+
+	rollups := Rollup(points, time.Minute)
+	assert.Equal(t, []Point{
+		{MType: "gauge", ID: "a", Time: start, Min: 2, Max: 6, Sum: 12, Count: 3, Last: 6},
+		{MType: "gauge", ID: "a", Time: start.Add(time.Minute), Min: 8, Max: 8, Sum: 8, Count: 1, Last: 8},
+		{MType: "counter", ID: "c", Time: start, Min: 3, Max: 4, Sum: 7, Count: 2, Last: 4},
+	}, rollups)
+	assert.Equal(t, 4.0, rollups[0].Avg())
+
+	// агрегаты объединяются в агрегаты большего интервала
+	assert.Equal(t, []Point{
+		{MType: "gauge", ID: "a", Time: start, Min: 2, Max: 8, Sum: 20, Count: 4, Last: 8},
+		{MType: "counter", ID: "c", Time: start, Min: 3, Max: 4, Sum: 7, Count: 2, Last: 4},
+	}, Rollup(rollups, time.Hour))
+}
@@ -0,0 +1,55 @@
+package history
+
+import (
+	"context"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Storage - обертка над хранилищем метрик, добавляющая в историю каждую успешную запись. Замена всех метрик
+// хранилища, например при импорте, не добавляется в историю.
+type Storage struct {
+	repositories.IStorage
+	history *History
+}
+
+// NewStorage - фабричная функция структуры Storage.
+func NewStorage(stor repositories.IStorage, history *History) *Storage {
+	return &Storage{
+		IStorage: stor,
+		history:  history,
+	}
+}
+
+// AddGauge - добавляет метрику типа gauge и ее значение в историю.
+func (s *Storage) AddGauge(ctx context.Context, name string, value float64) error {
+	if err := s.IStorage.AddGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.history.Record(time.Now(), repositories.Metric{ID: name, MType: "gauge", Value: &value})
+	return nil
+}
+
+// AddCounter - добавляет метрику типа counter и принятое приращение в историю.
+func (s *Storage) AddCounter(ctx context.Context, name string, value int64) error {
+	if err := s.IStorage.AddCounter(ctx, name, value); err != nil {
+		return err
+	}
+	s.history.Record(time.Now(), repositories.Metric{ID: name, MType: "counter", Delta: &value})
+	return nil
+}
+
+// AddMetricsFromSlice - добавляет метрики из слайса и их значения в историю.
+func (s *Storage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if err := s.IStorage.AddMetricsFromSlice(ctx, metrics); err != nil {
+		return err
+	}
+	s.history.Record(time.Now(), metrics...)
+	return nil
+}
+
+// ReplaceMetrics - заменяет все метрики хранилища метриками из слайса.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	return repositories.ReplaceMetrics(ctx, s.IStorage, metrics)
+}
@@ -0,0 +1,100 @@
+package history
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store - хранилище значений истории. Уровень хранения задается длительностью интервала агрегата,
+// 0 - сырые значения.
+type Store interface {
+	// AddPoints - добавляет значения уровня. Значение той же метрики с тем же временем заменяется.
+	AddPoints(ctx context.Context, resolution time.Duration, points []Point) error
+	// Points - возвращает значения уровня со временем из интервала [from, to), упорядоченные по метрике
+	// и времени. Пустое имя метрики отбирает значения всех метрик.
+	Points(ctx context.Context, resolution time.Duration, mtype, id string, from, to time.Time) ([]Point, error)
+	// DeletePoints - удаляет значения уровня со временем раньше before.
+	DeletePoints(ctx context.Context, resolution time.Duration, before time.Time) error
+}
+
+// seriesKey - тип и имя метрики.
+type seriesKey struct {
+	mtype, id string
+}
+
+// MemStore - хранилище значений истории в памяти.
+type MemStore struct {
+	mu    sync.RWMutex
+	tiers map[time.Duration]map[seriesKey][]Point // значения метрики упорядочены по времени
+}
+
+// NewMemStore - фабричная функция структуры MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{tiers: make(map[time.Duration]map[seriesKey][]Point)}
+}
+
+// AddPoints - реализует метод AddPoints интерфейса Store.
+func (s *MemStore) AddPoints(_ context.Context, resolution time.Duration, points []Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tier, ok := s.tiers[resolution]
+	if !ok {
+		tier = make(map[seriesKey][]Point)
+		s.tiers[resolution] = tier
+	}
+	for _, p := range points {
+		key := seriesKey{p.MType, p.ID}
+		series := tier[key]
+		i := searchTime(series, p.Time)
+		if i < len(series) && series[i].Time.Equal(p.Time) {
+			series[i] = p
+			continue
+		}
+		series = append(series, Point{})
+		copy(series[i+1:], series[i:])
+		series[i] = p
+		tier[key] = series
+	}
+	return nil
+}
+
+// Points - реализует метод Points интерфейса Store.
+func (s *MemStore) Points(_ context.Context, resolution time.Duration, mtype, id string, from, to time.Time) ([]Point, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []Point
+	for key, series := range s.tiers[resolution] {
+		if id != "" && (key.id != id || key.mtype != mtype) {
+			continue
+		}
+		result = append(result, series[searchTime(series, from):searchTime(series, to)]...)
+	}
+	SortPoints(result)
+	return result, nil
+}
+
+// DeletePoints - реализует метод DeletePoints интерфейса Store.
+func (s *MemStore) DeletePoints(_ context.Context, resolution time.Duration, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tier := s.tiers[resolution]
+	for key, series := range tier {
+		i := searchTime(series, before)
+		switch {
+		case i == 0:
+			continue
+		case i == len(series):
+			delete(tier, key)
+			continue
+		}
+		tier[key] = append([]Point(nil), series[i:]...)
+	}
+	return nil
+}
+
+// searchTime - возвращает индекс первого значения со временем не раньше t.
+func searchTime(series []Point, t time.Time) int {
+	return sort.Search(len(series), func(i int) bool { return !series[i].Time.Before(t) })
+}
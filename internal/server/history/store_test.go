@@ -0,0 +1,14 @@
+package history_test
+
+import (
+	"testing"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history/historytest"
+)
+
+func TestMemStoreConformance(t *testing.T) {
+	historytest.Run(t, func(_ *testing.T) history.Store {
+		return history.NewMemStore()
+	})
+}
@@ -0,0 +1,278 @@
+package influx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Способы преобразования тегов в имя метрики.
+const (
+	TagsAsLabels = "labels" // теги становятся метками имени в формате Graphite: "cpu_usage;host=a"
+	TagsAsPrefix = "prefix" // значения тегов, упорядоченных по имени, становятся префиксом имени: "a.cpu_usage"
+)
+
+// ValueField - поле, значение которого записывается в метрику с именем измерения без имени поля.
+const ValueField = "value"
+
+// counterSuffixes - суффиксы имен накопительных полей, которые могут записываться как counter.
+var counterSuffixes = []string{"_total", "_count"}
+
+// Config - параметры преобразования точек в метрики.
+type Config struct {
+	Tags     string // способ преобразования тегов: TagsAsLabels или TagsAsPrefix
+	Counters bool   // записывать поля с суффиксами _total и _count как counter
+}
+
+// ValidateTags - проверяет способ преобразования тегов.
+func ValidateTags(tags string) error {
+	if tags != TagsAsLabels && tags != TagsAsPrefix {
+		return fmt.Errorf("invalid influx tags mode %q, expected %s or %s", tags, TagsAsLabels, TagsAsPrefix)
+	}
+	return nil
+}
+
+// seriesTTL - время, после которого последнее значение counter без новых точек удаляется.
+const seriesTTL = time.Hour
+
+// series - последнее значение counter.
+type series struct {
+	last int64
+	seen time.Time // время последней записанной точки
+}
+
+// Converter - преобразование точек в метрики. Поля counter в line protocol содержат накопленное значение,
+// поэтому Converter хранит последнее значение каждого counter и записывает прирост. Первое значение counter
+// только запоминается: неизвестно, какая его часть уже была записана до перезапуска сервера или удаления
+// последнего значения. Уменьшение значения считается сбросом счетчика у клиента, и тогда приростом считается
+// все новое значение. Последние значения counter, не получавших точек дольше часа, удаляются.
+//
+// Counter запроса заняты от Convert до Commit или Discard: запрос с занятыми counter ждет их освобождения,
+// чтобы одновременные запросы не вычисляли приросты от одного и того же последнего значения.
+type Converter struct {
+	cfg   Config
+	mu    sync.Mutex
+	free  *sync.Cond // сигнал об освобождении занятых counter
+	last  map[string]*series
+	busy  map[string]struct{}
+	ttl   time.Duration
+	swept time.Time
+	now   func() time.Time
+}
+
+// NewConverter - фабричная функция структуры Converter.
+func NewConverter(cfg Config) *Converter {
+	if cfg.Tags == "" {
+		cfg.Tags = TagsAsLabels
+	}
+	c := &Converter{cfg: cfg, last: make(map[string]*series), busy: make(map[string]struct{}), ttl: seriesTTL, now: time.Now}
+	c.free = sync.NewCond(&c.mu)
+	return c
+}
+
+// Update - последние значения counter, вычисленные при преобразовании точек.
+type Update struct {
+	c    *Converter
+	last map[string]int64
+	done bool
+}
+
+// Commit - сохраняет последние значения counter и освобождает их. Вызывается после успешной записи метрик
+// в хранилище: если запись не удалась, вызывается Discard, значения не меняются, и повторная отправка тех же
+// точек дает те же приросты.
+func (u *Update) Commit() {
+	if u == nil || len(u.last) == 0 {
+		return
+	}
+	c := u.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if u.done {
+		return
+	}
+
+	now := c.now()
+	for id, last := range u.last {
+		c.last[id] = &series{last: last, seen: now}
+	}
+	u.release()
+	if now.Sub(c.swept) < c.ttl {
+		return
+	}
+	for id, s := range c.last {
+		if now.Sub(s.seen) >= c.ttl {
+			delete(c.last, id)
+		}
+	}
+	c.swept = now
+}
+
+// Discard - освобождает counter без изменения последних значений. После Commit не делает ничего, поэтому
+// его удобно вызывать через defer.
+func (u *Update) Discard() {
+	if u == nil || len(u.last) == 0 {
+		return
+	}
+	u.c.mu.Lock()
+	defer u.c.mu.Unlock()
+	if !u.done {
+		u.release()
+	}
+}
+
+// release - освобождает counter. Вызывается под блокировкой Converter.
+func (u *Update) release() {
+	for id := range u.last {
+		delete(u.c.busy, id)
+	}
+	u.done = true
+	u.c.free.Broadcast()
+}
+
+// Convert - преобразует точки в метрики: каждое числовое поле точки становится отдельной метрикой.
+// Последние значения counter не меняются, пока не вызван Commit возвращаемого Update; после записи метрик
+// нужно вызвать Commit или Discard.
+func (c *Converter) Convert(points []Point) ([]repositories.Metric, *Update) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		metrics, update := c.convert(points)
+		if c.reserve(update) {
+			return metrics, update
+		}
+		// последние значения занятых counter изменятся после записи другого запроса, поэтому точки
+		// преобразуются заново
+		c.free.Wait()
+	}
+}
+
+// convert - преобразует точки по текущим последним значениям counter. Вызывается под блокировкой Converter.
+func (c *Converter) convert(points []Point) ([]repositories.Metric, *Update) {
+	metrics := make([]repositories.Metric, 0, len(points))
+	update := &Update{c: c, last: make(map[string]int64)}
+	for _, p := range points {
+		fields := make([]string, 0, len(p.Fields))
+		for field := range p.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			value := p.Fields[field]
+			name := p.Measurement
+			if field != ValueField {
+				name += "_" + field
+			}
+			id := c.metricID(name, p.Tags)
+			if c.isCounter(name, value) {
+				delta := c.delta(update, id, int64(value))
+				update.last[id] = int64(value)
+				metrics = append(metrics, repositories.Metric{ID: id, MType: "counter", Delta: &delta})
+				continue
+			}
+			metrics = append(metrics, repositories.Metric{ID: id, MType: "gauge", Value: &value})
+		}
+	}
+	return metrics, update
+}
+
+// reserve - занимает counter, если ни один из них не занят другим запросом.
+func (c *Converter) reserve(u *Update) bool {
+	for id := range u.last {
+		if _, ok := c.busy[id]; ok {
+			return false
+		}
+	}
+	for id := range u.last {
+		c.busy[id] = struct{}{}
+	}
+	return true
+}
+
+// delta - возвращает прирост counter к последнему значению, в том числе к значению из этого же запроса.
+func (c *Converter) delta(update *Update, id string, value int64) int64 {
+	last, ok := update.last[id]
+	if !ok {
+		s, found := c.last[id]
+		if !found {
+			return 0
+		}
+		last = s.last
+	}
+	if value >= last {
+		return value - last
+	}
+	return value
+}
+
+// isCounter - проверяет, записывается ли поле как counter: значение должно быть неотрицательным целым,
+// представимым в int64.
+func (c *Converter) isCounter(name string, value float64) bool {
+	if !c.cfg.Counters || value < 0 || value != math.Trunc(value) || value >= math.MaxInt64 {
+		return false
+	}
+	for _, suffix := range counterSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// metricID - формирует имя метрики из имени и тегов точки.
+func (c *Converter) metricID(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	if c.cfg.Tags == TagsAsPrefix {
+		for _, key := range keys {
+			b.WriteString(sanitize(tags[key]))
+			b.WriteByte('.')
+		}
+		b.WriteString(name)
+		return b.String()
+	}
+	b.WriteString(name)
+	for _, key := range keys {
+		b.WriteByte(';')
+		b.WriteString(sanitize(key))
+		b.WriteByte('=')
+		b.WriteString(sanitize(tags[key]))
+	}
+	return b.String()
+}
+
+// sanitize - заменяет в теге символы, разделяющие метки в имени метрики.
+func sanitize(s string) string {
+	return strings.NewReplacer(";", "_", "=", "_").Replace(s)
+}
+
+var (
+	config    = Config{Tags: TagsAsLabels}
+	converter = NewConverter(config)
+)
+
+// SetConfig - устанавливает параметры преобразования и создает преобразование без накопленных значений counter.
+func SetConfig(cfg Config) {
+	config = cfg
+	converter = NewConverter(cfg)
+}
+
+// GetConfig - возвращает параметры преобразования.
+func GetConfig() Config {
+	return config
+}
+
+// GetConverter - возвращает преобразование точек сервера.
+func GetConverter() *Converter {
+	return converter
+}
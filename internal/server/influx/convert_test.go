@@ -0,0 +1,162 @@
+package influx
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// metricValues - возвращает значения метрик по типу и имени.
+func metricValues(metrics []repositories.Metric) map[string]float64 {
+	values := make(map[string]float64, len(metrics))
+	for _, m := range metrics {
+		values[m.MType+" "+m.ID] = repositories.SortValue(m)
+	}
+	return values
+}
+
+func TestConverterConvert(t *testing.T) {
+	points, err := ParseLines([]byte("cpu,host=a,dc=eu usage=1.5,requests_total=10i\nmem value=42,free=8"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want map[string]float64
+	}{
+		{
+			name: "tags as labels",
+			cfg:  Config{Tags: TagsAsLabels},
+			want: map[string]float64{
+				"gauge cpu_usage;dc=eu;host=a":          1.5,
+				"gauge cpu_requests_total;dc=eu;host=a": 10,
+				"gauge mem":                             42,
+				"gauge mem_free":                        8,
+			},
+		},
+		{
+			name: "tags as prefix with counters",
+			cfg:  Config{Tags: TagsAsPrefix, Counters: true},
+			want: map[string]float64{
+				"gauge eu.a.cpu_usage":            1.5,
+				"counter eu.a.cpu_requests_total": 0,
+				"gauge mem":                       42,
+				"gauge mem_free":                  8,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, _ := NewConverter(tt.cfg).Convert(points)
+			assert.Equal(t, tt.want, metricValues(metrics))
+		})
+	}
+}
+
+func TestConverterCounters(t *testing.T) {
+	conv := NewConverter(Config{Counters: true})
+	convert := func(line string) map[string]float64 {
+		points, err := ParseLines([]byte(line))
+		require.NoError(t, err)
+		metrics, update := conv.Convert(points)
+		update.Commit()
+		return metricValues(metrics)
+	}
+
+	// первое значение только запоминается, следующие записываются приростом к предыдущему
+	assert.Equal(t, map[string]float64{"counter http_requests_total;path=/a": 0}, convert("http,path=/a requests_total=10i"))
+	assert.Equal(t, map[string]float64{"counter http_requests_total;path=/a": 5}, convert("http,path=/a requests_total=15i"))
+	// серии с разными тегами учитываются отдельно
+	assert.Equal(t, map[string]float64{"counter http_requests_total;path=/b": 0}, convert("http,path=/b requests_total=7i"))
+	assert.Equal(t, map[string]float64{"counter http_requests_total;path=/b": 2}, convert("http,path=/b requests_total=9i"))
+	// уменьшение значения - сброс счетчика
+	assert.Equal(t, map[string]float64{"counter http_requests_total;path=/a": 3}, convert("http,path=/a requests_total=3i"))
+	// дробные и отрицательные значения не могут быть counter
+	assert.Equal(t, map[string]float64{"gauge latency_count": 1.5, "gauge queue_total": -1},
+		convert("latency count=1.5\nqueue total=-1"))
+	// имя измерения с суффиксом для поля value
+	assert.Equal(t, map[string]float64{"counter jobs_total": 0}, convert("jobs_total value=4"))
+	// значение, не представимое в int64, записывается как gauge
+	assert.Equal(t, map[string]float64{"gauge big_total": math.MaxInt64}, convert("big total=9223372036854775807"))
+}
+
+func TestConverterCommit(t *testing.T) {
+	conv := NewConverter(Config{Counters: true})
+	now := time.Unix(1000, 0)
+	conv.now = func() time.Time { return now }
+	convert := func(line string) ([]repositories.Metric, *Update) {
+		points, err := ParseLines([]byte(line))
+		require.NoError(t, err)
+		return conv.Convert(points)
+	}
+
+	_, seed := convert("http requests_total=10i")
+	seed.Commit()
+
+	// после Discard, например при ошибке записи, последнее значение не меняется
+	metrics, update := convert("http requests_total=15i")
+	assert.Equal(t, map[string]float64{"counter http_requests_total": 5}, metricValues(metrics))
+	update.Discard()
+	metrics, update = convert("http requests_total=15i\nhttp requests_total=18i")
+	assert.Equal(t, []float64{5, 3}, []float64{float64(*metrics[0].Delta), float64(*metrics[1].Delta)})
+	update.Commit()
+	update.Discard()
+	metrics, update = convert("http requests_total=20i")
+	assert.Equal(t, map[string]float64{"counter http_requests_total": 2}, metricValues(metrics))
+	update.Discard()
+
+	// последние значения counter без новых точек удаляются
+	now = now.Add(seriesTTL)
+	_, update = convert("jobs_total value=1")
+	update.Commit()
+	assert.Len(t, conv.last, 1)
+	metrics, _ = convert("http requests_total=20i")
+	assert.Equal(t, map[string]float64{"counter http_requests_total": 0}, metricValues(metrics))
+}
+
+func TestConverterConcurrent(t *testing.T) {
+	conv := NewConverter(Config{Counters: true})
+	points, err := ParseLines([]byte("http requests_total=10i"))
+	require.NoError(t, err)
+	_, update := conv.Convert(points)
+	update.Commit()
+
+	// одновременные запросы с одним и тем же значением counter записывают прирост один раз
+	points, err = ParseLines([]byte("http requests_total=15i"))
+	require.NoError(t, err)
+	var total atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics, update := conv.Convert(points)
+			defer update.Discard()
+			time.Sleep(time.Millisecond)
+			total.Add(*metrics[0].Delta)
+			update.Commit()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(5), total.Load())
+}
+
+func TestConverterSanitizesTags(t *testing.T) {
+	points, err := ParseLines([]byte(`cpu,host=a;b,k\=v=c usage=1`))
+	require.NoError(t, err)
+	metrics, _ := NewConverter(Config{}).Convert(points)
+	assert.Equal(t, map[string]float64{"gauge cpu_usage;host=a_b;k_v=c": 1}, metricValues(metrics))
+}
+
+func TestValidateTags(t *testing.T) {
+	assert.NoError(t, ValidateTags(TagsAsLabels))
+	assert.NoError(t, ValidateTags(TagsAsPrefix))
+	assert.Error(t, ValidateTags("suffix"))
+}
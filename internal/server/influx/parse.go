@@ -0,0 +1,171 @@
+// Package influx разбирает метрики в текстовом формате InfluxDB line protocol и преобразует их в метрики
+// сервера: поля - в gauge, а поля с суффиксами _total и _count по желанию - в counter. Теги становятся
+// метками имени в формате Graphite или префиксом имени.
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidLine - ошибка разбора строки line protocol.
+var ErrInvalidLine = errors.New("invalid line protocol")
+
+// Point - строка line protocol: измерение, теги и числовые поля. Строковые поля пропускаются, логические
+// поля имеют значения 1 и 0. Время точки не используется, потому что хранилище хранит только текущие значения.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64
+}
+
+// ParseLines - разбирает строки line protocol. Пустые строки и комментарии, начинающиеся с '#', пропускаются.
+// Ошибка содержит номер первой некорректной строки.
+func ParseLines(data []byte) ([]Point, error) {
+	lines := strings.Split(string(data), "\n")
+	points := make([]Point, 0, len(lines))
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		point, err := ParseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// ParseLine - разбирает одну строку line protocol вида "measurement,tag=v field=1,other=2i 1700000000000000000".
+func ParseLine(line string) (Point, error) {
+	head, rest := splitUnescaped(line, ' ')
+	if rest == "" {
+		return Point{}, fmt.Errorf("%w: no fields in %q", ErrInvalidLine, line)
+	}
+	fieldSet, timestamp := splitFields(rest)
+	if timestamp != "" {
+		if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+			return Point{}, fmt.Errorf("%w: invalid timestamp %q", ErrInvalidLine, timestamp)
+		}
+	}
+
+	measurement, tagSet := splitUnescaped(head, ',')
+	p := Point{Measurement: unescape(measurement), Tags: make(map[string]string), Fields: make(map[string]float64)}
+	if p.Measurement == "" {
+		return Point{}, fmt.Errorf("%w: empty measurement in %q", ErrInvalidLine, line)
+	}
+	for tagSet != "" {
+		var tag string
+		tag, tagSet = splitUnescaped(tagSet, ',')
+		key, value := splitUnescaped(tag, '=')
+		if key == "" || value == "" {
+			return Point{}, fmt.Errorf("%w: invalid tag %q", ErrInvalidLine, tag)
+		}
+		p.Tags[unescape(key)] = unescape(value)
+	}
+
+	for fieldSet != "" {
+		var field string
+		field, fieldSet = splitField(fieldSet)
+		key, value := splitUnescaped(field, '=')
+		if key == "" || value == "" {
+			return Point{}, fmt.Errorf("%w: invalid field %q", ErrInvalidLine, field)
+		}
+		v, ok, err := parseFieldValue(value)
+		if err != nil {
+			return Point{}, fmt.Errorf("%w: field %q: %v", ErrInvalidLine, unescape(key), err)
+		}
+		if ok {
+			p.Fields[unescape(key)] = v
+		}
+	}
+	return p, nil
+}
+
+// parseFieldValue - разбирает значение поля. Возвращает false для строковых полей. NaN и бесконечности
+// не принимаются: такие значения нельзя закодировать в JSON.
+func parseFieldValue(value string) (float64, bool, error) {
+	switch {
+	case value[0] == '"':
+		if len(value) < 2 || value[len(value)-1] != '"' {
+			return 0, false, fmt.Errorf("unclosed string %s", value)
+		}
+		return 0, false, nil
+	case value == "t" || value == "T" || value == "true" || value == "True" || value == "TRUE":
+		return 1, true, nil
+	case value == "f" || value == "F" || value == "false" || value == "False" || value == "FALSE":
+		return 0, true, nil
+	case strings.HasSuffix(value, "i"):
+		v, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		return float64(v), err == nil, err
+	case strings.HasSuffix(value, "u"):
+		v, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+		return float64(v), err == nil, err
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false, fmt.Errorf("value %s is not a finite number", value)
+	}
+	return v, true, nil
+}
+
+// splitUnescaped - делит строку по первому разделителю, не экранированному обратной косой чертой.
+func splitUnescaped(s string, sep byte) (string, string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// splitFields - отделяет поля от времени точки с учетом пробелов внутри строковых значений полей.
+func splitFields(s string) (string, string) {
+	inString := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inString = !inString
+		case s[i] == ' ' && !inString:
+			return s[:i], strings.TrimSpace(s[i+1:])
+		}
+	}
+	return s, ""
+}
+
+// splitField - отделяет первое поле с учетом запятых внутри строковых значений.
+func splitField(s string) (string, string) {
+	inString := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inString = !inString
+		case s[i] == ',' && !inString:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// unescape - убирает экранирование запятых, пробелов и знаков равенства.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\"`, `"`, `\\`, `\`).Replace(s)
+}
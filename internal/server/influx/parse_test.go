@@ -0,0 +1,75 @@
+package influx
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr bool
+	}{
+		{
+			name: "tags and fields",
+			line: "cpu,host=a,region=eu usage=1.5,idle=98i 1700000000000000000",
+			want: Point{Measurement: "cpu", Tags: map[string]string{"host": "a", "region": "eu"},
+				Fields: map[string]float64{"usage": 1.5, "idle": 98}},
+		},
+		{
+			name: "without tags and timestamp",
+			line: "mem value=42",
+			want: Point{Measurement: "mem", Tags: map[string]string{}, Fields: map[string]float64{"value": 42}},
+		},
+		{
+			name: "escaped characters",
+			line: `disk\ io,path=C:\,\ data read\=bytes=10u`,
+			want: Point{Measurement: "disk io", Tags: map[string]string{"path": "C:, data"},
+				Fields: map[string]float64{"read=bytes": 10}},
+		},
+		{
+			name: "booleans and strings",
+			line: `service up=t,down=false,status="ok, running now" 1700000000`,
+			want: Point{Measurement: "service", Tags: map[string]string{}, Fields: map[string]float64{"up": 1, "down": 0}},
+		},
+		{name: "without fields", line: "cpu,host=a", wantErr: true},
+		{name: "invalid value", line: "cpu usage=abc", wantErr: true},
+		{name: "not a number", line: "cpu value=NaN", wantErr: true},
+		{name: "infinity", line: "cpu value=+Inf", wantErr: true},
+		{name: "overflow", line: "cpu value=1e400", wantErr: true},
+		{name: "invalid integer", line: "cpu usage=1.5i", wantErr: true},
+		{name: "invalid tag", line: "cpu,host usage=1", wantErr: true},
+		{name: "invalid timestamp", line: "cpu usage=1 yesterday", wantErr: true},
+		{name: "empty measurement", line: ",host=a usage=1", wantErr: true},
+		{name: "unclosed string", line: `cpu status="ok`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrInvalidLine))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	points, err := ParseLines([]byte("# comment\ncpu usage=1\n\n  mem value=2  \n"))
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, "cpu", points[0].Measurement)
+	assert.Equal(t, "mem", points[1].Measurement)
+
+	_, err = ParseLines([]byte("cpu usage=1\ncpu usage="))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
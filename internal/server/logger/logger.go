@@ -36,6 +36,12 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
+// Unwrap - возвращает оригинальный http.ResponseWriter, чтобы http.ResponseController мог, например,
+// отправить клиенту буферизованные данные потока событий.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // Log будет доступен всему коду как синглтон.
 // Никакой код, кроме функции InitLogger, не должен модифицировать эту переменную.
 // По умолчанию установлен no-op-логер, который не выводит никаких сообщений.
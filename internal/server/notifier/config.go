@@ -0,0 +1,204 @@
+// Package notifier отправляет уведомления об оповещениях и записях метрик на адреса получателей (webhook).
+// Уведомления группируются, их частота ограничивается, а неудачная отправка повторяется с растущей задержкой.
+// Тело уведомления подписывается заголовком HashSHA256 так же, как запросы агента.
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// ErrInvalidReceiver - ошибка разбора настроек получателя уведомлений.
+var ErrInvalidReceiver = errors.New("invalid notification receiver")
+
+// Значения настроек получателя по умолчанию.
+const (
+	DefaultGroupWait     = 10 * time.Second // задержка первого уведомления группы
+	DefaultGroupInterval = time.Minute      // интервал между уведомлениями одной группы
+	DefaultMaxRetries    = 3                // количество повторов неудачной отправки
+	DefaultBackoff       = time.Second      // задержка перед первым повтором
+	DefaultTimeout       = 10 * time.Second // время ожидания ответа получателя
+)
+
+// Receiver - настройки получателя уведомлений.
+type Receiver struct {
+	Name          string
+	URL           string
+	Key           string            // ключ подписи, если не задан - ключ сервера
+	Headers       map[string]string // дополнительные заголовки запроса
+	ContentType   string
+	Template      *template.Template // шаблон тела уведомления, если не задан - уведомление в JSON
+	Alerts        bool               // отправлять оповещения правил
+	AlertLabels   map[string]string  // метки, которые должно содержать оповещение
+	Metrics       *repositories.MetricFilter
+	GroupBy       []string // метки, по значениям которых уведомления объединяются в группы
+	GroupWait     time.Duration
+	GroupInterval time.Duration
+	RateLimit     float64 // допустимое количество уведомлений в минуту, 0 отключает ограничение
+	MaxRetries    int
+	Backoff       time.Duration
+	Timeout       time.Duration
+}
+
+// receiverConfig - настройки получателя в файле настроек.
+type receiverConfig struct {
+	Name        string            `yaml:"name"`
+	URL         string            `yaml:"url"`
+	Key         string            `yaml:"key"`
+	Headers     map[string]string `yaml:"headers"`
+	ContentType string            `yaml:"content_type"`
+	Template    string            `yaml:"template"`
+	Alerts      *struct {
+		Labels map[string]string `yaml:"labels"`
+	} `yaml:"alerts"`
+	Metrics *struct {
+		Type   string `yaml:"type"`
+		Name   string `yaml:"name"`
+		Prefix string `yaml:"prefix"`
+	} `yaml:"metrics"`
+	GroupBy       []string `yaml:"group_by"`
+	GroupWait     string   `yaml:"group_wait"`
+	GroupInterval string   `yaml:"group_interval"`
+	RateLimit     float64  `yaml:"rate_limit"`
+	MaxRetries    *int     `yaml:"max_retries"`
+	Backoff       string   `yaml:"backoff"`
+	Timeout       string   `yaml:"timeout"`
+}
+
+// receiversFile - файл настроек получателей уведомлений.
+type receiversFile struct {
+	Receivers []receiverConfig `yaml:"receivers"`
+}
+
+// templateFuncs - функции, доступные в шаблонах уведомлений.
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// parseDuration - разбирает длительность из настроек получателя, пустое значение заменяется значением по умолчанию.
+func parseDuration(receiver, field, value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%w: receiver %q has invalid %s %q", ErrInvalidReceiver, receiver, field, value)
+	}
+	return d, nil
+}
+
+// ParseReceivers - разбирает настройки получателей уведомлений в формате YAML или JSON. Получатель без разделов
+// alerts и metrics получает все оповещения. Пример:
+//
+//	receivers:
+//	  - name: ops
+//	    url: https://hooks.example.com/alerts
+//	    alerts: {labels: {severity: critical}}
+//	    group_by: [severity]
+//	    rate_limit: 6
+//	    template: '{"text": "{{range .Alerts}}{{.Name}} is {{.State}} {{end}}"}'
+func ParseReceivers(data []byte) ([]Receiver, error) {
+	var file receiversFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse notification receivers error: %w", err)
+	}
+
+	receivers := make([]Receiver, 0, len(file.Receivers))
+	names := make(map[string]struct{}, len(file.Receivers))
+	for _, c := range file.Receivers {
+		if c.Name == "" {
+			return nil, fmt.Errorf("%w: receiver without name", ErrInvalidReceiver)
+		}
+		if _, ok := names[c.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate receiver name %q", ErrInvalidReceiver, c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: receiver %q has invalid url %q", ErrInvalidReceiver, c.Name, c.URL)
+		}
+		if c.RateLimit < 0 {
+			return nil, fmt.Errorf("%w: receiver %q has negative rate limit", ErrInvalidReceiver, c.Name)
+		}
+
+		r := Receiver{
+			Name:        c.Name,
+			URL:         c.URL,
+			Key:         c.Key,
+			Headers:     c.Headers,
+			ContentType: c.ContentType,
+			Alerts:      c.Alerts != nil || c.Metrics == nil,
+			GroupBy:     c.GroupBy,
+			RateLimit:   c.RateLimit,
+			MaxRetries:  DefaultMaxRetries,
+		}
+		if r.ContentType == "" {
+			r.ContentType = "application/json"
+		}
+		if c.Alerts != nil {
+			r.AlertLabels = c.Alerts.Labels
+		}
+		if c.Metrics != nil {
+			switch c.Metrics.Type {
+			case "", "gauge", "counter":
+			default:
+				return nil, fmt.Errorf("%w: receiver %q has invalid type of metric %q", ErrInvalidReceiver, c.Name, c.Metrics.Type)
+			}
+			r.Metrics = &repositories.MetricFilter{MType: c.Metrics.Type, ID: c.Metrics.Name, Prefix: c.Metrics.Prefix}
+		}
+		if c.MaxRetries != nil {
+			if *c.MaxRetries < 0 {
+				return nil, fmt.Errorf("%w: receiver %q has negative max retries", ErrInvalidReceiver, c.Name)
+			}
+			r.MaxRetries = *c.MaxRetries
+		}
+		if c.Template != "" {
+			r.Template, err = template.New(c.Name).Funcs(templateFuncs).Parse(c.Template)
+			if err != nil {
+				return nil, fmt.Errorf("%w: receiver %q has invalid template: %v", ErrInvalidReceiver, c.Name, err)
+			}
+			// шаблон проверяется на пустых данных, чтобы ошибки обращения к полям обнаруживались при загрузке
+			if err := r.Template.Execute(&bytes.Buffer{}, Payload{}); err != nil {
+				return nil, fmt.Errorf("%w: receiver %q has invalid template: %v", ErrInvalidReceiver, c.Name, err)
+			}
+		}
+
+		if r.GroupWait, err = parseDuration(c.Name, "group_wait", c.GroupWait, DefaultGroupWait); err != nil {
+			return nil, err
+		}
+		if r.GroupInterval, err = parseDuration(c.Name, "group_interval", c.GroupInterval, DefaultGroupInterval); err != nil {
+			return nil, err
+		}
+		if r.Backoff, err = parseDuration(c.Name, "backoff", c.Backoff, DefaultBackoff); err != nil {
+			return nil, err
+		}
+		if r.Timeout, err = parseDuration(c.Name, "timeout", c.Timeout, DefaultTimeout); err != nil {
+			return nil, err
+		}
+		receivers = append(receivers, r)
+	}
+	return receivers, nil
+}
+
+// LoadReceivers - читает настройки получателей уведомлений из файла.
+func LoadReceivers(path string) ([]Receiver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read notification receivers error: %w", err)
+	}
+	return ParseReceivers(data)
+}
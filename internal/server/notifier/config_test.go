@@ -0,0 +1,109 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func TestParseReceivers(t *testing.T) {
+	data := `
+receivers:
+  - name: ops
+    url: https://hooks.example.com/alerts
+    key: secret
+    headers: {Authorization: Bearer token}
+    alerts:
+      labels: {severity: critical}
+    group_by: [severity]
+    group_wait: 1s
+    group_interval: 30s
+    rate_limit: 6
+    max_retries: 0
+    backoff: 100ms
+    timeout: 2s
+    template: '{"text": "{{range .Alerts}}{{.Name}} {{end}}"}'
+  - name: errors
+    url: http://localhost:9000/hook
+    metrics: {type: counter, prefix: errors_}
+`
+	receivers, err := ParseReceivers([]byte(data))
+	require.NoError(t, err)
+	require.Len(t, receivers, 2)
+
+	ops := receivers[0]
+	assert.Equal(t, "secret", ops.Key)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer token"}, ops.Headers)
+	assert.Equal(t, "application/json", ops.ContentType)
+	assert.True(t, ops.Alerts)
+	assert.Equal(t, map[string]string{"severity": "critical"}, ops.AlertLabels)
+	assert.Nil(t, ops.Metrics)
+	assert.Equal(t, []string{"severity"}, ops.GroupBy)
+	assert.Equal(t, time.Second, ops.GroupWait)
+	assert.Equal(t, 30*time.Second, ops.GroupInterval)
+	assert.Equal(t, 6.0, ops.RateLimit)
+	assert.Equal(t, 0, ops.MaxRetries)
+	assert.Equal(t, 100*time.Millisecond, ops.Backoff)
+	assert.Equal(t, 2*time.Second, ops.Timeout)
+	assert.NotNil(t, ops.Template)
+
+	// получатель только записей метрик не получает оповещения, незаданные параметры имеют значения по умолчанию
+	errs := receivers[1]
+	assert.False(t, errs.Alerts)
+	assert.Equal(t, &repositories.MetricFilter{MType: "counter", Prefix: "errors_"}, errs.Metrics)
+	assert.Equal(t, DefaultGroupWait, errs.GroupWait)
+	assert.Equal(t, DefaultGroupInterval, errs.GroupInterval)
+	assert.Equal(t, DefaultMaxRetries, errs.MaxRetries)
+	assert.Equal(t, DefaultBackoff, errs.Backoff)
+	assert.Equal(t, DefaultTimeout, errs.Timeout)
+	assert.Nil(t, errs.Template)
+
+	// получатель без разделов alerts и metrics получает все оповещения
+	receivers, err = ParseReceivers([]byte(`{"receivers": [{"name": "all", "url": "http://localhost/hook"}]}`))
+	require.NoError(t, err)
+	assert.True(t, receivers[0].Alerts)
+	assert.Empty(t, receivers[0].AlertLabels)
+}
+
+func TestParseReceiversInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "without name", data: `receivers: [{url: "http://localhost/hook"}]`},
+		{name: "duplicate name", data: `receivers: [{name: a, url: "http://localhost/a"}, {name: a, url: "http://localhost/b"}]`},
+		{name: "without url", data: `receivers: [{name: a}]`},
+		{name: "unsupported scheme", data: `receivers: [{name: a, url: "ftp://localhost/hook"}]`},
+		{name: "invalid type of metric", data: `receivers: [{name: a, url: "http://localhost/hook", metrics: {type: histogram}}]`},
+		{name: "invalid duration", data: `receivers: [{name: a, url: "http://localhost/hook", group_wait: soon}]`},
+		{name: "negative rate limit", data: `receivers: [{name: a, url: "http://localhost/hook", rate_limit: -1}]`},
+		{name: "negative retries", data: `receivers: [{name: a, url: "http://localhost/hook", max_retries: -1}]`},
+		{name: "template syntax", data: `receivers: [{name: a, url: "http://localhost/hook", template: "{{range}}"}]`},
+		{name: "template field", data: `receivers: [{name: a, url: "http://localhost/hook", template: "{{.Missing}}"}]`},
+		{name: "not a list", data: `receivers: {name: a}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseReceivers([]byte(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadReceivers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receivers.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`receivers: [{name: a, url: "http://localhost/hook"}]`), 0644))
+
+	receivers, err := LoadReceivers(path)
+	require.NoError(t, err)
+	assert.Len(t, receivers, 1)
+
+	_, err = LoadReceivers(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
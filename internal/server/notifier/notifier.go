@@ -0,0 +1,144 @@
+package notifier
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/stream"
+)
+
+// resubscribeDelay - задержка повторной подписки на записи метрик после отключения от хаба.
+const resubscribeDelay = time.Second
+
+// Notifier - рассылает уведомления получателям. Оповещения передаются методом Notify, записи метрик
+// получатели с разделом metrics получают по подписке на хаб событий.
+type Notifier struct {
+	hub    *stream.Hub
+	client *http.Client
+
+	mu        sync.Mutex
+	receivers []*receiver
+}
+
+// New - фабричная функция структуры Notifier.
+func New(hub *stream.Hub, client *http.Client) *Notifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Notifier{hub: hub, client: client}
+}
+
+// SetReceivers - заменяет получателей уведомлений. Уведомления, накопленные прежними получателями,
+// не отправляются.
+func (n *Notifier) SetReceivers(configs []Receiver) {
+	receivers := make([]*receiver, 0, len(configs))
+	for _, config := range configs {
+		r := newReceiver(config, n.client)
+		if config.Metrics != nil && n.hub != nil {
+			// подписка выполняется сразу, чтобы записи метрик после загрузки настроек не пропускались
+			sub, _, _ := n.hub.Subscribe(*config.Metrics, 0)
+			r.wg.Add(1)
+			go n.watch(r, sub)
+		}
+		receivers = append(receivers, r)
+	}
+
+	n.mu.Lock()
+	previous := n.receivers
+	n.receivers = receivers
+	n.mu.Unlock()
+
+	for _, r := range previous {
+		r.close()
+	}
+}
+
+// Notify - добавляет оповещения в группы получателей, метки которых совпадают с метками оповещения.
+func (n *Notifier) Notify(alerts []alerting.Alert) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, r := range n.receivers {
+		for _, alert := range alerts {
+			if r.matchAlert(alert) {
+				r.addAlert(alert)
+			}
+		}
+	}
+}
+
+// watch - добавляет в группы получателя записи метрик из хаба событий до закрытия получателя. После
+// отключения от хаба подписка возобновляется с последнего полученного события.
+func (n *Notifier) watch(r *receiver, sub *stream.Subscription) {
+	defer r.wg.Done()
+	var lastID uint64
+	for {
+		if !n.receive(r, sub, &lastID) {
+			return
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+		var backlog []stream.Event
+		sub, backlog, _ = n.hub.Subscribe(*r.config.Metrics, lastID)
+		for _, event := range backlog {
+			r.addMetric(event.Metric)
+			lastID = event.ID
+		}
+	}
+}
+
+// receive - читает события подписки. Возвращает false, если получатель закрыт.
+func (n *Notifier) receive(r *receiver, sub *stream.Subscription, lastID *uint64) bool {
+	defer sub.Close()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return false
+		case event, ok := <-sub.C:
+			if !ok {
+				return true
+			}
+			r.addMetric(event.Metric)
+			*lastID = event.ID
+		}
+	}
+}
+
+// Close - закрывает получателей уведомлений, прерывая повторы отправки.
+func (n *Notifier) Close() {
+	n.SetReceivers(nil)
+}
+
+var configPath string // путь к файлу настроек получателей уведомлений
+
+// SetConfigPath - устанавливает путь к файлу настроек получателей уведомлений.
+func SetConfigPath(path string) {
+	configPath = path
+}
+
+// GetConfigPath - возвращает путь к файлу настроек получателей уведомлений.
+func GetConfigPath() string {
+	return configPath
+}
+
+// Reload - загружает настройки получателей уведомлений из файла. При ошибке чтения или разбора файла
+// прежние получатели сохраняются.
+func Reload(n *Notifier) error {
+	if configPath == "" {
+		return nil
+	}
+	receivers, err := LoadReceivers(configPath)
+	if err != nil {
+		return err
+	}
+	n.SetReceivers(receivers)
+	logger.ServerLog.Info("notification receivers loaded", zap.String("path", configPath), zap.Int("count", len(receivers)))
+	return nil
+}
@@ -0,0 +1,234 @@
+package notifier
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/stream"
+)
+
+// request - запрос, полученный тестовым получателем уведомлений.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// standIn - тестовый получатель уведомлений. Ответы задаются по порядку запросов, после их окончания
+// получатель отвечает 200.
+func standIn(t *testing.T, statuses ...int) (*httptest.Server, <-chan request) {
+	requests := make(chan request, 100)
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		requests <- request{header: r.Header.Clone(), body: body}
+		if i := int(count.Add(1)) - 1; i < len(statuses) {
+			w.WriteHeader(statuses[i])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+// receive - ожидает запрос тестового получателя.
+func receive(t *testing.T, requests <-chan request) request {
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "notification is not received")
+	}
+	return request{}
+}
+
+// testReceiver - настройки получателя с короткими интервалами для тестов.
+func testReceiver(url string) Receiver {
+	return Receiver{
+		Name:          "test",
+		URL:           url,
+		Key:           "secret",
+		ContentType:   "application/json",
+		Alerts:        true,
+		GroupWait:     20 * time.Millisecond,
+		GroupInterval: 50 * time.Millisecond,
+		MaxRetries:    DefaultMaxRetries,
+		Backoff:       10 * time.Millisecond,
+		Timeout:       time.Second,
+	}
+}
+
+func alert(name string, state alerting.State, labels map[string]string) alerting.Alert {
+	return alerting.Alert{Name: name, Expr: "gauge " + name + " > 1", State: state, Labels: labels}
+}
+
+func TestNotifierAlerts(t *testing.T) {
+	srv, requests := standIn(t)
+	n := New(nil, nil)
+	defer n.Close()
+	config := testReceiver(srv.URL)
+	config.AlertLabels = map[string]string{"team": "ops"}
+	config.GroupBy = []string{"severity"}
+	n.SetReceivers([]Receiver{config})
+
+	// оповещения одной группы отправляются одним уведомлением, оповещения без нужных меток не отправляются
+	n.Notify([]alerting.Alert{
+		alert("HighHeap", alerting.StateFiring, map[string]string{"team": "ops", "severity": "critical"}),
+		alert("HighCPU", alerting.StateFiring, map[string]string{"team": "ops", "severity": "critical"}),
+		alert("Other", alerting.StateFiring, map[string]string{"team": "dev", "severity": "critical"}),
+	})
+	r := receive(t, requests)
+
+	// тело подписано ключом получателя
+	hash, err := repositories.CalkHash(r.body, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, hash, r.header.Get("HashSHA256"))
+	assert.Equal(t, "application/json", r.header.Get("Content-Type"))
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(r.body, &payload))
+	assert.Equal(t, "test", payload.Receiver)
+	assert.Equal(t, "firing", payload.Status)
+	assert.Equal(t, map[string]string{"severity": "critical"}, payload.Group)
+	require.Len(t, payload.Alerts, 2)
+	assert.Equal(t, "HighCPU", payload.Alerts[0].Name)
+	assert.Equal(t, "HighHeap", payload.Alerts[1].Name)
+
+	// следующее уведомление группы отправляется не раньше GroupInterval
+	sent := time.Now()
+	n.Notify([]alerting.Alert{alert("HighHeap", alerting.StateResolved, map[string]string{"team": "ops", "severity": "critical"})})
+	r = receive(t, requests)
+	assert.GreaterOrEqual(t, time.Since(sent), 30*time.Millisecond)
+	payload = Payload{}
+	require.NoError(t, json.Unmarshal(r.body, &payload))
+	assert.Equal(t, "resolved", payload.Status)
+	require.Len(t, payload.Alerts, 1)
+	assert.Empty(t, requests)
+}
+
+func TestNotifierRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+	}{
+		{name: "success", statuses: nil, requests: 1},
+		{name: "server errors are retried", statuses: []int{500, 503}, requests: 3},
+		{name: "too many requests is retried", statuses: []int{429}, requests: 2},
+		{name: "client error is not retried", statuses: []int{400}, requests: 1},
+		{name: "retries are limited", statuses: []int{500, 500, 500, 500, 500}, requests: DefaultMaxRetries + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := standIn(t, tt.statuses...)
+			r := newReceiver(testReceiver(srv.URL), http.DefaultClient)
+			defer r.close()
+
+			err := r.send(r.ctx, Payload{Receiver: "test"})
+			if tt.requests > len(tt.statuses) {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Len(t, requests, tt.requests)
+		})
+	}
+}
+
+func TestNotifierTemplate(t *testing.T) {
+	srv, requests := standIn(t)
+	receivers, err := ParseReceivers([]byte(`
+receivers:
+  - name: chat
+    url: ` + srv.URL + `
+    content_type: text/plain
+    headers: {X-Token: abc}
+    group_wait: 10ms
+    template: '{{range .Alerts}}{{.Name}} is {{.State}};{{end}} {{json .Group}}'
+`))
+	require.NoError(t, err)
+	n := New(nil, nil)
+	defer n.Close()
+	n.SetReceivers(receivers)
+
+	n.Notify([]alerting.Alert{alert("HighHeap", alerting.StateFiring, nil)})
+	r := receive(t, requests)
+	assert.Equal(t, "HighHeap is firing; null", string(r.body))
+	assert.Equal(t, "text/plain", r.header.Get("Content-Type"))
+	assert.Equal(t, "abc", r.header.Get("X-Token"))
+	// ключ не задан ни для получателя, ни для сервера - тело не подписывается
+	assert.Empty(t, r.header.Get("HashSHA256"))
+}
+
+func TestNotifierRateLimit(t *testing.T) {
+	srv, requests := standIn(t)
+	config := testReceiver(srv.URL)
+	config.GroupBy = []string{"host"}
+	config.GroupWait = 0
+	// одно уведомление в минуту: уведомление второй группы откладывается
+	config.RateLimit = 1
+	r := newReceiver(config, http.DefaultClient)
+	defer r.close()
+
+	r.addAlert(alert("A", alerting.StateFiring, map[string]string{"host": "a"}))
+	receive(t, requests)
+	r.addAlert(alert("B", alerting.StateFiring, map[string]string{"host": "b"}))
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, requests)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.NotNil(t, r.groups["host=b"].timer, "notification must be postponed")
+	assert.Len(t, r.groups["host=b"].alerts, 1)
+}
+
+func TestNotifierMetrics(t *testing.T) {
+	srv, requests := standIn(t)
+	hub := stream.NewHub(10)
+	n := New(hub, nil)
+	defer n.Close()
+	config := testReceiver(srv.URL)
+	config.Alerts = false
+	config.Metrics = &repositories.MetricFilter{Prefix: "errors"}
+	n.SetReceivers([]Receiver{config})
+
+	one, two := int64(1), int64(2)
+	value := 0.5
+	hub.Publish(
+		repositories.Metric{ID: "errors", MType: "counter", Delta: &one},
+		repositories.Metric{ID: "Alloc", MType: "gauge", Value: &value},
+		repositories.Metric{ID: "errors", MType: "counter", Delta: &two},
+	)
+	n.Notify([]alerting.Alert{alert("HighHeap", alerting.StateFiring, nil)})
+
+	r := receive(t, requests)
+	var payload Payload
+	require.NoError(t, json.Unmarshal(r.body, &payload))
+	assert.Empty(t, payload.Alerts)
+	assert.Empty(t, payload.Status)
+	// приращения counter суммируются
+	require.Len(t, payload.Metrics, 1)
+	assert.Equal(t, "errors", payload.Metrics[0].ID)
+	assert.Equal(t, int64(3), *payload.Metrics[0].Delta)
+}
+
+func TestReload(t *testing.T) {
+	defer SetConfigPath("")
+	n := New(nil, nil)
+	defer n.Close()
+
+	// файл настроек не задан
+	require.NoError(t, Reload(n))
+
+	SetConfigPath(t.TempDir() + "/missing.yaml")
+	assert.Error(t, Reload(n))
+}
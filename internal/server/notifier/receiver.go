@@ -0,0 +1,332 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/alerting"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/hasher"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// maxBackoff - наибольшая задержка между повторами отправки уведомления.
+const maxBackoff = time.Minute
+
+// Payload - уведомление, отправляемое получателю. Используется как тело запроса в JSON и как данные шаблона.
+type Payload struct {
+	Receiver string                `json:"receiver"`
+	Status   string                `json:"status,omitempty"` // firing, если в группе есть сработавшее оповещение, иначе resolved
+	Group    map[string]string     `json:"group,omitempty"`  // значения меток группировки
+	Alerts   []alerting.Alert      `json:"alerts,omitempty"`
+	Metrics  []repositories.Metric `json:"metrics,omitempty"` // для counter - сумма приращений с предыдущего уведомления
+	Time     time.Time             `json:"time"`
+}
+
+// group - накопленные уведомления одной группы.
+type group struct {
+	labels    map[string]string
+	alerts    map[string]alerting.Alert
+	metrics   map[[2]string]repositories.Metric
+	lastFlush time.Time
+	timer     *time.Timer // запланированная отправка, nil - отправка не запланирована
+}
+
+// receiver - получатель уведомлений с группами накопленных уведомлений.
+type receiver struct {
+	config  Receiver
+	client  *http.Client
+	limiter *rate.Limiter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	groups map[string]*group
+	closed bool
+}
+
+// newReceiver - фабричная функция структуры receiver.
+func newReceiver(config Receiver, client *http.Client) *receiver {
+	r := &receiver{
+		config: config,
+		client: client,
+		groups: make(map[string]*group),
+	}
+	if config.RateLimit > 0 {
+		r.limiter = rate.NewLimiter(rate.Limit(config.RateLimit/60), max(1, int(math.Ceil(config.RateLimit))))
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	return r
+}
+
+// matchAlert - проверяет, содержит ли оповещение метки, заданные в настройках получателя.
+func (r *receiver) matchAlert(alert alerting.Alert) bool {
+	if !r.config.Alerts {
+		return false
+	}
+	for key, value := range r.config.AlertLabels {
+		if alert.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// groupKey - возвращает ключ группы и значения меток группировки.
+func (r *receiver) groupKey(labels map[string]string) (string, map[string]string) {
+	if len(r.config.GroupBy) == 0 {
+		return "", nil
+	}
+	values := make(map[string]string, len(r.config.GroupBy))
+	parts := make([]string, 0, len(r.config.GroupBy))
+	for _, key := range r.config.GroupBy {
+		values[key] = labels[key]
+		parts = append(parts, key+"="+labels[key])
+	}
+	return strings.Join(parts, ";"), values
+}
+
+// addAlert - добавляет оповещение в группу. Повторное оповещение того же правила заменяет прежнее.
+func (r *receiver) addAlert(alert alerting.Alert) {
+	key, labels := r.groupKey(alert.Labels)
+	r.add(key, labels, func(g *group) {
+		g.alerts[alert.Name] = alert
+	})
+}
+
+// addMetric - добавляет запись метрики в группу. Приращения counter суммируются, для gauge сохраняется
+// последнее значение.
+func (r *receiver) addMetric(metric repositories.Metric) {
+	_, metricLabels := repositories.ParseName(metric.ID)
+	key, labels := r.groupKey(metricLabels)
+	r.add(key, labels, func(g *group) {
+		id := [2]string{metric.MType, metric.ID}
+		if previous, ok := g.metrics[id]; ok && metric.MType == "counter" && previous.Delta != nil && metric.Delta != nil {
+			sum := *previous.Delta + *metric.Delta
+			metric.Delta = &sum
+		}
+		g.metrics[id] = metric
+	})
+}
+
+// add - изменяет группу и планирует ее отправку: первое уведомление группы отправляется через GroupWait,
+// следующие - не чаще, чем раз в GroupInterval.
+func (r *receiver) add(key string, labels map[string]string, update func(g *group)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+
+	now := time.Now()
+	for k, g := range r.groups {
+		if g.timer == nil && now.Sub(g.lastFlush) >= r.config.GroupInterval {
+			delete(r.groups, k)
+		}
+	}
+
+	g, ok := r.groups[key]
+	if !ok {
+		g = &group{labels: labels}
+		r.groups[key] = g
+	}
+	if g.alerts == nil {
+		g.alerts = make(map[string]alerting.Alert)
+		g.metrics = make(map[[2]string]repositories.Metric)
+	}
+	update(g)
+	if g.timer == nil {
+		wait := r.config.GroupWait
+		if !g.lastFlush.IsZero() {
+			wait = max(0, g.lastFlush.Add(r.config.GroupInterval).Sub(now))
+		}
+		g.timer = time.AfterFunc(wait, func() { r.flush(key) })
+	}
+}
+
+// flush - отправляет накопленные уведомления группы. Если частота уведомлений превышена, отправка
+// откладывается, а уведомления продолжают накапливаться.
+func (r *receiver) flush(key string) {
+	r.mu.Lock()
+	g, ok := r.groups[key]
+	if !ok || r.closed {
+		r.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if r.limiter != nil {
+		reservation := r.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			g.timer = time.AfterFunc(delay, func() { r.flush(key) })
+			r.mu.Unlock()
+			return
+		}
+	}
+
+	payload := Payload{Receiver: r.config.Name, Status: string(alerting.StateResolved), Group: g.labels, Time: now}
+	for _, alert := range g.alerts {
+		payload.Alerts = append(payload.Alerts, alert)
+		if alert.State == alerting.StateFiring {
+			payload.Status = string(alerting.StateFiring)
+		}
+	}
+	for _, metric := range g.metrics {
+		payload.Metrics = append(payload.Metrics, metric)
+	}
+	if len(payload.Alerts) == 0 {
+		payload.Status = ""
+	}
+	sort.Slice(payload.Alerts, func(i, j int) bool { return payload.Alerts[i].Name < payload.Alerts[j].Name })
+	sort.Slice(payload.Metrics, func(i, j int) bool {
+		if payload.Metrics[i].ID != payload.Metrics[j].ID {
+			return payload.Metrics[i].ID < payload.Metrics[j].ID
+		}
+		return payload.Metrics[i].MType < payload.Metrics[j].MType
+	})
+	g.alerts, g.metrics = nil, nil
+	g.timer = nil
+	g.lastFlush = now
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	defer r.wg.Done()
+	if err := r.send(r.ctx, payload); err != nil {
+		logger.ServerLog.Error("send notification error", zap.String("receiver", r.config.Name),
+			zap.String("error", error.Error(err)))
+	}
+}
+
+// body - формирует тело уведомления по шаблону получателя или в JSON.
+func (r *receiver) body(payload Payload) ([]byte, error) {
+	var buf bytes.Buffer
+	if r.config.Template != nil {
+		if err := r.config.Template.Execute(&buf, payload); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if err := json.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// send - отправляет уведомление, повторяя неудачную отправку с растущей задержкой. Ответ 4xx, кроме
+// 408 и 429, означает ошибку в уведомлении и не повторяется.
+func (r *receiver) send(ctx context.Context, payload Payload) error {
+	body, err := r.body(payload)
+	if err != nil {
+		return fmt.Errorf("execute template error: %w", err)
+	}
+	key := r.config.Key
+	if key == "" {
+		key = hasher.GetKey()
+	}
+	var hash string
+	if key != "" {
+		if hash, err = repositories.CalkHash(body, key); err != nil {
+			return err
+		}
+	}
+
+	backoff := r.config.Backoff
+	for attempt := 0; ; attempt++ {
+		delay, retry, err := r.post(ctx, body, hash)
+		if err == nil {
+			logger.ServerLog.Debug("notification is sent", zap.String("receiver", r.config.Name))
+			return nil
+		}
+		if !retry || attempt >= r.config.MaxRetries {
+			return err
+		}
+		if delay == 0 {
+			delay = backoff
+			backoff = min(2*backoff, maxBackoff)
+		}
+		logger.ServerLog.Debug("retry notification", zap.String("receiver", r.config.Name),
+			zap.Duration("delay", delay), zap.String("error", error.Error(err)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(delay, maxBackoff)):
+		}
+	}
+}
+
+// post - выполняет запрос к получателю. Возвращает признак возможности повтора и время до повтора,
+// запрошенное получателем в заголовке Retry-After.
+func (r *receiver) post(ctx context.Context, body []byte, hash string) (time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", r.config.ContentType)
+	if hash != "" {
+		req.Header.Set("HashSHA256", hash)
+	}
+	for name, value := range r.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return 0, false, nil
+	}
+	err = fmt.Errorf("receiver responded with status %d", res.StatusCode)
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return retryAfter(res.Header.Get("Retry-After"), time.Now()), true, err
+	case res.StatusCode == http.StatusRequestTimeout || res.StatusCode >= 500:
+		return 0, true, err
+	}
+	return 0, false, err
+}
+
+// retryAfter - разбирает заголовок Retry-After, заданный количеством секунд или датой.
+func retryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// close - отменяет запланированные отправки и прерывает повторы, ожидая завершения начатых отправок.
+func (r *receiver) close() {
+	r.mu.Lock()
+	r.closed = true
+	for _, g := range r.groups {
+		if g.timer != nil {
+			g.timer.Stop()
+		}
+	}
+	r.mu.Unlock()
+	r.cancel()
+	r.wg.Wait()
+}
@@ -0,0 +1,498 @@
+// Package otlp преобразует метрики OpenTelemetry (OTLP) в метрики сервера. Значения Gauge записываются
+// как gauge, монотонные Sum - как counter, немонотонные Sum - как gauge с текущим значением суммы.
+// Histogram записывается как набор метрик в стиле Prometheus: counter name_count и name_bucket с меткой le,
+// gauge name_sum с накопленной суммой и gauge name_min и name_max. Атрибуты точки становятся метками имени
+// в формате Graphite, выбранные атрибуты ресурса - метками или префиксом имени.
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Способы преобразования атрибутов ресурса в имя метрики.
+const (
+	ResourceAsLabels = "labels" // атрибуты становятся метками имени: "http.requests;service.name=api"
+	ResourceAsPrefix = "prefix" // значения атрибутов в порядке их перечисления становятся префиксом имени: "api.http.requests"
+)
+
+// DefaultResourceAttributes - атрибуты ресурса, которые по умолчанию попадают в имя метрики.
+const DefaultResourceAttributes = "service.name"
+
+// Config - параметры преобразования метрик OTLP.
+type Config struct {
+	Resource   string   // способ преобразования атрибутов ресурса: ResourceAsLabels или ResourceAsPrefix
+	Attributes []string // атрибуты ресурса, которые попадают в имя метрики
+}
+
+// ValidateResource - проверяет способ преобразования атрибутов ресурса.
+func ValidateResource(resource string) error {
+	if resource != ResourceAsLabels && resource != ResourceAsPrefix {
+		return fmt.Errorf("invalid otlp resource mode %q, expected %s or %s", resource, ResourceAsLabels, ResourceAsPrefix)
+	}
+	return nil
+}
+
+// ParseAttributes - разбирает список атрибутов ресурса, разделенных запятыми.
+func ParseAttributes(s string) []string {
+	attributes := make([]string, 0)
+	for _, attribute := range strings.Split(s, ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+// seriesTTL - время, после которого состояние серии без новых точек удаляется.
+const seriesTTL = time.Hour
+
+// series - состояние серии, необходимое для преобразования накопленных значений и приростов.
+type series struct {
+	start    uint64    // время начала накопления последнего накопленного значения
+	last     float64   // последнее накопленное значение или текущая сумма приростов
+	residual float64   // дробная часть прироста counter, еще не записанная в хранилище
+	seeded   bool      // получено хотя бы одно накопленное значение серии
+	seen     time.Time // время последней записанной точки серии
+}
+
+// Converter - преобразование метрик OTLP. Counter сервера хранит сумму приростов, поэтому для накопленных
+// (cumulative) значений Converter хранит последнее значение серии и записывает прирост. Первое накопленное
+// значение серии только запоминается: неизвестно, какая его часть уже была записана до перезапуска сервера
+// или удаления состояния серии. Изменение времени начала накопления или уменьшение значения считается
+// перезапуском источника, и тогда приростом считается все новое значение. Дробные приросты counter
+// накапливаются, пока не составят целое число. Состояние серий, не получавших точек дольше часа, удаляется.
+//
+// Серии запроса заняты от Convert до Commit или Discard: запрос с точками занятых серий ждет их освобождения,
+// чтобы одновременные запросы не вычисляли приросты от одного и того же состояния.
+type Converter struct {
+	cfg    Config
+	mu     sync.Mutex
+	free   *sync.Cond // сигнал об освобождении занятых серий
+	series map[string]*series
+	busy   map[string]struct{}
+	ttl    time.Duration
+	swept  time.Time
+	now    func() time.Time
+}
+
+// NewConverter - фабричная функция структуры Converter.
+func NewConverter(cfg Config) *Converter {
+	if cfg.Resource == "" {
+		cfg.Resource = ResourceAsLabels
+	}
+	c := &Converter{cfg: cfg, series: make(map[string]*series), busy: make(map[string]struct{}), ttl: seriesTTL, now: time.Now}
+	c.free = sync.NewCond(&c.mu)
+	return c
+}
+
+// Update - новое состояние серий, вычисленное при преобразовании запроса.
+type Update struct {
+	c      *Converter
+	series map[string]*series
+	done   bool
+}
+
+// Commit - сохраняет состояние серий и освобождает их. Вызывается после успешной записи метрик в хранилище:
+// если запись не удалась, вызывается Discard, состояние не меняется, и повторная отправка тех же точек дает
+// те же приросты.
+func (u *Update) Commit() {
+	if u == nil || len(u.series) == 0 {
+		return
+	}
+	c := u.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if u.done {
+		return
+	}
+
+	now := c.now()
+	for key, s := range u.series {
+		s.seen = now
+		c.series[key] = s
+	}
+	u.release()
+	if now.Sub(c.swept) < c.ttl {
+		return
+	}
+	for key, s := range c.series {
+		if now.Sub(s.seen) >= c.ttl {
+			delete(c.series, key)
+		}
+	}
+	c.swept = now
+}
+
+// Discard - освобождает серии без изменения их состояния. После Commit не делает ничего, поэтому
+// его удобно вызывать через defer.
+func (u *Update) Discard() {
+	if u == nil || len(u.series) == 0 {
+		return
+	}
+	u.c.mu.Lock()
+	defer u.c.mu.Unlock()
+	if !u.done {
+		u.release()
+	}
+}
+
+// release - освобождает серии. Вызывается под блокировкой Converter.
+func (u *Update) release() {
+	for key := range u.series {
+		delete(u.c.busy, key)
+	}
+	u.done = true
+	u.c.free.Broadcast()
+}
+
+// Convert - преобразует запрос OTLP в метрики. Точки, которые не удалось преобразовать, учитываются
+// в частичном успехе; если преобразованы все точки, частичный успех равен nil. Состояние серий не меняется,
+// пока не вызван Commit возвращаемого Update; после записи метрик нужно вызвать Commit или Discard.
+func (c *Converter) Convert(req *colmetricspb.ExportMetricsServiceRequest) ([]repositories.Metric, *colmetricspb.ExportMetricsPartialSuccess, *Update) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		b := &batch{c: c, metrics: make([]repositories.Metric, 0), update: &Update{c: c, series: make(map[string]*series)}}
+		for _, rm := range req.GetResourceMetrics() {
+			prefix, labels := c.resource(rm.GetResource().GetAttributes())
+			for _, sm := range rm.GetScopeMetrics() {
+				for _, m := range sm.GetMetrics() {
+					b.metric(prefix, labels, m)
+				}
+			}
+		}
+		if !c.reserve(b.update) {
+			// состояние занятых серий изменится после записи другого запроса, поэтому запрос преобразуется заново
+			c.free.Wait()
+			continue
+		}
+		if b.rejected == 0 {
+			return b.metrics, nil, b.update
+		}
+		return b.metrics, &colmetricspb.ExportMetricsPartialSuccess{RejectedDataPoints: b.rejected, ErrorMessage: b.message}, b.update
+	}
+}
+
+// reserve - занимает серии, если ни одна из них не занята другим запросом.
+func (c *Converter) reserve(u *Update) bool {
+	for key := range u.series {
+		if _, ok := c.busy[key]; ok {
+			return false
+		}
+	}
+	for key := range u.series {
+		c.busy[key] = struct{}{}
+	}
+	return true
+}
+
+// resource - возвращает префикс имени или метки из выбранных атрибутов ресурса.
+func (c *Converter) resource(attributes []*commonpb.KeyValue) (string, map[string]string) {
+	values := make(map[string]string, len(attributes))
+	for _, kv := range attributes {
+		if value, ok := attributeValue(kv.GetValue()); ok {
+			values[kv.GetKey()] = value
+		}
+	}
+
+	var prefix strings.Builder
+	labels := make(map[string]string, len(c.cfg.Attributes))
+	for _, key := range c.cfg.Attributes {
+		value, ok := values[key]
+		if !ok || value == "" {
+			continue
+		}
+		if c.cfg.Resource == ResourceAsPrefix {
+			prefix.WriteString(value)
+			prefix.WriteByte('.')
+		} else {
+			labels[key] = value
+		}
+	}
+	return prefix.String(), labels
+}
+
+// batch - метрики и отклоненные точки одного запроса.
+type batch struct {
+	c        *Converter
+	metrics  []repositories.Metric
+	update   *Update
+	rejected int64
+	message  string
+}
+
+// reject - учитывает отклоненные точки, в сообщении сохраняется первая причина.
+func (b *batch) reject(points int, format string, args ...any) {
+	b.rejected += int64(points)
+	if b.message == "" {
+		b.message = fmt.Sprintf(format, args...)
+	}
+}
+
+func (b *batch) metric(prefix string, resource map[string]string, m *metricspb.Metric) {
+	if m.GetName() == "" {
+		b.reject(dataPointsCount(m), "metric without name")
+		return
+	}
+	name := prefix + m.GetName()
+
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, p := range data.Gauge.GetDataPoints() {
+			if noRecordedValue(p.GetFlags()) {
+				continue
+			}
+			value, ok := numberValue(p)
+			if !ok {
+				b.reject(1, "metric %s: data point without finite value", name)
+				continue
+			}
+			b.gauge(metricID(name, resource, p.GetAttributes()), value)
+		}
+	case *metricspb.Metric_Sum:
+		temporality := data.Sum.GetAggregationTemporality()
+		if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED {
+			b.reject(len(data.Sum.GetDataPoints()), "metric %s: unspecified aggregation temporality", name)
+			return
+		}
+		cumulative := temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		for _, p := range data.Sum.GetDataPoints() {
+			if noRecordedValue(p.GetFlags()) {
+				continue
+			}
+			value, ok := numberValue(p)
+			if !ok || data.Sum.GetIsMonotonic() && value < 0 {
+				b.reject(1, "metric %s: data point without finite value or negative value of monotonic sum", name)
+				continue
+			}
+			id := metricID(name, resource, p.GetAttributes())
+			if data.Sum.GetIsMonotonic() {
+				b.counter(id, value, p.GetStartTimeUnixNano(), cumulative)
+			} else {
+				b.total(id, value, cumulative)
+			}
+		}
+	case *metricspb.Metric_Histogram:
+		temporality := data.Histogram.GetAggregationTemporality()
+		if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED {
+			b.reject(len(data.Histogram.GetDataPoints()), "metric %s: unspecified aggregation temporality", name)
+			return
+		}
+		cumulative := temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		for _, p := range data.Histogram.GetDataPoints() {
+			if noRecordedValue(p.GetFlags()) {
+				continue
+			}
+			b.histogram(name, resource, p, cumulative)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		b.reject(dataPointsCount(m), "metric %s: exponential histogram is not supported", name)
+	case *metricspb.Metric_Summary:
+		b.reject(dataPointsCount(m), "metric %s: summary is not supported", name)
+	}
+}
+
+// histogram - записывает точку гистограммы: количество значений и количества значений в корзинах
+// с нарастающим итогом как counter, сумму, минимум и максимум как gauge.
+func (b *batch) histogram(name string, resource map[string]string, p *metricspb.HistogramDataPoint, cumulative bool) {
+	counts, bounds := p.GetBucketCounts(), p.GetExplicitBounds()
+	if len(counts) > 0 && len(counts) != len(bounds)+1 {
+		b.reject(1, "metric %s: %d bucket counts do not match %d explicit bounds", name, len(counts), len(bounds))
+		return
+	}
+
+	start := p.GetStartTimeUnixNano()
+	b.counter(metricID(name+"_count", resource, p.GetAttributes()), float64(p.GetCount()), start, cumulative)
+	if p.Sum != nil && isFinite(p.GetSum()) {
+		b.total(metricID(name+"_sum", resource, p.GetAttributes()), p.GetSum(), cumulative)
+	}
+	var total uint64
+	for i, count := range counts {
+		total += count
+		le := "+Inf"
+		if i < len(bounds) {
+			le = strconv.FormatFloat(bounds[i], 'g', -1, 64)
+		}
+		b.counter(metricID(name+"_bucket", resource, p.GetAttributes(), "le", le), float64(total), start, cumulative)
+	}
+	if p.Min != nil && isFinite(p.GetMin()) {
+		b.gauge(metricID(name+"_min", resource, p.GetAttributes()), p.GetMin())
+	}
+	if p.Max != nil && isFinite(p.GetMax()) {
+		b.gauge(metricID(name+"_max", resource, p.GetAttributes()), p.GetMax())
+	}
+}
+
+func (b *batch) gauge(id string, value float64) {
+	b.metrics = append(b.metrics, repositories.Metric{ID: id, MType: "gauge", Value: &value})
+}
+
+// counter - записывает прирост counter. Накопленное значение преобразуется в прирост к предыдущему значению серии.
+func (b *batch) counter(id string, value float64, start uint64, cumulative bool) {
+	s := b.state("counter " + id)
+	increase := value
+	if cumulative {
+		switch {
+		case !s.seeded:
+			increase = 0
+		case s.start == start && value >= s.last:
+			increase = value - s.last
+		}
+		s.start, s.last, s.seeded = start, value, true
+	}
+	s.residual += increase
+	delta := math.Floor(s.residual)
+	s.residual -= delta
+	d := int64(delta)
+	b.metrics = append(b.metrics, repositories.Metric{ID: id, MType: "counter", Delta: &d})
+}
+
+// total - записывает текущую сумму как gauge: накопленное значение записывается как есть, приросты суммируются.
+func (b *batch) total(id string, value float64, cumulative bool) {
+	if !cumulative {
+		s := b.state("gauge " + id)
+		s.last += value
+		value = s.last
+	}
+	b.gauge(id, value)
+}
+
+// state - возвращает копию состояния серии, которая сохраняется в Converter только при вызове Update.Commit.
+// Если серия встречается в запросе несколько раз, возвращается одна и та же копия.
+func (b *batch) state(key string) *series {
+	if s, ok := b.update.series[key]; ok {
+		return s
+	}
+	s := &series{}
+	if current, ok := b.c.series[key]; ok {
+		*s = *current
+	}
+	b.update.series[key] = s
+	return s
+}
+
+// metricID - формирует имя метрики с метками из атрибутов ресурса, атрибутов точки и дополнительных пар
+// ключ-значение. Метки упорядочены по имени, атрибут точки заменяет одноименный атрибут ресурса.
+func metricID(name string, resource map[string]string, attributes []*commonpb.KeyValue, extra ...string) string {
+	labels := make(map[string]string, len(resource)+len(attributes)+len(extra)/2)
+	for key, value := range resource {
+		labels[key] = value
+	}
+	for _, kv := range attributes {
+		if value, ok := attributeValue(kv.GetValue()); ok {
+			labels[kv.GetKey()] = value
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, key := range keys {
+		b.WriteByte(';')
+		b.WriteString(sanitize(key))
+		b.WriteByte('=')
+		b.WriteString(sanitize(labels[key]))
+	}
+	return b.String()
+}
+
+// attributeValue - возвращает строковое значение атрибута. Массивы, списки и пустые значения не поддерживаются.
+func attributeValue(v *commonpb.AnyValue) (string, bool) {
+	switch value := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return value.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(value.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(value.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(value.DoubleValue, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// numberValue - возвращает значение точки, если оно задано и конечно.
+func numberValue(p *metricspb.NumberDataPoint) (float64, bool) {
+	switch value := p.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		return value.AsDouble, isFinite(value.AsDouble)
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(value.AsInt), true
+	}
+	return 0, false
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// noRecordedValue - проверяет флаг точки, означающий отсутствие значения.
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+// dataPointsCount - возвращает количество точек метрики любого типа.
+func dataPointsCount(m *metricspb.Metric) int {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	}
+	return 0
+}
+
+// sanitize - заменяет в метке символы, разделяющие метки в имени метрики.
+func sanitize(s string) string {
+	return strings.NewReplacer(";", "_", "=", "_").Replace(s)
+}
+
+var (
+	config    = Config{Resource: ResourceAsLabels, Attributes: ParseAttributes(DefaultResourceAttributes)}
+	converter = NewConverter(config)
+)
+
+// SetConfig - устанавливает параметры преобразования и создает преобразование без накопленного состояния серий.
+func SetConfig(cfg Config) {
+	config = cfg
+	converter = NewConverter(cfg)
+}
+
+// GetConfig - возвращает параметры преобразования.
+func GetConfig() Config {
+	return config
+}
+
+// GetConverter - возвращает преобразование метрик OTLP сервера.
+func GetConverter() *Converter {
+	return converter
+}
@@ -0,0 +1,285 @@
+package otlp
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+const (
+	delta      = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+)
+
+func attr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func doublePoint(value float64, start uint64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{Attributes: attrs, StartTimeUnixNano: start, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: value}}
+}
+
+func intPoint(value int64, start uint64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{Attributes: attrs, StartTimeUnixNano: start, Value: &metricspb.NumberDataPoint_AsInt{AsInt: value}}
+}
+
+func sum(name string, temporality metricspb.AggregationTemporality, monotonic bool, points ...*metricspb.NumberDataPoint) *metricspb.Metric {
+	return &metricspb.Metric{Name: name, Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+		DataPoints: points, AggregationTemporality: temporality, IsMonotonic: monotonic}}}
+}
+
+// request - возвращает запрос с метриками одного ресурса.
+func request(resource []*commonpb.KeyValue, metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource:     &resourcepb.Resource{Attributes: resource},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}}
+}
+
+// metricValues - возвращает значения метрик по типу и имени.
+func metricValues(metrics []repositories.Metric) map[string]float64 {
+	values := make(map[string]float64, len(metrics))
+	for _, m := range metrics {
+		values[m.MType+" "+m.ID] = repositories.SortValue(m)
+	}
+	return values
+}
+
+func TestConverterGaugeAndResource(t *testing.T) {
+	resource := []*commonpb.KeyValue{attr("service.name", "api"), attr("host.name", "web-1"), attr("telemetry.sdk.language", "go")}
+	gauge := &metricspb.Metric{Name: "process.memory", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+		DataPoints: []*metricspb.NumberDataPoint{doublePoint(1.5, 0, attr("state", "used")), intPoint(7, 0)},
+	}}}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want map[string]float64
+	}{
+		{
+			name: "resource as labels",
+			cfg:  Config{Resource: ResourceAsLabels, Attributes: []string{"service.name", "host.name"}},
+			want: map[string]float64{
+				"gauge process.memory;host.name=web-1;service.name=api;state=used": 1.5,
+				"gauge process.memory;host.name=web-1;service.name=api":            7,
+			},
+		},
+		{
+			name: "resource as prefix",
+			cfg:  Config{Resource: ResourceAsPrefix, Attributes: []string{"service.name", "host.name", "missing"}},
+			want: map[string]float64{
+				"gauge api.web-1.process.memory;state=used": 1.5,
+				"gauge api.web-1.process.memory":            7,
+			},
+		},
+		{
+			name: "without resource attributes",
+			cfg:  Config{},
+			want: map[string]float64{
+				"gauge process.memory;state=used": 1.5,
+				"gauge process.memory":            7,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, partial, _ := NewConverter(tt.cfg).Convert(request(resource, gauge))
+			assert.Nil(t, partial)
+			assert.Equal(t, tt.want, metricValues(metrics))
+		})
+	}
+}
+
+func TestConverterSumTemporality(t *testing.T) {
+	conv := NewConverter(Config{})
+	convert := func(metrics ...*metricspb.Metric) map[string]float64 {
+		result, partial, update := conv.Convert(request(nil, metrics...))
+		require.Nil(t, partial)
+		update.Commit()
+		return metricValues(result)
+	}
+
+	// первое накопленное значение серии только запоминается, следующие записываются приростом
+	assert.Equal(t, map[string]float64{"counter requests": 0}, convert(sum("requests", cumulative, true, intPoint(10, 100))))
+	assert.Equal(t, map[string]float64{"counter requests": 5}, convert(sum("requests", cumulative, true, intPoint(15, 100))))
+	// новое время начала накопления - перезапуск источника
+	assert.Equal(t, map[string]float64{"counter requests": 3}, convert(sum("requests", cumulative, true, intPoint(3, 200))))
+	// уменьшение значения - сброс счетчика
+	assert.Equal(t, map[string]float64{"counter requests": 2}, convert(sum("requests", cumulative, true, intPoint(2, 200))))
+
+	// приросты записываются как есть
+	assert.Equal(t, map[string]float64{"counter errors": 4}, convert(sum("errors", delta, true, intPoint(4, 0))))
+	assert.Equal(t, map[string]float64{"counter errors": 4}, convert(sum("errors", delta, true, intPoint(4, 0))))
+
+	// дробные приросты накапливаются до целого числа
+	assert.Equal(t, map[string]float64{"counter bytes": 0}, convert(sum("bytes", delta, true, doublePoint(0.6, 0))))
+	assert.Equal(t, map[string]float64{"counter bytes": 1}, convert(sum("bytes", delta, true, doublePoint(0.6, 0))))
+
+	// немонотонная сумма - gauge с текущим значением суммы
+	assert.Equal(t, map[string]float64{"gauge queue": 5}, convert(sum("queue", delta, false, intPoint(5, 0))))
+	assert.Equal(t, map[string]float64{"gauge queue": 3}, convert(sum("queue", delta, false, intPoint(-2, 0))))
+	assert.Equal(t, map[string]float64{"gauge active": 8}, convert(sum("active", cumulative, false, intPoint(8, 0))))
+}
+
+func TestConverterCommit(t *testing.T) {
+	conv := NewConverter(Config{})
+	now := time.Unix(1000, 0)
+	conv.now = func() time.Time { return now }
+	requests := func(value int64) *colmetricspb.ExportMetricsServiceRequest {
+		return request(nil, sum("requests", cumulative, true, intPoint(value, 100)), sum("bytes", delta, true, doublePoint(0.6, 0)))
+	}
+
+	_, _, seed := conv.Convert(requests(10))
+	seed.Commit()
+
+	// после Discard, например при ошибке записи, состояние не меняется и повторная отправка дает те же приросты
+	metrics, _, update := conv.Convert(requests(15))
+	assert.Equal(t, map[string]float64{"counter requests": 5, "counter bytes": 1}, metricValues(metrics))
+	update.Discard()
+	metrics, _, update = conv.Convert(requests(15))
+	assert.Equal(t, map[string]float64{"counter requests": 5, "counter bytes": 1}, metricValues(metrics))
+	update.Commit()
+	// Discard после Commit не отменяет сохраненное состояние
+	update.Discard()
+	metrics, _, update = conv.Convert(requests(15))
+	assert.Equal(t, map[string]float64{"counter requests": 0, "counter bytes": 0}, metricValues(metrics))
+	update.Discard()
+
+	// состояние серий без новых точек удаляется, и следующее накопленное значение снова только запоминается
+	now = now.Add(seriesTTL)
+	_, _, update = conv.Convert(request(nil, sum("errors", delta, true, intPoint(1, 0))))
+	update.Commit()
+	assert.Len(t, conv.series, 1)
+	metrics, _, _ = conv.Convert(requests(20))
+	assert.Equal(t, map[string]float64{"counter requests": 0, "counter bytes": 0}, metricValues(metrics))
+}
+
+func TestConverterConcurrent(t *testing.T) {
+	conv := NewConverter(Config{})
+	requests := func(value int64) *colmetricspb.ExportMetricsServiceRequest {
+		return request(nil,
+			sum("requests", cumulative, true, intPoint(value, 100)),
+			sum("bytes", delta, true, doublePoint(0.5, 0)),
+			sum("queue", delta, false, intPoint(1, 0)),
+		)
+	}
+	_, _, update := conv.Convert(requests(10))
+	update.Commit()
+
+	// одновременные запросы с одним и тем же накопленным значением записывают прирост один раз,
+	// а приросты всех запросов учитываются в сумме и дробной части
+	const workers = 8
+	var mu sync.Mutex
+	totals := make(map[string]float64)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics, _, update := conv.Convert(requests(15))
+			defer update.Discard()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			for key, value := range metricValues(metrics) {
+				if key == "gauge queue" {
+					totals[key] = math.Max(totals[key], value)
+				} else {
+					totals[key] += value
+				}
+			}
+			mu.Unlock()
+			update.Commit()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, map[string]float64{"counter requests": 5, "counter bytes": workers / 2, "gauge queue": workers + 1}, totals)
+}
+
+func TestConverterHistogram(t *testing.T) {
+	conv := NewConverter(Config{})
+	histogram := func(temporality metricspb.AggregationTemporality, count uint64, total float64, buckets ...uint64) *metricspb.Metric {
+		minimum, maximum := 0.1, 3.0
+		return &metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: temporality,
+			DataPoints: []*metricspb.HistogramDataPoint{{
+				Attributes: []*commonpb.KeyValue{attr("route", "/a")}, StartTimeUnixNano: 100,
+				Count: count, Sum: &total, BucketCounts: buckets, ExplicitBounds: []float64{0.5, 1},
+				Min: &minimum, Max: &maximum,
+			}},
+		}}}
+	}
+
+	metrics, partial, update := conv.Convert(request(nil, histogram(cumulative, 6, 4.5, 3, 2, 1)))
+	require.Nil(t, partial)
+	update.Commit()
+	assert.Equal(t, map[string]float64{
+		"counter latency_count;route=/a":          0,
+		"gauge latency_sum;route=/a":              4.5,
+		"counter latency_bucket;le=0.5;route=/a":  0,
+		"counter latency_bucket;le=1;route=/a":    0,
+		"counter latency_bucket;le=+Inf;route=/a": 0,
+		"gauge latency_min;route=/a":              0.1,
+		"gauge latency_max;route=/a":              3,
+	}, metricValues(metrics))
+
+	// следующее накопленное значение записывается приростом
+	metrics, partial, update = conv.Convert(request(nil, histogram(cumulative, 10, 7, 4, 4, 2)))
+	require.Nil(t, partial)
+	update.Commit()
+	values := metricValues(metrics)
+	assert.Equal(t, 4.0, values["counter latency_count;route=/a"])
+	assert.Equal(t, 7.0, values["gauge latency_sum;route=/a"])
+	assert.Equal(t, 1.0, values["counter latency_bucket;le=0.5;route=/a"])
+	assert.Equal(t, 4.0, values["counter latency_bucket;le=+Inf;route=/a"])
+
+	// сумма приростов накапливается
+	_, _, update = conv.Convert(request(nil, histogram(delta, 2, 1.5, 1, 1, 0)))
+	update.Commit()
+	metrics, _, _ = conv.Convert(request(nil, histogram(delta, 2, 1.5, 1, 1, 0)))
+	values = metricValues(metrics)
+	assert.Equal(t, 2.0, values["counter latency_count;route=/a"])
+	assert.Equal(t, 3.0, values["gauge latency_sum;route=/a"])
+}
+
+func TestConverterRejects(t *testing.T) {
+	conv := NewConverter(Config{})
+	nan := doublePoint(math.NaN(), 0)
+	noValue := doublePoint(1, 0)
+	noValue.Flags = uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+
+	metrics, partial, _ := conv.Convert(request(nil,
+		sum("requests", delta, true, intPoint(1, 0), intPoint(-1, 0)),
+		sum("unspecified", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED, true, intPoint(1, 0)),
+		&metricspb.Metric{Name: "temperature", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{nan, noValue}}}},
+		&metricspb.Metric{Name: "rpc.duration", Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+			DataPoints: []*metricspb.SummaryDataPoint{{}, {}}}}},
+		&metricspb.Metric{Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{intPoint(1, 0)}}}},
+		&metricspb.Metric{Name: "latency", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: delta,
+			DataPoints:             []*metricspb.HistogramDataPoint{{Count: 1, BucketCounts: []uint64{1}, ExplicitBounds: []float64{1}}},
+		}}},
+	))
+	assert.Equal(t, map[string]float64{"counter requests": 1}, metricValues(metrics))
+	require.NotNil(t, partial)
+	assert.Equal(t, int64(7), partial.GetRejectedDataPoints())
+	assert.Contains(t, partial.GetErrorMessage(), "requests")
+}
+
+func TestValidateResource(t *testing.T) {
+	assert.NoError(t, ValidateResource(ResourceAsLabels))
+	assert.NoError(t, ValidateResource(ResourceAsPrefix))
+	assert.Error(t, ValidateResource("suffix"))
+	assert.Equal(t, []string{"service.name", "host.name"}, ParseAttributes(" service.name, ,host.name"))
+}
@@ -0,0 +1,86 @@
+package pg
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// batch - метрики пакета, сгруппированные по колонкам таблицы metrics для передачи в запрос массивами.
+type batch struct {
+	ids    []string
+	mtypes []string
+	deltas []*int64
+	values []*float64
+}
+
+// aggregateBatch - проверяет метрики пакета и схлопывает повторяющиеся метрики: значения counter суммируются,
+// для gauge остается последнее значение. Метрики упорядочиваются по имени, чтобы параллельные транзакции
+// блокировали строки таблицы в одном порядке.
+func aggregateBatch(metrics []repositories.Metric) (batch, error) {
+	aggregated := make(map[string]repositories.Metric, len(metrics))
+	for _, metric := range metrics {
+		switch metric.MType {
+		case "gauge":
+			if metric.Value == nil {
+				return batch{}, fmt.Errorf("invalid metric, value of gauge metric is nil")
+			}
+		case "counter":
+			if metric.Delta == nil {
+				return batch{}, fmt.Errorf("invalid metric, delta of counter metric is nil")
+			}
+		default:
+			return batch{}, fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
+		}
+
+		prev, ok := aggregated[metric.ID]
+		if !ok {
+			aggregated[metric.ID] = metric
+			continue
+		}
+		if prev.MType != metric.MType {
+			return batch{}, repositories.TypeConflictError(metric.ID, metric.MType, prev.MType)
+		}
+		if metric.MType == "counter" {
+			sum := *prev.Delta + *metric.Delta
+			metric.Delta = &sum
+		}
+		aggregated[metric.ID] = metric
+	}
+
+	ids := make([]string, 0, len(aggregated))
+	for id := range aggregated {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	b := batch{
+		ids:    ids,
+		mtypes: make([]string, 0, len(ids)),
+		deltas: make([]*int64, 0, len(ids)),
+		values: make([]*float64, 0, len(ids)),
+	}
+	for _, id := range ids {
+		metric := aggregated[id]
+		b.mtypes = append(b.mtypes, metric.MType)
+		b.deltas = append(b.deltas, metric.Delta)
+		b.values = append(b.values, metric.Value)
+	}
+	return b, nil
+}
+
+// conflicting - возвращает ошибку конфликта типов для первой метрики пакета, которая не была записана.
+func (b batch) conflicting(upserted map[string]struct{}) error {
+	for i, id := range b.ids {
+		if _, ok := upserted[id]; ok {
+			continue
+		}
+		stored := "counter"
+		if b.mtypes[i] == "counter" {
+			stored = "gauge"
+		}
+		return repositories.TypeConflictError(id, b.mtypes[i], stored)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package pg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func TestAggregateBatch(t *testing.T) {
+	delta := func(d int64) *int64 {
+		return &d
+	}
+	value := func(v float64) *float64 {
+		return &v
+	}
+
+	tests := []struct {
+		name    string
+		metrics []repositories.Metric
+		want    batch
+		wantErr error
+	}{
+		{
+			name: "empty batch",
+			want: batch{ids: []string{}, mtypes: []string{}, deltas: []*int64{}, values: []*float64{}},
+		},
+		{
+			name: "duplicates are aggregated",
+			metrics: []repositories.Metric{
+				{ID: "PollCount", MType: "counter", Delta: delta(1)},
+				{ID: "Alloc", MType: "gauge", Value: value(1.5)},
+				{ID: "PollCount", MType: "counter", Delta: delta(2)},
+				{ID: "Alloc", MType: "gauge", Value: value(2.5)},
+			},
+			want: batch{
+				ids:    []string{"Alloc", "PollCount"},
+				mtypes: []string{"gauge", "counter"},
+				deltas: []*int64{nil, delta(3)},
+				values: []*float64{value(2.5), nil},
+			},
+		},
+		{
+			name: "type conflict",
+			metrics: []repositories.Metric{
+				{ID: "Alloc", MType: "gauge", Value: value(1.5)},
+				{ID: "Alloc", MType: "counter", Delta: delta(2)},
+			},
+			wantErr: repositories.ErrTypeConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := aggregateBatch(tt.metrics)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	invalid := [][]repositories.Metric{
+		{{ID: "Alloc", MType: "gauge"}},
+		{{ID: "PollCount", MType: "counter"}},
+		{{ID: "PollCount", MType: "summary", Delta: delta(1)}},
+	}
+	for _, metrics := range invalid {
+		_, err := aggregateBatch(metrics)
+		assert.Error(t, err)
+	}
+
+	// исходные метрики не изменяются при суммировании
+	first := repositories.Metric{ID: "PollCount", MType: "counter", Delta: delta(1)}
+	_, err := aggregateBatch([]repositories.Metric{first, {ID: "PollCount", MType: "counter", Delta: delta(2)}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *first.Delta)
+}
+
+func TestBatchConflicting(t *testing.T) {
+	b := batch{ids: []string{"Alloc", "PollCount"}, mtypes: []string{"gauge", "counter"}}
+	assert.NoError(t, b.conflicting(map[string]struct{}{"Alloc": {}, "PollCount": {}}))
+
+	err := b.conflicting(map[string]struct{}{"Alloc": {}})
+	assert.ErrorIs(t, err, repositories.ErrTypeConflict)
+	assert.Contains(t, err.Error(), "PollCount is stored as gauge")
+}
+
+func BenchmarkAggregateBatch(b *testing.B) {
+	metrics := make([]repositories.Metric, 0, 10000)
+	for i := 0; i < cap(metrics); i++ {
+		delta := int64(i)
+		metrics = append(metrics, repositories.Metric{ID: fmt.Sprintf("counter%d", i%1000), MType: "counter", Delta: &delta})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := aggregateBatch(metrics); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
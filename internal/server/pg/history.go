@@ -0,0 +1,115 @@
+package pg
+
+import (
+	"context"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+)
+
+// BootstrapHistory - создает таблицу истории значений метрик, если она еще не существует. Уровень хранения
+// задается длительностью интервала агрегата в секундах, 0 - сырые значения.
+func (s Store) BootstrapHistory(ctx context.Context) error {
+	_, err := s.conn.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS metrics_history (
+			resolution bigint NOT NULL,
+			id varchar(128) NOT NULL,
+			mtype varchar(128) NOT NULL,
+			ts timestamptz NOT NULL,
+			min double precision NOT NULL,
+			max double precision NOT NULL,
+			sum double precision NOT NULL,
+			count bigint NOT NULL,
+			last double precision NOT NULL,
+			PRIMARY KEY (resolution, id, mtype, ts)
+        )
+    `)
+	if err != nil {
+		return err
+	}
+	// индекс используется сжатием истории, выбирающим значения всех метрик уровня за интервал
+	_, err = s.conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metrics_history_time ON metrics_history (resolution, ts)`)
+	return err
+}
+
+// queryHistoryUpsert - запрос записи значений истории одним обращением к БД. Колонки передаются массивами.
+const queryHistoryUpsert = `
+	INSERT INTO metrics_history (resolution, id, mtype, ts, min, max, sum, count, last)
+	SELECT $1, id, mtype, ts, min, max, sum, count, last
+	FROM unnest($2::varchar[], $3::varchar[], $4::timestamptz[], $5::double precision[], $6::double precision[],
+		$7::double precision[], $8::bigint[], $9::double precision[]) AS batch (id, mtype, ts, min, max, sum, count, last)
+	ON CONFLICT (resolution, id, mtype, ts)
+	DO UPDATE SET min = EXCLUDED.min, max = EXCLUDED.max, sum = EXCLUDED.sum, count = EXCLUDED.count, last = EXCLUDED.last
+`
+
+// AddPoints - реализует метод AddPoints интерфейса history.Store. Из значений одной метрики с одинаковым
+// временем записывается последнее.
+func (s Store) AddPoints(ctx context.Context, resolution time.Duration, points []history.Point) error {
+	type key struct {
+		id, mtype string
+		ts        int64
+	}
+	index := make(map[key]int, len(points))
+	var (
+		ids, mtypes             []string
+		times                   []time.Time
+		mins, maxs, sums, lasts []float64
+		counts                  []int64
+	)
+	for _, p := range points {
+		ts := p.Time.Truncate(time.Microsecond)
+		k := key{p.ID, p.MType, ts.UnixMicro()}
+		if i, ok := index[k]; ok {
+			mins[i], maxs[i], sums[i], counts[i], lasts[i] = p.Min, p.Max, p.Sum, p.Count, p.Last
+			continue
+		}
+		index[k] = len(ids)
+		ids = append(ids, p.ID)
+		mtypes = append(mtypes, p.MType)
+		times = append(times, ts)
+		mins = append(mins, p.Min)
+		maxs = append(maxs, p.Max)
+		sums = append(sums, p.Sum)
+		counts = append(counts, p.Count)
+		lasts = append(lasts, p.Last)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.conn.ExecContext(ctx, queryHistoryUpsert, int64(resolution/time.Second),
+		ids, mtypes, times, mins, maxs, sums, counts, lasts)
+	return err
+}
+
+// Points - реализует метод Points интерфейса history.Store.
+func (s Store) Points(ctx context.Context, resolution time.Duration, mtype, id string, from, to time.Time) ([]history.Point, error) {
+	query := `SELECT id, mtype, ts, min, max, sum, count, last FROM metrics_history
+		WHERE resolution = $1 AND ts >= $2 AND ts < $3`
+	args := []any{int64(resolution / time.Second), from, to}
+	if id != "" {
+		query += " AND id = $4 AND mtype = $5"
+		args = append(args, id, mtype)
+	}
+	rows, err := s.conn.QueryContext(ctx, query+" ORDER BY id COLLATE \"C\", mtype, ts", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]history.Point, 0)
+	for rows.Next() {
+		var p history.Point
+		if err := rows.Scan(&p.ID, &p.MType, &p.Time, &p.Min, &p.Max, &p.Sum, &p.Count, &p.Last); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// DeletePoints - реализует метод DeletePoints интерфейса history.Store.
+func (s Store) DeletePoints(ctx context.Context, resolution time.Duration, before time.Time) error {
+	_, err := s.conn.ExecContext(ctx, "DELETE FROM metrics_history WHERE resolution = $1 AND ts < $2",
+		int64(resolution/time.Second), before)
+	return err
+}
@@ -0,0 +1,32 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history/historytest"
+)
+
+func TestHistoryConformance(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	historytest.Run(t, func(t *testing.T) history.Store {
+		conn, err := sql.Open("pgx", databaseDsn)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		ctx := context.Background()
+		require.NoError(t, conn.PingContext(ctx))
+
+		// каждый тест набора начинается с пустой таблицы истории
+		stor := NewStore(conn)
+		require.NoError(t, stor.BootstrapHistory(ctx))
+		_, err = conn.ExecContext(ctx, "DELETE FROM metrics_history")
+		require.NoError(t, err)
+		return stor
+	})
+}
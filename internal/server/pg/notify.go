@@ -0,0 +1,87 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// DefaultNotifyChannel - канал уведомлений об изменении метрик по умолчанию.
+const DefaultNotifyChannel = "metrics_changed"
+
+// Channel - канал уведомлений PostgreSQL (LISTEN/NOTIFY), через который экземпляры сервера,
+// работающие с одной БД, сообщают друг другу об изменении метрик.
+type Channel struct {
+	pool *pgxpool.Pool
+	name string
+}
+
+// NewChannel - возвращает канал уведомлений с именем name, работающий через пул соединений pool.
+func NewChannel(pool *pgxpool.Pool, name string) *Channel {
+	return &Channel{pool: pool, name: name}
+}
+
+// Notify - отправляет уведомление в канал.
+func (c *Channel) Notify(ctx context.Context, payload string) error {
+	if _, err := c.pool.Exec(ctx, "SELECT pg_notify($1, $2)", c.name, payload); err != nil {
+		return fmt.Errorf("notify channel %s error: %w", c.name, err)
+	}
+	return nil
+}
+
+// Listen - получает уведомления канала и передает их в handler до отмены контекста.
+// Уведомления, отправленные этим же соединением, не передаются. При потере соединения подписка
+// восстанавливается с увеличивающейся задержкой; после каждой подписки handler вызывается с reconnected,
+// равным true, так как уведомления, отправленные без подписки, потеряны.
+func (c *Channel) Listen(ctx context.Context, handler func(payload string, reconnected bool)) {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(connectDelay(attempt)):
+		}
+
+		err := c.listen(ctx, func() {
+			attempt = 0
+			handler("", true)
+		}, handler)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.ServerLog.Warn("listen database notifications error", zap.String("channel", c.name),
+			zap.String("error", error.Error(err)))
+	}
+}
+
+// listen - подписывается на канал на отдельном соединении пула и получает уведомления до ошибки соединения.
+func (c *Channel) listen(ctx context.Context, subscribed func(), handler func(payload string, reconnected bool)) error {
+	conn, err := c.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// соединение с подпиской не возвращается в пул, чтобы его не получил другой запрос
+	defer conn.Hijack().Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{c.name}.Sanitize()); err != nil {
+		return err
+	}
+	subscribed()
+
+	pid := conn.Conn().PgConn().PID()
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if notification.PID == pid {
+			continue
+		}
+		handler(notification.Payload, false)
+	}
+}
@@ -0,0 +1,47 @@
+package pg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelNotify(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool, err := Connect(ctx, databaseDsn, PoolConfig{})
+	if err != nil {
+		t.Skipf("database is not available: %v", err)
+	}
+	defer pool.Close()
+
+	listener := NewChannel(pool, "test_metrics_changed")
+	type notification struct {
+		payload     string
+		reconnected bool
+	}
+	received := make(chan notification, 10)
+	go listener.Listen(ctx, func(payload string, reconnected bool) {
+		received <- notification{payload: payload, reconnected: reconnected}
+	})
+
+	select {
+	case n := <-received:
+		assert.True(t, n.reconnected)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "listener is not subscribed")
+	}
+
+	require.NoError(t, NewChannel(pool, "test_metrics_changed").Notify(ctx, "instance\nAlloc"))
+	select {
+	case n := <-received:
+		assert.Equal(t, notification{payload: "instance\nAlloc"}, n)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "notification is not received")
+	}
+}
@@ -0,0 +1,183 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// DefaultConnectTimeout - время ожидания доступности БД при запуске сервера по умолчанию.
+const DefaultConnectTimeout = time.Minute
+
+// Интервалы между попытками подключения к БД при запуске сервера.
+const (
+	connectInitialDelay = 500 * time.Millisecond // задержка перед второй попыткой
+	connectMaxDelay     = 10 * time.Second       // максимальная задержка между попытками
+)
+
+// PoolConfig - настройки пула соединений с БД. Нулевые значения оставляют настройки pgxpool по умолчанию.
+type PoolConfig struct {
+	MaxConns               int32         // максимальное количество соединений
+	MinConns               int32         // минимальное количество открытых соединений
+	MaxConnLifetime        time.Duration // время жизни соединения
+	MaxConnIdleTime        time.Duration // время простоя, после которого соединение закрывается
+	HealthCheckPeriod      time.Duration // период проверки простаивающих соединений
+	StatementCacheCapacity int           // размер кеша подготовленных запросов соединения, отрицательное значение отключает кеш
+	ConnectTimeout         time.Duration // время ожидания доступности БД при запуске, 0 - одна попытка подключения
+}
+
+// poolConfig - настройки пула соединений, используемые сервером.
+var poolConfig = PoolConfig{ConnectTimeout: DefaultConnectTimeout}
+
+// SetPoolConfig - устанавливает настройки пула соединений с БД.
+func SetPoolConfig(cfg PoolConfig) {
+	poolConfig = cfg
+}
+
+// GetPoolConfig - возвращает настройки пула соединений с БД.
+func GetPoolConfig() PoolConfig {
+	return poolConfig
+}
+
+// parsePoolConfig - формирует настройки pgxpool из строки подключения и настроек пула.
+func parsePoolConfig(dsn string, cfg PoolConfig) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse database dsn error: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		config.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		config.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+	switch {
+	case cfg.StatementCacheCapacity > 0:
+		config.ConnConfig.StatementCacheCapacity = cfg.StatementCacheCapacity
+	case cfg.StatementCacheCapacity < 0:
+		// без кеша запросы выполняются без подготовки, что необходимо при работе через pgbouncer
+		config.ConnConfig.StatementCacheCapacity = 0
+		config.ConnConfig.DescriptionCacheCapacity = 0
+		config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+	return config, nil
+}
+
+// connectDelay - возвращает задержку перед попыткой подключения с номером attempt, начиная с нуля.
+// Задержка удваивается с каждой попыткой и ограничена connectMaxDelay.
+func connectDelay(attempt int) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+	delay := connectInitialDelay
+	for i := 1; i < attempt && delay < connectMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, connectMaxDelay)
+}
+
+// Connect - создает пул соединений с БД и ожидает доступности БД, повторяя попытки подключения
+// с увеличивающейся задержкой в течение cfg.ConnectTimeout.
+func Connect(ctx context.Context, dsn string, cfg PoolConfig) (*pgxpool.Pool, error) {
+	config, err := parsePoolConfig(dsn, cfg)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("create database pool error: %w", err)
+	}
+
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	for attempt := 0; ; attempt++ {
+		delay := connectDelay(attempt)
+		if attempt > 0 && time.Now().Add(delay).After(deadline) {
+			pool.Close()
+			return nil, fmt.Errorf("database is not available after %d attempts: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			pool.Close()
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if err = pool.Ping(ctx); err == nil {
+			return pool, nil
+		}
+		logger.ServerLog.Warn("database is not available", zap.Int("attempt", attempt+1),
+			zap.String("error", error.Error(err)))
+	}
+}
+
+// NewPoolStore - возвращает PostgreSQL-хранилище, работающее через пул соединений pgxpool.
+func NewPoolStore(pool *pgxpool.Pool) *Store {
+	return &Store{conn: stdlib.OpenDBFromPool(pool), pool: pool}
+}
+
+// PoolStats - статистика пула соединений с БД.
+type PoolStats struct {
+	TotalConns              int32   `json:"total_conns"`                // количество открытых соединений
+	IdleConns               int32   `json:"idle_conns"`                 // количество простаивающих соединений
+	AcquiredConns           int32   `json:"acquired_conns"`             // количество занятых соединений
+	ConstructingConns       int32   `json:"constructing_conns"`         // количество устанавливаемых соединений
+	MaxConns                int32   `json:"max_conns"`                  // максимальное количество соединений
+	AcquireCount            int64   `json:"acquire_count"`              // количество успешных получений соединения
+	EmptyAcquireCount       int64   `json:"empty_acquire_count"`        // количество получений соединения с ожиданием
+	CanceledAcquireCount    int64   `json:"canceled_acquire_count"`     // количество отмененных получений соединения
+	AcquireDurationMs       float64 `json:"acquire_duration_ms"`        // суммарное время получения соединений
+	NewConnsCount           int64   `json:"new_conns_count"`            // количество установленных соединений
+	MaxLifetimeDestroyCount int64   `json:"max_lifetime_destroy_count"` // количество соединений, закрытых по времени жизни
+	MaxIdleDestroyCount     int64   `json:"max_idle_destroy_count"`     // количество соединений, закрытых по времени простоя
+}
+
+// PoolStats - возвращает статистику пула соединений. Второе значение false, если хранилище создано без пула.
+func (s Store) PoolStats() (PoolStats, bool) {
+	if s.pool == nil {
+		return PoolStats{}, false
+	}
+	stat := s.pool.Stat()
+	return PoolStats{
+		TotalConns:              stat.TotalConns(),
+		IdleConns:               stat.IdleConns(),
+		AcquiredConns:           stat.AcquiredConns(),
+		ConstructingConns:       stat.ConstructingConns(),
+		MaxConns:                stat.MaxConns(),
+		AcquireCount:            stat.AcquireCount(),
+		EmptyAcquireCount:       stat.EmptyAcquireCount(),
+		CanceledAcquireCount:    stat.CanceledAcquireCount(),
+		AcquireDurationMs:       float64(stat.AcquireDuration()) / float64(time.Millisecond),
+		NewConnsCount:           stat.NewConnsCount(),
+		MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+	}, true
+}
+
+// PingContext - проверяет соединение с БД.
+func (s Store) PingContext(ctx context.Context) error {
+	return s.conn.PingContext(ctx)
+}
+
+// Close - закрывает соединения с БД.
+func (s Store) Close() {
+	s.conn.Close()
+	if s.pool != nil {
+		s.pool.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePoolConfig(t *testing.T) {
+	dsn := "host=localhost user=metrics password=password dbname=metrics sslmode=disable"
+
+	t.Run("defaults", func(t *testing.T) {
+		def, err := parsePoolConfig(dsn, PoolConfig{})
+		require.NoError(t, err)
+		config, err := parsePoolConfig(dsn, PoolConfig{ConnectTimeout: time.Second})
+		require.NoError(t, err)
+		assert.Equal(t, def.MaxConns, config.MaxConns)
+		assert.Equal(t, def.MaxConnLifetime, config.MaxConnLifetime)
+		assert.Equal(t, pgx.QueryExecModeCacheStatement, config.ConnConfig.DefaultQueryExecMode)
+	})
+	t.Run("custom values", func(t *testing.T) {
+		config, err := parsePoolConfig(dsn, PoolConfig{
+			MaxConns:               20,
+			MinConns:               2,
+			MaxConnLifetime:        time.Hour,
+			MaxConnIdleTime:        time.Minute,
+			HealthCheckPeriod:      15 * time.Second,
+			StatementCacheCapacity: 64,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(20), config.MaxConns)
+		assert.Equal(t, int32(2), config.MinConns)
+		assert.Equal(t, time.Hour, config.MaxConnLifetime)
+		assert.Equal(t, time.Minute, config.MaxConnIdleTime)
+		assert.Equal(t, 15*time.Second, config.HealthCheckPeriod)
+		assert.Equal(t, 64, config.ConnConfig.StatementCacheCapacity)
+	})
+	t.Run("statement cache disabled", func(t *testing.T) {
+		config, err := parsePoolConfig(dsn, PoolConfig{StatementCacheCapacity: -1})
+		require.NoError(t, err)
+		assert.Equal(t, 0, config.ConnConfig.StatementCacheCapacity)
+		assert.Equal(t, 0, config.ConnConfig.DescriptionCacheCapacity)
+		assert.Equal(t, pgx.QueryExecModeExec, config.ConnConfig.DefaultQueryExecMode)
+	})
+	t.Run("invalid dsn", func(t *testing.T) {
+		_, err := parsePoolConfig("postgres://user@host:port/db", PoolConfig{})
+		assert.Error(t, err)
+	})
+}
+
+func TestConnectDelay(t *testing.T) {
+	want := []time.Duration{
+		0,
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+	}
+	for attempt, delay := range want {
+		assert.Equal(t, delay, connectDelay(attempt), "attempt %d", attempt)
+	}
+}
+
+func TestConnectUnavailable(t *testing.T) {
+	dsn := "host=127.0.0.1 port=1 user=metrics password=password dbname=metrics sslmode=disable connect_timeout=1"
+
+	start := time.Now()
+	pool, err := Connect(context.Background(), dsn, PoolConfig{ConnectTimeout: 700 * time.Millisecond})
+	assert.Error(t, err)
+	assert.Nil(t, pool)
+	// вторая попытка выполняется через 500 миллисекунд, третья не укладывается в время ожидания
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool, err = Connect(ctx, dsn, PoolConfig{ConnectTimeout: time.Minute})
+	assert.Error(t, err)
+	assert.Nil(t, pool)
+}
+
+func TestStorePoolStatsWithoutPool(t *testing.T) {
+	stats, ok := NewStore(nil).PoolStats()
+	assert.False(t, ok)
+	assert.Equal(t, PoolStats{}, stats)
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
@@ -14,6 +19,8 @@ import (
 type Store struct {
 	// Поле conn содержит объект соединения с СУБД
 	conn *sql.DB
+	// Поле pool содержит пул соединений, через который работает conn, если хранилище создано функцией NewPoolStore
+	pool *pgxpool.Pool
 }
 
 // NewStore возвращает новый экземпляр PostgreSQL-хранилища
@@ -48,6 +55,20 @@ func (s Store) Bootstrap(ctx context.Context) error {
 	if errExec != nil {
 		return errExec
 	}
+	// время последнего обновления метрики используется для удаления устаревших метрик
+	_, errExec = tx.ExecContext(ctx, `ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now()`)
+	if errExec != nil {
+		return errExec
+	}
+	// индексы списка метрик: имена сравниваются побайтно, как в остальных хранилищах
+	_, errExec = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metrics_list_name ON metrics (id COLLATE "C")`)
+	if errExec != nil {
+		return errExec
+	}
+	_, errExec = tx.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS metrics_list_value ON metrics (`+sortValue+`, (id COLLATE "C"))`)
+	if errExec != nil {
+		return errExec
+	}
 
 	// коммитим транзакцию
 	return tx.Commit()
@@ -89,15 +110,11 @@ func (s Store) GetMetric(ctx context.Context, metricType string, metricName stri
 		FROM metrics
 		WHERE id = $1
 	`
-	stmt, err := s.conn.PrepareContext(ctx, query)
-	if err != nil {
-		return "", fmt.Errorf("prepare context error in DB, %w", err)
-	}
-	defer stmt.Close()
-	row := stmt.QueryRowContext(ctx, metricName)
+	// запрос выполняется без явной подготовки: подготовленные запросы кешируются драйвером соединения
+	row := s.conn.QueryRowContext(ctx, query, metricName)
 
 	var metric repositories.Metric
-	err = row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+	err := row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
 	if err != nil {
 		return "", err
 	}
@@ -127,15 +144,19 @@ func (s Store) AddGauge(ctx context.Context, nameMetric string, value float64) (
 				INSERT INTO metrics (id, mtype, value)
 				VALUES ($1, $2, $3)
 				ON CONFLICT (id) 
-				DO UPDATE SET value = EXCLUDED.value;
+				DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+				WHERE metrics.mtype = EXCLUDED.mtype;
 				`
 	stmt, err := s.conn.PrepareContext(ctx, queryUpsert)
 	if err != nil {
 		return fmt.Errorf("prepare context error in DB, %w", err)
 	}
 	defer stmt.Close()
-	_, err = stmt.ExecContext(ctx, nameMetric, "gauge", value)
-	return err
+	res, err := stmt.ExecContext(ctx, nameMetric, "gauge", value)
+	if err != nil {
+		return err
+	}
+	return checkUpserted(res, nameMetric, "gauge")
 }
 
 // AddCounter - реализует метод AddCounter интерфейса repositories.ServerRepo.
@@ -144,15 +165,36 @@ func (s Store) AddCounter(ctx context.Context, nameMetric string, value int64) (
 				INSERT INTO metrics (id, mtype, delta)
 				VALUES ($1, $2, $3)
 				ON CONFLICT (id) 
-				DO UPDATE SET delta = metrics.delta + EXCLUDED.delta;
+				DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, updated_at = now()
+				WHERE metrics.mtype = EXCLUDED.mtype;
 				`
 	stmt, err := s.conn.PrepareContext(ctx, queryUpsert)
 	if err != nil {
 		return fmt.Errorf("prepare context error in DB, %w", err)
 	}
 	defer stmt.Close()
-	_, err = stmt.ExecContext(ctx, nameMetric, "counter", value)
-	return err
+	res, err := stmt.ExecContext(ctx, nameMetric, "counter", value)
+	if err != nil {
+		return err
+	}
+	return checkUpserted(res, nameMetric, "counter")
+}
+
+// checkUpserted - проверяет, что запрос вставки или обновления метрики изменил строку.
+// Строка не изменяется, если имя метрики занято метрикой другого типа.
+func checkUpserted(res sql.Result, name, mtype string) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		stored := "counter"
+		if mtype == "counter" {
+			stored = "gauge"
+		}
+		return repositories.TypeConflictError(name, mtype, stored)
+	}
+	return nil
 }
 
 // GetAllMetrics - реализует метод GetAllMetrics интерфейса repositories.ServerRepo.
@@ -161,19 +203,40 @@ func (s Store) GetAllMetrics(ctx context.Context) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	var result string
+	var result strings.Builder
 	for _, metric := range metrics {
 		if metric.MType == "gauge" {
-			result += fmt.Sprintf("type: %s, name: %s, value: %g\n", metric.MType, metric.ID, *metric.Value)
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %g\n", metric.MType, metric.ID, *metric.Value)
 		} else {
-			result += fmt.Sprintf("type: %s, name: %s, value: %d\n", metric.MType, metric.ID, *metric.Delta)
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %d\n", metric.MType, metric.ID, *metric.Delta)
 		}
 	}
-	return result, nil
+	return result.String(), nil
 }
 
+// queryBulkUpsert - запрос записи пакета метрик одним обращением к БД. Колонки пакета передаются массивами.
+// Строка метрики, имя которой занято метрикой другого типа, не изменяется и не попадает в результат запроса.
+const queryBulkUpsert = `
+	INSERT INTO metrics (id, mtype, delta, value)
+	SELECT id, mtype, delta, value
+	FROM unnest($1::varchar[], $2::varchar[], $3::bigint[], $4::double precision[]) AS batch (id, mtype, delta, value)
+	ON CONFLICT (id)
+	DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, value = EXCLUDED.value, updated_at = now()
+	WHERE metrics.mtype = EXCLUDED.mtype
+	RETURNING id
+`
+
 // AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.ServerRepo.
+// Повторяющиеся метрики пакета схлопываются, после чего пакет записывается одним запросом.
 func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	b, err := aggregateBatch(metrics)
+	if err != nil {
+		return err
+	}
+	if len(b.ids) == 0 {
+		return nil
+	}
+
 	// запускаем транзакцию
 	tx, err := s.conn.BeginTx(ctx, nil)
 	if err != nil {
@@ -182,43 +245,59 @@ func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.M
 	// в случае неуспешного коммита все изменения транзакции будут отменены
 	defer tx.Rollback()
 
-	for _, metric := range metrics {
+	rows, err := tx.QueryContext(ctx, queryBulkUpsert, b.ids, b.mtypes, b.deltas, b.values)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-		if metric.MType == "gauge" {
-			queryUpsert := `
-				INSERT INTO metrics (id, mtype, value)
-				VALUES ($1, $2, $3)
-				ON CONFLICT (id) 
-				DO UPDATE SET value = EXCLUDED.value;
-				`
-			stmt, err := tx.PrepareContext(ctx, queryUpsert)
-			if err != nil {
-				return fmt.Errorf("prepare context error in DB, %w", err)
-			}
-			defer stmt.Close()
-			_, err = stmt.ExecContext(ctx, metric.ID, "gauge", metric.Value)
-			if err != nil {
-				return err
-			}
-		} else {
-			queryUpsert := `
-					INSERT INTO metrics (id, mtype, delta)
-					VALUES ($1, $2, $3)
-					ON CONFLICT (id) 
-					DO UPDATE SET delta = metrics.delta + EXCLUDED.delta;
-					`
-			stmt, err := tx.PrepareContext(ctx, queryUpsert)
-			if err != nil {
-				return fmt.Errorf("prepare context error in DB, %w", err)
-			}
-			defer stmt.Close()
-			_, err = stmt.ExecContext(ctx, metric.ID, "counter", metric.Delta)
-			if err != nil {
-				return err
-			}
+	upserted := make(map[string]struct{}, len(b.ids))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
 		}
+		upserted[id] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(upserted) != len(b.ids) {
+		return b.conflicting(upserted)
+	}
+
+	// коммитим транзакцию
+	return tx.Commit()
+}
+
+// ReplaceMetrics - реализует метод ReplaceMetrics интерфейса repositories.MetricsReplacer.
+// Метрики таблицы удаляются и заменяются метриками слайса одной транзакцией.
+func (s Store) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	if err := repositories.ValidateReplacement(metrics); err != nil {
+		return err
+	}
+	b, err := aggregateBatch(metrics)
+	if err != nil {
+		return err
+	}
 
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM metrics"); err != nil {
+		return err
+	}
+	if len(b.ids) > 0 {
+		if _, err := tx.ExecContext(ctx, queryBulkUpsert, b.ids, b.mtypes, b.deltas, b.values); err != nil {
+			return err
+		}
+	}
+
 	// коммитим транзакцию
 	return tx.Commit()
 }
@@ -253,3 +332,184 @@ func (s Store) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, e
 	}
 	return metrics, nil
 }
+
+// sortValue - выражение значения метрики, по которому сортируется список метрик.
+const sortValue = "(COALESCE(value, delta::double precision))"
+
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+// Отбор по типу и префиксу, сортировка и ограничение размера страницы выполняются базой данных.
+// Регулярное выражение проверяется после выборки тем же движком RE2, что и в остальных хранилищах:
+// синтаксис регулярных выражений PostgreSQL отличается, поэтому метрики читаются по порядку,
+// пока страница не заполнится.
+func (s Store) ListMetrics(ctx context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	conditions := make([]string, 0, 4)
+	args := make([]any, 0, 5)
+	if opts.MType != "" {
+		args = append(args, opts.MType)
+		conditions = append(conditions, fmt.Sprintf("mtype = $%d", len(args)))
+	}
+	if opts.Prefix != "" {
+		args = append(args, escapeLike(opts.Prefix)+"%")
+		conditions = append(conditions, fmt.Sprintf(`id COLLATE "C" LIKE $%d ESCAPE '\'`, len(args)))
+	}
+	order := `id COLLATE "C"`
+	if opts.SortBy() == repositories.SortByValue {
+		order = sortValue + `, id COLLATE "C"`
+		if opts.After != nil {
+			args = append(args, opts.After.Value, opts.After.Name)
+			conditions = append(conditions, fmt.Sprintf(`(%s, id COLLATE "C") > ($%d, $%d)`, sortValue, len(args)-1, len(args)))
+		}
+	} else if opts.After != nil {
+		args = append(args, opts.After.Name)
+		conditions = append(conditions, fmt.Sprintf(`id COLLATE "C" > $%d`, len(args)))
+	}
+
+	query := "SELECT id, mtype, delta, value FROM metrics"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + order
+	if opts.Limit > 0 && opts.Match == nil {
+		// лишняя метрика показывает, что есть следующая страница
+		args = append(args, opts.Limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	defer rows.Close()
+	metrics := make([]repositories.Metric, 0)
+	for (opts.Limit == 0 || len(metrics) <= opts.Limit) && rows.Next() {
+		var metric repositories.Metric
+		if err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
+			return repositories.MetricsPage{}, err
+		}
+		if opts.Match == nil || opts.Match.MatchString(metric.ID) {
+			metrics = append(metrics, metric)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	return repositories.NewPage(metrics, opts), nil
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+// Метрики отбираются и удаляются одним запросом DELETE, в том числе по меткам.
+func (s Store) DeleteMetrics(ctx context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	conditions := make([]string, 0, 3+len(filter.Labels))
+	args := make([]any, 0, 3+len(filter.Labels))
+	if filter.MType != "" {
+		args = append(args, filter.MType)
+		conditions = append(conditions, fmt.Sprintf("mtype = $%d", len(args)))
+	}
+	if filter.ID != "" {
+		args = append(args, filter.ID)
+		conditions = append(conditions, fmt.Sprintf("id = $%d", len(args)))
+	}
+	if filter.Prefix != "" {
+		args = append(args, escapeLike(filter.Prefix)+"%")
+		conditions = append(conditions, fmt.Sprintf(`id LIKE $%d ESCAPE '\'`, len(args)))
+	}
+	// метки записаны в имени после базового имени в формате Graphite: name;key=value;key2=value2
+	keys := make([]string, 0, len(filter.Labels))
+	for key := range filter.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "%;"+escapeLike(key+"="+filter.Labels[key])+";%")
+		conditions = append(conditions, fmt.Sprintf(`id || ';' LIKE $%d ESCAPE '\'`, len(args)))
+	}
+	where := "TRUE"
+	if len(conditions) > 0 {
+		where = strings.Join(conditions, " AND ")
+	}
+	return s.deleteWhere(ctx, where, args)
+}
+
+// ExpireMetrics - реализует метод ExpireMetrics интерфейса repositories.MetricsDeleter.
+// Время жизни отсчитывается по часам базы данных, условие истечения времени жизни проверяется в запросе DELETE.
+func (s Store) ExpireMetrics(ctx context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	if !ttl.Enabled() {
+		return nil, nil
+	}
+	where, args := ttlCondition(ttl)
+	return s.deleteWhere(ctx, where, args)
+}
+
+// ttlCondition - возвращает условие истечения времени жизни метрик с тем же порядком выбора времени жизни,
+// что и repositories.TTL.For: точное имя, затем самый длинный префикс, затем тип метрики. Нулевое время жизни
+// превращается в NULL, и такие метрики не удаляются.
+func ttlCondition(ttl repositories.TTL) (string, []any) {
+	args := make([]any, 0, 2*len(ttl.Metrics)+4)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	micros := func(d time.Duration) any {
+		if d <= 0 {
+			return nil
+		}
+		return d.Microseconds()
+	}
+
+	var names, prefixes []string
+	for pattern := range ttl.Metrics {
+		if _, ok := strings.CutSuffix(pattern, "*"); ok {
+			prefixes = append(prefixes, pattern)
+		} else {
+			names = append(names, pattern)
+		}
+	}
+	sort.Strings(names)
+	// более длинный префикс проверяется раньше
+	sort.Slice(prefixes, func(i, j int) bool {
+		if len(prefixes[i]) != len(prefixes[j]) {
+			return len(prefixes[i]) > len(prefixes[j])
+		}
+		return prefixes[i] < prefixes[j]
+	})
+
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, name := range names {
+		fmt.Fprintf(&b, " WHEN id = %s THEN %s::bigint", arg(name), arg(micros(ttl.Metrics[name])))
+	}
+	for _, pattern := range prefixes {
+		prefix := strings.TrimSuffix(pattern, "*")
+		fmt.Fprintf(&b, ` WHEN id LIKE %s ESCAPE '\' THEN %s::bigint`, arg(escapeLike(prefix)+"%"), arg(micros(ttl.Metrics[pattern])))
+	}
+	fmt.Fprintf(&b, " WHEN mtype = 'gauge' THEN %s::bigint", arg(micros(ttl.Gauge)))
+	fmt.Fprintf(&b, " WHEN mtype = 'counter' THEN %s::bigint", arg(micros(ttl.Counter)))
+	b.WriteString(" END")
+	return fmt.Sprintf("updated_at < now() - (%s) * interval '1 microsecond'", b.String()), args
+}
+
+// deleteWhere - удаляет метрики, удовлетворяющие условию where, одним запросом и возвращает удаленные метрики.
+func (s Store) deleteWhere(ctx context.Context, where string, args []any) ([]repositories.Metric, error) {
+	rows, err := s.conn.QueryContext(ctx, "DELETE FROM metrics WHERE "+where+" RETURNING id, mtype, delta, value", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	deleted := make([]repositories.Metric, 0)
+	for rows.Next() {
+		var metric repositories.Metric
+		if err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, metric)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// escapeLike - экранирует специальные символы шаблона LIKE.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -7,10 +7,12 @@ import (
 	"math"
 	"strconv"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -677,3 +679,128 @@ func TestGetAllMetricsSlice(t *testing.T) {
 	err = stor.AddMetricsFromSlice(ctx1, slice)
 	require.Error(t, err)
 }
+
+func TestStoreConformance(t *testing.T) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+
+	storagetest.Run(t, func(t *testing.T) repositories.IStorage {
+		conn, err := sql.Open("pgx", databaseDsn)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		ctx := context.Background()
+		require.NoError(t, conn.PingContext(ctx))
+
+		// каждый тест набора начинается с пустой таблицы метрик
+		stor := NewStore(conn)
+		require.NoError(t, stor.Bootstrap(ctx))
+		require.NoError(t, stor.Disable(ctx))
+		return stor
+	})
+}
+
+// addMetricsRowByRow - запись пакета метрик отдельным запросом для каждой метрики,
+// используется для сравнения с пакетной записью в бенчмарке.
+func addMetricsRowByRow(ctx context.Context, conn *sql.DB, metrics []repositories.Metric) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, metric := range metrics {
+		query := `
+			INSERT INTO metrics (id, mtype, delta, value)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (id)
+			DO UPDATE SET delta = metrics.delta + EXCLUDED.delta, value = EXCLUDED.value, updated_at = now()
+			WHERE metrics.mtype = EXCLUDED.mtype
+		`
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.ExecContext(ctx, metric.ID, metric.MType, metric.Delta, metric.Value)
+		stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func BenchmarkAddMetricsFromSlice(b *testing.B) {
+	databaseDsn := "host=localhost user=benchmarkmetrics password=password dbname=benchmarkmetrics sslmode=disable"
+	conn, err := sql.Open("pgx", databaseDsn)
+	require.NoError(b, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	if err := conn.PingContext(ctx); err != nil {
+		b.Skipf("database is not available: %v", err)
+	}
+	stor := NewStore(conn)
+	require.NoError(b, stor.Bootstrap(ctx))
+	defer stor.Disable(ctx)
+
+	// пакет агента: gauge метрики и счетчики, часть счетчиков повторяется
+	newBatch := func(size int) []repositories.Metric {
+		metrics := make([]repositories.Metric, 0, size)
+		for i := 0; i < size; i++ {
+			if i%2 == 0 {
+				value := float64(i)
+				metrics = append(metrics, repositories.Metric{ID: fmt.Sprintf("gauge%d", i), MType: "gauge", Value: &value})
+				continue
+			}
+			delta := int64(i)
+			metrics = append(metrics, repositories.Metric{ID: fmt.Sprintf("counter%d", i%(size/4+1)), MType: "counter", Delta: &delta})
+		}
+		return metrics
+	}
+
+	for _, size := range []int{10, 100, 1000} {
+		metrics := newBatch(size)
+		b.Run(fmt.Sprintf("bulk/%d", size), func(b *testing.B) {
+			require.NoError(b, stor.Disable(ctx))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := stor.AddMetricsFromSlice(ctx, metrics); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+		b.Run(fmt.Sprintf("row_by_row/%d", size), func(b *testing.B) {
+			require.NoError(b, stor.Disable(ctx))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := addMetricsRowByRow(ctx, conn, metrics); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
+
+func TestTTLCondition(t *testing.T) {
+	where, args := ttlCondition(repositories.TTL{
+		Gauge: time.Minute,
+		Metrics: map[string]time.Duration{
+			"Alloc":   0,
+			"cpu*":    time.Second,
+			"cpu_a*":  2 * time.Second,
+			"a_b%c*":  time.Millisecond,
+			"Exactly": time.Hour,
+		},
+	})
+	assert.Equal(t, "updated_at < now() - (CASE"+
+		" WHEN id = $1 THEN $2::bigint WHEN id = $3 THEN $4::bigint"+
+		` WHEN id LIKE $5 ESCAPE '\' THEN $6::bigint WHEN id LIKE $7 ESCAPE '\' THEN $8::bigint WHEN id LIKE $9 ESCAPE '\' THEN $10::bigint`+
+		" WHEN mtype = 'gauge' THEN $11::bigint WHEN mtype = 'counter' THEN $12::bigint END) * interval '1 microsecond'", where)
+	assert.Equal(t, []any{
+		"Alloc", nil, "Exactly", time.Hour.Microseconds(),
+		`a\_b\%c%`, time.Millisecond.Microseconds(), `cpu\_a%`, (2 * time.Second).Microseconds(), "cpu%", time.Second.Microseconds(),
+		time.Minute.Microseconds(), nil,
+	}, args)
+}
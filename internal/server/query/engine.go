@@ -0,0 +1,373 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+)
+
+// Параметры вычисления запросов.
+const (
+	Lookback  = 5 * time.Minute // время, в течение которого последнее значение gauge из истории считается текущим
+	MaxPoints = 11000           // наибольшее количество моментов вычисления запроса интервала
+)
+
+// Ошибки вычисления запроса.
+var (
+	ErrHistoryDisabled = errors.New("query requires history of metric values, enable it with -history")
+	ErrTooManyPoints   = fmt.Errorf("query range exceeds %d points, increase step", MaxPoints)
+)
+
+// Sample - значение серии в момент времени.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series - результат запроса: метки серии и ее значения, упорядоченные по времени.
+type Series struct {
+	Labels  map[string]string
+	Samples []Sample
+}
+
+// vector - значения серии в моменты вычисления запроса, NaN - значение не определено.
+type vector struct {
+	labels map[string]string
+	values []float64
+}
+
+// evaluation - моменты вычисления запроса.
+type evaluation struct {
+	times []time.Time
+	step  time.Duration
+	live  bool // запрос вычисляется по текущим значениям хранилища
+	now   time.Time
+}
+
+// Engine - вычисление запросов по хранилищу метрик и истории значений.
+type Engine struct {
+	stor repositories.MetricsReader
+	hist *history.History // nil - история отключена, доступны только текущие значения
+}
+
+// NewEngine - фабричная функция структуры Engine.
+func NewEngine(stor repositories.MetricsReader, hist *history.History) *Engine {
+	return &Engine{stor: stor, hist: hist}
+}
+
+// Instant - вычисляет запрос в момент t. Нулевой t означает текущий момент: селекторы вычисляются по текущим
+// значениям хранилища без обращения к истории.
+func (e *Engine) Instant(ctx context.Context, expr Expr, t time.Time) ([]Series, error) {
+	now := time.Now()
+	ev := evaluation{times: []time.Time{t}, now: now}
+	if t.IsZero() {
+		ev.times[0], ev.live = now, true
+	}
+	return e.run(ctx, expr, ev)
+}
+
+// Range - вычисляет запрос в моменты от start до end включительно с шагом step.
+func (e *Engine) Range(ctx context.Context, expr Expr, start, end time.Time, step time.Duration) ([]Series, error) {
+	if step <= 0 || end.Before(start) {
+		return nil, fmt.Errorf("%w: range must have positive step and end not before start", ErrInvalidQuery)
+	}
+	if end.Sub(start)/step >= MaxPoints {
+		return nil, ErrTooManyPoints
+	}
+	ev := evaluation{step: step, now: time.Now()}
+	for t := start; !t.After(end); t = t.Add(step) {
+		ev.times = append(ev.times, t)
+	}
+	return e.run(ctx, expr, ev)
+}
+
+// run - вычисляет запрос и преобразует значения в серии результата, упорядоченные по меткам.
+func (e *Engine) run(ctx context.Context, expr Expr, ev evaluation) ([]Series, error) {
+	vectors, err := e.eval(ctx, expr, ev)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Series, 0, len(vectors))
+	for _, v := range vectors {
+		s := Series{Labels: v.labels, Samples: make([]Sample, 0, len(v.values))}
+		for i, value := range v.values {
+			if !math.IsNaN(value) {
+				s.Samples = append(s.Samples, Sample{Time: ev.times[i], Value: value})
+			}
+		}
+		if len(s.Samples) > 0 {
+			result = append(result, s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return labelsKey(result[i].Labels) < labelsKey(result[j].Labels) })
+	return result, nil
+}
+
+func (e *Engine) eval(ctx context.Context, expr Expr, ev evaluation) ([]vector, error) {
+	switch expr := expr.(type) {
+	case *Selector:
+		return e.evalSelector(ctx, expr, ev)
+	case *RangeFunc:
+		return e.evalRangeFunc(ctx, expr, ev)
+	case *Aggregate:
+		return e.evalAggregate(ctx, expr, ev)
+	}
+	return nil, fmt.Errorf("%w: unsupported expression %s", ErrInvalidQuery, expr)
+}
+
+// seriesLabels - возвращает метки серии метрики: метки из имени в формате Graphite, базовое имя и тип.
+func seriesLabels(metric repositories.Metric) map[string]string {
+	name, labels := repositories.ParseName(metric.ID)
+	result := make(map[string]string, len(labels)+2)
+	for key, value := range labels {
+		result[key] = value
+	}
+	result[NameLabel] = name
+	result[TypeLabel] = metric.MType
+	return result
+}
+
+// selectMetrics - возвращает метрики хранилища, удовлетворяющие селектору.
+func (e *Engine) selectMetrics(ctx context.Context, sel *Selector) ([]repositories.Metric, error) {
+	metrics, err := e.stor.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]repositories.Metric, 0)
+	for _, m := range metrics {
+		if sel.Match(seriesLabels(m)) {
+			selected = append(selected, m)
+		}
+	}
+	return selected, nil
+}
+
+// nanVector - возвращает значения с неопределенными значениями во все моменты вычисления.
+func nanVector(labels map[string]string, n int) vector {
+	v := vector{labels: labels, values: make([]float64, n)}
+	for i := range v.values {
+		v.values[i] = math.NaN()
+	}
+	return v
+}
+
+// evalSelector - вычисляет значения серий селектора. Значение gauge в прошлом - последнее значение истории
+// не старше Lookback, значение counter - текущее значение за вычетом приращений после момента вычисления.
+func (e *Engine) evalSelector(ctx context.Context, sel *Selector, ev evaluation) ([]vector, error) {
+	metrics, err := e.selectMetrics(ctx, sel)
+	if err != nil {
+		return nil, err
+	}
+	if !ev.live && e.hist == nil {
+		return nil, ErrHistoryDisabled
+	}
+
+	vectors := make([]vector, 0, len(metrics))
+	for _, m := range metrics {
+		v := nanVector(seriesLabels(m), len(ev.times))
+		current := repositories.SortValue(m)
+		if ev.live {
+			v.values[0] = current
+			vectors = append(vectors, v)
+			continue
+		}
+
+		to := ev.times[len(ev.times)-1].Add(time.Nanosecond)
+		if m.MType == "counter" {
+			to = ev.now.Add(time.Nanosecond)
+		}
+		_, points, err := e.hist.Query(ctx, m.MType, m.ID, ev.times[0].Add(-Lookback), to, ev.step)
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range ev.times {
+			if m.MType == "counter" {
+				later := 0.0
+				for _, p := range points {
+					if p.Time.After(t) {
+						later += p.Sum
+					}
+				}
+				v.values[i] = current - later
+				continue
+			}
+			for _, p := range points {
+				if !p.Time.After(t) && p.Time.After(t.Add(-Lookback)) {
+					v.values[i] = p.Last
+				}
+			}
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+// evalRangeFunc - вычисляет функцию над значениями истории за интервал [t-window, t). Приращение counter -
+// сумма приращений за интервал, приращение gauge - разность последнего и первого значений интервала.
+func (e *Engine) evalRangeFunc(ctx context.Context, f *RangeFunc, ev evaluation) ([]vector, error) {
+	if e.hist == nil {
+		return nil, ErrHistoryDisabled
+	}
+	metrics, err := e.selectMetrics(ctx, f.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	// уровень истории выбирается по шагу запроса, но не грубее интервала функции
+	resolution := ev.step
+	if resolution > f.Window {
+		resolution = f.Window
+	}
+
+	vectors := make([]vector, 0, len(metrics))
+	for _, m := range metrics {
+		labels := seriesLabels(m)
+		delete(labels, NameLabel)
+		v := nanVector(labels, len(ev.times))
+
+		_, points, err := e.hist.Query(ctx, m.MType, m.ID, ev.times[0].Add(-f.Window), ev.times[len(ev.times)-1], resolution)
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range ev.times {
+			var window []history.Point
+			for _, p := range points {
+				if !p.Time.Before(t.Add(-f.Window)) && p.Time.Before(t) {
+					window = append(window, p)
+				}
+			}
+			if value, ok := applyRangeFunc(f, m.MType, window); ok {
+				v.values[i] = value
+			}
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+// applyRangeFunc - вычисляет функцию по значениям истории за интервал.
+func applyRangeFunc(f *RangeFunc, mtype string, window []history.Point) (float64, bool) {
+	switch f.Func {
+	case "rate", "increase":
+		var increase float64
+		if mtype == "counter" {
+			for _, p := range window {
+				increase += p.Sum
+			}
+		} else {
+			if len(window) < 2 {
+				return 0, false
+			}
+			increase = window[len(window)-1].Last - window[0].Last
+		}
+		if f.Func == "rate" {
+			return increase / f.Window.Seconds(), true
+		}
+		return increase, true
+	}
+
+	if len(window) == 0 {
+		return 0, false
+	}
+	merged := window[0]
+	for _, p := range window[1:] {
+		merged.Min = math.Min(merged.Min, p.Min)
+		merged.Max = math.Max(merged.Max, p.Max)
+		merged.Sum += p.Sum
+		merged.Count += p.Count
+	}
+	switch f.Func {
+	case "min_over_time":
+		return merged.Min, true
+	case "max_over_time":
+		return merged.Max, true
+	}
+	return merged.Avg(), true
+}
+
+// evalAggregate - объединяет серии в группы с одинаковыми значениями меток By и агрегирует значения групп
+// в каждый момент вычисления. Результат содержит только метки группировки.
+func (e *Engine) evalAggregate(ctx context.Context, a *Aggregate, ev evaluation) ([]vector, error) {
+	inner, err := e.eval(ctx, a.Expr, ev)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string][]vector)
+	groupLabels := make(map[string]map[string]string)
+	for _, v := range inner {
+		labels := make(map[string]string, len(a.By))
+		for _, key := range a.By {
+			if value, ok := v.labels[key]; ok && value != "" {
+				labels[key] = value
+			}
+		}
+		key := labelsKey(labels)
+		groups[key] = append(groups[key], v)
+		groupLabels[key] = labels
+	}
+
+	result := make([]vector, 0, len(groups))
+	for key, members := range groups {
+		out := nanVector(groupLabels[key], len(ev.times))
+		for i := range ev.times {
+			var values []float64
+			for _, member := range members {
+				if !math.IsNaN(member.values[i]) {
+					values = append(values, member.values[i])
+				}
+			}
+			if len(values) > 0 {
+				out.values[i] = aggregateValues(a.Op, values)
+			}
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// aggregateValues - агрегирует непустой набор значений.
+func aggregateValues(op string, values []float64) float64 {
+	result := values[0]
+	for _, v := range values[1:] {
+		switch op {
+		case "sum", "avg":
+			result += v
+		case "min":
+			result = math.Min(result, v)
+		case "max":
+			result = math.Max(result, v)
+		}
+	}
+	switch op {
+	case "avg":
+		return result / float64(len(values))
+	case "count":
+		return float64(len(values))
+	}
+	return result
+}
+
+// labelsKey - возвращает строку меток, упорядоченных по имени, для сравнения и группировки.
+func labelsKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(labels[key])
+		b.WriteByte(';')
+	}
+	return b.String()
+}
@@ -0,0 +1,218 @@
+package query
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+// testEngine - возвращает вычислитель запросов с историей значений и момент base, выровненный по минуте,
+// до которого записана история.
+func testEngine(t *testing.T) (*Engine, time.Time) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	hist := history.New(history.NewMemStore(), []history.Tier{
+		{Retention: 2 * time.Hour},
+		{Resolution: time.Minute, Retention: 24 * time.Hour},
+	})
+	base := time.Now().Truncate(time.Minute).Add(-time.Minute)
+
+	record := func(offset time.Duration, metric repositories.Metric) {
+		hist.Record(base.Add(offset), metric)
+		switch metric.MType {
+		case "gauge":
+			require.NoError(t, stor.AddGauge(ctx, metric.ID, *metric.Value))
+		case "counter":
+			require.NoError(t, stor.AddCounter(ctx, metric.ID, *metric.Delta))
+		}
+	}
+	gauge := func(id string, value float64) repositories.Metric {
+		return repositories.Metric{ID: id, MType: "gauge", Value: &value}
+	}
+	counter := func(id string, delta int64) repositories.Metric {
+		return repositories.Metric{ID: id, MType: "counter", Delta: &delta}
+	}
+
+	record(-50*time.Second, gauge("cpu;host=a", 1))
+	record(-50*time.Second, counter("requests;path=/a", 10))
+	record(-30*time.Second, counter("requests;path=/a", 5))
+	record(-10*time.Second, counter("requests;path=/a", 5))
+	record(-10*time.Second, gauge("cpu;host=a", 3))
+	record(-10*time.Second, gauge("cpu;host=b", 5))
+	record(-10*time.Second, counter("requests;path=/b", 2))
+	return NewEngine(stor, hist), base
+}
+
+func TestEngineInstant(t *testing.T) {
+	engine, base := testEngine(t)
+
+	type series struct {
+		labels map[string]string
+		value  float64
+	}
+	tests := []struct {
+		name  string
+		query string
+		time  time.Time
+		want  []series
+	}{
+		{
+			name:  "current values",
+			query: "cpu",
+			want: []series{
+				{labels: map[string]string{NameLabel: "cpu", TypeLabel: "gauge", "host": "a"}, value: 3},
+				{labels: map[string]string{NameLabel: "cpu", TypeLabel: "gauge", "host": "b"}, value: 5},
+			},
+		},
+		{
+			name:  "current sum",
+			query: `sum(cpu{host=~"a|b"})`,
+			want:  []series{{labels: map[string]string{}, value: 8}},
+		},
+		{
+			name:  "sum by label",
+			query: `sum by (path) ({__type__="counter"})`,
+			want: []series{
+				{labels: map[string]string{"path": "/a"}, value: 20},
+				{labels: map[string]string{"path": "/b"}, value: 2},
+			},
+		},
+		{
+			name:  "gauge in the past",
+			query: "cpu",
+			time:  base.Add(-20 * time.Second),
+			want:  []series{{labels: map[string]string{NameLabel: "cpu", TypeLabel: "gauge", "host": "a"}, value: 1}},
+		},
+		{
+			name:  "counter in the past",
+			query: `requests{path="/a"}`,
+			time:  base.Add(-20 * time.Second),
+			want:  []series{{labels: map[string]string{NameLabel: "requests", TypeLabel: "counter", "path": "/a"}, value: 15}},
+		},
+		{
+			name:  "increase",
+			query: `increase(requests{path="/a"}[1m])`,
+			time:  base,
+			want:  []series{{labels: map[string]string{TypeLabel: "counter", "path": "/a"}, value: 20}},
+		},
+		{
+			name:  "rate",
+			query: `rate(requests{path="/b"}[20s])`,
+			time:  base,
+			want:  []series{{labels: map[string]string{TypeLabel: "counter", "path": "/b"}, value: 0.1}},
+		},
+		{
+			name:  "increase of gauge",
+			query: `increase(cpu{host="a"}[1m])`,
+			time:  base,
+			want:  []series{{labels: map[string]string{TypeLabel: "gauge", "host": "a"}, value: 2}},
+		},
+		{
+			name:  "avg over time",
+			query: `avg_over_time(cpu{host="a"}[1m])`,
+			time:  base,
+			want:  []series{{labels: map[string]string{TypeLabel: "gauge", "host": "a"}, value: 2}},
+		},
+		{
+			name:  "max over time",
+			query: `max by (__type__) (max_over_time(cpu[1m]))`,
+			time:  base,
+			want:  []series{{labels: map[string]string{TypeLabel: "gauge"}, value: 5}},
+		},
+		{
+			name:  "count",
+			query: "count(min_over_time(cpu[1m]))",
+			time:  base,
+			want:  []series{{labels: map[string]string{}, value: 2}},
+		},
+		{
+			name:  "no matches",
+			query: "mem",
+			want:  []series{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.query)
+			require.NoError(t, err)
+			result, err := engine.Instant(context.Background(), expr, tt.time)
+			require.NoError(t, err)
+
+			got := make([]series, 0, len(result))
+			for _, s := range result {
+				require.Len(t, s.Samples, 1)
+				got = append(got, series{labels: s.Labels, value: s.Samples[0].Value})
+			}
+			require.Len(t, got, len(tt.want))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].labels, got[i].labels)
+				assert.InDelta(t, tt.want[i].value, got[i].value, 1e-9)
+			}
+		})
+	}
+}
+
+func TestEngineRange(t *testing.T) {
+	engine, base := testEngine(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query string
+		want  []float64
+	}{
+		{name: "increase", query: `increase(requests{path="/a"}[30s])`, want: []float64{10, 15, 5, 10}},
+		{name: "gauge", query: `cpu{host="a"}`, want: []float64{1, 1, 3, 3}},
+		{name: "counter", query: `requests{path="/a"}`, want: []float64{15, 15, 20, 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.query)
+			require.NoError(t, err)
+			result, err := engine.Range(ctx, expr, base.Add(-30*time.Second), base, 10*time.Second)
+			require.NoError(t, err)
+			require.Len(t, result, 1)
+
+			values := make([]float64, 0, len(result[0].Samples))
+			for i, s := range result[0].Samples {
+				assert.Equal(t, base.Add(time.Duration(i-3)*10*time.Second), s.Time)
+				values = append(values, s.Value)
+			}
+			assert.Equal(t, tt.want, values)
+		})
+	}
+
+	expr, err := Parse("cpu")
+	require.NoError(t, err)
+	_, err = engine.Range(ctx, expr, base, base.Add(-time.Second), time.Second)
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = engine.Range(ctx, expr, base.Add(-24*time.Hour), base, time.Second)
+	assert.ErrorIs(t, err, ErrTooManyPoints)
+}
+
+func TestEngineWithoutHistory(t *testing.T) {
+	ctx := context.Background()
+	engine := NewEngine(storage.NewMemStorage(map[string]float64{"cpu": 1}, nil), nil)
+
+	expr, err := Parse("cpu")
+	require.NoError(t, err)
+	result, err := engine.Instant(ctx, expr, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, 1.0, result[0].Samples[0].Value)
+
+	_, err = engine.Instant(ctx, expr, time.Now().Add(-time.Minute))
+	assert.ErrorIs(t, err, ErrHistoryDisabled)
+
+	expr, err = Parse("rate(cpu[1m])")
+	require.NoError(t, err)
+	_, err = engine.Instant(ctx, expr, time.Time{})
+	assert.ErrorIs(t, err, ErrHistoryDisabled)
+}
@@ -0,0 +1,396 @@
+// Package query вычисляет запросы на небольшом языке, похожем на PromQL: селекторы метрик по имени, типу
+// и меткам, функции над интервалом времени rate, increase и avg_over_time и агрегации вида sum by (label).
+// Текущие значения метрик берутся из хранилища, значения в прошлом и за интервалы - из истории значений.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/history"
+)
+
+// ErrInvalidQuery - ошибка разбора запроса.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Служебные метки серии: базовое имя и тип метрики.
+const (
+	NameLabel = "__name__"
+	TypeLabel = "__type__"
+)
+
+// aggregations - операторы агрегации серий.
+var aggregations = map[string]struct{}{"sum": {}, "avg": {}, "min": {}, "max": {}, "count": {}}
+
+// rangeFuncs - функции над значениями серии за интервал времени.
+var rangeFuncs = map[string]struct{}{
+	"rate": {}, "increase": {}, "avg_over_time": {}, "min_over_time": {}, "max_over_time": {},
+}
+
+// Expr - разобранный запрос.
+type Expr interface {
+	String() string
+}
+
+// MatchOp - оператор сравнения значения метки.
+type MatchOp string
+
+// Операторы сравнения значения метки.
+const (
+	MatchEqual     MatchOp = "="
+	MatchNotEqual  MatchOp = "!="
+	MatchRegexp    MatchOp = "=~"
+	MatchNotRegexp MatchOp = "!~"
+)
+
+// Matcher - условие на значение метки. Отсутствующая метка имеет пустое значение.
+type Matcher struct {
+	Label string
+	Op    MatchOp
+	Value string
+	re    *regexp.Regexp
+}
+
+// Match - проверяет значение метки.
+func (m Matcher) Match(value string) bool {
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// Selector - отбор серий по условиям на метки. Имя метрики перед фигурными скобками - условие на метку __name__.
+type Selector struct {
+	Matchers []Matcher
+}
+
+// Match - проверяет, удовлетворяют ли метки серии всем условиям селектора.
+func (s *Selector) Match(labels map[string]string) bool {
+	for _, m := range s.Matchers {
+		if !m.Match(labels[m.Label]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Selector) String() string {
+	parts := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		parts = append(parts, m.Label+string(m.Op)+strconv.Quote(m.Value))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// RangeFunc - функция над значениями серий селектора за интервал Window до момента вычисления.
+type RangeFunc struct {
+	Func     string
+	Selector *Selector
+	Window   time.Duration
+}
+
+func (f *RangeFunc) String() string {
+	return fmt.Sprintf("%s(%s[%s])", f.Func, f.Selector, f.Window)
+}
+
+// Aggregate - агрегация серий в группы с одинаковыми значениями меток By.
+type Aggregate struct {
+	Op   string
+	By   []string
+	Expr Expr
+}
+
+func (a *Aggregate) String() string {
+	if len(a.By) == 0 {
+		return fmt.Sprintf("%s(%s)", a.Op, a.Expr)
+	}
+	return fmt.Sprintf("%s by (%s) (%s)", a.Op, strings.Join(a.By, ", "), a.Expr)
+}
+
+// parser - разбор запроса методом рекурсивного спуска. Грамматика:
+//
+//	expr      = aggregate | rangefunc | selector
+//	aggregate = op [ "by" "(" labels ")" ] "(" expr ")" [ "by" "(" labels ")" ]
+//	rangefunc = func "(" selector "[" duration "]" ")"
+//	selector  = name [ "{" [ matcher { "," matcher } ] "}" ] | "{" matcher { "," matcher } "}"
+//	matcher   = label ( "=" | "!=" | "=~" | "!~" ) string
+type parser struct {
+	src string
+	pos int
+}
+
+// Parse - разбирает запрос.
+func Parse(src string) (Expr, error) {
+	p := &parser{src: src}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidQuery, fmt.Sprintf(format, args...), p.pos)
+}
+
+// peek - возвращает следующий символ после пробелов или 0 в конце запроса.
+func (p *parser) peek() byte {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// expect - пропускает ожидаемый символ.
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// ident - читает имя метрики, метки или функции.
+func (p *parser) ident() string {
+	p.peek()
+	start := p.pos
+	for p.pos < len(p.src) && isIdentChar(p.src[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func isIdentChar(c byte, first bool) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' {
+		return true
+	}
+	return !first && (c >= '0' && c <= '9' || c == '.' || c == '-' || c == '/')
+}
+
+func (p *parser) expr() (Expr, error) {
+	if p.peek() == '{' {
+		return p.selector("")
+	}
+	start := p.pos
+	word := p.ident()
+	if word == "" {
+		if p.peek() == 0 {
+			return nil, p.errorf("unexpected end of query")
+		}
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+
+	if _, ok := aggregations[word]; ok && (p.peek() == '(' || p.keyword("by")) {
+		return p.aggregate(word)
+	}
+	if _, ok := rangeFuncs[word]; ok && p.peek() == '(' {
+		return p.rangeFunc(word)
+	}
+	if p.peek() == '(' {
+		p.pos = start
+		return nil, p.errorf("unknown function %q", word)
+	}
+	return p.selector(word)
+}
+
+// keyword - проверяет, что следующее слово совпадает с kw, не пропуская его.
+func (p *parser) keyword(kw string) bool {
+	p.peek()
+	rest := p.src[p.pos:]
+	return strings.HasPrefix(rest, kw) && (len(rest) == len(kw) || !isIdentChar(rest[len(kw)], false))
+}
+
+func (p *parser) aggregate(op string) (Expr, error) {
+	a := &Aggregate{Op: op}
+	var err error
+	if p.keyword("by") {
+		if a.By, err = p.by(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	if a.Expr, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	if a.By == nil && p.keyword("by") {
+		if a.By, err = p.by(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// by - разбирает список меток группировки.
+func (p *parser) by() ([]string, error) {
+	p.ident()
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0)
+	for p.peek() != ')' {
+		if len(labels) > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		label := p.ident()
+		if label == "" {
+			return nil, p.errorf("expected label name")
+		}
+		labels = append(labels, label)
+	}
+	p.pos++
+	return labels, nil
+}
+
+func (p *parser) rangeFunc(name string) (Expr, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	f := &RangeFunc{Func: name}
+	if p.peek() == '{' {
+		sel, err := p.selector("")
+		if err != nil {
+			return nil, err
+		}
+		f.Selector = sel
+	} else {
+		metric := p.ident()
+		if metric == "" {
+			return nil, p.errorf("expected selector in %s", name)
+		}
+		sel, err := p.selector(metric)
+		if err != nil {
+			return nil, err
+		}
+		f.Selector = sel
+	}
+
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	end := strings.IndexByte(p.src[p.pos:], ']')
+	if end < 0 {
+		return nil, p.errorf("unclosed window")
+	}
+	window, err := history.ParseDuration(strings.TrimSpace(p.src[p.pos : p.pos+end]))
+	if err != nil || window <= 0 {
+		return nil, p.errorf("invalid window %q", p.src[p.pos:p.pos+end])
+	}
+	f.Window = window
+	p.pos += end + 1
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// selector - разбирает селектор, имя метрики которого уже прочитано.
+func (p *parser) selector(name string) (*Selector, error) {
+	sel := &Selector{}
+	if name != "" {
+		sel.Matchers = append(sel.Matchers, Matcher{Label: NameLabel, Op: MatchEqual, Value: name})
+	}
+	if p.peek() != '{' {
+		return sel, nil
+	}
+	p.pos++
+	for n := 0; p.peek() != '}'; n++ {
+		if n > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		m, err := p.matcher()
+		if err != nil {
+			return nil, err
+		}
+		sel.Matchers = append(sel.Matchers, m)
+	}
+	p.pos++
+	if len(sel.Matchers) == 0 {
+		return nil, p.errorf("selector must contain a name of metric or a label matcher")
+	}
+	return sel, nil
+}
+
+func (p *parser) matcher() (Matcher, error) {
+	m := Matcher{Label: p.ident()}
+	if m.Label == "" {
+		return Matcher{}, p.errorf("expected label name")
+	}
+	p.peek()
+	for _, op := range []MatchOp{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(p.src[p.pos:], string(op)) {
+			m.Op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if m.Op == "" {
+		return Matcher{}, p.errorf("expected match operator after label %q", m.Label)
+	}
+
+	value, err := p.str()
+	if err != nil {
+		return Matcher{}, err
+	}
+	m.Value = value
+	if m.Op == MatchRegexp || m.Op == MatchNotRegexp {
+		// регулярное выражение должно совпадать со всем значением метки, как в PromQL
+		if m.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return Matcher{}, p.errorf("invalid regexp %q: %v", value, err)
+		}
+	}
+	return m, nil
+}
+
+// str - читает строку в двойных или одинарных кавычках.
+func (p *parser) str() (string, error) {
+	quote := p.peek()
+	if quote != '"' && quote != '\'' {
+		return "", p.errorf("expected quoted string")
+	}
+	start := p.pos
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case quote:
+			p.pos = i + 1
+			raw := p.src[start:p.pos]
+			if quote == '\'' {
+				raw = `"` + strings.ReplaceAll(strings.ReplaceAll(raw[1:len(raw)-1], `\'`, `'`), `"`, `\"`) + `"`
+			}
+			value, err := strconv.Unquote(raw)
+			if err != nil {
+				p.pos = start
+				return "", p.errorf("invalid string %s", p.src[start:i+1])
+			}
+			return value, nil
+		}
+	}
+	return "", p.errorf("unclosed string")
+}
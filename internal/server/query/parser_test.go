@@ -0,0 +1,74 @@
+package query
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+		err   bool
+	}{
+		{name: "metric name", query: "Alloc", want: `{__name__="Alloc"}`},
+		{name: "labels", query: `cpu{host="a", __type__!='gauge'}`, want: `{__name__="cpu", host="a", __type__!="gauge"}`},
+		{name: "only matchers", query: `{__name__=~"cpu.*"}`, want: `{__name__=~"cpu.*"}`},
+		{name: "rate", query: `rate(requests{path="/a"}[5m])`, want: `rate({__name__="requests", path="/a"}[5m0s])`},
+		{name: "window in days", query: "increase(requests[1d])", want: `increase({__name__="requests"}[24h0m0s])`},
+		{name: "sum", query: "sum(cpu)", want: `sum({__name__="cpu"})`},
+		{name: "sum by before", query: "sum by (host, dc) (rate(requests[1m]))", want: `sum by (host, dc) (rate({__name__="requests"}[1m0s]))`},
+		{name: "sum by after", query: "max(cpu) by (host)", want: `max by (host) ({__name__="cpu"})`},
+		{name: "metric named as function", query: "rate", want: `{__name__="rate"}`},
+		{name: "empty", query: "", err: true},
+		{name: "unknown function", query: "delta(requests[5m])", err: true},
+		{name: "without window", query: "rate(requests)", err: true},
+		{name: "invalid window", query: "rate(requests[5x])", err: true},
+		{name: "empty selector", query: "{}", err: true},
+		{name: "invalid regexp", query: `cpu{host=~"("}`, err: true},
+		{name: "unclosed string", query: `cpu{host="a}`, err: true},
+		{name: "unquoted value", query: `cpu{host=a}`, err: true},
+		{name: "trailing input", query: "cpu cpu", err: true},
+		{name: "unclosed by", query: "sum by (host (cpu)", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.query)
+			if tt.err {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrInvalidQuery))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expr.String())
+		})
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	expr, err := Parse(`cpu{host=~"a|b", dc!="west", zone!~"x.*"}`)
+	require.NoError(t, err)
+	sel := expr.(*Selector)
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{name: "match", labels: map[string]string{NameLabel: "cpu", "host": "a"}, want: true},
+		{name: "regexp is anchored", labels: map[string]string{NameLabel: "cpu", "host": "ab"}, want: false},
+		{name: "other name", labels: map[string]string{NameLabel: "mem", "host": "a"}, want: false},
+		{name: "not equal", labels: map[string]string{NameLabel: "cpu", "host": "b", "dc": "west"}, want: false},
+		{name: "not regexp", labels: map[string]string{NameLabel: "cpu", "host": "b", "zone": "x1"}, want: false},
+		{name: "missing label", labels: map[string]string{NameLabel: "cpu"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sel.Match(tt.labels))
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Package ratelimit ограничивает частоту и объем запросов на запись метрик от каждого клиента.
+// Частота запросов ограничивается алгоритмом token bucket отдельно для каждой пары "клиент - маршрут".
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Заголовки, используемые для идентификации клиента и сообщения о превышении лимита.
+const (
+	AgentIDHeader    = "X-Agent-ID"
+	RetryAfterHeader = "Retry-After"
+)
+
+const (
+	// quotaRetryAfter - задержка перед повтором запроса, превысившего квоту.
+	quotaRetryAfter = time.Second
+	// idleTimeout - время, после которого неиспользуемый bucket клиента удаляется.
+	idleTimeout = 10 * time.Minute
+	// cleanupInterval - период очистки неиспользуемых bucket.
+	cleanupInterval = time.Minute
+)
+
+// Ошибки превышения квот.
+var (
+	ErrTooManyMetrics = errors.New("too many metrics in batch")
+	ErrBodyTooLarge   = errors.New("request body too large")
+)
+
+// Limits - настройки ограничений. Нулевое значение параметра отключает соответствующее ограничение.
+type Limits struct {
+	RPS             float64            // допустимое количество запросов в секунду от одного клиента на один маршрут
+	Burst           int                // максимальное количество запросов, которое клиент может отправить единовременно
+	RouteRPS        map[string]float64 // переопределение RPS для отдельных маршрутов или gRPC методов
+	MaxBatchMetrics int                // максимальное количество метрик в одном батче
+	MaxBodySize     int64              // максимальный размер тела запроса в байтах
+}
+
+// rpsFor - возвращает допустимое количество запросов в секунду для маршрута.
+func (l Limits) rpsFor(route string) float64 {
+	if rps, ok := l.RouteRPS[route]; ok {
+		return rps
+	}
+	return l.RPS
+}
+
+// burstFor - возвращает размер bucket для маршрута. По умолчанию он равен RPS, но не меньше одного запроса.
+func (l Limits) burstFor(route string) int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return max(1, int(math.Ceil(l.rpsFor(route))))
+}
+
+// bucket - token bucket клиента с временем последнего обращения.
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter - ограничитель частоты запросов по идентификатору клиента и маршруту.
+type Limiter struct {
+	mu          sync.Mutex
+	limits      Limits
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+// New - фабричная функция структуры Limiter.
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:      limits,
+		buckets:     make(map[string]*bucket),
+		lastCleanup: time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Limits - возвращает настройки ограничений.
+func (l *Limiter) Limits() Limits {
+	return l.limits
+}
+
+// Allow - проверяет, может ли клиент identity выполнить запрос к маршруту route.
+// Если лимит превышен, возвращает false и время, через которое можно повторить запрос.
+func (l *Limiter) Allow(identity, route string) (bool, time.Duration) {
+	rps := l.limits.rpsFor(route)
+	if rps <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+
+	key := identity + "|" + route
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(rps), l.limits.burstFor(route))}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return false, time.Second
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		// запрос отклоняется, поэтому токен возвращается в bucket
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// cleanup - удаляет bucket клиентов, которые давно не выполняли запросов.
+func (l *Limiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastCleanup = now
+}
+
+// CheckBatch - проверяет квоту на количество метрик в одном батче.
+func (l *Limiter) CheckBatch(count int) error {
+	if l.limits.MaxBatchMetrics > 0 && count > l.limits.MaxBatchMetrics {
+		return fmt.Errorf("%w: %d metrics, limit is %d", ErrTooManyMetrics, count, l.limits.MaxBatchMetrics)
+	}
+	return nil
+}
+
+// CheckBodySize - проверяет квоту на размер тела запроса.
+func (l *Limiter) CheckBodySize(size int64) error {
+	if l.limits.MaxBodySize > 0 && size > l.limits.MaxBodySize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrBodyTooLarge, size, l.limits.MaxBodySize)
+	}
+	return nil
+}
+
+// limiter - ограничитель, используемый мидлварью и перехватчиками gRPC.
+var limiter = New(Limits{})
+
+// SetLimits - устанавливает настройки ограничений, сбрасывая накопленное состояние клиентов.
+func SetLimits(l Limits) {
+	limiter = New(l)
+}
+
+// GetLimiter - возвращает установленный ограничитель.
+func GetLimiter() *Limiter {
+	return limiter
+}
+
+// QuotaExceeded - отвечает на превышение квоты на размер тела запроса или количество метрик в батче
+// статусом 429 и заголовком Retry-After, который учитывает агент.
+func QuotaExceeded(w http.ResponseWriter, err error) {
+	w.Header().Set(RetryAfterHeader, strconv.Itoa(RetryAfterSeconds(quotaRetryAfter)))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+// RetryAfterSeconds - округляет задержку до целого числа секунд вверх для заголовка Retry-After.
+func RetryAfterSeconds(delay time.Duration) int {
+	return max(1, int(math.Ceil(delay.Seconds())))
+}
+
+// ClientIdentity - определяет идентификатор клиента: идентификатор агента из заголовка X-Agent-ID,
+// при его отсутствии - ip адрес из заголовка X-Real-IP или адрес соединения.
+func ClientIdentity(r *http.Request) string {
+	if id := r.Header.Get(AgentIDHeader); id != "" {
+		return "agent:" + id
+	}
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return "ip:" + ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// identityKey - ключ контекста для хранения идентификатора клиента.
+type identityKey struct{}
+
+// WithClientIdentity - возвращает копию контекста с идентификатором клиента.
+func WithClientIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// ClientIdentityFromContext - возвращает идентификатор клиента, сохраненный в контексте мидлварью или перехватчиком gRPC.
+// Если идентификатор не установлен, возвращает "unknown".
+func ClientIdentityFromContext(ctx context.Context) string {
+	if identity, ok := ctx.Value(identityKey{}).(string); ok && identity != "" {
+		return identity
+	}
+	return "unknown"
+}
+
+// routeOf - возвращает шаблон маршрута chi, а при его отсутствии - путь запроса.
+func routeOf(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return r.URL.Path
+}
+
+// Middleware - мидлварь ограничения частоты запросов и размера тела запроса.
+// Идентификатор клиента сохраняется в контексте запроса.
+// При превышении частоты запросов или размера тела запроса возвращает статус 429 и заголовок Retry-After.
+func Middleware(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := GetLimiter()
+
+		identity := ClientIdentity(r)
+		route := routeOf(r)
+		if ok, delay := l.Allow(identity, route); !ok {
+			logger.ServerLog.Info("rate limit exceeded", zap.String("client", identity), zap.String("route", route),
+				zap.Duration("retry after", delay))
+			w.Header().Set(RetryAfterHeader, strconv.Itoa(RetryAfterSeconds(delay)))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		if maxSize := l.Limits().MaxBodySize; maxSize > 0 {
+			if err := l.CheckBodySize(r.ContentLength); err != nil {
+				logger.ServerLog.Info("body size quota exceeded", zap.String("client", identity), zap.String("error", error.Error(err)))
+				QuotaExceeded(w, err)
+				return
+			}
+			// размер тела может быть не указан в заголовке Content-Length
+			r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		}
+		// идентификатор клиента используется обработчиками для учета квот
+		r = r.WithContext(WithClientIdentity(r.Context(), identity))
+
+		// передаём управление хендлеру
+		h.ServeHTTP(w, r)
+	}
+}
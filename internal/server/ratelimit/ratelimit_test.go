@@ -0,0 +1,186 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	// лимитер с управляемыми часами
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(Limits{RPS: 2, Burst: 2, RouteRPS: map[string]float64{"/unlimited": 0, "/slow": 0.5}})
+	l.now = func() time.Time { return now }
+	l.lastCleanup = now
+
+	// клиент может выполнить количество запросов, равное размеру bucket
+	for i := 0; i < 2; i++ {
+		ok, _ := l.Allow("agent:1", "/updates/")
+		assert.True(t, ok)
+	}
+	ok, delay := l.Allow("agent:1", "/updates/")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, delay)
+
+	// отклоненный запрос не расходует токены, поэтому через 500мс доступен ровно один запрос
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("agent:1", "/updates/")
+	assert.True(t, ok)
+	ok, _ = l.Allow("agent:1", "/updates/")
+	assert.False(t, ok)
+
+	// лимиты разных клиентов и маршрутов независимы
+	ok, _ = l.Allow("agent:2", "/updates/")
+	assert.True(t, ok)
+	ok, _ = l.Allow("agent:1", "/update/")
+	assert.True(t, ok)
+
+	// маршрут без ограничений
+	for i := 0; i < 10; i++ {
+		ok, _ := l.Allow("agent:1", "/unlimited")
+		assert.True(t, ok)
+	}
+
+	// переопределенный лимит маршрута, размер bucket задан глобально
+	ok, _ = l.Allow("agent:1", "/slow")
+	assert.True(t, ok)
+	ok, _ = l.Allow("agent:1", "/slow")
+	assert.True(t, ok)
+	ok, delay = l.Allow("agent:1", "/slow")
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Second, delay)
+
+	// неиспользуемые bucket удаляются
+	assert.Len(t, l.buckets, 4)
+	now = now.Add(idleTimeout + cleanupInterval)
+	ok, _ = l.Allow("agent:3", "/updates/")
+	assert.True(t, ok)
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := New(Limits{})
+	for i := 0; i < 100; i++ {
+		ok, _ := l.Allow("agent:1", "/updates/")
+		assert.True(t, ok)
+	}
+	assert.NoError(t, l.CheckBatch(1000000))
+	assert.NoError(t, l.CheckBodySize(1<<40))
+}
+
+func TestLimiterQuotas(t *testing.T) {
+	l := New(Limits{MaxBatchMetrics: 10, MaxBodySize: 100})
+
+	assert.NoError(t, l.CheckBatch(10))
+	assert.ErrorIs(t, l.CheckBatch(11), ErrTooManyMetrics)
+
+	assert.NoError(t, l.CheckBodySize(100))
+	assert.NoError(t, l.CheckBodySize(-1))
+	assert.ErrorIs(t, l.CheckBodySize(101), ErrBodyTooLarge)
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, 1, RetryAfterSeconds(0))
+	assert.Equal(t, 1, RetryAfterSeconds(200*time.Millisecond))
+	assert.Equal(t, 2, RetryAfterSeconds(1100*time.Millisecond))
+	assert.Equal(t, 3, RetryAfterSeconds(3*time.Second))
+}
+
+func TestClientIdentity(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	r.RemoteAddr = "10.0.0.1:4567"
+	assert.Equal(t, "ip:10.0.0.1", ClientIdentity(r))
+
+	r.Header.Set("X-Real-IP", "192.168.0.5")
+	assert.Equal(t, "ip:192.168.0.5", ClientIdentity(r))
+
+	r.Header.Set(AgentIDHeader, "host-1")
+	assert.Equal(t, "agent:host-1", ClientIdentity(r))
+}
+
+func TestMiddleware(t *testing.T) {
+	defer SetLimits(Limits{})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			QuotaExceeded(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	r := chi.NewRouter()
+	r.Post("/update/{metricType}/{metricName}/{metricValue}", Middleware(handler))
+
+	send := func(path, agentID string, body io.Reader) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, path, body)
+		request.Header.Set(AgentIDHeader, agentID)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+		return w.Result()
+	}
+
+	// ограничение частоты запросов действует на шаблон маршрута, а не на конкретный путь
+	SetLimits(Limits{RPS: 1, Burst: 1})
+	{
+		res := send("/update/counter/first/1", "agent", nil)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	{
+		res := send("/update/counter/second/1", "agent", nil)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(t, "1", res.Header.Get(RetryAfterHeader))
+	}
+	{
+		res := send("/update/counter/first/1", "other agent", nil)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	// квота на размер тела запроса по заголовку Content-Length
+	SetLimits(Limits{MaxBodySize: 10})
+	{
+		res := send("/update/counter/first/1", "agent", bytes.NewReader(make([]byte, 11)))
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(t, "1", res.Header.Get(RetryAfterHeader))
+	}
+	{
+		res := send("/update/counter/first/1", "agent", bytes.NewReader(make([]byte, 10)))
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	// квота на размер тела запроса без заголовка Content-Length
+	{
+		res := send("/update/counter/first/1", "agent", io.NopCloser(strings.NewReader(strings.Repeat("a", 11))))
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(t, "1", res.Header.Get(RetryAfterHeader))
+	}
+	require.Equal(t, int64(10), GetLimiter().Limits().MaxBodySize)
+}
+
+func TestClientIdentityFromContext(t *testing.T) {
+	assert.Equal(t, "unknown", ClientIdentityFromContext(context.Background()))
+
+	// мидлварь сохраняет идентификатор клиента в контексте запроса
+	var identity string
+	handler := Middleware(func(w http.ResponseWriter, r *http.Request) {
+		identity = ClientIdentityFromContext(r.Context())
+	})
+	request := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+	request.Header.Set(AgentIDHeader, "host-1")
+	handler(httptest.NewRecorder(), request)
+	assert.Equal(t, "agent:host-1", identity)
+}
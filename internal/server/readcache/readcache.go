@@ -0,0 +1,363 @@
+// Package readcache кеширует результаты чтения метрик из хранилища. Записи через обертку сбрасывают
+// закешированные значения измененных метрик, а при работе нескольких экземпляров сервера с одной БД
+// изменения распространяются уведомлениями между экземплярами. Время жизни значений ограничивает
+// устаревание кеша, если уведомление потеряно.
+package readcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// Config - настройки кеша чтения метрик.
+type Config struct {
+	TTL    time.Duration // время жизни закешированных значений, 0 отключает кеш
+	Notify bool          // рассылать и получать уведомления об изменении метрик через БД
+}
+
+// Enabled - проверяет, что кеш чтения включен.
+func (c Config) Enabled() bool {
+	return c.TTL > 0
+}
+
+// config - настройки кеша чтения, используемые сервером.
+var config Config
+
+// SetConfig - устанавливает настройки кеша чтения.
+func SetConfig(c Config) {
+	config = c
+}
+
+// GetConfig - возвращает настройки кеша чтения.
+func GetConfig() Config {
+	return config
+}
+
+// Stats - счетчики обращений к кешу чтения.
+type Stats struct {
+	Enabled       bool  `json:"enabled"`       // включен ли кеш
+	Hits          int64 `json:"hits"`          // количество чтений, обслуженных кешем
+	Misses        int64 `json:"misses"`        // количество чтений, выполненных хранилищем
+	Invalidations int64 `json:"invalidations"` // количество сбросов закешированных значений
+}
+
+// счетчики обращений к кешу сервера
+var hits, misses, invalidations atomic.Int64
+
+// GetStats - возвращает счетчики обращений к кешу чтения.
+func GetStats() Stats {
+	return Stats{
+		Enabled:       config.Enabled(),
+		Hits:          hits.Load(),
+		Misses:        misses.Load(),
+		Invalidations: invalidations.Load(),
+	}
+}
+
+// ResetStats - обнуляет счетчики обращений к кешу чтения.
+func ResetStats() {
+	hits.Store(0)
+	misses.Store(0)
+	invalidations.Store(0)
+}
+
+// Notifier - интерфейс отправки уведомлений об изменении метрик другим экземплярам сервера.
+type Notifier interface {
+	Notify(ctx context.Context, payload string) error
+}
+
+// maxPayload - максимальный размер уведомления; при большем количестве измененных метрик
+// отправляется уведомление о сбросе всего кеша. Ограничение PostgreSQL - 8000 байт.
+const maxPayload = 7900
+
+// invalidateAll - имя в уведомлении, означающее сброс всего кеша.
+const invalidateAll = "*"
+
+// entry - закешированное значение.
+type entry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// Storage - обертка над хранилищем, кеширующая чтение метрик.
+type Storage struct {
+	repositories.IStorage
+	ttl      time.Duration
+	notifier Notifier
+	instance string // идентификатор экземпляра сервера в уведомлениях
+	now      func() time.Time
+
+	// deferNotify - запись метрик только сбрасывает локальный кеш, а уведомление о ней отправляется
+	// методом NotifyWritten после того, как метрики записаны в хранилище
+	deferNotify bool
+
+	mu         sync.Mutex
+	generation uint64 // увеличивается при каждом сбросе кеша, чтобы не кешировать значения, прочитанные до сброса
+	values     map[string]entry[string]
+	slice      *entry[[]repositories.Metric]
+	text       *entry[string]
+}
+
+// NewStorage - фабричная функция структуры Storage. Если notifier не равен nil, об изменении метрик
+// через обертку отправляются уведомления.
+func NewStorage(stor repositories.IStorage, ttl time.Duration, notifier Notifier) *Storage {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return &Storage{
+		IStorage: stor,
+		ttl:      ttl,
+		notifier: notifier,
+		instance: hex.EncodeToString(id),
+		now:      time.Now,
+		values:   make(map[string]entry[string]),
+	}
+}
+
+// SetDeferredNotify - включает отложенную отправку уведомлений о записи метрик. Используется, когда обертка
+// установлена над буфером записи: другие экземпляры сервера должны получать уведомление после сброса буфера
+// в хранилище, а не при попадании метрик в буфер, иначе они прочитают из хранилища прежние значения.
+// Удаление и замена метрик выполняются в хранилище сразу, поэтому уведомления о них не откладываются.
+// Метод необходимо вызывать до начала работы с оберткой.
+func (s *Storage) SetDeferredNotify(deferred bool) {
+	s.deferNotify = deferred
+}
+
+// NotifyWritten - уведомляет другие экземпляры сервера о записи метрик в хранилище одним уведомлением.
+func (s *Storage) NotifyWritten(ctx context.Context, metrics []repositories.Metric) {
+	s.notify(ctx, names(metrics))
+}
+
+// key - ключ закешированного значения метрики.
+func key(metricType, name string) string {
+	return metricType + "/" + name
+}
+
+// GetMetric - возвращает значение метрики из кеша или из хранилища.
+func (s *Storage) GetMetric(ctx context.Context, metricType, name string) (string, error) {
+	k := key(metricType, name)
+	s.mu.Lock()
+	cached, ok := s.values[k]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && s.now().Before(cached.expires) {
+		hits.Add(1)
+		return cached.value, nil
+	}
+	misses.Add(1)
+
+	value, err := s.IStorage.GetMetric(ctx, metricType, name)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	if s.generation == generation {
+		s.values[k] = entry[string]{value: value, expires: s.now().Add(s.ttl)}
+	}
+	s.mu.Unlock()
+	return value, nil
+}
+
+// GetAllMetricsSlice - возвращает все метрики из кеша или из хранилища. Возвращаемый слайс
+// не разделяет значения с кешем.
+func (s *Storage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	s.mu.Lock()
+	cached := s.slice
+	generation := s.generation
+	s.mu.Unlock()
+	if cached != nil && s.now().Before(cached.expires) {
+		hits.Add(1)
+		return clone(cached.value), nil
+	}
+	misses.Add(1)
+
+	metrics, err := s.IStorage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.generation == generation {
+		s.slice = &entry[[]repositories.Metric]{value: clone(metrics), expires: s.now().Add(s.ttl)}
+	}
+	s.mu.Unlock()
+	return metrics, nil
+}
+
+// GetAllMetrics - возвращает все метрики в виде строки из кеша или из хранилища.
+func (s *Storage) GetAllMetrics(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	cached := s.text
+	generation := s.generation
+	s.mu.Unlock()
+	if cached != nil && s.now().Before(cached.expires) {
+		hits.Add(1)
+		return cached.value, nil
+	}
+	misses.Add(1)
+
+	text, err := s.IStorage.GetAllMetrics(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	if s.generation == generation {
+		s.text = &entry[string]{value: text, expires: s.now().Add(s.ttl)}
+	}
+	s.mu.Unlock()
+	return text, nil
+}
+
+// AddGauge - добавляет метрику типа gauge в хранилище и сбрасывает ее значение в кеше.
+func (s *Storage) AddGauge(ctx context.Context, name string, value float64) error {
+	err := s.IStorage.AddGauge(ctx, name, value)
+	s.written(ctx, name)
+	return err
+}
+
+// AddCounter - добавляет метрику типа counter в хранилище и сбрасывает ее значение в кеше.
+func (s *Storage) AddCounter(ctx context.Context, name string, value int64) error {
+	err := s.IStorage.AddCounter(ctx, name, value)
+	s.written(ctx, name)
+	return err
+}
+
+// AddMetricsFromSlice - добавляет метрики из слайса в хранилище и сбрасывает их значения в кеше.
+func (s *Storage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	err := s.IStorage.AddMetricsFromSlice(ctx, metrics)
+	s.written(ctx, names(metrics)...)
+	return err
+}
+
+// ReplaceMetrics - заменяет все метрики хранилища метриками из слайса и сбрасывает весь кеш.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	err := repositories.ReplaceMetrics(ctx, s.IStorage, metrics)
+	s.changed(ctx, invalidateAll)
+	return err
+}
+
+// DeleteMetrics - удаляет метрики из хранилища и сбрасывает их значения в кеше.
+func (s *Storage) DeleteMetrics(ctx context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	deleted, err := s.IStorage.DeleteMetrics(ctx, filter)
+	s.changed(ctx, names(deleted)...)
+	return deleted, err
+}
+
+// ExpireMetrics - удаляет устаревшие метрики из хранилища и сбрасывает их значения в кеше.
+func (s *Storage) ExpireMetrics(ctx context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	expired, err := s.IStorage.ExpireMetrics(ctx, ttl)
+	s.changed(ctx, names(expired)...)
+	return expired, err
+}
+
+// written - сбрасывает кеш записанных метрик. Если отправка уведомлений не отложена, уведомляет о записи
+// другие экземпляры сервера.
+func (s *Storage) written(ctx context.Context, names ...string) {
+	if !s.deferNotify {
+		s.changed(ctx, names...)
+		return
+	}
+	if len(names) > 0 {
+		s.Invalidate(names...)
+	}
+}
+
+// changed - сбрасывает кеш измененных метрик и уведомляет об изменении другие экземпляры сервера.
+// Кеш сбрасывается и при ошибке записи, так как часть метрик могла быть записана.
+func (s *Storage) changed(ctx context.Context, names ...string) {
+	if len(names) == 0 {
+		return
+	}
+	s.Invalidate(names...)
+	s.notify(ctx, names)
+}
+
+// notify - уведомляет другие экземпляры сервера об изменении метрик.
+func (s *Storage) notify(ctx context.Context, names []string) {
+	if s.notifier == nil || len(names) == 0 {
+		return
+	}
+	if err := s.notifier.Notify(ctx, s.payload(names)); err != nil {
+		logger.ServerLog.Warn("notify metrics changed error", zap.String("error", error.Error(err)))
+	}
+}
+
+// payload - формирует уведомление об изменении метрик: идентификатор экземпляра и имена метрик,
+// разделенные переводом строки.
+func (s *Storage) payload(names []string) string {
+	payload := s.instance + "\n" + strings.Join(names, "\n")
+	if len(payload) > maxPayload {
+		return s.instance + "\n" + invalidateAll
+	}
+	return payload
+}
+
+// Invalidate - сбрасывает закешированные значения метрик с заданными именами и списки всех метрик.
+func (s *Storage) Invalidate(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	invalidations.Add(1)
+	for _, name := range names {
+		if name == invalidateAll {
+			s.values = make(map[string]entry[string])
+			break
+		}
+		delete(s.values, key("gauge", name))
+		delete(s.values, key("counter", name))
+	}
+	s.slice, s.text = nil, nil
+}
+
+// InvalidateAll - сбрасывает весь кеш.
+func (s *Storage) InvalidateAll() {
+	s.Invalidate(invalidateAll)
+}
+
+// HandleNotification - сбрасывает кеш по уведомлению другого экземпляра сервера. Если reconnected
+// равно true, уведомления могли быть потеряны, поэтому сбрасывается весь кеш.
+func (s *Storage) HandleNotification(payload string, reconnected bool) {
+	if reconnected {
+		s.InvalidateAll()
+		return
+	}
+	instance, names, _ := strings.Cut(payload, "\n")
+	if instance == s.instance || names == "" {
+		return
+	}
+	s.Invalidate(strings.Split(names, "\n")...)
+}
+
+// names - возвращает имена метрик.
+func names(metrics []repositories.Metric) []string {
+	result := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		result = append(result, metric.ID)
+	}
+	return result
+}
+
+// clone - возвращает копию слайса метрик, не разделяющую с ним значения.
+func clone(metrics []repositories.Metric) []repositories.Metric {
+	result := make([]repositories.Metric, len(metrics))
+	for i, metric := range metrics {
+		result[i] = repositories.Metric{ID: metric.ID, MType: metric.MType}
+		if metric.Delta != nil {
+			delta := *metric.Delta
+			result[i].Delta = &delta
+		}
+		if metric.Value != nil {
+			value := *metric.Value
+			result[i].Value = &value
+		}
+	}
+	return result
+}
@@ -0,0 +1,249 @@
+package readcache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/writebehind"
+)
+
+// countingStorage - хранилище в памяти, считающее обращения на чтение.
+type countingStorage struct {
+	*storage.MemStorage
+	reads  int
+	onRead func()
+}
+
+func (s *countingStorage) read() {
+	s.reads++
+	if s.onRead != nil {
+		s.onRead()
+	}
+}
+
+func (s *countingStorage) GetMetric(ctx context.Context, metricType, name string) (string, error) {
+	s.read()
+	return s.MemStorage.GetMetric(ctx, metricType, name)
+}
+
+func (s *countingStorage) GetAllMetrics(ctx context.Context) (string, error) {
+	s.read()
+	return s.MemStorage.GetAllMetrics(ctx)
+}
+
+func (s *countingStorage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	s.read()
+	return s.MemStorage.GetAllMetricsSlice(ctx)
+}
+
+// recordingNotifier - запоминает отправленные уведомления.
+type recordingNotifier struct {
+	mu       sync.Mutex
+	payloads []string
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, payload string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.payloads = append(n.payloads, payload)
+	return nil
+}
+
+func TestStorageHitsAndMisses(t *testing.T) {
+	ResetStats()
+	defer ResetStats()
+	ctx := context.Background()
+	backing := &countingStorage{MemStorage: storage.NewDefaultMemStorage()}
+	require.NoError(t, backing.MemStorage.AddGauge(ctx, "temp", 36.6))
+	stor := NewStorage(backing, time.Minute, nil)
+
+	for i := 0; i < 3; i++ {
+		value, err := stor.GetMetric(ctx, "gauge", "temp")
+		require.NoError(t, err)
+		assert.Equal(t, "36.6", value)
+		_, err = stor.GetAllMetrics(ctx)
+		require.NoError(t, err)
+		metrics, err := stor.GetAllMetricsSlice(ctx)
+		require.NoError(t, err)
+		assert.Len(t, metrics, 1)
+	}
+	assert.Equal(t, 3, backing.reads)
+
+	// ошибки чтения не кешируются
+	_, err := stor.GetMetric(ctx, "gauge", "unknown")
+	assert.Error(t, err)
+	_, err = stor.GetMetric(ctx, "gauge", "unknown")
+	assert.Error(t, err)
+	assert.Equal(t, 5, backing.reads)
+
+	stats := GetStats()
+	assert.Equal(t, int64(6), stats.Hits)
+	assert.Equal(t, int64(5), stats.Misses)
+}
+
+func TestStorageInvalidatesOnWrite(t *testing.T) {
+	ctx := context.Background()
+	backing := &countingStorage{MemStorage: storage.NewDefaultMemStorage()}
+	stor := NewStorage(backing, time.Minute, nil)
+
+	require.NoError(t, stor.AddCounter(ctx, "requests", 1))
+	value, err := stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+	all, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	require.NoError(t, stor.AddCounter(ctx, "requests", 2))
+	value, err = stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+
+	delta := int64(4)
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "requests", MType: "counter", Delta: &delta}}))
+	value, err = stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "7", value)
+
+	require.NoError(t, stor.AddGauge(ctx, "temp", 1))
+	all, err = stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{ID: "requests"})
+	require.NoError(t, err)
+	_, err = stor.GetMetric(ctx, "counter", "requests")
+	assert.Error(t, err)
+}
+
+func TestStorageTTL(t *testing.T) {
+	ctx := context.Background()
+	backing := &countingStorage{MemStorage: storage.NewDefaultMemStorage()}
+	require.NoError(t, backing.MemStorage.AddGauge(ctx, "temp", 1))
+	stor := NewStorage(backing, time.Second, nil)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stor.now = func() time.Time { return now }
+
+	_, err := stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	// запись в обход обертки становится видна после истечения времени жизни значения
+	require.NoError(t, backing.MemStorage.AddGauge(ctx, "temp", 2))
+
+	value, err := stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	now = now.Add(2 * time.Second)
+	value, err = stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "2", value)
+}
+
+func TestStorageDoesNotCacheStaleRead(t *testing.T) {
+	ctx := context.Background()
+	backing := &countingStorage{MemStorage: storage.NewDefaultMemStorage()}
+	require.NoError(t, backing.MemStorage.AddGauge(ctx, "temp", 1))
+	stor := NewStorage(backing, time.Minute, nil)
+
+	// кеш сбрасывается, пока значение читается из хранилища
+	backing.onRead = func() {
+		backing.onRead = nil
+		stor.Invalidate("temp")
+	}
+	_, err := stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	_, err = stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, 2, backing.reads)
+}
+
+func TestStorageNotifications(t *testing.T) {
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	backing := &countingStorage{MemStorage: storage.NewDefaultMemStorage()}
+	stor := NewStorage(backing, time.Minute, notifier)
+	other := NewStorage(backing, time.Minute, notifier)
+
+	require.NoError(t, stor.AddGauge(ctx, "temp", 1))
+	require.Len(t, notifier.payloads, 1)
+	assert.Equal(t, stor.instance+"\ntemp", notifier.payloads[0])
+
+	_, err := other.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	reads := backing.reads
+
+	// собственные уведомления не сбрасывают кеш
+	other.HandleNotification(other.instance+"\ntemp", false)
+	_, err = other.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, reads, backing.reads)
+
+	other.HandleNotification(notifier.payloads[0], false)
+	_, err = other.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, reads+1, backing.reads)
+
+	other.HandleNotification("", true)
+	_, err = other.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, reads+2, backing.reads)
+
+	// слишком длинный список имен заменяется сбросом всего кеша
+	metrics := make([]repositories.Metric, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		value := float64(i)
+		metrics = append(metrics, repositories.Metric{ID: "very.long.metric.name." + strings.Repeat("x", i%10), MType: "gauge", Value: &value})
+	}
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, metrics))
+	assert.Equal(t, stor.instance+"\n*", notifier.payloads[len(notifier.payloads)-1])
+
+	other.HandleNotification(notifier.payloads[len(notifier.payloads)-1], false)
+	_, err = other.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, reads+3, backing.reads)
+}
+
+func TestStorageDeferredNotifications(t *testing.T) {
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	buffered := writebehind.NewStorage(storage.NewDefaultMemStorage(), writebehind.Config{FlushInterval: time.Hour})
+	stor := NewStorage(buffered, time.Minute, notifier)
+	stor.SetDeferredNotify(true)
+	buffered.SetOnFlush(stor.NotifyWritten)
+
+	// запись в буфер сбрасывает только локальный кеш
+	_, err := stor.GetMetric(ctx, "gauge", "temp")
+	require.Error(t, err)
+	require.NoError(t, stor.AddGauge(ctx, "temp", 1))
+	require.NoError(t, stor.AddCounter(ctx, "requests", 2))
+	assert.Empty(t, notifier.payloads)
+	value, err := stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	// после сброса буфера отправляется одно уведомление обо всех записанных метриках
+	require.NoError(t, buffered.Flush(ctx))
+	require.Len(t, notifier.payloads, 1)
+	assert.Equal(t, stor.instance+"\nrequests\ntemp", notifier.payloads[0])
+
+	// удаление выполняется в хранилище сразу, уведомление о нем не откладывается
+	_, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{ID: "temp"})
+	require.NoError(t, err)
+	require.Len(t, notifier.payloads, 2)
+	assert.Equal(t, stor.instance+"\ntemp", notifier.payloads[1])
+}
+
+func TestStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(_ *testing.T) repositories.IStorage {
+		return NewStorage(storage.NewDefaultMemStorage(), time.Minute, nil)
+	})
+}
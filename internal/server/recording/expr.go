@@ -0,0 +1,465 @@
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// ErrInvalidExpr - ошибка разбора выражения правила записи.
+var ErrInvalidExpr = errors.New("invalid recording expression")
+
+// aggregations - функции агрегации значений метрик, отобранных селектором.
+var aggregations = map[string]func(values []float64) (float64, bool){
+	"sum": func(values []float64) (float64, bool) {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum, len(values) > 0
+	},
+	"avg": func(values []float64) (float64, bool) {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values)), len(values) > 0
+	},
+	"min": func(values []float64) (float64, bool) {
+		result := math.Inf(1)
+		for _, v := range values {
+			result = math.Min(result, v)
+		}
+		return result, len(values) > 0
+	},
+	"max": func(values []float64) (float64, bool) {
+		result := math.Inf(-1)
+		for _, v := range values {
+			result = math.Max(result, v)
+		}
+		return result, len(values) > 0
+	},
+	"count": func(values []float64) (float64, bool) {
+		return float64(len(values)), true
+	},
+}
+
+// Snapshot - значения метрик хранилища, по которым вычисляются выражения.
+type Snapshot struct {
+	metrics []repositories.Metric
+	values  map[[2]string]float64
+}
+
+// NewSnapshot - фабричная функция структуры Snapshot. Значение counter - накопленная сумма.
+func NewSnapshot(metrics []repositories.Metric) *Snapshot {
+	s := &Snapshot{values: make(map[[2]string]float64, len(metrics))}
+	for _, m := range metrics {
+		s.Set(m.MType, m.ID, repositories.SortValue(m))
+	}
+	return s
+}
+
+// Set - устанавливает значение метрики, например результат правила, чтобы его могли использовать следующие правила.
+func (s *Snapshot) Set(mtype, id string, value float64) {
+	key := [2]string{mtype, id}
+	if _, ok := s.values[key]; !ok {
+		s.metrics = append(s.metrics, repositories.Metric{ID: id, MType: mtype})
+	}
+	s.values[key] = value
+}
+
+// lookup - возвращает значение метрики. Если тип не указан, ищется gauge, затем counter.
+func (s *Snapshot) lookup(mtype, id string) (float64, bool) {
+	if mtype != "" {
+		v, ok := s.values[[2]string{mtype, id}]
+		return v, ok
+	}
+	if v, ok := s.values[[2]string{"gauge", id}]; ok {
+		return v, true
+	}
+	v, ok := s.values[[2]string{"counter", id}]
+	return v, ok
+}
+
+// Expr - разобранное выражение правила записи.
+type Expr interface {
+	// Eval - вычисляет выражение. Возвращает false, если значение не определено: метрики нет в хранилище,
+	// селектор не отобрал ни одной метрики или результат не является конечным числом.
+	Eval(s *Snapshot) (float64, bool)
+}
+
+// number - числовая константа.
+type number float64
+
+func (n number) Eval(*Snapshot) (float64, bool) {
+	return float64(n), true
+}
+
+// ref - значение одной метрики.
+type ref struct {
+	mtype string
+	id    string
+}
+
+func (r ref) Eval(s *Snapshot) (float64, bool) {
+	return s.lookup(r.mtype, r.id)
+}
+
+// negation - унарный минус.
+type negation struct {
+	x Expr
+}
+
+func (n negation) Eval(s *Snapshot) (float64, bool) {
+	v, ok := n.x.Eval(s)
+	return -v, ok
+}
+
+// binary - арифметическая операция.
+type binary struct {
+	op          byte
+	left, right Expr
+}
+
+func (b binary) Eval(s *Snapshot) (float64, bool) {
+	l, ok := b.left.Eval(s)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.right.Eval(s)
+	if !ok {
+		return 0, false
+	}
+	var v float64
+	switch b.op {
+	case '+':
+		v = l + r
+	case '-':
+		v = l - r
+	case '*':
+		v = l * r
+	case '/':
+		v = l / r
+	}
+	return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// selector - отбор метрик для агрегации: по базовому имени или префиксу имени и по меткам.
+type selector struct {
+	mtype  string
+	name   string
+	prefix bool
+	labels map[string]string
+}
+
+// match - проверяет, удовлетворяет ли метрика селектору.
+func (sel selector) match(m repositories.Metric) bool {
+	if sel.mtype != "" && sel.mtype != m.MType {
+		return false
+	}
+	name, labels := repositories.ParseName(m.ID)
+	if sel.prefix && !strings.HasPrefix(name, sel.name) || !sel.prefix && name != sel.name {
+		return false
+	}
+	for key, value := range sel.labels {
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregate - агрегация значений метрик, отобранных селектором.
+type aggregate struct {
+	fn  string
+	sel selector
+}
+
+func (a aggregate) Eval(s *Snapshot) (float64, bool) {
+	var values []float64
+	for _, m := range s.metrics {
+		if a.sel.match(m) {
+			values = append(values, s.values[[2]string{m.MType, m.ID}])
+		}
+	}
+	return aggregations[a.fn](values)
+}
+
+// selectors - возвращает селекторы всех агрегаций выражения.
+func selectors(e Expr) []selector {
+	switch e := e.(type) {
+	case aggregate:
+		return []selector{e.sel}
+	case negation:
+		return selectors(e.x)
+	case binary:
+		return append(selectors(e.left), selectors(e.right)...)
+	}
+	return nil
+}
+
+// parser - разбор выражения методом рекурсивного спуска. Грамматика:
+//
+//	expr     = term { ("+" | "-") term }
+//	term     = unary { ("*" | "/") unary }
+//	unary    = "-" unary | primary
+//	primary  = number | "(" expr ")" | func "(" selector ")" | metric
+//	metric   = [ "gauge" | "counter" ] name
+//	selector = [ "gauge" | "counter" ] name [ "*" ]
+//
+// Имя метрики может содержать метки в формате Graphite: "cpu;host=a" или cpu;host="web-1". В селекторе символ "*" после
+// базового имени отбирает метрики по префиксу, а метки отбирают метрики, содержащие эти метки.
+type parser struct {
+	src string
+	pos int
+}
+
+// ParseExpr - разбирает выражение правила записи.
+func ParseExpr(src string) (Expr, error) {
+	p := &parser{src: src}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at position %d in %q", ErrInvalidExpr, fmt.Sprintf(format, args...), p.pos, p.src)
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+// peek - возвращает следующий символ после пробелов или 0 в конце выражения.
+func (p *parser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) expr() (Expr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (Expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.peek() == '-' {
+		p.pos++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Expr, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return e, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.number()
+	case isNameStart(c):
+	case c == 0:
+		return nil, p.errorf("unexpected end of expression")
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+
+	start := p.pos
+	word, err := p.name(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == '(' {
+		if _, ok := aggregations[word]; !ok {
+			p.pos = start
+			return nil, p.errorf("unknown function %q", word)
+		}
+		p.pos++
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return aggregate{fn: word, sel: sel}, nil
+	}
+
+	mtype, id, err := p.typed(word, false)
+	if err != nil {
+		return nil, err
+	}
+	return ref{mtype: mtype, id: id}, nil
+}
+
+// typed - разбирает необязательный тип метрики перед именем.
+func (p *parser) typed(word string, prefix bool) (mtype, id string, err error) {
+	if word == "gauge" || word == "counter" {
+		if !isNameStart(p.peek()) {
+			return "", "", p.errorf("expected name of metric after %q", word)
+		}
+		id, err := p.name(prefix)
+		return word, id, err
+	}
+	return "", word, nil
+}
+
+func (p *parser) selector() (selector, error) {
+	if !isNameStart(p.peek()) {
+		return selector{}, p.errorf("expected name of metric")
+	}
+	word, err := p.name(true)
+	if err != nil {
+		return selector{}, err
+	}
+	mtype, id, err := p.typed(word, true)
+	if err != nil {
+		return selector{}, err
+	}
+	name, labels := repositories.ParseName(id)
+	sel := selector{mtype: mtype, name: name, labels: labels}
+	if base, ok := strings.CutSuffix(name, "*"); ok {
+		sel.name, sel.prefix = base, true
+	}
+	if strings.Contains(sel.name, "*") {
+		return selector{}, p.errorf("symbol * is allowed only at the end of name %q", name)
+	}
+	return sel, nil
+}
+
+func (p *parser) number() (Expr, error) {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		exponentSign := (c == '+' || c == '-') && p.pos > start && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')
+		if !(c >= '0' && c <= '9' || c == '.' || c == 'e' || c == 'E' || exponentSign) {
+			break
+		}
+		p.pos++
+	}
+	v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+	}
+	return number(v), nil
+}
+
+// name - читает имя метрики с метками и, если prefix истинно, с символом "*" после базового имени. Ключи
+// и значения меток состоят из тех же символов, что и имя, поэтому операторы после меток не требуют пробелов:
+// "cpu;host=a/2" - это метрика "cpu;host=a", деленная на 2. Значения с другими символами, например "-" или
+// "/", записываются в двойных кавычках: cpu;host="web-1".
+func (p *parser) name(prefix bool) (string, error) {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+		p.pos++
+	}
+	if prefix && p.pos < len(p.src) && p.src[p.pos] == '*' {
+		p.pos++
+	}
+	var b strings.Builder
+	b.WriteString(p.src[start:p.pos])
+	for p.pos < len(p.src) && p.src[p.pos] == ';' {
+		p.pos++
+		keyStart := p.pos
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		key := p.src[keyStart:p.pos]
+		if key == "" || p.pos >= len(p.src) || p.src[p.pos] != '=' {
+			return "", p.errorf("expected label as key=value")
+		}
+		p.pos++
+		value, err := p.labelValue()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(";" + key + "=" + value)
+	}
+	return b.String(), nil
+}
+
+// labelValue - читает значение метки: последовательность символов имени или строку в двойных кавычках.
+func (p *parser) labelValue() (string, error) {
+	if p.pos < len(p.src) && p.src[p.pos] == '"' {
+		quoted, err := strconv.QuotedPrefix(p.src[p.pos:])
+		if err != nil {
+			return "", p.errorf("invalid quoted label value")
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil || strings.ContainsAny(value, ";=") {
+			return "", p.errorf("invalid label value %s", quoted)
+		}
+		p.pos += len(quoted)
+		return value, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos], nil
+}
+
+func isNameStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9' || c == '.' || c == ':'
+}
@@ -0,0 +1,105 @@
+package recording
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func gauge(id string, value float64) repositories.Metric {
+	return repositories.Metric{ID: id, MType: "gauge", Value: &value}
+}
+
+func counter(id string, delta int64) repositories.Metric {
+	return repositories.Metric{ID: id, MType: "counter", Delta: &delta}
+}
+
+func TestParseExpr(t *testing.T) {
+	snapshot := NewSnapshot([]repositories.Metric{
+		gauge("HeapAlloc", 25),
+		gauge("HeapSys", 100),
+		gauge("cpu;host=a;dc=eu", 10),
+		gauge("cpu;host=b;dc=eu", 30),
+		gauge("cpu;host=c;dc=us", 50),
+		gauge("cpu_total", 1000),
+		gauge("mem;host=web-1", 4),
+		counter("requests;host=a", 7),
+		counter("requests;host=b", 3),
+		counter("PollCount", 5),
+		gauge("PollCount", 2),
+	})
+
+	tests := []struct {
+		name    string
+		expr    string
+		value   float64
+		defined bool
+	}{
+		{name: "ratio", expr: "HeapAlloc / HeapSys", value: 0.25, defined: true},
+		{name: "without spaces", expr: "HeapAlloc/HeapSys*100", value: 25, defined: true},
+		{name: "precedence", expr: "1 + 2 * 3 - 4 / 2", value: 5, defined: true},
+		{name: "parentheses", expr: "(1 + 2) * -3", value: -9, defined: true},
+		{name: "exponent", expr: "1e2 - 2.5e+1", value: 75, defined: true},
+		{name: "metric with labels", expr: "cpu;host=a;dc=eu * 2", value: 20, defined: true},
+		{name: "operator after label", expr: "cpu;host=a;dc=eu/2-1", value: 4, defined: true},
+		{name: "quoted label value", expr: `mem;host="web-1" + 1`, value: 5, defined: true},
+		{name: "quoted label in selector", expr: `sum(gauge mem;host="web-1")`, value: 4, defined: true},
+		{name: "untyped prefers gauge", expr: "PollCount", value: 2, defined: true},
+		{name: "typed counter", expr: "counter PollCount", value: 5, defined: true},
+		{name: "sum by name", expr: "sum(cpu)", value: 90, defined: true},
+		{name: "sum by label", expr: "sum(gauge cpu;dc=eu)", value: 40, defined: true},
+		{name: "avg", expr: "avg(cpu)", value: 30, defined: true},
+		{name: "min", expr: "min(cpu)", value: 10, defined: true},
+		{name: "max by prefix", expr: "max(cpu*)", value: 1000, defined: true},
+		{name: "count by prefix and type", expr: "count(counter req*)", value: 2, defined: true},
+		{name: "sum of counters", expr: "sum(counter requests)", value: 10, defined: true},
+		{name: "count without matches", expr: "count(missing)", value: 0, defined: true},
+		{name: "sum without matches", expr: "sum(missing)", defined: false},
+		{name: "missing metric", expr: "HeapAlloc / Missing", defined: false},
+		{name: "division by zero", expr: "HeapAlloc / 0", defined: false},
+		{name: "type mismatch", expr: "counter HeapAlloc", defined: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := ParseExpr(tt.expr)
+			require.NoError(t, err)
+			value, ok := e.Eval(snapshot)
+			assert.Equal(t, tt.defined, ok)
+			if tt.defined {
+				assert.InDelta(t, tt.value, value, 1e-9)
+			}
+		})
+	}
+}
+
+func TestParseExprInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "empty", expr: ""},
+		{name: "unknown function", expr: "rate(cpu)"},
+		{name: "unclosed parenthesis", expr: "(1 + 2"},
+		{name: "unclosed function", expr: "sum(cpu"},
+		{name: "expression in function", expr: "sum(1 + 2)"},
+		{name: "dangling operator", expr: "HeapAlloc /"},
+		{name: "two metrics", expr: "HeapAlloc HeapSys"},
+		{name: "operator after aggregation", expr: "sum(cpu*) *"},
+		{name: "asterisk inside name", expr: "sum(c*u)"},
+		{name: "type without name", expr: "gauge"},
+		{name: "invalid number", expr: "1.2.3"},
+		{name: "unexpected character", expr: "HeapAlloc % 2"},
+		{name: "label without value", expr: "cpu;host"},
+		{name: "unclosed quoted label", expr: `cpu;host="a`},
+		{name: "separator in quoted label", expr: `cpu;host="a;b=c"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseExpr(tt.expr)
+			assert.ErrorIs(t, err, ErrInvalidExpr)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package recording
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/ratelimit"
+)
+
+// DefaultInterval - период вычисления правил записи по умолчанию.
+const DefaultInterval = 15 * time.Second
+
+// Identity - идентификатор клиента, от имени которого записываются результаты правил. Используется
+// ограничениями количества метрик клиента.
+const Identity = "recording"
+
+// Storage - хранилище, из которого читаются метрики и в которое записываются результаты правил.
+type Storage interface {
+	repositories.MetricsReader
+	repositories.MetricsWriter
+}
+
+// Recorder - вычисление правил записи.
+type Recorder struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// NewRecorder - фабричная функция структуры Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// SetRules - устанавливает правила записи.
+func (r *Recorder) SetRules(rules []Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = rules
+}
+
+// RulesCount - возвращает количество правил записи.
+func (r *Recorder) RulesCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.rules)
+}
+
+// Evaluate - вычисляет правила по текущим значениям метрик хранилища и записывает результаты одним запросом.
+// Правило, значение которого не определено, пропускается, а прежнее значение его метрики сохраняется.
+func (r *Recorder) Evaluate(ctx context.Context, stor Storage) error {
+	r.mu.RLock()
+	rules := r.rules
+	r.mu.RUnlock()
+	if len(rules) == 0 {
+		return nil
+	}
+
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot := NewSnapshot(metrics)
+	results := make([]repositories.Metric, 0, len(rules))
+	for _, rule := range rules {
+		value, ok := rule.Parsed.Eval(snapshot)
+		if !ok {
+			logger.ServerLog.Debug("recording rule value is undefined", zap.String("record", rule.Record),
+				zap.String("expr", rule.Expr))
+			continue
+		}
+		snapshot.Set("gauge", rule.Record, value)
+		results = append(results, repositories.Metric{ID: rule.Record, MType: "gauge", Value: &value})
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return stor.AddMetricsFromSlice(ratelimit.WithClientIdentity(ctx, Identity), results)
+}
+
+var (
+	rulesPath string                          // путь к файлу правил записи
+	interval  time.Duration = DefaultInterval // период вычисления правил записи
+	recorder                = NewRecorder()
+)
+
+// SetRulesPath - устанавливает путь к файлу правил записи.
+func SetRulesPath(path string) {
+	rulesPath = path
+}
+
+// GetRulesPath - возвращает путь к файлу правил записи.
+func GetRulesPath() string {
+	return rulesPath
+}
+
+// SetInterval - устанавливает период вычисления правил записи.
+func SetInterval(i time.Duration) {
+	interval = i
+}
+
+// GetInterval - возвращает период вычисления правил записи.
+func GetInterval() time.Duration {
+	return interval
+}
+
+// GetRecorder - возвращает вычисление правил записи сервера.
+func GetRecorder() *Recorder {
+	return recorder
+}
+
+// Reload - загружает правила записи из файла. При ошибке чтения или разбора файла прежние правила сохраняются.
+func Reload() error {
+	if rulesPath == "" {
+		return nil
+	}
+	rules, err := LoadRules(rulesPath)
+	if err != nil {
+		return err
+	}
+	recorder.SetRules(rules)
+	logger.ServerLog.Info("recording rules loaded", zap.String("path", rulesPath), zap.Int("count", len(rules)))
+	return nil
+}
+
+// Run - периодически вычисляет правила записи до отмены контекста.
+// Если файл правил не задан, сразу возвращает управление.
+func Run(ctx context.Context, stor Storage) {
+	if rulesPath == "" || interval <= 0 {
+		return
+	}
+	logger.ServerLog.Debug("starting recording rules evaluation", zap.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := recorder.Evaluate(ctx, stor); err != nil {
+				logger.ServerLog.Error("evaluate recording rules error", zap.String("error", error.Error(err)))
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package recording
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestRecorderEvaluate(t *testing.T) {
+	ctx := context.Background()
+	stor := storage.NewDefaultMemStorage()
+	recorder := NewRecorder()
+	rules, err := ParseRules([]byte(`
+rules:
+  - record: HeapUtilization
+    expr: HeapAlloc / HeapSys
+  - record: HeapUtilizationPercent
+    expr: HeapUtilization * 100
+  - record: cpu_total
+    expr: sum(cpu)
+`))
+	require.NoError(t, err)
+	recorder.SetRules(rules)
+
+	// метрик нет - значения правил не определены и ничего не записывается
+	require.NoError(t, recorder.Evaluate(ctx, stor))
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	require.NoError(t, stor.AddGauge(ctx, "HeapAlloc", 30))
+	require.NoError(t, stor.AddGauge(ctx, "HeapSys", 120))
+	require.NoError(t, stor.AddGauge(ctx, "cpu;host=a", 1.5))
+	require.NoError(t, stor.AddGauge(ctx, "cpu;host=b", 2.5))
+	require.NoError(t, recorder.Evaluate(ctx, stor))
+
+	// правило использует результат предыдущего правила в том же вычислении
+	tests := []struct {
+		id    string
+		value string
+	}{
+		{id: "HeapUtilization", value: "0.25"},
+		{id: "HeapUtilizationPercent", value: "25"},
+		{id: "cpu_total", value: "4"},
+	}
+	for _, tt := range tests {
+		value, err := stor.GetMetric(ctx, "gauge", tt.id)
+		require.NoError(t, err, tt.id)
+		assert.Equal(t, tt.value, value, tt.id)
+	}
+
+	// значение правила не определено - прежнее значение метрики сохраняется
+	require.NoError(t, stor.AddGauge(ctx, "HeapSys", 0))
+	require.NoError(t, recorder.Evaluate(ctx, stor))
+	value, err := stor.GetMetric(ctx, "gauge", "HeapUtilization")
+	require.NoError(t, err)
+	assert.Equal(t, "0.25", value)
+}
+
+func TestReload(t *testing.T) {
+	defer SetRulesPath("")
+	defer GetRecorder().SetRules(nil)
+
+	// файл правил не задан
+	require.NoError(t, Reload())
+	assert.Equal(t, 0, GetRecorder().RulesCount())
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{record: a, expr: b + 1}]"), 0644))
+	SetRulesPath(path)
+	require.NoError(t, Reload())
+	assert.Equal(t, 1, GetRecorder().RulesCount())
+
+	// при ошибке в файле прежние правила сохраняются
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{record: a, expr: b +}]"), 0644))
+	assert.Error(t, Reload())
+	assert.Equal(t, 1, GetRecorder().RulesCount())
+}
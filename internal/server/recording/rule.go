@@ -0,0 +1,89 @@
+// Package recording периодически вычисляет правила записи - выражения над метриками хранилища - и записывает
+// их результаты в хранилище как новые метрики gauge. Например, правило "HeapUtilization = HeapAlloc / HeapSys"
+// или сумма метрики по всем агентам.
+package recording
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/cardinality"
+)
+
+// Rule - правило записи.
+type Rule struct {
+	Record string // имя метрики gauge, в которую записывается результат
+	Expr   string
+	Parsed Expr
+}
+
+// ruleConfig - правило записи в файле правил.
+type ruleConfig struct {
+	Record string `yaml:"record"`
+	Expr   string `yaml:"expr"`
+}
+
+// rulesFile - файл правил записи.
+type rulesFile struct {
+	Rules []ruleConfig `yaml:"rules"`
+}
+
+// ParseRules - разбирает правила записи в формате YAML или JSON. Правила вычисляются по порядку, поэтому
+// правило может использовать результат предыдущего правила. Агрегации не должны отбирать метрики, в которые
+// записываются правила: иначе результат правила учитывался бы в нем самом или в других правилах при следующем
+// вычислении. Пример:
+//
+//	rules:
+//	  - record: HeapUtilization
+//	    expr: HeapAlloc / HeapSys
+//	  - record: cpu_total
+//	    expr: sum(gauge cpu_usage)
+//	  - record: requests_eu
+//	    expr: sum(counter requests;dc=eu) / count(counter requests;dc=eu)
+func ParseRules(data []byte) ([]Rule, error) {
+	var file rulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse recording rules error: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(file.Rules))
+	records := make(map[string]struct{}, len(file.Rules))
+	for _, r := range file.Rules {
+		if err := cardinality.ValidateName(r.Record); err != nil {
+			return nil, fmt.Errorf("%w: rule %q has invalid record name: %v", ErrInvalidExpr, r.Record, err)
+		}
+		if _, ok := records[r.Record]; ok {
+			return nil, fmt.Errorf("%w: duplicate record name %q", ErrInvalidExpr, r.Record)
+		}
+		records[r.Record] = struct{}{}
+
+		parsed, err := ParseExpr(r.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Record, err)
+		}
+		rules = append(rules, Rule{Record: r.Record, Expr: r.Expr, Parsed: parsed})
+	}
+
+	for _, rule := range rules {
+		for _, sel := range selectors(rule.Parsed) {
+			for record := range records {
+				if sel.match(repositories.Metric{ID: record, MType: "gauge"}) {
+					return nil, fmt.Errorf("%w: rule %q aggregates recorded metric %q", ErrInvalidExpr, rule.Record, record)
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// LoadRules - читает правила записи из файла.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read recording rules error: %w", err)
+	}
+	return ParseRules(data)
+}
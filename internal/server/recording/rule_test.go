@@ -0,0 +1,58 @@
+package recording
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`
+rules:
+  - record: HeapUtilization
+    expr: HeapAlloc / HeapSys
+  - record: cpu_total;dc=eu
+    expr: sum(gauge cpu;dc=eu)
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "HeapUtilization", rules[0].Record)
+	assert.Equal(t, "HeapAlloc / HeapSys", rules[0].Expr)
+	assert.NotNil(t, rules[0].Parsed)
+	assert.Equal(t, "cpu_total;dc=eu", rules[1].Record)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "without record", data: `rules: [{expr: "1"}]`},
+		{name: "invalid record name", data: `rules: [{record: "a#b", expr: "1"}]`},
+		{name: "duplicate record", data: `rules: [{record: a, expr: "1"}, {record: a, expr: "2"}]`},
+		{name: "invalid expression", data: `rules: [{record: a, expr: "sum("}]`},
+		{name: "not a list", data: `rules: {record: a}`},
+		{name: "aggregates own record", data: `rules: [{record: cpu_total, expr: "sum(cpu*)"}]`},
+		{name: "aggregates earlier record", data: `rules: [{record: cpu;host=all, expr: "1"}, {record: b, expr: "sum(gauge cpu)"}]`},
+		{name: "aggregates later record", data: `rules: [{record: a, expr: "count(req*)"}, {record: req_total, expr: "1"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [{"record": "a", "expr": "b * 2"}]}`), 0644))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	_, err = LoadRules(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
@@ -10,7 +10,10 @@ import (
 	"os"
 	"time"
 
+	"go.uber.org/zap"
+
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/expiry"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
 )
 
@@ -63,6 +66,11 @@ type FileReader interface {
 	ReadMetrics() ([]repositories.Metric, error) // Метод чтения.
 }
 
+// TimedFileReader - интерфейс чтения метрик вместе со временем их последнего обновления.
+type TimedFileReader interface {
+	ReadTimedMetrics() ([]repositories.TimedMetric, error) // Метод чтения.
+}
+
 // SaverWriter --------------------------------------------------------------------------------------------------
 
 // Writer - реализация интерфейса FileWriter
@@ -94,13 +102,25 @@ func (storage *Writer) Close() error {
 	return storage.file.Close()
 }
 
-// WriteMetrics - сохраняю метрики из сервера в файл, причем предыдущее содержимое файла удаляю
+// WriteMetrics - сохраняю метрики из сервера в файл, причем предыдущее содержимое файла удаляю.
+// Если хранилище учитывает время обновления метрик, оно также сохраняется в файл.
 func (storage *Writer) WriteMetrics(metrics repositories.MetricsReader) error {
-	metricsSlice, err := metrics.GetAllMetricsSlice(context.Background())
-	if err != nil {
-		return err
+	var metricsSlice any
+	var count int
+	if timed, ok := metrics.(repositories.TimedMetricsReader); ok {
+		timedSlice, err := timed.GetAllTimedMetrics(context.Background())
+		if err != nil {
+			return err
+		}
+		metricsSlice, count = timedSlice, len(timedSlice)
+	} else {
+		plainSlice, err := metrics.GetAllMetricsSlice(context.Background())
+		if err != nil {
+			return err
+		}
+		metricsSlice, count = plainSlice, len(plainSlice)
 	}
-	if len(metricsSlice) == 0 {
+	if count == 0 {
 		return nil
 	}
 
@@ -187,8 +207,31 @@ func (saver *Reader) ReadMetrics() ([]repositories.Metric, error) {
 	return metrics, nil
 }
 
+// ReadTimedMetrics - метод для чтения метрик вместе со временем их последнего обновления из файла.
+func (saver *Reader) ReadTimedMetrics() ([]repositories.TimedMetric, error) {
+	var bufRead bytes.Buffer
+
+	_, err := bufRead.ReadFrom(saver.reader)
+	if err != nil {
+		return nil, err
+	}
+	if bufRead.Len() == 0 {
+		return nil, nil
+	}
+
+	var metrics = make([]repositories.TimedMetric, 0)
+	if err := json.NewDecoder(&bufRead).Decode(&metrics); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
 // AddMetricsFromFile - функция для загрузки метрик из файла в сервер.
+// Метрики, время жизни которых истекло, не загружаются.
 func AddMetricsFromFile(stor repositories.MetricsWriter, reader FileReader) error {
+	if timedReader, ok := reader.(TimedFileReader); ok && GetRestore() {
+		return addTimedMetricsFromFile(stor, timedReader)
+	}
 	if GetRestore() {
 		metrics, err := reader.ReadMetrics()
 		if err != nil {
@@ -200,3 +243,42 @@ func AddMetricsFromFile(stor repositories.MetricsWriter, reader FileReader) erro
 	}
 	return nil
 }
+
+// addTimedMetricsFromFile - загружает метрики из файла, сохраняя время их последнего обновления.
+func addTimedMetricsFromFile(stor repositories.MetricsWriter, reader TimedFileReader) error {
+	metrics, err := reader.ReadTimedMetrics()
+	if err != nil {
+		return err
+	}
+
+	ttl := expiry.GetTTL()
+	now := time.Now()
+	actual := make([]repositories.TimedMetric, 0, len(metrics))
+	// файл, записанный предыдущими версиями сервера, может содержать метрики разных типов с одинаковым именем,
+	// загружается первая из них, чтобы конфликт типов не помешал запуску сервера
+	types := make(map[string]string, len(metrics))
+	for _, metric := range metrics {
+		if metric.Updated != nil && ttl.Expired(metric.MType, metric.ID, *metric.Updated, now) {
+			continue
+		}
+		if mtype, ok := types[metric.ID]; ok && mtype != metric.MType {
+			logger.ServerLog.Warn("metric skipped while restoring from file", zap.String("error",
+				repositories.TypeConflictError(metric.ID, metric.MType, mtype).Error()))
+			continue
+		}
+		types[metric.ID] = metric.MType
+		actual = append(actual, metric)
+	}
+	if len(actual) < len(metrics) {
+		logger.ServerLog.Info("expired metrics skipped while restoring from file", zap.Int("count", len(metrics)-len(actual)))
+	}
+
+	if timedWriter, ok := stor.(repositories.TimedMetricsWriter); ok {
+		return timedWriter.AddTimedMetrics(context.Background(), actual)
+	}
+	plain := make([]repositories.Metric, 0, len(actual))
+	for _, metric := range actual {
+		plain = append(plain, metric.Metric)
+	}
+	return stor.AddMetricsFromSlice(context.Background(), plain)
+}
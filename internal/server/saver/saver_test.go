@@ -1,8 +1,10 @@
 package saver
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -10,7 +12,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/mocks"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/expiry"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
 )
 
 func TestSetStoreInterval(t *testing.T) {
@@ -83,3 +88,82 @@ func TestWriteMetrics(t *testing.T) {
 		require.Error(t, err)
 	}
 }
+
+func TestTimedMetricsFile(t *testing.T) {
+	ctx := context.Background()
+	testFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	source := storage.NewDefaultMemStorage()
+	require.NoError(t, source.AddGauge(ctx, "fresh", 1.5))
+	require.NoError(t, source.AddCounter(ctx, "PollCount", 3))
+	stale := time.Now().Add(-2 * time.Hour)
+	value := 2.5
+	require.NoError(t, source.AddTimedMetrics(ctx, []repositories.TimedMetric{
+		{Metric: repositories.Metric{ID: "stale", MType: "gauge", Value: &value}, Updated: &stale},
+	}))
+
+	writer, err := NewWriter(testFile)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteMetrics(source))
+	require.NoError(t, writer.Close())
+
+	prevRestore, prevTTL := GetRestore(), expiry.GetTTL()
+	defer func() {
+		SetRestore(prevRestore)
+		expiry.SetTTL(prevTTL)
+	}()
+	SetRestore(true)
+	expiry.SetTTL(repositories.TTL{Gauge: time.Hour})
+
+	reader, err := NewReader(testFile)
+	require.NoError(t, err)
+	target := storage.NewDefaultMemStorage()
+	require.NoError(t, AddMetricsFromFile(target, reader))
+
+	// метрика, время жизни которой истекло, не загружается
+	_, err = target.GetMetric(ctx, "gauge", "stale")
+	assert.Error(t, err)
+	got, err := target.GetMetric(ctx, "gauge", "fresh")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", got)
+	got, err = target.GetMetric(ctx, "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "3", got)
+
+	// время обновления метрик сохраняется
+	want, err := source.GetAllTimedMetrics(ctx)
+	require.NoError(t, err)
+	restored, err := target.GetAllTimedMetrics(ctx)
+	require.NoError(t, err)
+	for _, r := range restored {
+		for _, w := range want {
+			if w.ID == r.ID && w.MType == r.MType {
+				assert.True(t, w.Updated.Equal(*r.Updated), "metric %s", r.ID)
+			}
+		}
+	}
+}
+
+func TestAddMetricsFromFileTypeConflict(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "metrics.json")
+	data := `[{"id":"Alloc","type":"gauge","value":1.5},{"id":"Alloc","type":"counter","delta":2},{"id":"PollCount","type":"counter","delta":3}]`
+	require.NoError(t, os.WriteFile(testFile, []byte(data), 0644))
+
+	prevRestore := GetRestore()
+	defer SetRestore(prevRestore)
+	SetRestore(true)
+
+	reader, err := NewReader(testFile)
+	require.NoError(t, err)
+	stor := storage.NewDefaultMemStorage()
+	require.NoError(t, AddMetricsFromFile(stor, reader))
+
+	got, err := stor.GetMetric(context.Background(), "gauge", "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", got)
+	_, err = stor.GetMetric(context.Background(), "counter", "Alloc")
+	assert.Error(t, err)
+	got, err = stor.GetMetric(context.Background(), "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, "3", got)
+}
@@ -0,0 +1,437 @@
+// Package sqlite реализует хранилище метрик в файле базы данных SQLite. Хранилище повторяет схему
+// и поведение записи хранилища PostgreSQL из пакета pg и предназначено для развертываний на одном узле.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	// драйвер SQLite для database/sql
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Scheme - схема адреса подключения к базе данных, по которой выбирается хранилище SQLite.
+const Scheme = "sqlite://"
+
+// busyTimeout - время ожидания блокировки базы данных другой транзакцией в миллисекундах.
+const busyTimeout = 5000
+
+// IsDSN - проверяет, что адрес подключения к базе данных указывает на файл SQLite.
+func IsDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, Scheme)
+}
+
+// Store - хранилище метрик в базе данных SQLite.
+type Store struct {
+	// Поле conn содержит объект соединения с базой данных
+	conn *sql.DB
+	now  func() time.Time
+}
+
+// Open - открывает базу данных по адресу вида sqlite:///path/metrics.db, создавая файл при необходимости.
+func Open(dsn string) (*Store, error) {
+	path := strings.TrimPrefix(dsn, Scheme)
+	if path == "" {
+		return nil, fmt.Errorf("path of sqlite database is empty in address %s", dsn)
+	}
+	// журнал WAL позволяет читать метрики во время записи, а транзакции сразу захватывают блокировку записи,
+	// чтобы параллельные транзакции ожидали друг друга, а не завершались ошибкой при повышении блокировки
+	conn, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", path, busyTimeout))
+	if err != nil {
+		return nil, err
+	}
+	return &Store{conn: conn, now: time.Now}, nil
+}
+
+// PingContext - проверяет соединение с базой данных.
+func (s Store) PingContext(ctx context.Context) error {
+	return s.conn.PingContext(ctx)
+}
+
+// Close - закрывает базу данных.
+func (s Store) Close() error {
+	return s.conn.Close()
+}
+
+// Bootstrap - подготавливает БД к работе, создавая необходимые таблицы.
+func (s Store) Bootstrap(ctx context.Context) error {
+	// время последнего обновления метрики хранится в наносекундах Unix и используется для удаления устаревших метрик
+	_, err := s.conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS metrics (
+			id varchar(128) PRIMARY KEY,
+			mtype varchar(128),
+			delta bigint DEFAULT NULL,
+			value double precision DEFAULT NULL,
+			updated_at bigint NOT NULL DEFAULT 0
+		)
+	`)
+	return err
+}
+
+// GetMetric -возвращает значение метрики в строчном представлении по имени и типу метрики.
+func (s Store) GetMetric(ctx context.Context, metricType string, metricName string) (string, error) {
+	row := s.conn.QueryRowContext(ctx, "SELECT id, mtype, delta, value FROM metrics WHERE id = ?", metricName)
+
+	var metric repositories.Metric
+	err := row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+	if err != nil {
+		return "", err
+	}
+	if metric.MType != metricType {
+		return "", fmt.Errorf("metric type is different, metric type in database is: %s, metric type in request is: %s", metric.MType, metricType)
+	}
+
+	switch metric.MType {
+	case "gauge":
+		if metric.Value == nil {
+			return "", fmt.Errorf("value of gauge metric is nil")
+		}
+		return fmt.Sprintf("%g", *metric.Value), nil
+	case "counter":
+		if metric.Delta == nil {
+			return "", fmt.Errorf("value of counter metric is nil")
+		}
+		return fmt.Sprintf("%d", *metric.Delta), nil
+	default:
+		return "", fmt.Errorf("whrong type of metric")
+	}
+}
+
+// queryUpsert - запрос записи метрики: значение gauge заменяется, значение counter увеличивается.
+// Строка метрики, имя которой занято метрикой другого типа, не изменяется.
+const queryUpsert = `
+	INSERT INTO metrics (id, mtype, delta, value, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (id)
+	DO UPDATE SET delta = metrics.delta + excluded.delta, value = excluded.value, updated_at = excluded.updated_at
+	WHERE metrics.mtype = excluded.mtype
+`
+
+// AddGauge - реализует метод AddGauge интерфейса repositories.ServerRepo.
+func (s Store) AddGauge(ctx context.Context, nameMetric string, value float64) error {
+	res, err := s.conn.ExecContext(ctx, queryUpsert, nameMetric, "gauge", nil, value, s.now().UnixNano())
+	if err != nil {
+		return err
+	}
+	return checkUpserted(res, nameMetric, "gauge")
+}
+
+// AddCounter - реализует метод AddCounter интерфейса repositories.ServerRepo.
+func (s Store) AddCounter(ctx context.Context, nameMetric string, value int64) error {
+	res, err := s.conn.ExecContext(ctx, queryUpsert, nameMetric, "counter", value, nil, s.now().UnixNano())
+	if err != nil {
+		return err
+	}
+	return checkUpserted(res, nameMetric, "counter")
+}
+
+// checkUpserted - проверяет, что запрос вставки или обновления метрики изменил строку.
+// Строка не изменяется, если имя метрики занято метрикой другого типа.
+func checkUpserted(res sql.Result, name, mtype string) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		stored := "counter"
+		if mtype == "counter" {
+			stored = "gauge"
+		}
+		return repositories.TypeConflictError(name, mtype, stored)
+	}
+	return nil
+}
+
+// GetAllMetrics - реализует метод GetAllMetrics интерфейса repositories.ServerRepo.
+func (s Store) GetAllMetrics(ctx context.Context) (string, error) {
+	metrics, err := s.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return "", err
+	}
+	var result strings.Builder
+	for _, metric := range metrics {
+		if metric.MType == "gauge" {
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %g\n", metric.MType, metric.ID, *metric.Value)
+		} else {
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %d\n", metric.MType, metric.ID, *metric.Delta)
+		}
+	}
+	return result.String(), nil
+}
+
+// AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.ServerRepo.
+// Метрики записываются одной транзакцией: некорректная метрика или конфликт типов отменяют запись всего слайса.
+func (s Store) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	for _, metric := range metrics {
+		switch metric.MType {
+		case "gauge":
+			if metric.Value == nil {
+				return fmt.Errorf("invalid metric, value of gauge metric is nil")
+			}
+		case "counter":
+			if metric.Delta == nil {
+				return fmt.Errorf("invalid metric, delta of counter metric is nil")
+			}
+		default:
+			return fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, queryUpsert)
+	if err != nil {
+		return fmt.Errorf("prepare context error in DB, %w", err)
+	}
+	defer stmt.Close()
+	now := s.now().UnixNano()
+	for _, metric := range metrics {
+		res, err := stmt.ExecContext(ctx, metric.ID, metric.MType, metric.Delta, metric.Value, now)
+		if err != nil {
+			return err
+		}
+		if err := checkUpserted(res, metric.ID, metric.MType); err != nil {
+			return err
+		}
+	}
+
+	// коммитим транзакцию
+	return tx.Commit()
+}
+
+// ReplaceMetrics - реализует метод ReplaceMetrics интерфейса repositories.MetricsReplacer.
+// Метрики таблицы удаляются и заменяются метриками слайса одной транзакцией.
+func (s Store) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	if err := repositories.ValidateReplacement(metrics); err != nil {
+		return err
+	}
+
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM metrics"); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, queryUpsert)
+	if err != nil {
+		return fmt.Errorf("prepare context error in DB, %w", err)
+	}
+	defer stmt.Close()
+	now := s.now().UnixNano()
+	for _, metric := range metrics {
+		if _, err := stmt.ExecContext(ctx, metric.ID, metric.MType, metric.Delta, metric.Value, now); err != nil {
+			return err
+		}
+	}
+
+	// коммитим транзакцию
+	return tx.Commit()
+}
+
+// GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.ServerRepo.
+func (s Store) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	metrics := make([]repositories.Metric, 0)
+
+	rows, err := s.conn.QueryContext(ctx, "SELECT id, mtype, delta, value FROM metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var metric repositories.Metric
+		err = rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+	// проверяем на ошибки
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// sortValue - выражение значения метрики, по которому сортируется список метрик.
+const sortValue = "COALESCE(value, delta)"
+
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+// Отбор по типу и префиксу, сортировка и ограничение размера страницы выполняются базой данных.
+// В SQLite нет регулярных выражений, поэтому при отборе по регулярному выражению метрики читаются
+// по порядку, пока страница не заполнится.
+func (s Store) ListMetrics(ctx context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	conditions := make([]string, 0, 3)
+	args := make([]any, 0, 5)
+	if opts.MType != "" {
+		args = append(args, opts.MType)
+		conditions = append(conditions, "mtype = ?")
+	}
+	if opts.Prefix != "" {
+		// оператор LIKE в SQLite не учитывает регистр, поэтому префикс сравнивается функцией substr
+		args = append(args, opts.Prefix, opts.Prefix)
+		conditions = append(conditions, "substr(id, 1, length(?)) = ?")
+	}
+	order := "id"
+	if opts.SortBy() == repositories.SortByValue {
+		order = sortValue + ", id"
+		if opts.After != nil {
+			args = append(args, opts.After.Value, opts.After.Name)
+			conditions = append(conditions, "("+sortValue+", id) > (?, ?)")
+		}
+	} else if opts.After != nil {
+		args = append(args, opts.After.Name)
+		conditions = append(conditions, "id > ?")
+	}
+
+	query := "SELECT id, mtype, delta, value FROM metrics"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + order
+	if opts.Limit > 0 && opts.Match == nil {
+		// лишняя метрика показывает, что есть следующая страница
+		args = append(args, opts.Limit+1)
+		query += " LIMIT ?"
+	}
+
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	defer rows.Close()
+	metrics := make([]repositories.Metric, 0)
+	for (opts.Limit == 0 || len(metrics) <= opts.Limit) && rows.Next() {
+		var metric repositories.Metric
+		if err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
+			return repositories.MetricsPage{}, err
+		}
+		if opts.Match == nil || opts.Match.MatchString(metric.ID) {
+			metrics = append(metrics, metric)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	return repositories.NewPage(metrics, opts), nil
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+// Отбор по типу, имени и префиксу выполняется базой данных, отбор по меткам - после выборки.
+// Оператор LIKE в SQLite не учитывает регистр, поэтому префикс проверяется повторно после выборки.
+func (s Store) DeleteMetrics(ctx context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	conditions := make([]string, 0, 3)
+	args := make([]any, 0, 3)
+	if filter.MType != "" {
+		args = append(args, filter.MType)
+		conditions = append(conditions, "mtype = ?")
+	}
+	if filter.ID != "" {
+		args = append(args, filter.ID)
+		conditions = append(conditions, "id = ?")
+	}
+	if filter.Prefix != "" {
+		args = append(args, escapeLike(filter.Prefix)+"%")
+		conditions = append(conditions, `id LIKE ? ESCAPE '\'`)
+	}
+	query := "SELECT id, mtype, delta, value, updated_at FROM metrics"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	return s.deleteSelected(ctx, query, args, func(metric repositories.Metric, _ time.Time) bool {
+		return filter.Match(metric.MType, metric.ID)
+	})
+}
+
+// ExpireMetrics - реализует метод ExpireMetrics интерфейса repositories.MetricsDeleter.
+func (s Store) ExpireMetrics(ctx context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	if !ttl.Enabled() {
+		return nil, nil
+	}
+
+	now := s.now()
+	query := "SELECT id, mtype, delta, value, updated_at FROM metrics"
+	return s.deleteSelected(ctx, query, nil, func(metric repositories.Metric, updated time.Time) bool {
+		return ttl.Expired(metric.MType, metric.ID, updated, now)
+	})
+}
+
+// deleteSelected - в одной транзакции выбирает метрики запросом query и удаляет те из них,
+// для которых функция match возвращает true. Возвращает удаленные метрики.
+// Транзакция захватывает блокировку записи при начале, поэтому выбранные метрики не изменяются до удаления.
+func (s Store) deleteSelected(ctx context.Context, query string, args []any,
+	match func(metric repositories.Metric, updated time.Time) bool) ([]repositories.Metric, error) {
+	// запускаем транзакцию
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// в случае неуспешного коммита все изменения транзакции будут отменены
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	deleted := make([]repositories.Metric, 0)
+	for rows.Next() {
+		var metric repositories.Metric
+		var updated int64
+		if err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value, &updated); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if match(metric, time.Unix(0, updated)) {
+			deleted = append(deleted, metric)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return deleted, nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "DELETE FROM metrics WHERE id = ?")
+	if err != nil {
+		return nil, fmt.Errorf("prepare context error in DB, %w", err)
+	}
+	defer stmt.Close()
+	for _, metric := range deleted {
+		if _, err := stmt.ExecContext(ctx, metric.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// коммитим транзакцию
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// escapeLike - экранирует специальные символы шаблона LIKE.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime/pprof"
+	"sync/atomic"
+	"testing"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// benchStorage - хранилище, сравниваемое в параллельных бенчмарках.
+type benchStorage interface {
+	repositories.MetricsReader
+	repositories.MetricsWriter
+}
+
+// benchSeries - количество серий в бенчмарках.
+const benchSeries = 1000
+
+// benchNames - имена серий бенчмарков.
+var benchNames = func() []string {
+	names := make([]string, benchSeries)
+	for i := range names {
+		names[i] = fmt.Sprintf("metric.%d", i)
+	}
+	return names
+}()
+
+// newBenchStorages - возвращает сравниваемые хранилища, заполненные сериями бенчмарков.
+func newBenchStorages(b *testing.B) map[string]benchStorage {
+	storages := map[string]benchStorage{
+		"memstorage": NewDefaultMemStorage(),
+		"sharded":    NewShardedStorage(DefaultShards),
+	}
+	for _, stor := range storages {
+		for i, name := range benchNames {
+			var err error
+			if i%2 == 0 {
+				err = stor.AddGauge(context.Background(), name, float64(i))
+			} else {
+				err = stor.AddCounter(context.Background(), name, int64(i))
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return storages
+}
+
+// benchOperation - операция бенчмарка, выполняемая над хранилищем одной горутиной.
+type benchOperation func(ctx context.Context, stor benchStorage, rnd *rand.Rand, i int) error
+
+// benchWrite - запись значения в случайную серию.
+func benchWrite(ctx context.Context, stor benchStorage, rnd *rand.Rand, _ int) error {
+	n := rnd.Intn(benchSeries)
+	if n%2 == 0 {
+		return stor.AddGauge(ctx, benchNames[n], rnd.Float64())
+	}
+	return stor.AddCounter(ctx, benchNames[n], 1)
+}
+
+// benchRead - чтение случайной серии.
+func benchRead(ctx context.Context, stor benchStorage, rnd *rand.Rand, _ int) error {
+	n := rnd.Intn(benchSeries)
+	mtype := "counter"
+	if n%2 == 0 {
+		mtype = "gauge"
+	}
+	_, err := stor.GetMetric(ctx, mtype, benchNames[n])
+	return err
+}
+
+// benchMixed - запись с редким чтением всех метрик, как при одновременной работе агентов и страницы со списком метрик.
+func benchMixed(ctx context.Context, stor benchStorage, rnd *rand.Rand, i int) error {
+	switch {
+	case i%100 == 0:
+		_, err := stor.GetAllMetrics(ctx)
+		return err
+	case i%4 == 0:
+		return benchRead(ctx, stor, rnd, i)
+	default:
+		return benchWrite(ctx, stor, rnd, i)
+	}
+}
+
+// BenchmarkStorageParallel - сравнивает MemStorage и ShardedStorage при параллельной нагрузке.
+// Для нагрузки mixed профиль процессора сохраняется в каталог profiles, профили хранилищ сравниваются командой
+// go tool pprof -top -diff_base=profiles/memstorage.pprof profiles/sharded.pprof
+func BenchmarkStorageParallel(b *testing.B) {
+	workloads := []struct {
+		name    string
+		op      benchOperation
+		profile bool
+	}{
+		{name: "write", op: benchWrite},
+		{name: "read", op: benchRead},
+		{name: "mixed", op: benchMixed, profile: true},
+	}
+	for _, workload := range workloads {
+		for _, impl := range []string{"memstorage", "sharded"} {
+			b.Run(workload.name+"/"+impl, func(b *testing.B) {
+				stor := newBenchStorages(b)[impl]
+				ctx := context.Background()
+
+				if workload.profile {
+					stop := startCPUProfile(b, `./../../../profiles/`+impl+`.pprof`)
+					defer stop()
+				}
+
+				var seed atomic.Int64
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					rnd := rand.New(rand.NewSource(seed.Add(1)))
+					for i := 0; pb.Next(); i++ {
+						if err := workload.op(ctx, stor, rnd, i); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// startCPUProfile - начинает запись профиля процессора в файл и возвращает функцию остановки записи.
+// Если профиль уже записывается, например при запуске go test с флагом -cpuprofile, файл не создается.
+func startCPUProfile(b *testing.B, path string) func() {
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return func() {}
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		f.Close()
+	}
+}
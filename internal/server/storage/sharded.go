@@ -0,0 +1,419 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// DefaultShards - количество сегментов хранилища ShardedStorage по умолчанию.
+const DefaultShards = 32
+
+// series - значение метрики и время ее последнего обновления. Значения изменяются атомарно,
+// поэтому запись в существующую серию выполняется под блокировкой сегмента на чтение.
+type series struct {
+	mtype   string
+	bits    atomic.Uint64 // значение gauge в представлении math.Float64bits
+	delta   atomic.Int64  // значение counter
+	updated atomic.Int64  // время последнего обновления в наносекундах Unix
+}
+
+// metric - возвращает метрику серии с текущим значением.
+func (s *series) metric(name string) repositories.Metric {
+	metric := repositories.Metric{ID: name, MType: s.mtype}
+	if s.mtype == "gauge" {
+		value := math.Float64frombits(s.bits.Load())
+		metric.Value = &value
+	} else {
+		delta := s.delta.Load()
+		metric.Delta = &delta
+	}
+	return metric
+}
+
+// apply - записывает значение метрики в серию: gauge заменяется, counter увеличивается.
+func (s *series) apply(value float64, delta int64, now time.Time) {
+	if s.mtype == "gauge" {
+		s.bits.Store(math.Float64bits(value))
+	} else {
+		s.delta.Add(delta)
+	}
+	s.updated.Store(now.UnixNano())
+}
+
+// values - возвращает значения метрики для записи в серию.
+func values(metric repositories.Metric) (value float64, delta int64) {
+	if metric.Value != nil {
+		value = *metric.Value
+	}
+	if metric.Delta != nil {
+		delta = *metric.Delta
+	}
+	return value, delta
+}
+
+// shard - сегмент хранилища, содержащий часть серий.
+type shard struct {
+	sync.RWMutex
+	series map[string]*series
+}
+
+// ShardedStorage - хранилище метрик в памяти, разделенное на сегменты по хешу имени метрики.
+// Сегменты блокируются независимо, а запись в существующие серии и чтение выполняются под блокировкой
+// на чтение, поэтому писатели разных метрик не ждут друг друга и читателей. Чтение всех метрик
+// собирает снимок сегментов по очереди и формирует результат без блокировок.
+type ShardedStorage struct {
+	shards []*shard
+	now    func() time.Time
+}
+
+// NewShardedStorage - фабричная функция структуры ShardedStorage. Количество сегментов меньше единицы
+// заменяется значением DefaultShards.
+func NewShardedStorage(shards int) *ShardedStorage {
+	if shards < 1 {
+		shards = DefaultShards
+	}
+	storage := &ShardedStorage{
+		shards: make([]*shard, shards),
+		now:    time.Now,
+	}
+	for i := range storage.shards {
+		storage.shards[i] = &shard{series: make(map[string]*series)}
+	}
+	return storage
+}
+
+// shardIndex - возвращает номер сегмента метрики по хешу FNV-1a ее имени.
+func (storage *ShardedStorage) shardIndex(name string) int {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(name); i++ {
+		hash ^= uint64(name[i])
+		hash *= 1099511628211
+	}
+	return int(hash % uint64(len(storage.shards)))
+}
+
+// shard - возвращает сегмент метрики.
+func (storage *ShardedStorage) shard(name string) *shard {
+	return storage.shards[storage.shardIndex(name)]
+}
+
+// AddGauge - реализует метод AddGauge интерфейса repositories.MetricsWriter.
+// Метрика не добавляется, если ее имя занято метрикой типа counter.
+func (storage *ShardedStorage) AddGauge(_ context.Context, name string, value float64) error {
+	return storage.add(name, "gauge", value, 0)
+}
+
+// AddCounter - реализует метод AddCounter интерфейса repositories.MetricsWriter.
+// Метрика не добавляется, если ее имя занято метрикой типа gauge.
+func (storage *ShardedStorage) AddCounter(_ context.Context, name string, value int64) error {
+	return storage.add(name, "counter", 0, value)
+}
+
+// add - записывает метрику в сегмент. Существующая серия изменяется под блокировкой на чтение,
+// новая серия создается под блокировкой на запись.
+func (storage *ShardedStorage) add(name, mtype string, value float64, delta int64) error {
+	sh := storage.shard(name)
+	now := storage.now()
+
+	sh.RLock()
+	s, ok := sh.series[name]
+	if ok && s.mtype == mtype {
+		s.apply(value, delta, now)
+	}
+	sh.RUnlock()
+	if ok {
+		if s.mtype != mtype {
+			return repositories.TypeConflictError(name, mtype, s.mtype)
+		}
+		return nil
+	}
+
+	sh.Lock()
+	defer sh.Unlock()
+	return sh.put(name, mtype, value, delta, now)
+}
+
+// put - записывает метрику в сегмент, создавая серию при необходимости. Вызывается под блокировкой на запись.
+func (sh *shard) put(name, mtype string, value float64, delta int64, now time.Time) error {
+	s, ok := sh.series[name]
+	if !ok {
+		s = &series{mtype: mtype}
+		sh.series[name] = s
+	}
+	if s.mtype != mtype {
+		return repositories.TypeConflictError(name, mtype, s.mtype)
+	}
+	s.apply(value, delta, now)
+	return nil
+}
+
+// GetMetric - реализует метод GetMetric интерфейса repositories.MetricsReader.
+func (storage *ShardedStorage) GetMetric(_ context.Context, metricType, name string) (string, error) {
+	if metricType != "gauge" && metricType != "counter" {
+		return "", fmt.Errorf("whrong type of metric")
+	}
+	sh := storage.shard(name)
+	sh.RLock()
+	s, ok := sh.series[name]
+	sh.RUnlock()
+	if !ok || s.mtype != metricType {
+		return "", fmt.Errorf("metric %s of type %s not found", name, metricType)
+	}
+	if metricType == "gauge" {
+		return fmt.Sprintf("%g", math.Float64frombits(s.bits.Load())), nil
+	}
+	return fmt.Sprintf("%d", s.delta.Load()), nil
+}
+
+// snapshot - возвращает серии всех сегментов. Каждый сегмент блокируется на чтение только на время
+// копирования ссылок на серии, значения серий читаются после снятия блокировки.
+func (storage *ShardedStorage) snapshot() (names []string, all []*series) {
+	size := 0
+	for _, sh := range storage.shards {
+		sh.RLock()
+		size += len(sh.series)
+		sh.RUnlock()
+	}
+	names = make([]string, 0, size)
+	all = make([]*series, 0, size)
+	for _, sh := range storage.shards {
+		sh.RLock()
+		for name, s := range sh.series {
+			names = append(names, name)
+			all = append(all, s)
+		}
+		sh.RUnlock()
+	}
+	return names, all
+}
+
+// GetAllMetrics - реализует метод GetAllMetrics интерфейса repositories.MetricsReader.
+func (storage *ShardedStorage) GetAllMetrics(_ context.Context) (string, error) {
+	names, all := storage.snapshot()
+	var result strings.Builder
+	for i, s := range all {
+		if s.mtype == "gauge" {
+			fmt.Fprintf(&result, "%s: %g\n", names[i], math.Float64frombits(s.bits.Load()))
+		}
+	}
+	for i, s := range all {
+		if s.mtype == "counter" {
+			fmt.Fprintf(&result, "%s: %d\n", names[i], s.delta.Load())
+		}
+	}
+	return result.String(), nil
+}
+
+// GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.MetricsReader.
+func (storage *ShardedStorage) GetAllMetricsSlice(_ context.Context) ([]repositories.Metric, error) {
+	names, all := storage.snapshot()
+	result := make([]repositories.Metric, 0, len(all))
+	for i, s := range all {
+		result = append(result, s.metric(names[i]))
+	}
+	return result, nil
+}
+
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+func (storage *ShardedStorage) ListMetrics(ctx context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	metrics, err := storage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	return repositories.ListSlice(metrics, opts), nil
+}
+
+// lockShards - блокирует на запись сегменты метрик в порядке номеров сегментов и возвращает функцию
+// снятия блокировок.
+func (storage *ShardedStorage) lockShards(metrics []repositories.Metric) func() {
+	indexes := make(map[int]struct{}, len(metrics))
+	for _, metric := range metrics {
+		indexes[storage.shardIndex(metric.ID)] = struct{}{}
+	}
+	ordered := make([]int, 0, len(indexes))
+	for index := range indexes {
+		ordered = append(ordered, index)
+	}
+	sort.Ints(ordered)
+	for _, index := range ordered {
+		storage.shards[index].Lock()
+	}
+	return func() {
+		for _, index := range ordered {
+			storage.shards[index].Unlock()
+		}
+	}
+}
+
+// AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.MetricsWriter.
+// Метрики добавляются атомарно: некорректная метрика или конфликт типов отклоняют весь слайс.
+func (storage *ShardedStorage) AddMetricsFromSlice(_ context.Context, metrics []repositories.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	for _, metric := range metrics {
+		switch metric.MType {
+		case "gauge":
+			if metric.Value == nil {
+				return fmt.Errorf("invalid metric, value of gauge metric is nil")
+			}
+		case "counter":
+			if metric.Delta == nil {
+				return fmt.Errorf("invalid metric, delta of counter metric is nil")
+			}
+		default:
+			return fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
+		}
+	}
+
+	unlock := storage.lockShards(metrics)
+	defer unlock()
+
+	// типы метрик слайса, чтобы найти конфликт типов и внутри самого слайса
+	types := make(map[string]string, len(metrics))
+	for _, metric := range metrics {
+		stored, ok := types[metric.ID]
+		if !ok {
+			stored = metric.MType
+			if s, exists := storage.shard(metric.ID).series[metric.ID]; exists {
+				stored = s.mtype
+			}
+			types[metric.ID] = stored
+		}
+		if stored != metric.MType {
+			return repositories.TypeConflictError(metric.ID, metric.MType, stored)
+		}
+	}
+
+	now := storage.now()
+	for _, metric := range metrics {
+		// конфликты типов проверены выше
+		value, delta := values(metric)
+		_ = storage.shard(metric.ID).put(metric.ID, metric.MType, value, delta, now)
+	}
+	return nil
+}
+
+// Replace - заменяет все метрики хранилища метриками из слайса. Значения метрик counter не суммируются,
+// а устанавливаются. Метрики с некорректным типом или без значения пропускаются.
+func (storage *ShardedStorage) Replace(metrics []repositories.Metric) {
+	fresh := make([]map[string]*series, len(storage.shards))
+	for i := range fresh {
+		fresh[i] = make(map[string]*series)
+	}
+	now := storage.now()
+	for _, metric := range metrics {
+		if (metric.MType != "gauge" || metric.Value == nil) && (metric.MType != "counter" || metric.Delta == nil) {
+			continue
+		}
+		s := &series{mtype: metric.MType}
+		value, delta := values(metric)
+		s.apply(value, delta, now)
+		fresh[storage.shardIndex(metric.ID)][metric.ID] = s
+	}
+
+	for _, sh := range storage.shards {
+		sh.Lock()
+	}
+	for i, sh := range storage.shards {
+		sh.series = fresh[i]
+	}
+	for _, sh := range storage.shards {
+		sh.Unlock()
+	}
+}
+
+// ReplaceMetrics - реализует метод ReplaceMetrics интерфейса repositories.MetricsReplacer.
+// Некорректная метрика отклоняет весь слайс, и хранилище не изменяется.
+func (storage *ShardedStorage) ReplaceMetrics(_ context.Context, metrics []repositories.Metric) error {
+	if err := repositories.ValidateReplacement(metrics); err != nil {
+		return err
+	}
+	storage.Replace(metrics)
+	return nil
+}
+
+// Bootstrap - реализует метод Bootstrap интерфейса repositories.StorageStarter.
+func (storage *ShardedStorage) Bootstrap(_ context.Context) error {
+	return nil
+}
+
+// Clean - очищает хранилище от данных.
+func (storage *ShardedStorage) Clean(_ context.Context) {
+	storage.Replace(nil)
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+func (storage *ShardedStorage) DeleteMetrics(_ context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	return storage.deleteIf(func(mtype, name string, _ time.Time) bool {
+		return filter.Match(mtype, name)
+	}), nil
+}
+
+// ExpireMetrics - реализует метод ExpireMetrics интерфейса repositories.MetricsDeleter.
+func (storage *ShardedStorage) ExpireMetrics(_ context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	if !ttl.Enabled() {
+		return nil, nil
+	}
+	now := storage.now()
+	return storage.deleteIf(func(mtype, name string, updated time.Time) bool {
+		return ttl.Expired(mtype, name, updated, now)
+	}), nil
+}
+
+// deleteIf - удаляет метрики, для которых функция match возвращает true, и возвращает удаленные метрики.
+// Сегменты блокируются по очереди.
+func (storage *ShardedStorage) deleteIf(match func(mtype, name string, updated time.Time) bool) []repositories.Metric {
+	deleted := make([]repositories.Metric, 0)
+	for _, sh := range storage.shards {
+		sh.Lock()
+		for name, s := range sh.series {
+			if !match(s.mtype, name, time.Unix(0, s.updated.Load())) {
+				continue
+			}
+			deleted = append(deleted, s.metric(name))
+			delete(sh.series, name)
+		}
+		sh.Unlock()
+	}
+	return deleted
+}
+
+// GetAllTimedMetrics - реализует метод GetAllTimedMetrics интерфейса repositories.TimedMetricsReader.
+func (storage *ShardedStorage) GetAllTimedMetrics(_ context.Context) ([]repositories.TimedMetric, error) {
+	names, all := storage.snapshot()
+	result := make([]repositories.TimedMetric, 0, len(all))
+	for i, s := range all {
+		updated := time.Unix(0, s.updated.Load())
+		result = append(result, repositories.TimedMetric{Metric: s.metric(names[i]), Updated: &updated})
+	}
+	return result, nil
+}
+
+// AddTimedMetrics - реализует метод AddTimedMetrics интерфейса repositories.TimedMetricsWriter.
+// Метрики без времени обновления считаются обновленными в момент добавления.
+func (storage *ShardedStorage) AddTimedMetrics(ctx context.Context, metrics []repositories.TimedMetric) error {
+	for _, metric := range metrics {
+		if err := storage.AddMetricsFromSlice(ctx, []repositories.Metric{metric.Metric}); err != nil {
+			return err
+		}
+		if metric.Updated == nil {
+			continue
+		}
+		sh := storage.shard(metric.ID)
+		sh.RLock()
+		if s, ok := sh.series[metric.ID]; ok {
+			s.updated.Store(metric.Updated.UnixNano())
+		}
+		sh.RUnlock()
+	}
+	return nil
+}
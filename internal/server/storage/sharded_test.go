@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
+)
+
+func TestShardedStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(_ *testing.T) repositories.IStorage {
+		return NewShardedStorage(4)
+	})
+}
+
+func TestShardedStorage_GetMetric(t *testing.T) {
+	ctx := context.Background()
+	stor := NewShardedStorage(0)
+	assert.Len(t, stor.shards, DefaultShards)
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 12.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 4))
+
+	tests := []struct {
+		name    string
+		mtype   string
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{name: "gauge", mtype: "gauge", id: "Alloc", want: "12.5"},
+		{name: "counter", mtype: "counter", id: "PollCount", want: "7"},
+		{name: "other type", mtype: "counter", id: "Alloc", wantErr: true},
+		{name: "unknown metric", mtype: "gauge", id: "unknown", wantErr: true},
+		{name: "unknown type", mtype: "histogram", id: "Alloc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stor.GetMetric(ctx, tt.mtype, tt.id)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	all, err := stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "Alloc: 12.5\nPollCount: 7\n", all)
+}
+
+func TestShardedStorage_Replace(t *testing.T) {
+	ctx := context.Background()
+	stor := NewShardedStorage(4)
+	require.NoError(t, stor.AddGauge(ctx, "stale", 1))
+	require.NoError(t, stor.AddCounter(ctx, "requests", 100))
+
+	value := 2.5
+	delta := int64(7)
+	stor.Replace([]repositories.Metric{
+		{ID: "temp", MType: "gauge", Value: &value},
+		{ID: "requests", MType: "counter", Delta: &delta},
+		{ID: "broken", MType: "gauge"},
+	})
+
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	got, err := stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "7", got)
+
+	stor.Clean(ctx)
+	metrics, err = stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+func TestShardedStorage_TimedMetrics(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stor := NewShardedStorage(4)
+	stor.now = func() time.Time { return now }
+
+	updated := now.Add(-time.Hour)
+	value := 1.5
+	delta := int64(2)
+	require.NoError(t, stor.AddTimedMetrics(ctx, []repositories.TimedMetric{
+		{Metric: repositories.Metric{ID: "gauge", MType: "gauge", Value: &value}, Updated: &updated},
+		{Metric: repositories.Metric{ID: "counter", MType: "counter", Delta: &delta}},
+	}))
+
+	metrics, err := stor.GetAllTimedMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	for _, m := range metrics {
+		require.NotNil(t, m.Updated)
+		if m.MType == "gauge" {
+			assert.True(t, updated.Equal(*m.Updated))
+		} else {
+			assert.True(t, now.Equal(*m.Updated))
+		}
+	}
+
+	expired, err := stor.ExpireMetrics(ctx, repositories.TTL{Gauge: 30 * time.Minute})
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "gauge", expired[0].ID)
+}
+
+func TestShardedStorage_Distribution(t *testing.T) {
+	stor := NewShardedStorage(8)
+	counts := make([]int, 8)
+	for i := 0; i < 8000; i++ {
+		counts[stor.shardIndex(fmt.Sprintf("metric.%d", i))]++
+	}
+	for _, count := range counts {
+		assert.InDelta(t, 1000, count, 200)
+	}
+}
+
+func TestShardedStorage_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	stor := NewShardedStorage(4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				assert.NoError(t, stor.AddCounter(ctx, "requests", 1))
+				assert.NoError(t, stor.AddGauge(ctx, fmt.Sprintf("gauge.%d", j%20), float64(worker)))
+				delta := int64(1)
+				assert.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+					{ID: "batch", MType: "counter", Delta: &delta},
+					{ID: fmt.Sprintf("batch.%d", j%10), MType: "counter", Delta: &delta},
+				}))
+				if j%50 == 0 {
+					all, err := stor.GetAllMetrics(ctx)
+					assert.NoError(t, err)
+					assert.True(t, strings.Contains(all, "requests"))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	got, err := stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "1600", got)
+	got, err = stor.GetMetric(ctx, "counter", "batch")
+	require.NoError(t, err)
+	assert.Equal(t, "1600", got)
+}
@@ -4,7 +4,9 @@ package storage
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
 )
@@ -16,14 +18,16 @@ type MemStorage struct {
 	sync.Mutex
 	gauges   map[string]float64
 	counters map[string]int64
+
+	// время последнего обновления метрик, используется для удаления устаревших метрик
+	gaugesUpdated   map[string]time.Time
+	countersUpdated map[string]time.Time
+	now             func() time.Time
 }
 
 // NewDefaultMemStorage - фабричная функция для создания структуры MemStorage с параметрами по умолчанию.
 func NewDefaultMemStorage() *MemStorage {
-	return &MemStorage{
-		gauges:   make(map[string]float64),
-		counters: make(map[string]int64),
-	}
+	return NewMemStorage(nil, nil)
 }
 
 // NewDefaultMemStorage - фабричная функция для создания структуры MemStorage с принятыми параметрами.
@@ -34,28 +38,77 @@ func NewMemStorage(gaugesArg map[string]float64, countersArg map[string]int64) *
 	if countersArg == nil {
 		countersArg = make(map[string]int64)
 	}
-	return &MemStorage{
-		gauges:   gaugesArg,
-		counters: countersArg,
+	storage := &MemStorage{
+		gauges:          gaugesArg,
+		counters:        countersArg,
+		gaugesUpdated:   make(map[string]time.Time, len(gaugesArg)),
+		countersUpdated: make(map[string]time.Time, len(countersArg)),
+		now:             time.Now,
+	}
+	// время обновления переданных метрик считается равным времени создания хранилища
+	now := storage.now()
+	for name := range gaugesArg {
+		storage.gaugesUpdated[name] = now
 	}
+	for name := range countersArg {
+		storage.countersUpdated[name] = now
+	}
+	return storage
 }
 
 // AddGauge - реализует метод AddGauge интерфейса repositories.ServerRepo.
+// Метрика не добавляется, если ее имя занято метрикой типа counter.
 func (storage *MemStorage) AddGauge(_ context.Context, name string, guage float64) error {
 	storage.Mutex.Lock()
 	defer storage.Mutex.Unlock()
-	storage.gauges[name] = guage
+	if _, ok := storage.counters[name]; ok {
+		return repositories.TypeConflictError(name, "gauge", "counter")
+	}
+	storage.addGauge(name, guage)
 	return nil
 }
 
+// addGauge - записывает значение метрики типа gauge. Вызывается под блокировкой.
+func (storage *MemStorage) addGauge(name string, guage float64) {
+	storage.gauges[name] = guage
+	storage.touch(&storage.gaugesUpdated, name)
+}
+
 // AddCounter - реализует метод AddCounter интерфейса repositories.ServerRepo.
+// Метрика не добавляется, если ее имя занято метрикой типа gauge.
 func (storage *MemStorage) AddCounter(_ context.Context, name string, counter int64) error {
 	storage.Mutex.Lock()
 	defer storage.Mutex.Unlock()
-	storage.counters[name] += counter
+	if _, ok := storage.gauges[name]; ok {
+		return repositories.TypeConflictError(name, "counter", "gauge")
+	}
+	storage.addCounter(name, counter)
 	return nil
 }
 
+// addCounter - увеличивает значение метрики типа counter. Вызывается под блокировкой.
+func (storage *MemStorage) addCounter(name string, counter int64) {
+	storage.counters[name] += counter
+	storage.touch(&storage.countersUpdated, name)
+}
+
+// touch - запоминает время обновления метрики. Вызывается под блокировкой.
+// Учитывает хранилища, созданные без фабричной функции.
+func (storage *MemStorage) touch(updated *map[string]time.Time, name string) {
+	if *updated == nil {
+		*updated = make(map[string]time.Time)
+	}
+	(*updated)[name] = storage.clock()
+}
+
+// clock - возвращает текущее время хранилища.
+func (storage *MemStorage) clock() time.Time {
+	if storage.now == nil {
+		return time.Now()
+	}
+	return storage.now()
+}
+
 // GetMetric - реализует метод GetMetric интерфейса repositories.ServerRepo.
 func (storage *MemStorage) GetMetric(_ context.Context, metricType, name string) (string, error) {
 	storage.Mutex.Lock()
@@ -84,15 +137,15 @@ func (storage *MemStorage) GetAllMetrics(_ context.Context) (string, error) {
 	storage.Mutex.Lock()
 	defer storage.Mutex.Unlock()
 
-	var result string
+	var result strings.Builder
 	for name, val := range storage.gauges {
-		result += fmt.Sprintf("%s: %g\n", name, val)
+		fmt.Fprintf(&result, "%s: %g\n", name, val)
 	}
 
 	for name, val := range storage.counters {
-		result += fmt.Sprintf("%s: %d\n", name, val)
+		fmt.Fprintf(&result, "%s: %d\n", name, val)
 	}
-	return result, nil
+	return result.String(), nil
 }
 
 // GetAllMetricsSlice - реализует метод GetAllMetricsSlice интерфейса repositories.ServerRepo.
@@ -120,34 +173,99 @@ func (storage *MemStorage) GetAllMetricsSlice(_ context.Context) ([]repositories
 	return result, nil
 }
 
+// ListMetrics - реализует метод ListMetrics интерфейса repositories.MetricsReader.
+func (storage *MemStorage) ListMetrics(ctx context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	metrics, err := storage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	return repositories.ListSlice(metrics, opts), nil
+}
+
 // AddMetricsFromSlice - реализует метод AddMetricsFromSlice интерфейса repositories.ServerRepo.
-func (storage *MemStorage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+// Метрики добавляются атомарно: некорректная метрика или конфликт типов отклоняют весь слайс.
+func (storage *MemStorage) AddMetricsFromSlice(_ context.Context, metrics []repositories.Metric) error {
 	if metrics == nil {
 		return nil
 	}
 
+	storage.Mutex.Lock()
+	defer storage.Mutex.Unlock()
+
+	// типы метрик слайса, чтобы найти конфликт типов и внутри самого слайса
+	types := make(map[string]string, len(metrics))
 	for _, metric := range metrics {
 		switch metric.MType {
 		case "gauge":
 			if metric.Value == nil {
 				return fmt.Errorf("invalid metric, value of gauge metric is nil")
 			}
-			err := storage.AddGauge(ctx, metric.ID, *metric.Value)
-			if err != nil {
-				return fmt.Errorf("add gauge error: %f", err)
+			if _, ok := storage.counters[metric.ID]; ok {
+				return repositories.TypeConflictError(metric.ID, "gauge", "counter")
 			}
 		case "counter":
 			if metric.Delta == nil {
 				return fmt.Errorf("invalid metric, delta of counter metric is nil")
 			}
-			err := storage.AddCounter(ctx, metric.ID, *metric.Delta)
-			if err != nil {
-				return fmt.Errorf("add counter error: %f", err)
+			if _, ok := storage.gauges[metric.ID]; ok {
+				return repositories.TypeConflictError(metric.ID, "counter", "gauge")
 			}
 		default:
 			return fmt.Errorf("invalid metric, undefined type of metric: %s", metric.MType)
 		}
+		if mtype, ok := types[metric.ID]; ok && mtype != metric.MType {
+			return repositories.TypeConflictError(metric.ID, metric.MType, mtype)
+		}
+		types[metric.ID] = metric.MType
+	}
+
+	for _, metric := range metrics {
+		if metric.MType == "gauge" {
+			storage.addGauge(metric.ID, *metric.Value)
+		} else {
+			storage.addCounter(metric.ID, *metric.Delta)
+		}
+	}
+	return nil
+}
+
+// Replace - заменяет все метрики хранилища метриками из слайса. Значения метрик counter не суммируются,
+// а устанавливаются. Метрики с некорректным типом или без значения пропускаются.
+func (storage *MemStorage) Replace(metrics []repositories.Metric) {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	for _, metric := range metrics {
+		switch {
+		case metric.MType == "gauge" && metric.Value != nil:
+			gauges[metric.ID] = *metric.Value
+		case metric.MType == "counter" && metric.Delta != nil:
+			counters[metric.ID] = *metric.Delta
+		}
+	}
+
+	storage.Mutex.Lock()
+	defer storage.Mutex.Unlock()
+
+	now := storage.clock()
+	gaugesUpdated := make(map[string]time.Time, len(gauges))
+	for name := range gauges {
+		gaugesUpdated[name] = now
+	}
+	countersUpdated := make(map[string]time.Time, len(counters))
+	for name := range counters {
+		countersUpdated[name] = now
 	}
+	storage.gauges, storage.counters = gauges, counters
+	storage.gaugesUpdated, storage.countersUpdated = gaugesUpdated, countersUpdated
+}
+
+// ReplaceMetrics - реализует метод ReplaceMetrics интерфейса repositories.MetricsReplacer.
+// Некорректная метрика отклоняет весь слайс, и хранилище не изменяется.
+func (storage *MemStorage) ReplaceMetrics(_ context.Context, metrics []repositories.Metric) error {
+	if err := repositories.ValidateReplacement(metrics); err != nil {
+		return err
+	}
+	storage.Replace(metrics)
 	return nil
 }
 
@@ -158,8 +276,105 @@ func (storage *MemStorage) Bootstrap(_ context.Context) error {
 
 // Clean - очищает хранилище от данных.
 func (storage *MemStorage) Clean(_ context.Context) {
+	storage.Mutex.Lock()
+	defer storage.Mutex.Unlock()
+
 	storage.counters = map[string]int64{}
 	storage.gauges = map[string]float64{}
+	storage.gaugesUpdated = map[string]time.Time{}
+	storage.countersUpdated = map[string]time.Time{}
+}
+
+// DeleteMetrics - реализует метод DeleteMetrics интерфейса repositories.MetricsDeleter.
+func (storage *MemStorage) DeleteMetrics(_ context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	storage.Mutex.Lock()
+	defer storage.Mutex.Unlock()
+
+	return storage.deleteIf(func(mtype, name string, _ time.Time) bool {
+		return filter.Match(mtype, name)
+	}), nil
+}
+
+// ExpireMetrics - реализует метод ExpireMetrics интерфейса repositories.MetricsDeleter.
+func (storage *MemStorage) ExpireMetrics(_ context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	if !ttl.Enabled() {
+		return nil, nil
+	}
+
+	storage.Mutex.Lock()
+	defer storage.Mutex.Unlock()
+
+	now := storage.clock()
+	return storage.deleteIf(func(mtype, name string, updated time.Time) bool {
+		return ttl.Expired(mtype, name, updated, now)
+	}), nil
+}
+
+// deleteIf - удаляет метрики, для которых функция match возвращает true, и возвращает удаленные метрики.
+// Вызывается под блокировкой.
+func (storage *MemStorage) deleteIf(match func(mtype, name string, updated time.Time) bool) []repositories.Metric {
+	deleted := make([]repositories.Metric, 0)
+	for name, value := range storage.gauges {
+		if !match("gauge", name, storage.gaugesUpdated[name]) {
+			continue
+		}
+		deleted = append(deleted, repositories.Metric{ID: name, MType: "gauge", Value: &value})
+		delete(storage.gauges, name)
+		delete(storage.gaugesUpdated, name)
+	}
+	for name, delta := range storage.counters {
+		if !match("counter", name, storage.countersUpdated[name]) {
+			continue
+		}
+		deleted = append(deleted, repositories.Metric{ID: name, MType: "counter", Delta: &delta})
+		delete(storage.counters, name)
+		delete(storage.countersUpdated, name)
+	}
+	return deleted
+}
+
+// GetAllTimedMetrics - реализует метод GetAllTimedMetrics интерфейса repositories.TimedMetricsReader.
+func (storage *MemStorage) GetAllTimedMetrics(_ context.Context) ([]repositories.TimedMetric, error) {
+	storage.Mutex.Lock()
+	defer storage.Mutex.Unlock()
+
+	result := make([]repositories.TimedMetric, 0, len(storage.gauges)+len(storage.counters))
+	for name, value := range storage.gauges {
+		updated := storage.gaugesUpdated[name]
+		result = append(result, repositories.TimedMetric{
+			Metric:  repositories.Metric{ID: name, MType: "gauge", Value: &value},
+			Updated: &updated,
+		})
+	}
+	for name, delta := range storage.counters {
+		updated := storage.countersUpdated[name]
+		result = append(result, repositories.TimedMetric{
+			Metric:  repositories.Metric{ID: name, MType: "counter", Delta: &delta},
+			Updated: &updated,
+		})
+	}
+	return result, nil
+}
+
+// AddTimedMetrics - реализует метод AddTimedMetrics интерфейса repositories.TimedMetricsWriter.
+// Метрики без времени обновления считаются обновленными в момент добавления.
+func (storage *MemStorage) AddTimedMetrics(ctx context.Context, metrics []repositories.TimedMetric) error {
+	for _, metric := range metrics {
+		if err := storage.AddMetricsFromSlice(ctx, []repositories.Metric{metric.Metric}); err != nil {
+			return err
+		}
+		if metric.Updated == nil {
+			continue
+		}
+		storage.Mutex.Lock()
+		if metric.MType == "gauge" {
+			storage.gaugesUpdated[metric.ID] = *metric.Updated
+		} else {
+			storage.countersUpdated[metric.ID] = *metric.Updated
+		}
+		storage.Mutex.Unlock()
+	}
+	return nil
 }
 
 // Хранилище метрик -----------------------------------------------------------------------------------------
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
 )
 
 func TestNewDefaultMemStorage(t *testing.T) {
@@ -361,3 +363,136 @@ func TestAddMetricsFromSlice(t *testing.T) {
 	}})
 	require.Error(t, err)
 }
+
+func TestMemStorage_DeleteMetrics(t *testing.T) {
+	ctx := context.Background()
+	stor := NewMemStorage(
+		map[string]float64{"cpu;host=a": 1, "cpu;host=b": 2, "Alloc": 3},
+		map[string]int64{"cpu;host=a": 4, "PollCount": 5},
+	)
+
+	deleted, err := stor.DeleteMetrics(ctx, repositories.MetricFilter{MType: "gauge", ID: "Alloc"})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "Alloc", deleted[0].ID)
+	assert.Equal(t, 3.0, *deleted[0].Value)
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	assert.Len(t, deleted, 2)
+
+	deleted, err = stor.DeleteMetrics(ctx, repositories.MetricFilter{ID: "unknown"})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	_, err = stor.GetMetric(ctx, "gauge", "cpu;host=b")
+	assert.NoError(t, err)
+	_, err = stor.GetMetric(ctx, "counter", "PollCount")
+	assert.NoError(t, err)
+}
+
+func TestMemStorage_ExpireMetrics(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stor := NewDefaultMemStorage()
+	stor.now = func() time.Time { return now }
+
+	require.NoError(t, stor.AddGauge(ctx, "old", 1))
+	require.NoError(t, stor.AddCounter(ctx, "old.counter", 1))
+	require.NoError(t, stor.AddGauge(ctx, "host.cpu", 1))
+	now = now.Add(10 * time.Minute)
+	require.NoError(t, stor.AddGauge(ctx, "fresh", 1))
+
+	// время жизни не задано
+	expired, err := stor.ExpireMetrics(ctx, repositories.TTL{})
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	ttl := repositories.TTL{
+		Gauge:   5 * time.Minute,
+		Metrics: map[string]time.Duration{"host.*": time.Hour},
+	}
+	expired, err = stor.ExpireMetrics(ctx, ttl)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "old", expired[0].ID)
+	assert.Equal(t, "gauge", expired[0].MType)
+
+	_, err = stor.GetMetric(ctx, "counter", "old.counter")
+	assert.NoError(t, err, "counter ttl is not set")
+	_, err = stor.GetMetric(ctx, "gauge", "host.cpu")
+	assert.NoError(t, err)
+
+	// обновление метрики продлевает время ее жизни
+	require.NoError(t, stor.AddGauge(ctx, "host.cpu", 2))
+	now = now.Add(55 * time.Minute)
+	expired, err = stor.ExpireMetrics(ctx, ttl)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, "fresh", expired[0].ID)
+}
+
+func TestMemStorage_TimedMetrics(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stor := NewDefaultMemStorage()
+	stor.now = func() time.Time { return now }
+
+	updated := now.Add(-time.Hour)
+	value := 1.5
+	delta := int64(2)
+	require.NoError(t, stor.AddTimedMetrics(ctx, []repositories.TimedMetric{
+		{Metric: repositories.Metric{ID: "gauge", MType: "gauge", Value: &value}, Updated: &updated},
+		{Metric: repositories.Metric{ID: "counter", MType: "counter", Delta: &delta}},
+	}))
+
+	metrics, err := stor.GetAllTimedMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	for _, m := range metrics {
+		require.NotNil(t, m.Updated)
+		if m.MType == "gauge" {
+			assert.Equal(t, updated, *m.Updated)
+		} else {
+			assert.Equal(t, now, *m.Updated)
+		}
+	}
+}
+
+func TestMemStorage_Replace(t *testing.T) {
+	ctx := context.Background()
+	stor := NewDefaultMemStorage()
+	require.NoError(t, stor.AddGauge(ctx, "stale", 1))
+	require.NoError(t, stor.AddCounter(ctx, "requests", 100))
+
+	value := 2.5
+	delta := int64(7)
+	stor.Replace([]repositories.Metric{
+		{ID: "temp", MType: "gauge", Value: &value},
+		{ID: "requests", MType: "counter", Delta: &delta},
+		{ID: "broken", MType: "gauge"},
+		{ID: "unknown", MType: "histogram", Value: &value},
+	})
+
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+
+	got, err := stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "7", got)
+	got, err = stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "2.5", got)
+	_, err = stor.GetMetric(ctx, "gauge", "stale")
+	assert.Error(t, err)
+}
+
+func TestMemStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(_ *testing.T) repositories.IStorage {
+		return NewDefaultMemStorage()
+	})
+}
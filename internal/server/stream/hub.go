@@ -0,0 +1,197 @@
+// Package stream рассылает подписчикам принятые сервером записи метрик. Обертка над хранилищем публикует
+// каждую успешную запись в хаб, а хаб хранит последние события, чтобы подписчик после переподключения
+// мог получить пропущенные события по номеру последнего полученного события.
+package stream
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Значения настроек по умолчанию.
+const (
+	DefaultBufferSize = 1000             // количество последних событий, хранимых для возобновления подписки
+	DefaultHeartbeat  = 15 * time.Second // период отправки подписчику пустых сообщений при отсутствии событий
+
+	// subscriberBuffer - количество событий, которые подписчик может не забрать, прежде чем будет отключен.
+	subscriberBuffer = 256
+)
+
+// Event - событие записи метрики.
+type Event struct {
+	ID     uint64              // номер события, возрастает на единицу с каждым событием
+	Time   time.Time           // время записи
+	Metric repositories.Metric // записанная метрика: для counter - принятое приращение
+}
+
+// Subscription - подписка на события хаба. Канал C закрывается, когда подписка отменена или подписчик
+// не успевает забирать события.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	filter repositories.MetricFilter
+	hub    *Hub
+}
+
+// Close - отменяет подписку.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub - рассылает события записи метрик подписчикам и хранит последние события.
+type Hub struct {
+	mu     sync.Mutex
+	events []Event // кольцевой буфер последних событий
+	next   int     // позиция в буфере для следующего события
+	lastID uint64
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub - фабричная функция структуры Hub. size - количество последних событий, хранимых для возобновления
+// подписки, 0 отключает возобновление.
+func NewHub(size int) *Hub {
+	return &Hub{
+		events: make([]Event, 0, size),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish - рассылает подписчикам события записи метрик. Подписчик, не успевающий забирать события,
+// отключается и может возобновить подписку с последнего полученного события.
+func (h *Hub) Publish(metrics ...repositories.Metric) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, metric := range metrics {
+		h.lastID++
+		event := Event{ID: h.lastID, Time: now, Metric: metric}
+		if cap(h.events) > 0 {
+			if len(h.events) < cap(h.events) {
+				h.events = append(h.events, event)
+			} else {
+				h.events[h.next] = event
+			}
+			h.next = (h.next + 1) % cap(h.events)
+		}
+		for sub := range h.subs {
+			if !sub.filter.Match(metric.MType, metric.ID) {
+				continue
+			}
+			select {
+			case sub.c <- event:
+			default:
+				h.remove(sub)
+			}
+		}
+	}
+}
+
+// Subscribe - подписывается на события, удовлетворяющие фильтру. Если after больше нуля, возвращает также
+// хранимые события с номерами больше after. Признак lost равен true, если часть событий после after уже
+// удалена из буфера или номер after выдан до перезапуска сервера.
+func (h *Hub) Subscribe(filter repositories.MetricFilter, after uint64) (sub *Subscription, backlog []Event, lost bool) {
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c, filter: filter, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return sub, nil, false
+	}
+	h.subs[sub] = struct{}{}
+	if after == 0 {
+		return sub, nil, false
+	}
+
+	if after > h.lastID {
+		return sub, nil, true
+	}
+	stored := h.ordered()
+	lost = after < h.lastID && (len(stored) == 0 || stored[0].ID > after+1)
+	for _, event := range stored {
+		if event.ID > after && filter.Match(event.Metric.MType, event.Metric.ID) {
+			backlog = append(backlog, event)
+		}
+	}
+	return sub, backlog, lost
+}
+
+// LastID - возвращает номер последнего события.
+func (h *Hub) LastID() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID
+}
+
+// Close - отменяет все подписки и запрещает новые. События продолжают сохраняться в буфере.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		h.remove(sub)
+	}
+}
+
+// ordered - возвращает хранимые события в порядке возрастания номеров.
+func (h *Hub) ordered() []Event {
+	if len(h.events) < cap(h.events) {
+		return h.events
+	}
+	return append(append(make([]Event, 0, len(h.events)), h.events[h.next:]...), h.events[:h.next]...)
+}
+
+// remove - удаляет подписку и закрывает ее канал. Вызывается под блокировкой хаба.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	close(sub.c)
+}
+
+// Config - настройки потока событий.
+type Config struct {
+	BufferSize int           // количество последних событий, хранимых для возобновления подписки
+	Heartbeat  time.Duration // период отправки пустых сообщений при отсутствии событий
+}
+
+// Validate - проверяет настройки: размер буфера не может быть отрицательным, период пустых сообщений
+// должен быть положительным.
+func (c Config) Validate() error {
+	if c.BufferSize < 0 {
+		return fmt.Errorf("invalid stream buffer size %d, expected non-negative value", c.BufferSize)
+	}
+	if c.Heartbeat <= 0 {
+		return fmt.Errorf("invalid stream heartbeat %s, expected positive duration", c.Heartbeat)
+	}
+	return nil
+}
+
+var (
+	config = Config{BufferSize: DefaultBufferSize, Heartbeat: DefaultHeartbeat}
+	hub    = NewHub(DefaultBufferSize)
+)
+
+// SetConfig - устанавливает настройки потока событий и создает хаб с новым размером буфера.
+func SetConfig(c Config) {
+	config = c
+	hub = NewHub(c.BufferSize)
+}
+
+// GetConfig - возвращает настройки потока событий.
+func GetConfig() Config {
+	return config
+}
+
+// GetHub - возвращает хаб сервера.
+func GetHub() *Hub {
+	return hub
+}
@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+func gauge(name string, value float64) repositories.Metric {
+	return repositories.Metric{ID: name, MType: "gauge", Value: &value}
+}
+
+// ids - возвращает номера событий.
+func ids(events []Event) []uint64 {
+	var result []uint64
+	for _, event := range events {
+		result = append(result, event.ID)
+	}
+	return result
+}
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub(10)
+	all, _, _ := hub.Subscribe(repositories.MetricFilter{}, 0)
+	defer all.Close()
+	filtered, _, _ := hub.Subscribe(repositories.MetricFilter{Prefix: "go_"}, 0)
+	defer filtered.Close()
+
+	hub.Publish(gauge("Alloc", 1), gauge("go_heap", 2))
+
+	event := <-all.C
+	assert.Equal(t, uint64(1), event.ID)
+	assert.Equal(t, "Alloc", event.Metric.ID)
+	event = <-all.C
+	assert.Equal(t, uint64(2), event.ID)
+
+	event = <-filtered.C
+	assert.Equal(t, uint64(2), event.ID)
+	assert.Equal(t, "go_heap", event.Metric.ID)
+	assert.Empty(t, filtered.C)
+	assert.Equal(t, uint64(2), hub.LastID())
+}
+
+func TestHubResume(t *testing.T) {
+	hub := NewHub(3)
+	for i := 0; i < 5; i++ {
+		hub.Publish(gauge("Alloc", float64(i)))
+	}
+
+	tests := []struct {
+		name    string
+		after   uint64
+		backlog []uint64
+		lost    bool
+	}{
+		{name: "new subscription", after: 0, backlog: nil, lost: false},
+		{name: "stored events", after: 3, backlog: []uint64{4, 5}, lost: false},
+		{name: "oldest stored event", after: 2, backlog: []uint64{3, 4, 5}, lost: false},
+		{name: "up to date", after: 5, backlog: nil, lost: false},
+		{name: "events removed from buffer", after: 1, backlog: []uint64{3, 4, 5}, lost: true},
+		{name: "id from previous server run", after: 10, backlog: nil, lost: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, backlog, lost := hub.Subscribe(repositories.MetricFilter{}, tt.after)
+			defer sub.Close()
+			assert.Equal(t, tt.backlog, ids(backlog))
+			assert.Equal(t, tt.lost, lost)
+		})
+	}
+}
+
+func TestHubWithoutBuffer(t *testing.T) {
+	hub := NewHub(0)
+	hub.Publish(gauge("Alloc", 1), gauge("Alloc", 2))
+
+	sub, backlog, lost := hub.Subscribe(repositories.MetricFilter{}, 1)
+	defer sub.Close()
+	assert.Empty(t, backlog)
+	assert.True(t, lost)
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	hub := NewHub(0)
+	sub, _, _ := hub.Subscribe(repositories.MetricFilter{}, 0)
+	defer sub.Close()
+
+	// подписчик, не забирающий события, отключается и не задерживает публикацию
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Publish(gauge("Alloc", float64(i)))
+	}
+	received := 0
+	for range sub.C {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub(10)
+	sub, _, _ := hub.Subscribe(repositories.MetricFilter{}, 0)
+	hub.Close()
+
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	sub.Close()
+
+	// после закрытия хаба новые подписки сразу завершаются
+	late, _, _ := hub.Subscribe(repositories.MetricFilter{}, 0)
+	_, ok = <-late.C
+	require.False(t, ok)
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "defaults", cfg: Config{BufferSize: DefaultBufferSize, Heartbeat: DefaultHeartbeat}},
+		{name: "without buffer", cfg: Config{BufferSize: 0, Heartbeat: time.Second}},
+		{name: "negative buffer", cfg: Config{BufferSize: -1, Heartbeat: time.Second}, wantErr: true},
+		{name: "zero heartbeat", cfg: Config{BufferSize: 1}, wantErr: true},
+		{name: "negative heartbeat", cfg: Config{BufferSize: 1, Heartbeat: -time.Second}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
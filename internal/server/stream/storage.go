@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+)
+
+// Storage - обертка над хранилищем метрик, публикующая в хаб каждую успешную запись.
+type Storage struct {
+	repositories.IStorage
+	hub *Hub
+}
+
+// NewStorage - фабричная функция структуры Storage.
+func NewStorage(stor repositories.IStorage, hub *Hub) *Storage {
+	return &Storage{
+		IStorage: stor,
+		hub:      hub,
+	}
+}
+
+// AddGauge - добавляет метрику типа gauge и публикует ее значение.
+func (s *Storage) AddGauge(ctx context.Context, name string, value float64) error {
+	if err := s.IStorage.AddGauge(ctx, name, value); err != nil {
+		return err
+	}
+	s.hub.Publish(repositories.Metric{ID: name, MType: "gauge", Value: &value})
+	return nil
+}
+
+// AddCounter - добавляет метрику типа counter и публикует принятое приращение.
+func (s *Storage) AddCounter(ctx context.Context, name string, value int64) error {
+	if err := s.IStorage.AddCounter(ctx, name, value); err != nil {
+		return err
+	}
+	s.hub.Publish(repositories.Metric{ID: name, MType: "counter", Delta: &value})
+	return nil
+}
+
+// AddMetricsFromSlice - добавляет метрики из слайса и публикует их.
+func (s *Storage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	if err := s.IStorage.AddMetricsFromSlice(ctx, metrics); err != nil {
+		return err
+	}
+	s.hub.Publish(metrics...)
+	return nil
+}
+
+// ReplaceMetrics - заменяет все метрики хранилища метриками из слайса и публикует новые метрики.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	if err := repositories.ReplaceMetrics(ctx, s.IStorage, metrics); err != nil {
+		return err
+	}
+	s.hub.Publish(metrics...)
+	return nil
+}
@@ -0,0 +1,54 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	hub := NewHub(10)
+	stor := NewStorage(storage.NewDefaultMemStorage(), hub)
+	sub, _, _ := hub.Subscribe(repositories.MetricFilter{}, 0)
+	defer sub.Close()
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 2))
+	require.NoError(t, stor.AddCounter(ctx, "PollCount", 3))
+	delta := int64(4)
+	require.NoError(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		gauge("Heap", 7),
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	}))
+	require.NoError(t, stor.ReplaceMetrics(ctx, []repositories.Metric{gauge("Alloc", 9)}))
+
+	// для counter публикуется принятое приращение, а не накопленное значение
+	want := []string{
+		`{"id":"Alloc","type":"gauge","value":1.5}`,
+		`{"id":"PollCount","type":"counter","delta":2}`,
+		`{"id":"PollCount","type":"counter","delta":3}`,
+		`{"id":"Heap","type":"gauge","value":7}`,
+		`{"id":"PollCount","type":"counter","delta":4}`,
+		`{"id":"Alloc","type":"gauge","value":9}`,
+	}
+	for i, metric := range want {
+		event := <-sub.C
+		assert.Equal(t, uint64(i+1), event.ID)
+		got, err := json.Marshal(event.Metric)
+		require.NoError(t, err)
+		assert.JSONEq(t, metric, string(got))
+	}
+
+	// неудачная запись не публикуется
+	assert.Error(t, stor.AddCounter(ctx, "Alloc", 1))
+	assert.Error(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "Alloc", MType: "counter", Delta: &delta}}))
+	assert.Empty(t, sub.C)
+	assert.Equal(t, uint64(len(want)), hub.LastID())
+}
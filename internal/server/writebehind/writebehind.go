@@ -0,0 +1,642 @@
+// Package writebehind накапливает записываемые метрики в памяти и периодически сбрасывает их в хранилище
+// одним пакетом. Значения counter в буфере суммируются, для gauge остается последнее значение.
+// Чтение метрик объединяет значения хранилища с еще не сброшенными значениями буфера. Запись метрики,
+// имя которой занято метрикой другого типа в буфере или в хранилище, отклоняется сразу.
+package writebehind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/logger"
+)
+
+// ErrBufferFull - буфер заполнен и не освободился за время ожидания, например пока хранилище недоступно.
+var ErrBufferFull = errors.New("write-behind buffer is full")
+
+// Значения настроек буфера по умолчанию.
+const (
+	DefaultFlushSize  = 1000            // количество серий в буфере, при котором буфер сбрасывается досрочно
+	DefaultMaxPending = 10000           // максимальное количество серий в буфере
+	DefaultMaxWait    = 5 * time.Second // время ожидания освобождения буфера при записи
+)
+
+// Config - настройки буфера записи.
+type Config struct {
+	FlushInterval time.Duration // период сброса буфера в хранилище, 0 отключает буферизацию
+	FlushSize     int           // количество серий в буфере, при котором буфер сбрасывается досрочно
+	MaxPending    int           // максимальное количество серий в буфере, при достижении которого запись ожидает сброса
+	MaxWait       time.Duration // время ожидания освобождения буфера, после которого запись завершается ошибкой ErrBufferFull
+}
+
+// Enabled - проверяет, что буферизация записи включена.
+func (c Config) Enabled() bool {
+	return c.FlushInterval > 0
+}
+
+// config - настройки буфера записи, используемые сервером.
+var config = Config{
+	FlushSize:  DefaultFlushSize,
+	MaxPending: DefaultMaxPending,
+	MaxWait:    DefaultMaxWait,
+}
+
+// SetConfig - устанавливает настройки буфера записи.
+func SetConfig(c Config) {
+	config = c
+}
+
+// GetConfig - возвращает настройки буфера записи.
+func GetConfig() Config {
+	return config
+}
+
+// Storage - обертка над хранилищем, буферизующая запись метрик.
+type Storage struct {
+	repositories.IStorage
+	cfg Config
+
+	// flushMu захватывается на запись на время сброса буфера и удаления метрик, чтобы чтение
+	// не видело метрики, уже извлеченные из буфера, но еще не записанные в хранилище
+	flushMu sync.RWMutex
+
+	mu      sync.Mutex
+	pending map[string]repositories.Metric // несброшенные метрики по имени
+	updated map[string]time.Time           // время последней записи несброшенных метрик по имени
+	space   chan struct{}                  // закрывается, когда в буфере освобождается место
+
+	// types - типы метрик хранилища и буфера по имени, чтобы проверять конфликт типов без обращения
+	// к хранилищу при каждой записи. Загружается из хранилища при первой записи, nil - еще не загружен.
+	types map[string]string
+
+	onFlush func(ctx context.Context, metrics []repositories.Metric) // вызывается после записи метрик буфера в хранилище
+
+	kick      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewStorage - фабричная функция структуры Storage. Нулевые настройки FlushSize, MaxPending и MaxWait
+// заменяются значениями по умолчанию.
+func NewStorage(stor repositories.IStorage, cfg Config) *Storage {
+	if cfg.FlushSize <= 0 {
+		cfg.FlushSize = DefaultFlushSize
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = DefaultMaxPending
+	}
+	if cfg.MaxWait <= 0 {
+		cfg.MaxWait = DefaultMaxWait
+	}
+	return &Storage{
+		IStorage: stor,
+		cfg:      cfg,
+		pending:  make(map[string]repositories.Metric),
+		updated:  make(map[string]time.Time),
+		space:    make(chan struct{}),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// SetOnFlush - устанавливает функцию, которая вызывается с метриками, записанными в хранилище при сбросе
+// буфера, например для уведомления других экземпляров сервера об изменении метрик. Функцию необходимо
+// устанавливать до вызова Start.
+func (s *Storage) SetOnFlush(fn func(ctx context.Context, metrics []repositories.Metric)) {
+	s.onFlush = fn
+}
+
+// Start - запускает периодический сброс буфера в хранилище.
+func (s *Storage) Start() {
+	s.startOnce.Do(func() {
+		go s.run()
+	})
+}
+
+// Close - останавливает периодический сброс буфера и сбрасывает в хранилище оставшиеся метрики.
+func (s *Storage) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.startOnce.Do(func() {
+		close(s.done)
+	})
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.Flush(ctx)
+}
+
+// run - сбрасывает буфер по таймеру и при его заполнении до остановки.
+func (s *Storage) run() {
+	defer close(s.done)
+	logger.ServerLog.Debug("starting write-behind flush", zap.Duration("interval", s.cfg.FlushInterval))
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.kick:
+		}
+		if err := s.Flush(context.Background()); err != nil {
+			logger.ServerLog.Error("flush write-behind buffer error", zap.String("error", error.Error(err)))
+		}
+	}
+}
+
+// Pending - возвращает количество серий в буфере.
+func (s *Storage) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// AddGauge - добавляет метрику типа gauge в буфер.
+func (s *Storage) AddGauge(ctx context.Context, name string, value float64) error {
+	return s.add(ctx, []repositories.Metric{{ID: name, MType: "gauge", Value: &value}})
+}
+
+// AddCounter - добавляет метрику типа counter в буфер.
+func (s *Storage) AddCounter(ctx context.Context, name string, value int64) error {
+	return s.add(ctx, []repositories.Metric{{ID: name, MType: "counter", Delta: &value}})
+}
+
+// AddMetricsFromSlice - добавляет метрики из слайса в буфер. Метрики пакета добавляются все или ни одна.
+func (s *Storage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	return s.add(ctx, metrics)
+}
+
+// add - проверяет метрики и добавляет их в буфер. Если для новых серий нет места, ожидает сброса буфера
+// не дольше cfg.MaxWait.
+func (s *Storage) add(ctx context.Context, metrics []repositories.Metric) error {
+	for _, metric := range metrics {
+		if err := repositories.ValidateMetric(metric); err != nil {
+			return err
+		}
+	}
+	if err := s.loadTypes(ctx); err != nil {
+		return err
+	}
+
+	var timeout <-chan time.Time
+	for {
+		s.mu.Lock()
+		created, err := s.conflicts(metrics)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		// пустой буфер принимает пакет любого размера, иначе такой пакет никогда не был бы записан
+		if len(s.pending) == 0 || len(s.pending)+created <= s.cfg.MaxPending {
+			now := time.Now()
+			for _, metric := range metrics {
+				s.pending[metric.ID] = merge(s.pending[metric.ID], metric)
+				s.updated[metric.ID] = now
+				s.types[metric.ID] = metric.MType
+			}
+			full := len(s.pending) >= s.cfg.FlushSize
+			s.mu.Unlock()
+			if full {
+				s.requestFlush()
+			}
+			return nil
+		}
+		space := s.space
+		s.mu.Unlock()
+
+		s.requestFlush()
+		if timeout == nil {
+			timer := time.NewTimer(s.cfg.MaxWait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-space:
+		case <-timeout:
+			return ErrBufferFull
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrBufferFull, ctx.Err())
+		}
+	}
+}
+
+// loadTypes - загружает типы метрик хранилища, если они еще не загружены.
+func (s *Storage) loadTypes(ctx context.Context) error {
+	s.mu.Lock()
+	loaded := s.types != nil
+	s.mu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	// сброс буфера во время чтения не должен изменить хранилище
+	s.flushMu.RLock()
+	defer s.flushMu.RUnlock()
+	metrics, err := s.IStorage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return fmt.Errorf("load types of stored metrics error: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.types != nil {
+		return nil
+	}
+	s.types = make(map[string]string, len(metrics)+len(s.pending))
+	for _, metric := range metrics {
+		s.types[metric.ID] = metric.MType
+	}
+	for id, metric := range s.pending {
+		s.types[id] = metric.MType
+	}
+	return nil
+}
+
+// conflicts - проверяет, что типы метрик не расходятся с типами метрик хранилища, буфера и других метрик
+// пакета, и возвращает количество новых серий буфера. Вызывается под блокировкой mu.
+func (s *Storage) conflicts(metrics []repositories.Metric) (int, error) {
+	created := 0
+	types := make(map[string]string, len(metrics))
+	for _, metric := range metrics {
+		stored, seen := types[metric.ID]
+		if !seen {
+			stored = metric.MType
+			if known, exists := s.types[metric.ID]; exists {
+				stored = known
+			}
+			if _, exists := s.pending[metric.ID]; !exists {
+				created++
+			}
+			types[metric.ID] = stored
+		}
+		if stored != metric.MType {
+			return 0, repositories.TypeConflictError(metric.ID, metric.MType, stored)
+		}
+	}
+	return created, nil
+}
+
+// requestFlush - запрашивает досрочный сброс буфера.
+func (s *Storage) requestFlush() {
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// freeSpace - оповещает ожидающие запись горутины об освобождении буфера. Вызывается под блокировкой mu.
+func (s *Storage) freeSpace() {
+	close(s.space)
+	s.space = make(chan struct{})
+}
+
+// Flush - записывает накопленные метрики в хранилище. Метрики, которые не удалось записать из-за ошибки
+// хранилища, возвращаются в буфер для повторной попытки. Конфликт типов при сбросе возможен, только если
+// хранилище изменено в обход буфера, например другим экземпляром сервера; такие метрики остаются в буфере,
+// пока конфликтующая метрика не будет удалена.
+func (s *Storage) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	return s.flush(ctx)
+}
+
+// flush - записывает накопленные метрики в хранилище. Вызывается под блокировкой flushMu на запись.
+func (s *Storage) flush(ctx context.Context) error {
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	batch, updated := s.pending, s.updated
+	s.pending = make(map[string]repositories.Metric)
+	s.updated = make(map[string]time.Time)
+	s.mu.Unlock()
+
+	metrics := sorted(batch)
+	err := s.IStorage.AddMetricsFromSlice(ctx, metrics)
+	var failed []repositories.Metric
+	switch {
+	case err == nil:
+	case errors.Is(err, repositories.ErrTypeConflict):
+		// пакет отклонен целиком, поэтому метрики записываются по одной, чтобы записать метрики без конфликта
+		failed, err = s.flushEach(ctx, metrics)
+	default:
+		failed = metrics
+	}
+
+	s.mu.Lock()
+	for _, metric := range failed {
+		// метрики, добавленные в буфер во время сброса, новее метрик неудачного сброса
+		// тип метрики не меняется, пока она в буфере: запись другого типа отклоняется по индексу типов
+		prev, ok := s.pending[metric.ID]
+		if !ok {
+			s.pending[metric.ID] = metric
+			s.updated[metric.ID] = updated[metric.ID]
+			continue
+		}
+		s.pending[metric.ID] = merge(metric, prev)
+	}
+	if len(failed) < len(metrics) {
+		s.freeSpace()
+	}
+	s.mu.Unlock()
+
+	if s.onFlush != nil && len(failed) < len(metrics) {
+		s.onFlush(ctx, written(metrics, failed))
+	}
+	if err != nil {
+		return fmt.Errorf("flush %d of %d metrics failed: %w", len(failed), len(metrics), err)
+	}
+	return nil
+}
+
+// flushEach - записывает метрики в хранилище по одной и возвращает метрики, которые не удалось записать.
+func (s *Storage) flushEach(ctx context.Context, metrics []repositories.Metric) ([]repositories.Metric, error) {
+	var failed []repositories.Metric
+	var lastErr error
+	for _, metric := range metrics {
+		if err := s.IStorage.AddMetricsFromSlice(ctx, []repositories.Metric{metric}); err != nil {
+			failed = append(failed, metric)
+			lastErr = err
+		}
+	}
+	return failed, lastErr
+}
+
+// GetMetric - возвращает значение метрики с учетом несброшенного значения из буфера.
+func (s *Storage) GetMetric(ctx context.Context, metricType, name string) (string, error) {
+	s.flushMu.RLock()
+	defer s.flushMu.RUnlock()
+
+	s.mu.Lock()
+	buffered, ok := s.pending[name]
+	s.mu.Unlock()
+	if !ok || buffered.MType != metricType {
+		return s.IStorage.GetMetric(ctx, metricType, name)
+	}
+	if buffered.MType == "gauge" {
+		return fmt.Sprintf("%g", *buffered.Value), nil
+	}
+
+	delta := *buffered.Delta
+	// ошибка означает, что метрика еще не записана в хранилище
+	if stored, err := s.IStorage.GetMetric(ctx, metricType, name); err == nil {
+		value, err := strconv.ParseInt(stored, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("parse stored counter %s error: %w", name, err)
+		}
+		delta += value
+	}
+	return fmt.Sprintf("%d", delta), nil
+}
+
+// GetAllMetricsSlice - возвращает все метрики хранилища, объединенные с метриками буфера.
+func (s *Storage) GetAllMetricsSlice(ctx context.Context) ([]repositories.Metric, error) {
+	s.flushMu.RLock()
+	defer s.flushMu.RUnlock()
+
+	metrics, err := s.IStorage.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]repositories.Metric, len(metrics))
+	for _, metric := range metrics {
+		merged[metric.ID] = metric
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, buffered := range s.pending {
+		stored, ok := merged[id]
+		if ok && stored.MType != buffered.MType {
+			// хранилище изменено в обход буфера: метрика буфера не будет записана, пока хранится метрика другого типа
+			continue
+		}
+		merged[id] = merge(stored, buffered)
+	}
+	return sorted(merged), nil
+}
+
+// ListMetrics - возвращает страницу списка метрик. Пока буфер пуст, список формирует хранилище,
+// иначе страница формируется из метрик хранилища, объединенных с метриками буфера.
+func (s *Storage) ListMetrics(ctx context.Context, opts repositories.ListOptions) (repositories.MetricsPage, error) {
+	if s.Pending() == 0 {
+		return s.IStorage.ListMetrics(ctx, opts)
+	}
+	metrics, err := s.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return repositories.MetricsPage{}, err
+	}
+	return repositories.ListSlice(metrics, opts), nil
+}
+
+// GetAllMetrics - возвращает все метрики хранилища, объединенные с метриками буфера, в виде строки.
+func (s *Storage) GetAllMetrics(ctx context.Context) (string, error) {
+	metrics, err := s.GetAllMetricsSlice(ctx)
+	if err != nil {
+		return "", err
+	}
+	var result strings.Builder
+	for _, metric := range metrics {
+		if metric.MType == "gauge" {
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %g\n", metric.MType, metric.ID, *metric.Value)
+		} else {
+			fmt.Fprintf(&result, "type: %s, name: %s, value: %d\n", metric.MType, metric.ID, *metric.Delta)
+		}
+	}
+	return result.String(), nil
+}
+
+// DeleteMetrics - удаляет метрики, удовлетворяющие фильтру, из хранилища и из буфера.
+func (s *Storage) DeleteMetrics(ctx context.Context, filter repositories.MetricFilter) ([]repositories.Metric, error) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	deleted, err := s.IStorage.DeleteMetrics(ctx, filter)
+	if err != nil {
+		return deleted, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := false
+	for id, buffered := range s.pending {
+		if !filter.Match(buffered.MType, id) {
+			continue
+		}
+		delete(s.pending, id)
+		delete(s.updated, id)
+		removed = true
+
+		found := false
+		for i, metric := range deleted {
+			if metric.ID == id && metric.MType == buffered.MType {
+				deleted[i] = merge(metric, buffered)
+				found = true
+				break
+			}
+		}
+		if !found {
+			deleted = append(deleted, buffered)
+		}
+	}
+	s.forget(deleted)
+	if removed {
+		s.freeSpace()
+	}
+	return deleted, nil
+}
+
+// ExpireMetrics - удаляет метрики хранилища и буфера, не обновлявшиеся дольше времени жизни. Перед удалением
+// буфер сбрасывается, чтобы хранилище не удалило метрику, обновленное значение которой еще в буфере.
+func (s *Storage) ExpireMetrics(ctx context.Context, ttl repositories.TTL) ([]repositories.Metric, error) {
+	if !ttl.Enabled() {
+		return nil, nil
+	}
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	// метрики буфера, время жизни которых истекло, не сбрасываются в хранилище
+	now := time.Now()
+	var expiredPending []repositories.Metric
+	s.mu.Lock()
+	for id, buffered := range s.pending {
+		if ttl.Expired(buffered.MType, id, s.updated[id], now) {
+			expiredPending = append(expiredPending, buffered)
+			delete(s.pending, id)
+			delete(s.updated, id)
+		}
+	}
+	if len(expiredPending) > 0 {
+		s.freeSpace()
+	}
+	s.mu.Unlock()
+
+	if err := s.flush(ctx); err != nil {
+		return expiredPending, err
+	}
+	expired, err := s.IStorage.ExpireMetrics(ctx, ttl)
+	if err != nil {
+		return expiredPending, err
+	}
+	for _, buffered := range expiredPending {
+		found := false
+		for i, metric := range expired {
+			if metric.ID == buffered.ID && metric.MType == buffered.MType {
+				expired[i] = merge(metric, buffered)
+				found = true
+				break
+			}
+		}
+		if !found {
+			expired = append(expired, buffered)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(expired)
+	return expired, nil
+}
+
+// forget - удаляет удаленные метрики из индекса типов. Вызывается под блокировкой mu.
+func (s *Storage) forget(metrics []repositories.Metric) {
+	if s.types == nil {
+		return
+	}
+	for _, metric := range metrics {
+		if _, ok := s.pending[metric.ID]; !ok {
+			delete(s.types, metric.ID)
+		}
+	}
+}
+
+// ReplaceMetrics - заменяет все метрики хранилища метриками из слайса. Несброшенные метрики буфера
+// записаны раньше замены, поэтому при успешной замене они отбрасываются.
+func (s *Storage) ReplaceMetrics(ctx context.Context, metrics []repositories.Metric) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	if err := repositories.ReplaceMetrics(ctx, s.IStorage, metrics); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.types != nil {
+		s.types = make(map[string]string, len(metrics))
+		for _, metric := range metrics {
+			s.types[metric.ID] = metric.MType
+		}
+	}
+	if len(s.pending) > 0 {
+		s.pending = make(map[string]repositories.Metric)
+		s.updated = make(map[string]time.Time)
+		s.freeSpace()
+	}
+	return nil
+}
+
+// merge - объединяет предыдущее значение метрики с новым: значения counter суммируются, для gauge
+// остается новое значение. Возвращаемая метрика не разделяет указатели на значения с аргументами.
+func merge(prev, next repositories.Metric) repositories.Metric {
+	result := repositories.Metric{ID: next.ID, MType: next.MType}
+	if next.MType == "gauge" {
+		value := *next.Value
+		result.Value = &value
+		return result
+	}
+	delta := *next.Delta
+	if prev.MType == "counter" && prev.Delta != nil {
+		delta += *prev.Delta
+	}
+	result.Delta = &delta
+	return result
+}
+
+// written - возвращает метрики пакета, не вошедшие в слайс неудачно записанных метрик failed.
+func written(metrics, failed []repositories.Metric) []repositories.Metric {
+	if len(failed) == 0 {
+		return metrics
+	}
+	skip := make(map[string]struct{}, len(failed))
+	for _, metric := range failed {
+		skip[metric.ID] = struct{}{}
+	}
+	result := make([]repositories.Metric, 0, len(metrics)-len(failed))
+	for _, metric := range metrics {
+		if _, ok := skip[metric.ID]; !ok {
+			result = append(result, metric)
+		}
+	}
+	return result
+}
+
+// sorted - возвращает метрики, упорядоченные по имени.
+func sorted(metrics map[string]repositories.Metric) []repositories.Metric {
+	result := make([]repositories.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		result = append(result, metric)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
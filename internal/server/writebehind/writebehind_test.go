@@ -0,0 +1,426 @@
+package writebehind
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/repositories/storagetest"
+	"github.com/AntonBezemskiy/go-musthave-metrics/internal/server/storage"
+)
+
+var errDown = errors.New("connection refused")
+
+// countingStorage - хранилище в памяти, считающее обращения на запись и умеющее имитировать недоступность.
+type countingStorage struct {
+	*storage.MemStorage
+	mu      sync.Mutex
+	batches int
+	down    bool
+}
+
+func newCountingStorage() *countingStorage {
+	return &countingStorage{MemStorage: storage.NewDefaultMemStorage()}
+}
+
+func (s *countingStorage) AddMetricsFromSlice(ctx context.Context, metrics []repositories.Metric) error {
+	s.mu.Lock()
+	s.batches++
+	down := s.down
+	s.mu.Unlock()
+	if down {
+		return errDown
+	}
+	return s.MemStorage.AddMetricsFromSlice(ctx, metrics)
+}
+
+func (s *countingStorage) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *countingStorage) writes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+func TestStorageAggregatesUntilFlush(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+
+	require.NoError(t, backing.MemStorage.AddCounter(ctx, "requests", 10))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, stor.AddCounter(ctx, "requests", 2))
+		require.NoError(t, stor.AddGauge(ctx, "temp", float64(i)))
+	}
+	assert.Equal(t, 0, backing.writes())
+	assert.Equal(t, 2, stor.Pending())
+
+	// чтение объединяет значения хранилища и буфера
+	value, err := stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "20", value)
+	value, err = stor.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "4", value)
+	metrics, err := stor.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+	all, err := stor.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "type: counter, name: requests, value: 20\ntype: gauge, name: temp, value: 4\n", all)
+
+	require.NoError(t, stor.Flush(ctx))
+	assert.Equal(t, 1, backing.writes())
+	assert.Equal(t, 0, stor.Pending())
+
+	value, err = backing.MemStorage.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "20", value)
+	value, err = stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "20", value)
+}
+
+func TestStorageRejectsInvalidMetrics(t *testing.T) {
+	ctx := context.Background()
+	stor := NewStorage(newCountingStorage(), Config{FlushInterval: time.Hour})
+	delta := int64(1)
+
+	assert.Error(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "broken", MType: "gauge"}}))
+	assert.Error(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{{ID: "unknown", MType: "histogram", Delta: &delta}}))
+
+	require.NoError(t, stor.AddGauge(ctx, "name", 1))
+	assert.ErrorIs(t, stor.AddCounter(ctx, "name", 1), repositories.ErrTypeConflict)
+
+	value := 1.0
+	err := stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "pair", MType: "counter", Delta: &delta},
+		{ID: "pair", MType: "gauge", Value: &value},
+	})
+	assert.ErrorIs(t, err, repositories.ErrTypeConflict)
+	assert.Equal(t, 1, stor.Pending())
+}
+
+func TestStorageFlushBySize(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour, FlushSize: 3})
+	stor.Start()
+	defer stor.Close(ctx)
+
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, stor.AddGauge(ctx, name, 1))
+	}
+	assert.Eventually(t, func() bool {
+		return backing.writes() == 1 && stor.Pending() == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestStorageFlushByInterval(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: 10 * time.Millisecond})
+	stor.Start()
+	defer stor.Close(ctx)
+
+	require.NoError(t, stor.AddCounter(ctx, "requests", 1))
+	assert.Eventually(t, func() bool {
+		value, err := backing.MemStorage.GetMetric(ctx, "counter", "requests")
+		return err == nil && value == "1"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestStorageCloseFlushes(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+	stor.Start()
+
+	require.NoError(t, stor.AddGauge(ctx, "temp", 36.6))
+	require.NoError(t, stor.Close(ctx))
+
+	value, err := backing.MemStorage.GetMetric(ctx, "gauge", "temp")
+	require.NoError(t, err)
+	assert.Equal(t, "36.6", value)
+	// повторное закрытие безопасно
+	assert.NoError(t, stor.Close(ctx))
+}
+
+func TestStorageRetriesFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+
+	require.NoError(t, stor.AddCounter(ctx, "requests", 2))
+	backing.setDown(true)
+	assert.ErrorIs(t, stor.Flush(ctx), errDown)
+	assert.Equal(t, 1, stor.Pending())
+
+	// значения, записанные после неудачного сброса, объединяются с возвращенными в буфер
+	require.NoError(t, stor.AddCounter(ctx, "requests", 3))
+	backing.setDown(false)
+	require.NoError(t, stor.Flush(ctx))
+
+	value, err := backing.MemStorage.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "5", value)
+}
+
+func TestStorageOnFlush(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+	var flushed [][]string
+	stor.SetOnFlush(func(_ context.Context, metrics []repositories.Metric) {
+		names := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			names = append(names, metric.ID)
+		}
+		flushed = append(flushed, names)
+	})
+
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	require.NoError(t, stor.AddCounter(ctx, "requests", 1))
+	// метрики не записаны в хранилище, функция не вызывается
+	backing.setDown(true)
+	assert.Error(t, stor.Flush(ctx))
+	assert.Empty(t, flushed)
+
+	backing.setDown(false)
+	require.NoError(t, stor.Flush(ctx))
+	require.NoError(t, stor.Flush(ctx))
+	assert.Equal(t, [][]string{{"Alloc", "requests"}}, flushed)
+}
+
+func TestStorageRejectsStoredTypeConflict(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	require.NoError(t, backing.MemStorage.AddGauge(ctx, "name", 1))
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+	one := int64(1)
+
+	// имя занято метрикой хранилища, запись отклоняется сразу, а не при сбросе
+	assert.ErrorIs(t, stor.AddCounter(ctx, "name", 1), repositories.ErrTypeConflict)
+	assert.ErrorIs(t, stor.AddMetricsFromSlice(ctx, []repositories.Metric{
+		{ID: "valid", MType: "counter", Delta: &one},
+		{ID: "name", MType: "counter", Delta: &one},
+	}), repositories.ErrTypeConflict)
+	assert.Equal(t, 0, stor.Pending())
+
+	// после удаления метрики имя можно занять метрикой другого типа
+	_, err := stor.DeleteMetrics(ctx, repositories.MetricFilter{ID: "name"})
+	require.NoError(t, err)
+	require.NoError(t, stor.AddCounter(ctx, "name", 2))
+	require.NoError(t, stor.Flush(ctx))
+	value, err := backing.MemStorage.GetMetric(ctx, "counter", "name")
+	require.NoError(t, err)
+	assert.Equal(t, "2", value)
+}
+
+func TestStorageKeepsConflictingOnFlush(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+
+	require.NoError(t, stor.AddCounter(ctx, "name", 1))
+	require.NoError(t, stor.AddCounter(ctx, "valid", 1))
+	// хранилище изменено в обход буфера, например другим экземпляром сервера
+	require.NoError(t, backing.MemStorage.AddGauge(ctx, "name", 1))
+
+	assert.ErrorIs(t, stor.Flush(ctx), repositories.ErrTypeConflict)
+	assert.Equal(t, 1, stor.Pending(), "conflicting metric must stay in buffer")
+	value, err := backing.MemStorage.GetMetric(ctx, "counter", "valid")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value)
+
+	// после удаления конфликтующей метрики хранилища значение буфера записывается
+	_, err = backing.MemStorage.DeleteMetrics(ctx, repositories.MetricFilter{MType: "gauge", ID: "name"})
+	require.NoError(t, err)
+	require.NoError(t, stor.AddCounter(ctx, "name", 2))
+	require.NoError(t, stor.Flush(ctx))
+	value, err = backing.MemStorage.GetMetric(ctx, "counter", "name")
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+}
+
+func TestStorageExpireMetrics(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+
+	require.NoError(t, stor.AddCounter(ctx, "requests", 1))
+	require.NoError(t, stor.Flush(ctx))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, stor.AddGauge(ctx, "Alloc", 1))
+	// обновленное значение счетчика еще в буфере, поэтому метрика хранилища не удаляется
+	require.NoError(t, stor.AddCounter(ctx, "requests", 2))
+
+	expired, err := stor.ExpireMetrics(ctx, repositories.TTL{Gauge: 10 * time.Millisecond, Counter: 10 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+	value, err := backing.MemStorage.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+
+	// время жизни метрики буфера истекло до сброса
+	require.NoError(t, stor.AddGauge(ctx, "Frees", 1))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, stor.AddCounter(ctx, "requests", 1))
+	expired, err = stor.ExpireMetrics(ctx, repositories.TTL{Gauge: 10 * time.Millisecond})
+	require.NoError(t, err)
+	names := make([]string, 0, len(expired))
+	for _, metric := range expired {
+		names = append(names, metric.ID)
+	}
+	assert.ElementsMatch(t, []string{"Alloc", "Frees"}, names)
+	assert.Equal(t, 0, stor.Pending())
+	_, err = stor.GetMetric(ctx, "gauge", "Frees")
+	assert.Error(t, err)
+
+	// имя удаленной метрики можно занять метрикой другого типа
+	assert.NoError(t, stor.AddCounter(ctx, "Frees", 1))
+}
+
+func TestStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(_ *testing.T) repositories.IStorage {
+		return NewStorage(storage.NewDefaultMemStorage(), Config{FlushInterval: time.Hour})
+	})
+}
+
+func TestStorageBackpressure(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	backing.setDown(true)
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour, FlushSize: 100, MaxPending: 2, MaxWait: 20 * time.Millisecond})
+
+	require.NoError(t, stor.AddGauge(ctx, "a", 1))
+	require.NoError(t, stor.AddGauge(ctx, "b", 1))
+	// обновление серии, уже находящейся в буфере, не требует места
+	require.NoError(t, stor.AddGauge(ctx, "a", 2))
+	assert.ErrorIs(t, stor.AddGauge(ctx, "c", 1), ErrBufferFull)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, stor.AddGauge(canceled, "c", 1), context.Canceled)
+
+	// после сброса буфера ожидающая запись завершается успешно
+	stor = NewStorage(backing, Config{FlushInterval: time.Hour, FlushSize: 100, MaxPending: 2, MaxWait: time.Second})
+	require.NoError(t, stor.AddGauge(ctx, "a", 1))
+	require.NoError(t, stor.AddGauge(ctx, "b", 1))
+	backing.setDown(false)
+	stor.Start()
+	defer stor.Close(ctx)
+	assert.NoError(t, stor.AddGauge(ctx, "c", 1))
+}
+
+func TestStorageDeleteMetrics(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	require.NoError(t, backing.MemStorage.AddCounter(ctx, "host.requests", 4))
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+
+	require.NoError(t, stor.AddCounter(ctx, "host.requests", 1))
+	require.NoError(t, stor.AddGauge(ctx, "host.load", 0.5))
+	require.NoError(t, stor.AddGauge(ctx, "other", 1))
+
+	deleted, err := stor.DeleteMetrics(ctx, repositories.MetricFilter{Prefix: "host."})
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+	for _, m := range deleted {
+		if m.MType == "counter" {
+			assert.Equal(t, int64(5), *m.Delta)
+		}
+	}
+	assert.Equal(t, 1, stor.Pending())
+
+	require.NoError(t, stor.Flush(ctx))
+	metrics, err := backing.MemStorage.GetAllMetricsSlice(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "other", metrics[0].ID)
+}
+
+func TestStorageConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	stor := NewStorage(backing, Config{FlushInterval: time.Millisecond, FlushSize: 10})
+	stor.Start()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, stor.AddCounter(ctx, "requests", 1))
+				_, err := stor.GetMetric(ctx, "counter", "requests")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, stor.Close(ctx))
+
+	value, err := backing.MemStorage.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "800", value)
+}
+
+func TestStorageReplaceMetrics(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	require.NoError(t, backing.MemStorage.AddCounter(ctx, "requests", 4))
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+
+	require.NoError(t, stor.AddCounter(ctx, "requests", 1))
+	require.NoError(t, stor.AddGauge(ctx, "load", 0.5))
+	require.Equal(t, 2, stor.Pending())
+
+	// буфер, записанный до замены, отбрасывается
+	delta := int64(10)
+	require.NoError(t, repositories.ReplaceMetrics(ctx, stor, []repositories.Metric{
+		{ID: "requests", MType: "counter", Delta: &delta},
+	}))
+	assert.Equal(t, 0, stor.Pending())
+
+	require.NoError(t, stor.Flush(ctx))
+	got, err := stor.GetMetric(ctx, "counter", "requests")
+	require.NoError(t, err)
+	assert.Equal(t, "10", got)
+	_, err = stor.GetMetric(ctx, "gauge", "load")
+	assert.Error(t, err)
+}
+
+func TestStorageListMetrics(t *testing.T) {
+	ctx := context.Background()
+	backing := newCountingStorage()
+	require.NoError(t, backing.MemStorage.AddCounter(ctx, "requests", 4))
+	require.NoError(t, backing.MemStorage.AddGauge(ctx, "load", 2))
+	stor := NewStorage(backing, Config{FlushInterval: time.Hour})
+
+	// метрики буфера участвуют в отборе и сортировке
+	require.NoError(t, stor.AddCounter(ctx, "requests", 1))
+	require.NoError(t, stor.AddGauge(ctx, "free", 3))
+	page, err := stor.ListMetrics(ctx, repositories.ListOptions{Sort: repositories.SortByValue, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Metrics, 2)
+	assert.Equal(t, "load", page.Metrics[0].ID)
+	assert.Equal(t, "free", page.Metrics[1].ID)
+	assert.NotEmpty(t, page.Next)
+
+	require.NoError(t, stor.Flush(ctx))
+	page, err = stor.ListMetrics(ctx, repositories.ListOptions{MType: "counter"})
+	require.NoError(t, err)
+	require.Len(t, page.Metrics, 1)
+	assert.Equal(t, int64(5), *page.Metrics[0].Delta)
+}